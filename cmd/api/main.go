@@ -11,6 +11,7 @@ import (
 	"backend-summithub/internal/config"
 	"backend-summithub/internal/db"
 	"backend-summithub/internal/server"
+	"backend-summithub/internal/tracking"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -70,10 +71,31 @@ var shutdownFn = func(app *fiber.App, ctx context.Context) error {
 	return app.ShutdownWithContext(ctx)
 }
 
-// Run starts the HTTP server and waits for termination signals.
+// Run starts the HTTP server and background workers and waits for
+// termination signals.
 func Run(ctx context.Context, cfg config.Config, pg *pgxpool.Pool, rdb *redis.Client, signals <-chan os.Signal, listen ListenFunc) error {
 	srv := server.NewServer(cfg, pg, rdb)
 
+	var autoCloser *tracking.AutoCloser
+	if pg != nil && cfg.SessionIdleTimeout > 0 && cfg.SessionSweepInterval > 0 {
+		autoCloser = tracking.NewAutoCloser(srv.Tracking, cfg.SessionIdleTimeout, cfg.SessionSweepInterval)
+		autoCloser.Start(ctx)
+	}
+
+	var partitions *tracking.PartitionMaintainer
+	if pg != nil && cfg.PartitionInterval > 0 {
+		partitions = tracking.NewPartitionMaintainer(srv.Tracking, cfg.TrackPointRetention, cfg.PartitionInterval)
+		partitions.Start(ctx)
+	}
+	stopWorkers := func() {
+		if autoCloser != nil {
+			autoCloser.Stop()
+		}
+		if partitions != nil {
+			partitions.Stop()
+		}
+	}
+
 	if listen == nil {
 		listen = defaultListen
 	}
@@ -88,14 +110,22 @@ func Run(ctx context.Context, cfg config.Config, pg *pgxpool.Pool, rdb *redis.Cl
 	case <-ctx.Done():
 	case err := <-errCh:
 		if err != nil {
+			stopWorkers()
+			srv.Tracking.Wait()
 			return err
 		}
 	}
 
+	stopWorkers()
+
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	if err := shutdownFn(srv.App, shutdownCtx); err != nil {
+	err := shutdownFn(srv.App, shutdownCtx)
+	// Escalations and end listeners outlive their requests; let them finish
+	// before the connections they use are closed.
+	srv.Tracking.Wait()
+	if err != nil {
 		return err
 	}
 	if pg != nil {
@@ -0,0 +1,15 @@
+package achievement
+
+import "github.com/gofiber/fiber/v2"
+
+// RegisterRoutes mounts the achievement endpoints under /users.
+func RegisterRoutes(r fiber.Router, svc *Service, authMiddleware fiber.Handler) {
+	r.Get("/:id/achievements", authMiddleware, func(c *fiber.Ctx) error {
+		viewerID, _ := c.Locals("user_id").(string)
+		profile, err := svc.Profile(c.Context(), c.Params("id"), viewerID)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		}
+		return c.JSON(profile)
+	})
+}
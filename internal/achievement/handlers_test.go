@@ -0,0 +1,59 @@
+package achievement
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pashagolub/pgxmock/v3"
+)
+
+func TestAchievementHandlers(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	mock.ExpectQuery(`achievements_evaluated_at IS NULL`).
+		WithArgs("user-1", catchUpBatch).
+		WillReturnRows(pgxmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`FROM user_records r`).WithArgs("user-1", "user-1").
+		WillReturnRows(pgxmock.NewRows([]string{"kind", "scope", "route", "value", "session", "at"}))
+	mock.ExpectQuery(`FROM user_summits s`).WithArgs("user-1", "user-1").
+		WillReturnRows(pgxmock.NewRows([]string{"waypoint", "name", "mountain", "session", "at"}))
+	mock.ExpectQuery(`SELECT COALESCE\(\(SELECT value FROM user_records`).WithArgs("user-1").
+		WillReturnRows(pgxmock.NewRows(progressCols).AddRow(0.0, 0.0, 0.0, 0.0, 0.0, 0.0, []string{}))
+	mock.ExpectQuery(`FROM user_achievements`).WithArgs("user-1", "user-1").
+		WillReturnRows(pgxmock.NewRows([]string{"id", "earned_at", "session_id"}))
+
+	app := fiber.New()
+	RegisterRoutes(app.Group("/users"), NewService(mock), func(c *fiber.Ctx) error {
+		c.Locals("user_id", "user-1")
+		return c.Next()
+	})
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/users/user-1/achievements", nil))
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected response %v %v", resp, err)
+	}
+	var body map[string]json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if string(body["records"]) != "[]" || string(body["summits"]) != "[]" {
+		t.Fatalf("expected empty lists, got %s %s", body["records"], body["summits"])
+	}
+
+	mock.ExpectQuery(`achievements_evaluated_at IS NULL`).WithArgs("user-2", catchUpBatch).WillReturnError(errors.New("connection refused"))
+	resp, err = app.Test(httptest.NewRequest(http.MethodGet, "/users/user-2/achievements", nil))
+	if err != nil || resp.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %v %v", resp.StatusCode, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
@@ -0,0 +1,59 @@
+package achievement
+
+import "time"
+
+// Record kinds. Fastest ascents are kept per route; lower is better for
+// them and higher for every other kind.
+const (
+	RecordLongestDistance  = "longest_distance"
+	RecordBiggestDayAscent = "biggest_day_ascent"
+	RecordHighestElevation = "highest_elevation"
+	RecordFastestAscent    = "fastest_ascent"
+)
+
+// Record is a user's best value of one kind. Value is in metres, or in
+// seconds for fastest ascents, whose Scope is the route id.
+type Record struct {
+	Kind       string    `json:"kind"`
+	Scope      string    `json:"scope,omitempty"`
+	RouteName  string    `json:"route_name,omitempty"`
+	Value      float64   `json:"value"`
+	SessionID  string    `json:"session_id,omitempty"`
+	AchievedAt time.Time `json:"achieved_at"`
+}
+
+// Achievement is a rule as seen by one user: earned or not, and how far
+// along they are.
+type Achievement struct {
+	Rule
+	Earned    bool       `json:"earned"`
+	EarnedAt  *time.Time `json:"earned_at,omitempty"`
+	SessionID string     `json:"session_id,omitempty"`
+	// Progress runs from 0 to 1.
+	Progress float64 `json:"progress"`
+}
+
+// Summit is a peak waypoint a user has reached.
+type Summit struct {
+	WaypointID   string    `json:"waypoint_id"`
+	Name         string    `json:"name"`
+	MountainName string    `json:"mountain_name,omitempty"`
+	SessionID    string    `json:"session_id,omitempty"`
+	ReachedAt    time.Time `json:"reached_at"`
+}
+
+// Profile is the response of GET /users/:id/achievements.
+type Profile struct {
+	UserID       string        `json:"user_id"`
+	Records      []Record      `json:"records"`
+	Summits      []Summit      `json:"summits"`
+	Achievements []Achievement `json:"achievements"`
+}
+
+// Result reports what evaluating one session changed.
+type Result struct {
+	SessionID    string   `json:"session_id"`
+	NewRecords   []Record `json:"new_records,omitempty"`
+	NewSummits   []string `json:"new_summits,omitempty"`
+	Achievements []Rule   `json:"achievements,omitempty"`
+}
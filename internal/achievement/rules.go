@@ -0,0 +1,100 @@
+package achievement
+
+import (
+	"math"
+	"strings"
+)
+
+// Rule metrics. Each compares one figure of the user's history with the
+// rule's Threshold, except MetricMountains, which needs a summit on every
+// mountain listed.
+const (
+	MetricLongestDistance  = "longest_distance_m"
+	MetricDayAscent        = "day_ascent_m"
+	MetricHighestElevation = "highest_elevation_m"
+	MetricTotalDistance    = "total_distance_m"
+	MetricSessions         = "sessions"
+	MetricSummits          = "summits"
+	MetricMountains        = "mountains"
+)
+
+// Rule declares a badge. Rules are data: adding one needs no code.
+type Rule struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Metric      string   `json:"metric"`
+	Threshold   float64  `json:"threshold,omitempty"`
+	Mountains   []string `json:"mountains,omitempty"`
+}
+
+// DefaultRules are the badges offered out of the box.
+var DefaultRules = []Rule{
+	{ID: "first-steps", Name: "First Steps", Description: "Complete your first tracked hike.", Metric: MetricSessions, Threshold: 1},
+	{ID: "regular", Name: "Regular", Description: "Complete 25 tracked hikes.", Metric: MetricSessions, Threshold: 25},
+	{ID: "half-marathon", Name: "Half Marathon", Description: "Hike 21 km in one session.", Metric: MetricLongestDistance, Threshold: 21097},
+	{ID: "vertical-km", Name: "Vertical Kilometre", Description: "Climb 1000 m in a single day.", Metric: MetricDayAscent, Threshold: 1000},
+	{ID: "big-day", Name: "Big Day", Description: "Climb 2000 m in a single day.", Metric: MetricDayAscent, Threshold: 2000},
+	{ID: "three-thousander", Name: "Three-Thousander", Description: "Stand above 3000 m.", Metric: MetricHighestElevation, Threshold: 3000},
+	{ID: "century", Name: "Century", Description: "Hike 100 km in total.", Metric: MetricTotalDistance, Threshold: 100000},
+	{ID: "first-summit", Name: "First Summit", Description: "Reach a peak.", Metric: MetricSummits, Threshold: 1},
+	{ID: "peak-bagger", Name: "Peak Bagger", Description: "Reach 10 different peaks.", Metric: MetricSummits, Threshold: 10},
+	{
+		ID:          "seven-summits-java",
+		Name:        "Seven Summits of Java",
+		Description: "Reach the summit of the seven highest volcanoes of Java.",
+		Metric:      MetricMountains,
+		Mountains:   []string{"Semeru", "Slamet", "Sumbing", "Arjuno", "Raung", "Lawu", "Welirang"},
+	},
+}
+
+// progress is a user's history as rules see it.
+type progress struct {
+	LongestDistanceM  float64
+	DayAscentM        float64
+	HighestElevationM float64
+	TotalDistanceM    float64
+	Sessions          float64
+	Summits           float64
+	// Mountains holds the lower-cased names of mountains summited.
+	Mountains map[string]bool
+}
+
+// progress reports how close p is to meeting the rule, from 0 to 1.
+func (r Rule) progress(p progress) float64 {
+	if r.Metric == MetricMountains {
+		if len(r.Mountains) == 0 {
+			return 0
+		}
+		done := 0
+		for _, name := range r.Mountains {
+			if p.Mountains[strings.ToLower(name)] {
+				done++
+			}
+		}
+		return float64(done) / float64(len(r.Mountains))
+	}
+	if r.Threshold <= 0 {
+		return 0
+	}
+	var value float64
+	switch r.Metric {
+	case MetricLongestDistance:
+		value = p.LongestDistanceM
+	case MetricDayAscent:
+		value = p.DayAscentM
+	case MetricHighestElevation:
+		value = p.HighestElevationM
+	case MetricTotalDistance:
+		value = p.TotalDistanceM
+	case MetricSessions:
+		value = p.Sessions
+	case MetricSummits:
+		value = p.Summits
+	}
+	return math.Min(1, value/r.Threshold)
+}
+
+func (r Rule) met(p progress) bool {
+	return r.progress(p) >= 1
+}
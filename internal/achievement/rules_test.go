@@ -0,0 +1,48 @@
+package achievement
+
+import "testing"
+
+func TestRuleProgress(t *testing.T) {
+	p := progress{
+		LongestDistanceM:  10548,
+		DayAscentM:        1200,
+		HighestElevationM: 3676,
+		Sessions:          3,
+		Summits:           2,
+		Mountains:         map[string]bool{"semeru": true, "sumbing": true, "welirang": true},
+	}
+	cases := []struct {
+		rule Rule
+		want float64
+	}{
+		{Rule{Metric: MetricLongestDistance, Threshold: 21096}, 0.5},
+		{Rule{Metric: MetricDayAscent, Threshold: 1000}, 1},
+		{Rule{Metric: MetricHighestElevation, Threshold: 3000}, 1},
+		{Rule{Metric: MetricSessions, Threshold: 25}, 0.12},
+		{Rule{Metric: MetricSummits, Threshold: 0}, 0},
+		{Rule{Metric: "unknown", Threshold: 1}, 0},
+		{Rule{Metric: MetricMountains, Mountains: []string{"Semeru", "Slamet", "Sumbing", "Welirang"}}, 0.75},
+		{Rule{Metric: MetricMountains}, 0},
+	}
+	for _, tc := range cases {
+		if got := tc.rule.progress(p); got != tc.want {
+			t.Fatalf("%s: expected %v, got %v", tc.rule.Metric, tc.want, got)
+		}
+	}
+	if !(Rule{Metric: MetricDayAscent, Threshold: 1000}).met(p) || (Rule{Metric: MetricSummits, Threshold: 10}).met(p) {
+		t.Fatalf("unexpected met")
+	}
+}
+
+func TestDefaultRulesAreUnique(t *testing.T) {
+	seen := map[string]bool{}
+	for _, rule := range DefaultRules {
+		if rule.ID == "" || rule.Name == "" || seen[rule.ID] {
+			t.Fatalf("bad rule %+v", rule)
+		}
+		seen[rule.ID] = true
+		if rule.Metric == MetricMountains && len(rule.Mountains) == 0 || rule.Metric != MetricMountains && rule.Threshold <= 0 {
+			t.Fatalf("rule %s can never be earned", rule.ID)
+		}
+	}
+}
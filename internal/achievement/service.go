@@ -0,0 +1,444 @@
+package achievement
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"backend-summithub/internal/db"
+	"backend-summithub/internal/tracking"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// summitRadiusM is how close a track point must come to a peak waypoint
+	// for the peak to count as reached.
+	summitRadiusM = 100.0
+	// routeMatchRadiusM is how close a session's start and highest point must
+	// be to a planned route for the climb to count as an ascent of it.
+	routeMatchRadiusM = 200.0
+	// catchUpBatch bounds how many older sessions one profile read evaluates.
+	catchUpBatch = 50
+)
+
+type Service struct {
+	db    db.TxBeginner
+	rules []Rule
+}
+
+func NewService(db db.TxBeginner) *Service {
+	return &Service{db: db, rules: DefaultRules}
+}
+
+// SetRules replaces the badges evaluated. Badges already earned are kept.
+func (s *Service) SetRules(rules []Rule) {
+	s.rules = rules
+}
+
+// SessionEnded evaluates a session as soon as it ends. Failures are only
+// logged: the session stays unevaluated and is caught up on the next
+// profile read.
+func (s *Service) SessionEnded(ctx context.Context, session tracking.Session) {
+	if _, err := s.Evaluate(ctx, session.ID); err != nil {
+		log.Printf("achievements for session %s: %v", session.ID, err)
+	}
+}
+
+// Evaluate counts one ended session into its user's records, summits and
+// badges. Each session is counted once; evaluating it again, or evaluating
+// a session that has not ended, changes nothing.
+func (s *Service) Evaluate(ctx context.Context, sessionID string) (Result, error) {
+	result := Result{SessionID: sessionID}
+	err := db.WithTx(ctx, s.db, func(tx pgx.Tx) error {
+		var userID string
+		var distanceM float64
+		var endedAt time.Time
+		var evaluated bool
+		err := tx.QueryRow(ctx, `
+			SELECT COALESCE(user_id::text,''), COALESCE(total_distance_m,0), COALESCE(ended_at, started_at),
+			       achievements_evaluated_at IS NOT NULL
+			FROM track_sessions
+			WHERE id=$1 AND status IN ('ended', 'auto_closed')
+			FOR UPDATE
+		`, sessionID).Scan(&userID, &distanceM, &endedAt, &evaluated)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if evaluated || userID == "" {
+			return nil
+		}
+
+		candidates, err := sessionRecords(ctx, tx, sessionID, userID)
+		if err != nil {
+			return err
+		}
+		if distanceM > 0 {
+			candidates = append(candidates, Record{Kind: RecordLongestDistance, Value: distanceM, AchievedAt: endedAt})
+		}
+		for _, r := range candidates {
+			r.SessionID = sessionID
+			improved, err := saveRecord(ctx, tx, userID, r)
+			if err != nil {
+				return err
+			}
+			if improved {
+				result.NewRecords = append(result.NewRecords, r)
+			}
+		}
+
+		if result.NewSummits, err = saveSummits(ctx, tx, sessionID, userID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `
+			UPDATE track_sessions SET achievements_evaluated_at = NOW() WHERE id=$1
+		`, sessionID); err != nil {
+			return err
+		}
+
+		p, err := loadProgress(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+		earned, err := earnedAchievements(ctx, tx, userID, userID)
+		if err != nil {
+			return err
+		}
+		for _, rule := range s.rules {
+			if _, ok := earned[rule.ID]; ok || !rule.met(p) {
+				continue
+			}
+			if _, err := tx.Exec(ctx, `
+				INSERT INTO user_achievements (user_id, achievement_id, session_id, earned_at)
+				VALUES ($1, $2, $3, $4)
+				ON CONFLICT DO NOTHING
+			`, userID, rule.ID, sessionID, endedAt); err != nil {
+				return err
+			}
+			result.Achievements = append(result.Achievements, rule)
+		}
+		return nil
+	})
+	if err != nil {
+		return Result{}, err
+	}
+	return result, nil
+}
+
+// sessionRecords computes the session's candidates for the point-based
+// records: highest elevation, the user's ascent on each day the session
+// touched, and the time to the top of each planned route it followed.
+func sessionRecords(ctx context.Context, tx pgx.Tx, sessionID, userID string) ([]Record, error) {
+	var records []Record
+
+	var top Record
+	err := tx.QueryRow(ctx, `
+		SELECT elevation_m, recorded_at FROM track_points
+		WHERE session_id=$1 AND elevation_m IS NOT NULL
+		ORDER BY elevation_m DESC, recorded_at
+		LIMIT 1
+	`, sessionID).Scan(&top.Value, &top.AchievedAt)
+	if err == nil {
+		top.Kind = RecordHighestElevation
+		records = append(records, top)
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO session_day_ascents (session_id, day, ascent_m)
+		SELECT $1, day, SUM(GREATEST(climb, 0))
+		FROM (
+		    SELECT recorded_at::date AS day,
+		           elevation_m - LAG(elevation_m) OVER (ORDER BY recorded_at, id) AS climb
+		    FROM track_points
+		    WHERE session_id=$1 AND elevation_m IS NOT NULL
+		) climbs
+		WHERE climb IS NOT NULL
+		GROUP BY day
+		ON CONFLICT DO NOTHING
+	`, sessionID); err != nil {
+		return nil, err
+	}
+	var day Record
+	err = tx.QueryRow(ctx, `
+		SELECT d.day::timestamp, SUM(d.ascent_m)
+		FROM session_day_ascents d
+		JOIN track_sessions ts ON ts.id = d.session_id
+		WHERE ts.user_id = $2
+		  AND d.day IN (SELECT day FROM session_day_ascents WHERE session_id=$1)
+		GROUP BY d.day
+		ORDER BY 2 DESC
+		LIMIT 1
+	`, sessionID, userID).Scan(&day.AchievedAt, &day.Value)
+	if err == nil && day.Value > 0 {
+		day.Kind = RecordBiggestDayAscent
+		records = append(records, day)
+	} else if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	rows, err := tx.Query(ctx, `
+		WITH start_point AS (
+		    SELECT location, recorded_at FROM track_points WHERE session_id=$1 ORDER BY recorded_at, id LIMIT 1
+		), top_point AS (
+		    SELECT location, recorded_at FROM track_points
+		    WHERE session_id=$1 AND elevation_m IS NOT NULL
+		    ORDER BY elevation_m DESC, recorded_at LIMIT 1
+		)
+		SELECT r.id::text, COALESCE(r.name,''), EXTRACT(EPOCH FROM top_point.recorded_at - start_point.recorded_at)::float8, top_point.recorded_at
+		FROM track_sessions ts
+		JOIN gpx_routes r ON r.trip_id = ts.trip_id AND r.route IS NOT NULL
+		CROSS JOIN start_point
+		CROSS JOIN top_point
+		WHERE ts.id=$1
+		  AND top_point.recorded_at > start_point.recorded_at
+		  AND ST_DWithin(r.route, start_point.location, $2)
+		  AND ST_DWithin(r.route, top_point.location, $2)
+	`, sessionID, routeMatchRadiusM)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		r := Record{Kind: RecordFastestAscent}
+		if err := rows.Scan(&r.Scope, &r.RouteName, &r.Value, &r.AchievedAt); err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+// saveRecord keeps r when it beats the user's record of its kind and
+// reports whether it did. The first value of a kind always counts.
+func saveRecord(ctx context.Context, tx pgx.Tx, userID string, r Record) (bool, error) {
+	lowerIsBetter := r.Kind == RecordFastestAscent
+	var value float64
+	err := tx.QueryRow(ctx, `
+		INSERT INTO user_records (user_id, kind, scope, value, session_id, achieved_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (user_id, kind, scope) DO UPDATE
+		SET value = EXCLUDED.value, session_id = EXCLUDED.session_id, achieved_at = EXCLUDED.achieved_at
+		WHERE CASE WHEN $7 THEN EXCLUDED.value < user_records.value ELSE EXCLUDED.value > user_records.value END
+		RETURNING value
+	`, userID, r.Kind, r.Scope, r.Value, r.SessionID, r.AchievedAt, lowerIsBetter).Scan(&value)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// saveSummits records the peaks the session came within summitRadiusM of
+// and returns the ids of those the user had not reached before.
+func saveSummits(ctx context.Context, tx pgx.Tx, sessionID, userID string) ([]string, error) {
+	rows, err := tx.Query(ctx, `
+		INSERT INTO user_summits (user_id, waypoint_id, mountain_id, session_id, reached_at)
+		SELECT $2, w.id,
+		       (SELECT m.id FROM mountains m
+		        WHERE ST_Intersects(m.boundary, w.location)
+		        ORDER BY ST_Distance(m.summit, w.location)
+		        LIMIT 1),
+		       $1, MIN(tp.recorded_at)
+		FROM waypoints w
+		JOIN track_points tp ON tp.session_id = $1 AND ST_DWithin(tp.location, w.location, $3)
+		WHERE w.type = 'peak'
+		GROUP BY w.id
+		ON CONFLICT (user_id, waypoint_id) DO NOTHING
+		RETURNING waypoint_id::text
+	`, sessionID, userID, summitRadiusM)
+	if err != nil {
+		return nil, err
+	}
+	return scanStrings(rows)
+}
+
+// loadProgress reads the figures rules are evaluated on. Totals only count
+// evaluated sessions, so a catch-up awards badges in the order earned.
+func loadProgress(ctx context.Context, q db.Querier, userID string) (progress, error) {
+	p := progress{Mountains: map[string]bool{}}
+	var mountains []string
+	err := q.QueryRow(ctx, `
+		SELECT COALESCE((SELECT value FROM user_records WHERE user_id=$1 AND kind='longest_distance'), 0),
+		       COALESCE((SELECT value FROM user_records WHERE user_id=$1 AND kind='biggest_day_ascent'), 0),
+		       COALESCE((SELECT value FROM user_records WHERE user_id=$1 AND kind='highest_elevation'), 0),
+		       (SELECT COALESCE(SUM(total_distance_m),0)::float8 FROM track_sessions
+		        WHERE user_id=$1 AND achievements_evaluated_at IS NOT NULL),
+		       (SELECT COUNT(*)::float8 FROM track_sessions
+		        WHERE user_id=$1 AND achievements_evaluated_at IS NOT NULL),
+		       (SELECT COUNT(*)::float8 FROM user_summits WHERE user_id=$1),
+		       ARRAY(SELECT DISTINCT lower(m.name) FROM user_summits s
+		             JOIN mountains m ON m.id = s.mountain_id
+		             WHERE s.user_id=$1)
+	`, userID).Scan(&p.LongestDistanceM, &p.DayAscentM, &p.HighestElevationM, &p.TotalDistanceM, &p.Sessions, &p.Summits, &mountains)
+	if err != nil {
+		return progress{}, err
+	}
+	for _, name := range mountains {
+		p.Mountains[name] = true
+	}
+	return p, nil
+}
+
+type earned struct {
+	at        time.Time
+	sessionID string
+}
+
+// earnedAchievements lists the badges userID earned on sessions viewerID
+// may read.
+func earnedAchievements(ctx context.Context, q db.Querier, userID, viewerID string) (map[string]earned, error) {
+	rows, err := q.Query(ctx, `
+		SELECT a.achievement_id, a.earned_at, COALESCE(a.session_id::text,'')
+		FROM user_achievements a
+		WHERE a.user_id=$1 AND `+viewableSession("a", "$2")+`
+	`, userID, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := map[string]earned{}
+	for rows.Next() {
+		var id string
+		var e earned
+		if err := rows.Scan(&id, &e.at, &e.sessionID); err != nil {
+			return nil, err
+		}
+		out[id] = e
+	}
+	return out, rows.Err()
+}
+
+// Profile returns a user's records, summits and every badge with progress,
+// as viewerID may see them. Ended sessions not yet evaluated, such as those
+// recorded before badges existed, are evaluated first, oldest first.
+//
+// Other users only see the records, summits and badges of sessions they may
+// read under tracking.ViewableSQL, and no progress towards unearned badges,
+// as the totals behind it include sessions hidden from them.
+func (s *Service) Profile(ctx context.Context, userID, viewerID string) (Profile, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT id FROM track_sessions
+		WHERE user_id=$1 AND status IN ('ended', 'auto_closed') AND achievements_evaluated_at IS NULL
+		ORDER BY ended_at
+		LIMIT $2
+	`, userID, catchUpBatch)
+	if err != nil {
+		return Profile{}, err
+	}
+	pending, err := scanStrings(rows)
+	if err != nil {
+		return Profile{}, err
+	}
+	for _, id := range pending {
+		if _, err := s.Evaluate(ctx, id); err != nil {
+			return Profile{}, err
+		}
+	}
+
+	profile := Profile{UserID: userID}
+	if profile.Records, err = s.records(ctx, userID, viewerID); err != nil {
+		return Profile{}, err
+	}
+	if profile.Summits, err = s.summits(ctx, userID, viewerID); err != nil {
+		return Profile{}, err
+	}
+
+	var p progress
+	if viewerID == userID {
+		if p, err = loadProgress(ctx, s.db, userID); err != nil {
+			return Profile{}, err
+		}
+	}
+	got, err := earnedAchievements(ctx, s.db, userID, viewerID)
+	if err != nil {
+		return Profile{}, err
+	}
+	profile.Achievements = make([]Achievement, 0, len(s.rules))
+	for _, rule := range s.rules {
+		a := Achievement{Rule: rule}
+		if viewerID == userID {
+			a.Progress = rule.progress(p)
+		}
+		if e, ok := got[rule.ID]; ok {
+			a.Earned, a.EarnedAt, a.SessionID, a.Progress = true, &e.at, e.sessionID, 1
+		}
+		profile.Achievements = append(profile.Achievements, a)
+	}
+	return profile, nil
+}
+
+func (s *Service) records(ctx context.Context, userID, viewerID string) ([]Record, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT r.kind, r.scope, COALESCE(g.name,''), r.value, COALESCE(r.session_id::text,''), r.achieved_at
+		FROM user_records r
+		LEFT JOIN gpx_routes g ON r.kind = 'fastest_ascent' AND g.id::text = r.scope
+		WHERE r.user_id=$1 AND `+viewableSession("r", "$2")+`
+		ORDER BY r.kind, r.scope
+	`, userID, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []Record{}
+	for rows.Next() {
+		var r Record
+		if err := rows.Scan(&r.Kind, &r.Scope, &r.RouteName, &r.Value, &r.SessionID, &r.AchievedAt); err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+func (s *Service) summits(ctx context.Context, userID, viewerID string) ([]Summit, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT s.waypoint_id::text, COALESCE(w.name,''), COALESCE(m.name,''), COALESCE(s.session_id::text,''), s.reached_at
+		FROM user_summits s
+		JOIN waypoints w ON w.id = s.waypoint_id
+		LEFT JOIN mountains m ON m.id = s.mountain_id
+		WHERE s.user_id=$1 AND `+viewableSession("s", "$2")+`
+		ORDER BY s.reached_at
+	`, userID, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summits := []Summit{}
+	for rows.Next() {
+		var sm Summit
+		if err := rows.Scan(&sm.WaypointID, &sm.Name, &sm.MountainName, &sm.SessionID, &sm.ReachedAt); err != nil {
+			return nil, err
+		}
+		summits = append(summits, sm)
+	}
+	return summits, rows.Err()
+}
+
+// viewableSession is an SQL condition that holds when viewer is the user of
+// row, an alias of a table with user_id and session_id columns, or may read
+// the session the row was set on.
+func viewableSession(row, viewer string) string {
+	return `(` + row + `.user_id::text = ` + viewer + ` OR EXISTS (
+		SELECT 1 FROM track_sessions ts WHERE ts.id = ` + row + `.session_id AND ` + tracking.ViewableSQL("ts", viewer) + `))`
+}
+
+func scanStrings(rows pgx.Rows) ([]string, error) {
+	defer rows.Close()
+	var values []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, rows.Err()
+}
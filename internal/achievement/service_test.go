@@ -0,0 +1,237 @@
+package achievement
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"backend-summithub/internal/tracking"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v3"
+)
+
+var progressCols = []string{"longest", "day_ascent", "highest", "total", "sessions", "summits", "mountains"}
+
+func expectEvaluation(mock pgxmock.PgxPoolIface, sessionID string, ended time.Time) {
+	top := ended.Add(-3 * time.Hour)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM track_sessions WHERE id=\$1 AND status IN \('ended', 'auto_closed'\) FOR UPDATE`).
+		WithArgs(sessionID).
+		WillReturnRows(pgxmock.NewRows([]string{"user_id", "distance", "ended_at", "evaluated"}).
+			AddRow("user-1", 12400.0, ended, false))
+	mock.ExpectQuery(`SELECT elevation_m, recorded_at FROM track_points`).
+		WithArgs(sessionID).
+		WillReturnRows(pgxmock.NewRows([]string{"elevation_m", "recorded_at"}).AddRow(3676.0, top))
+	mock.ExpectExec(`INSERT INTO session_day_ascents`).
+		WithArgs(sessionID).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectQuery(`FROM session_day_ascents d JOIN track_sessions ts`).
+		WithArgs(sessionID, "user-1").
+		WillReturnRows(pgxmock.NewRows([]string{"day", "ascent"}).AddRow(time.Date(2026, 8, 20, 0, 0, 0, 0, time.UTC), 1650.0))
+	mock.ExpectQuery(`JOIN gpx_routes r ON r.trip_id = ts.trip_id`).
+		WithArgs(sessionID, routeMatchRadiusM).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "name", "seconds", "at"}).AddRow("route-1", "Ranu Pani", 21600.0, top))
+}
+
+func TestEvaluateSessionRecordsAndBadges(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	ended := time.Date(2026, 8, 20, 15, 0, 0, 0, time.UTC)
+	expectEvaluation(mock, "session-1", ended)
+
+	recordCols := []string{"value"}
+	// Highest elevation and day ascent are new records, the route was done
+	// faster before, and the distance beats the old longest.
+	mock.ExpectQuery(`INSERT INTO user_records`).
+		WithArgs("user-1", RecordHighestElevation, "", 3676.0, "session-1", pgxmock.AnyArg(), false).
+		WillReturnRows(pgxmock.NewRows(recordCols).AddRow(3676.0))
+	mock.ExpectQuery(`INSERT INTO user_records`).
+		WithArgs("user-1", RecordBiggestDayAscent, "", 1650.0, "session-1", pgxmock.AnyArg(), false).
+		WillReturnRows(pgxmock.NewRows(recordCols).AddRow(1650.0))
+	mock.ExpectQuery(`INSERT INTO user_records`).
+		WithArgs("user-1", RecordFastestAscent, "route-1", 21600.0, "session-1", pgxmock.AnyArg(), true).
+		WillReturnError(pgx.ErrNoRows)
+	mock.ExpectQuery(`INSERT INTO user_records`).
+		WithArgs("user-1", RecordLongestDistance, "", 12400.0, "session-1", ended, false).
+		WillReturnRows(pgxmock.NewRows(recordCols).AddRow(12400.0))
+	mock.ExpectQuery(`INSERT INTO user_summits`).
+		WithArgs("session-1", "user-1", summitRadiusM).
+		WillReturnRows(pgxmock.NewRows([]string{"waypoint_id"}).AddRow("peak-semeru"))
+	mock.ExpectExec(`UPDATE track_sessions SET achievements_evaluated_at = NOW\(\) WHERE id=\$1`).
+		WithArgs("session-1").
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectQuery(`SELECT COALESCE\(\(SELECT value FROM user_records`).
+		WithArgs("user-1").
+		WillReturnRows(pgxmock.NewRows(progressCols).AddRow(12400.0, 1650.0, 3676.0, 30000.0, 2.0, 1.0, []string{"semeru"}))
+	mock.ExpectQuery(`FROM user_achievements a WHERE a.user_id=\$1`).
+		WithArgs("user-1", "user-1").
+		WillReturnRows(pgxmock.NewRows([]string{"id", "earned_at", "session_id"}).AddRow("first-steps", ended.AddDate(0, -1, 0), "session-0"))
+	for _, id := range []string{"vertical-km", "three-thousander", "first-summit"} {
+		mock.ExpectExec(`INSERT INTO user_achievements`).
+			WithArgs("user-1", id, "session-1", ended).
+			WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	}
+	mock.ExpectCommit()
+
+	result, err := NewService(mock).Evaluate(context.Background(), "session-1")
+	if err != nil {
+		t.Fatalf("evaluate: %v", err)
+	}
+	if len(result.NewRecords) != 3 || result.NewRecords[2].Kind != RecordLongestDistance {
+		t.Fatalf("unexpected records %+v", result.NewRecords)
+	}
+	if len(result.NewSummits) != 1 || len(result.Achievements) != 3 || result.Achievements[0].ID != "vertical-km" {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
+
+func TestEvaluateSkipsCountedAndOpenSessions(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM track_sessions WHERE id=\$1 AND status IN`).
+		WithArgs("session-1").
+		WillReturnRows(pgxmock.NewRows([]string{"user_id", "distance", "ended_at", "evaluated"}).
+			AddRow("user-1", 12400.0, time.Now(), true))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM track_sessions WHERE id=\$1 AND status IN`).
+		WithArgs("session-open").
+		WillReturnError(pgx.ErrNoRows)
+	mock.ExpectCommit()
+
+	svc := NewService(mock)
+	for _, id := range []string{"session-1", "session-open"} {
+		result, err := svc.Evaluate(context.Background(), id)
+		if err != nil || len(result.NewRecords) != 0 || len(result.Achievements) != 0 {
+			t.Fatalf("expected %s to change nothing, got %+v %v", id, result, err)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
+
+func TestSessionEndedLogsFailures(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	mock.ExpectBegin().WillReturnError(pgx.ErrTxClosed)
+	NewService(mock).SessionEnded(context.Background(), tracking.Session{ID: "session-1"})
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
+
+func TestProfileCatchesUpAndReportsProgress(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	ended := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`achievements_evaluated_at IS NULL ORDER BY ended_at LIMIT \$2`).
+		WithArgs("user-1", catchUpBatch).
+		WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow("session-old"))
+	// The old session was counted by another request in the meantime.
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM track_sessions WHERE id=\$1 AND status IN`).
+		WithArgs("session-old").
+		WillReturnRows(pgxmock.NewRows([]string{"user_id", "distance", "ended_at", "evaluated"}).AddRow("user-1", 9000.0, ended, true))
+	mock.ExpectCommit()
+
+	mock.ExpectQuery(`FROM user_records r LEFT JOIN gpx_routes g`).
+		WithArgs("user-1", "user-1").
+		WillReturnRows(pgxmock.NewRows([]string{"kind", "scope", "route", "value", "session", "at"}).
+			AddRow(RecordFastestAscent, "route-1", "Ranu Pani", 21600.0, "session-old", ended))
+	mock.ExpectQuery(`FROM user_summits s JOIN waypoints w`).
+		WithArgs("user-1", "user-1").
+		WillReturnRows(pgxmock.NewRows([]string{"waypoint", "name", "mountain", "session", "at"}).
+			AddRow("peak-1", "Puncak Mahameru", "Semeru", "session-old", ended))
+	mock.ExpectQuery(`SELECT COALESCE\(\(SELECT value FROM user_records`).
+		WithArgs("user-1").
+		WillReturnRows(pgxmock.NewRows(progressCols).AddRow(9000.0, 900.0, 3676.0, 9000.0, 1.0, 1.0, []string{"semeru", "sumbing"}))
+	mock.ExpectQuery(`FROM user_achievements a WHERE a.user_id=\$1`).
+		WithArgs("user-1", "user-1").
+		WillReturnRows(pgxmock.NewRows([]string{"id", "earned_at", "session_id"}).AddRow("first-steps", ended, "session-old"))
+
+	profile, err := NewService(mock).Profile(context.Background(), "user-1", "user-1")
+	if err != nil {
+		t.Fatalf("profile: %v", err)
+	}
+	if len(profile.Records) != 1 || profile.Records[0].RouteName != "Ranu Pani" || len(profile.Summits) != 1 {
+		t.Fatalf("unexpected profile %+v", profile)
+	}
+	byID := map[string]Achievement{}
+	for _, a := range profile.Achievements {
+		byID[a.ID] = a
+	}
+	if len(profile.Achievements) != len(DefaultRules) || !byID["first-steps"].Earned || byID["first-steps"].SessionID != "session-old" {
+		t.Fatalf("unexpected achievements %+v", profile.Achievements)
+	}
+	if java := byID["seven-summits-java"]; java.Earned || java.Progress != 2.0/7 {
+		t.Fatalf("unexpected seven summits progress %+v", java)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
+
+func TestProfileForOtherViewersHidesPrivateSessions(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	ended := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`achievements_evaluated_at IS NULL`).
+		WithArgs("user-1", catchUpBatch).
+		WillReturnRows(pgxmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`FROM user_records r .* WHERE r.user_id=\$1 AND \(r.user_id::text = \$2 OR EXISTS \( SELECT 1 FROM track_sessions ts WHERE ts.id = r.session_id AND \(ts.visibility = 'public'`).
+		WithArgs("user-1", "user-2").
+		WillReturnRows(pgxmock.NewRows([]string{"kind", "scope", "route", "value", "session", "at"}).
+			AddRow(RecordLongestDistance, "", "", 9000.0, "session-public", ended))
+	mock.ExpectQuery(`FROM user_summits s .* WHERE s.user_id=\$1 AND \(s.user_id::text = \$2 OR EXISTS`).
+		WithArgs("user-1", "user-2").
+		WillReturnRows(pgxmock.NewRows([]string{"waypoint", "name", "mountain", "session", "at"}))
+	// No progress query: the totals include sessions user-2 may not read.
+	mock.ExpectQuery(`FROM user_achievements a WHERE a.user_id=\$1 AND \(a.user_id::text = \$2 OR EXISTS`).
+		WithArgs("user-1", "user-2").
+		WillReturnRows(pgxmock.NewRows([]string{"id", "earned_at", "session_id"}).AddRow("first-steps", ended, "session-public"))
+
+	profile, err := NewService(mock).Profile(context.Background(), "user-1", "user-2")
+	if err != nil {
+		t.Fatalf("profile: %v", err)
+	}
+	if len(profile.Records) != 1 || len(profile.Summits) != 0 {
+		t.Fatalf("unexpected profile %+v", profile)
+	}
+	for _, a := range profile.Achievements {
+		if a.ID == "first-steps" && (!a.Earned || a.Progress != 1) {
+			t.Fatalf("expected the visible badge earned, got %+v", a)
+		}
+		if a.ID != "first-steps" && (a.Earned || a.Progress != 0) {
+			t.Fatalf("expected no progress shown to other users, got %+v", a)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
@@ -1,40 +1,98 @@
 package auth
 
 import (
+	"errors"
 	"strings"
 
+	"backend-summithub/internal/db"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
 )
 
 // JWTMiddleware validates bearer tokens and stores user_id in locals.
+// Browsers cannot set headers on WebSocket handshakes, so upgrade requests
+// may pass the token as the access_token query parameter instead.
 func JWTMiddleware(secret string) fiber.Handler {
 	secretBytes := []byte(secret)
 	return func(c *fiber.Ctx) error {
-		token := bearerFromHeader(c.Get("Authorization"))
+		token := requestToken(c)
 		if token == "" {
 			return fiber.NewError(fiber.StatusUnauthorized, "missing bearer token")
 		}
 
-		parsed, err := parseMiddlewareClaimsFn(token, &Claims{}, func(_ *jwt.Token) (interface{}, error) {
-			return secretBytes, nil
-		})
+		userID, err := tokenUserID(token, secretBytes)
 		if err != nil {
 			return fiber.NewError(fiber.StatusUnauthorized, err.Error())
 		}
 
-		claims, ok := parsed.Claims.(*Claims)
-		if !ok || !parsed.Valid {
-			return fiber.NewError(fiber.StatusUnauthorized, "token invalid")
-		}
+		c.Locals("user_id", userID)
+		return c.Next()
+	}
+}
 
-		c.Locals("user_id", claims.UserID)
+// IdentifyMiddleware stores user_id in locals when the request carries a
+// valid token, the same way JWTMiddleware does, but lets anonymous and
+// badly authenticated requests through. It runs on every route so that
+// public endpoints know who is looking, which privacy filtering relies on.
+func IdentifyMiddleware(secret string) fiber.Handler {
+	secretBytes := []byte(secret)
+	return func(c *fiber.Ctx) error {
+		if token := requestToken(c); token != "" {
+			if userID, err := tokenUserID(token, secretBytes); err == nil {
+				c.Locals("user_id", userID)
+			}
+		}
 		return c.Next()
 	}
 }
 
+func requestToken(c *fiber.Ctx) string {
+	token := bearerFromHeader(c.Get("Authorization"))
+	if token == "" && strings.EqualFold(c.Get("Upgrade"), "websocket") {
+		token = c.Query("access_token")
+	}
+	return token
+}
+
+func tokenUserID(token string, secret []byte) (string, error) {
+	parsed, err := parseMiddlewareClaimsFn(token, &Claims{}, func(_ *jwt.Token) (interface{}, error) {
+		return secret, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	claims, ok := parsed.Claims.(*Claims)
+	if !ok || !parsed.Valid {
+		return "", errors.New("token invalid")
+	}
+	return claims.UserID, nil
+}
+
 var parseMiddlewareClaimsFn = jwt.ParseWithClaims
 
+// RequireRole allows the request only when the user stored in locals by
+// JWTMiddleware holds one of the given roles.
+func RequireRole(q db.Querier, roles ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID, _ := c.Locals("user_id").(string)
+		if userID == "" {
+			return fiber.NewError(fiber.StatusUnauthorized, "missing user")
+		}
+
+		var role string
+		if err := q.QueryRow(c.Context(), `SELECT role FROM users WHERE id=$1`, userID).Scan(&role); err != nil {
+			return fiber.NewError(fiber.StatusForbidden, "user role unavailable")
+		}
+		for _, allowed := range roles {
+			if role == allowed {
+				return c.Next()
+			}
+		}
+		return fiber.NewError(fiber.StatusForbidden, "insufficient role")
+	}
+}
+
 func bearerFromHeader(header string) string {
 	parts := strings.SplitN(header, " ", 2)
 	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
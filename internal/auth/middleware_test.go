@@ -1,12 +1,15 @@
 package auth
 
 import (
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v3"
 )
 
 func TestJWTMiddleware(t *testing.T) {
@@ -45,6 +48,19 @@ func TestJWTMiddleware(t *testing.T) {
 		t.Fatalf("expected unauthorized")
 	}
 
+	// query token is only honoured on websocket upgrades
+	req = httptest.NewRequest(http.MethodGet, "/private?access_token="+token, nil)
+	resp, _ = app.Test(req)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected unauthorized for query token without upgrade")
+	}
+	req = httptest.NewRequest(http.MethodGet, "/private?access_token="+token, nil)
+	req.Header.Set("Upgrade", "websocket")
+	resp, _ = app.Test(req)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected ok for websocket query token")
+	}
+
 	// invalid token signature
 	wrongToken, _ := NewService("other", nil).signToken("user-1", accessTokenTTL)
 	req = httptest.NewRequest(http.MethodGet, "/private", nil)
@@ -74,3 +90,88 @@ func TestJWTMiddlewareInvalidClaims(t *testing.T) {
 		t.Fatalf("expected unauthorized")
 	}
 }
+
+func TestIdentifyMiddleware(t *testing.T) {
+	svc := NewService("secret", nil)
+	app := fiber.New()
+	app.Get("/public", IdentifyMiddleware("secret"), func(c *fiber.Ctx) error {
+		userID, _ := c.Locals("user_id").(string)
+		return c.SendString(userID)
+	})
+
+	get := func(header string) string {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/public", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		resp, err := app.Test(req)
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected ok, got %v %v", resp, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	token, _ := svc.signToken("user-1", accessTokenTTL)
+	if got := get("Bearer " + token); got != "user-1" {
+		t.Fatalf("expected user-1, got %q", got)
+	}
+	if got := get(""); got != "" {
+		t.Fatalf("expected anonymous, got %q", got)
+	}
+	wrongToken, _ := NewService("other", nil).signToken("user-1", accessTokenTTL)
+	if got := get("Bearer " + wrongToken); got != "" {
+		t.Fatalf("expected a bad token to stay anonymous, got %q", got)
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	app := fiber.New()
+	app.Get("/admin", func(c *fiber.Ctx) error {
+		if id := c.Get("X-User"); id != "" {
+			c.Locals("user_id", id)
+		}
+		return c.Next()
+	}, RequireRole(mock, RoleAdmin, RoleParkAuthority), func(c *fiber.Ctx) error {
+		return c.SendStatus(http.StatusOK)
+	})
+
+	// no user in locals
+	resp, _ := app.Test(httptest.NewRequest(http.MethodGet, "/admin", nil))
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected unauthorized")
+	}
+
+	mock.ExpectQuery(`SELECT role FROM users`).WithArgs("ranger").
+		WillReturnRows(pgxmock.NewRows([]string{"role"}).AddRow(RoleParkAuthority))
+	req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+	req.Header.Set("X-User", "ranger")
+	resp, _ = app.Test(req)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected ok for park authority")
+	}
+
+	mock.ExpectQuery(`SELECT role FROM users`).WithArgs("hiker").
+		WillReturnRows(pgxmock.NewRows([]string{"role"}).AddRow(RoleHiker))
+	req = httptest.NewRequest(http.MethodGet, "/admin", nil)
+	req.Header.Set("X-User", "hiker")
+	resp, _ = app.Test(req)
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected forbidden for hiker")
+	}
+
+	mock.ExpectQuery(`SELECT role FROM users`).WithArgs("ghost").WillReturnError(pgx.ErrNoRows)
+	req = httptest.NewRequest(http.MethodGet, "/admin", nil)
+	req.Header.Set("X-User", "ghost")
+	resp, _ = app.Test(req)
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected forbidden for unknown user")
+	}
+}
@@ -2,6 +2,12 @@ package auth
 
 import "time"
 
+const (
+	RoleHiker         = "hiker"
+	RoleAdmin         = "admin"
+	RoleParkAuthority = "park_authority"
+)
+
 type User struct {
 	ID           string    `json:"id"`
 	Email        string    `json:"email"`
@@ -0,0 +1,106 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+)
+
+func RegisterRoutes(r fiber.Router, svc *Service, authMiddleware fiber.Handler) {
+	r.Get("/trips/:tripID/messages", authMiddleware, func(c *fiber.Ctx) error {
+		userID, _ := c.Locals("user_id").(string)
+		history, err := svc.History(c.Context(), c.Params("tripID"), userID, c.Query("before"), c.Query("after"), c.QueryInt("limit"))
+		if err != nil {
+			return chatError(err)
+		}
+		return c.JSON(history)
+	})
+
+	r.Post("/trips/:tripID/messages", authMiddleware, func(c *fiber.Ctx) error {
+		var req Message
+		if err := c.BodyParser(&req); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		req.TripID = c.Params("tripID")
+		req.UserID, _ = c.Locals("user_id").(string)
+		msg, err := svc.Send(c.Context(), req)
+		if err != nil {
+			return chatError(err)
+		}
+		return c.Status(fiber.StatusCreated).JSON(msg)
+	})
+
+	// The membership check runs before the upgrade so outsiders get a plain
+	// HTTP 403 instead of a socket that closes immediately.
+	r.Get("/trips/:tripID/ws", authMiddleware, func(c *fiber.Ctx) error {
+		if !websocket.IsWebSocketUpgrade(c) {
+			return fiber.ErrUpgradeRequired
+		}
+		userID, _ := c.Locals("user_id").(string)
+		member, err := svc.IsMember(c.Context(), c.Params("tripID"), userID)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		}
+		if !member {
+			return fiber.NewError(fiber.StatusForbidden, ErrNotTripMember.Error())
+		}
+		return c.Next()
+	}, websocket.New(func(c *websocket.Conn) {
+		tripID := c.Params("tripID")
+		userID, _ := c.Locals("user_id").(string)
+		client := svc.hub.Register(Channel(tripID))
+
+		done := make(chan struct{})
+		go func() {
+			for msg := range client.Send {
+				if err := c.WriteMessage(websocket.TextMessage, msg); err != nil {
+					break
+				}
+			}
+			close(done)
+		}()
+
+		for {
+			_, raw, err := c.ReadMessage()
+			if err != nil {
+				break
+			}
+			var req Message
+			if err := json.Unmarshal(raw, &req); err != nil {
+				reply(client.Send, Event{Type: EventError, Error: "invalid message"})
+				continue
+			}
+			req.TripID = tripID
+			req.UserID = userID
+			// Successful sends reach this client through the hub like everyone else's.
+			if _, err := svc.Send(context.Background(), req); err != nil {
+				reply(client.Send, Event{Type: EventError, Error: err.Error()})
+			}
+		}
+		svc.hub.Unregister(client)
+		<-done
+	}))
+}
+
+// reply queues a frame for this connection only, dropping it if the client
+// is not keeping up.
+func reply(send chan<- []byte, event Event) {
+	payload, _ := json.Marshal(event)
+	select {
+	case send <- payload:
+	default:
+	}
+}
+
+func chatError(err error) error {
+	switch {
+	case errors.Is(err, ErrNotTripMember):
+		return fiber.NewError(fiber.StatusForbidden, err.Error())
+	case errors.Is(err, ErrInvalidBody), errors.Is(err, ErrInvalidCursor):
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+}
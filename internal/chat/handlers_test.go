@@ -0,0 +1,165 @@
+package chat
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"backend-summithub/internal/stream"
+
+	"github.com/gofiber/fiber/v2"
+	gws "github.com/gorilla/websocket"
+	"github.com/pashagolub/pgxmock/v3"
+)
+
+func setUser(c *fiber.Ctx) error {
+	c.Locals("user_id", c.Get("X-User", "user-1"))
+	return c.Next()
+}
+
+func TestChatHTTPHandlers(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	expectMember(mock, "user-1", true)
+	mock.ExpectQuery(`INSERT INTO trip_messages`).
+		WithArgs(pgxmock.AnyArg(), "trip-1", "user-1", "hello", "").
+		WillReturnRows(pgxmock.NewRows([]string{"id", "seq", "body", "created_at"}).AddRow("msg-1", int64(1), "hello", time.Now()))
+	expectMember(mock, "user-1", true)
+	mock.ExpectQuery(`FROM trip_messages`).
+		WithArgs("trip-1", int64(0), 50).
+		WillReturnRows(pgxmock.NewRows(messageCols).AddRow("msg-1", int64(1), "trip-1", "user-1", "hello", "", time.Now()))
+	expectMember(mock, "stranger", false)
+
+	app := fiber.New()
+	RegisterRoutes(app.Group("/chat"), NewService(mock, stream.NewHub(nil)), setUser)
+
+	req := httptest.NewRequest(http.MethodPost, "/chat/trips/trip-1/messages", bytes.NewReader([]byte(`{"body":"hello"}`)))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	if err != nil || resp.StatusCode != http.StatusCreated {
+		t.Fatalf("send status: %v", err)
+	}
+
+	resp, err = app.Test(httptest.NewRequest(http.MethodGet, "/chat/trips/trip-1/messages", nil))
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("history status: %v", err)
+	}
+	var history History
+	if err := json.NewDecoder(resp.Body).Decode(&history); err != nil || len(history.Messages) != 1 {
+		t.Fatalf("unexpected history: %+v %v", history, err)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/chat/trips/trip-1/messages", nil)
+	req.Header.Set("X-User", "stranger")
+	resp, err = app.Test(req)
+	if err != nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403 for outsider: %v", err)
+	}
+
+	resp, err = app.Test(httptest.NewRequest(http.MethodGet, "/chat/trips/trip-1/ws", nil))
+	if err != nil || resp.StatusCode != http.StatusUpgradeRequired {
+		t.Fatalf("expected 426 without upgrade: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestChatWebsocketRoundTrip(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	expectMember(mock, "user-1", true) // upgrade check
+	expectMember(mock, "user-1", true) // send
+	mock.ExpectQuery(`INSERT INTO trip_messages`).
+		WithArgs(pgxmock.AnyArg(), "trip-1", "user-1", "on my way", "c-9").
+		WillReturnRows(pgxmock.NewRows([]string{"id", "seq", "body", "created_at"}).AddRow("msg-9", int64(9), "on my way", time.Now()))
+
+	app := fiber.New()
+	RegisterRoutes(app.Group("/chat"), NewService(mock, stream.NewHub(nil)), setUser)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen error: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		_ = app.Listener(ln)
+	}()
+	defer func() { _ = app.Shutdown() }()
+
+	conn, _, err := gws.DefaultDialer.Dial("ws://"+ln.Addr().String()+"/chat/trips/trip-1/ws", nil)
+	if err != nil {
+		t.Fatalf("dial error: %v", err)
+	}
+	defer conn.Close()
+
+	if err := conn.WriteMessage(gws.TextMessage, []byte(`not json`)); err != nil {
+		t.Fatalf("write error: %v", err)
+	}
+	if err := conn.WriteMessage(gws.TextMessage, []byte(`{"body":"on my way","client_id":"c-9"}`)); err != nil {
+		t.Fatalf("write error: %v", err)
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	var events []Event
+	for len(events) < 2 {
+		var event Event
+		if err := conn.ReadJSON(&event); err != nil {
+			t.Fatalf("read error: %v", err)
+		}
+		events = append(events, event)
+	}
+	if events[0].Type != EventError {
+		t.Fatalf("expected error frame first, got %+v", events[0])
+	}
+	if events[1].Type != EventMessage || events[1].Message.ID != "msg-9" || events[1].Message.UserID != "user-1" {
+		t.Fatalf("unexpected message frame: %+v", events[1])
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestChatNotReachableThroughPublicStream(t *testing.T) {
+	hub := stream.NewHub(nil)
+	app := fiber.New()
+	stream.RegisterRoutes(app.Group("/stream"), hub)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen error: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		_ = app.Listener(ln)
+	}()
+	defer func() { _ = app.Shutdown() }()
+
+	conn, resp, err := gws.DefaultDialer.Dial("ws://"+ln.Addr().String()+"/stream/ws/"+Channel("x"), nil)
+	if err == nil {
+		defer conn.Close()
+		hub.Broadcast(Channel("x"), []byte(`{"type":"message"}`))
+		_ = conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		if _, msg, err := conn.ReadMessage(); err == nil {
+			t.Fatalf("public stream delivered chat message %s", msg)
+		}
+		t.Fatalf("expected the public stream to refuse the chat channel")
+	}
+	if resp == nil || resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 for chat channel, got %v", err)
+	}
+}
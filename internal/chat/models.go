@@ -0,0 +1,34 @@
+package chat
+
+import "time"
+
+type Message struct {
+	ID        string    `json:"id"`
+	Seq       int64     `json:"seq"`
+	TripID    string    `json:"trip_id"`
+	UserID    string    `json:"user_id"`
+	Body      string    `json:"body"`
+	ClientID  string    `json:"client_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// History is one page of a trip's messages. NextCursor is empty on the last page.
+type History struct {
+	Messages   []Message `json:"messages"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+}
+
+// Event is the frame pushed to chat WebSocket clients.
+type Event struct {
+	Type    string   `json:"type"`
+	Message *Message `json:"message,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+const (
+	EventMessage = "chat_message"
+	EventError   = "error"
+)
+
+// maxBodyLen matches the CHECK constraint on trip_messages.body.
+const maxBodyLen = 4000
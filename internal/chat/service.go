@@ -0,0 +1,162 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"backend-summithub/internal/db"
+	"backend-summithub/internal/stream"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrNotTripMember = errors.New("user is not a member of the trip")
+	ErrInvalidBody   = errors.New("message body must be 1-4000 characters")
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+type Service struct {
+	db  db.Querier
+	hub *stream.Hub
+}
+
+func NewService(db db.Querier, hub *stream.Hub) *Service {
+	return &Service{db: db, hub: hub}
+}
+
+// Channel is the hub channel carrying a trip's chat messages.
+func Channel(tripID string) string {
+	return stream.InternalChannel("trip-chat", tripID)
+}
+
+// IsMember reports whether the user belongs to the trip or created it.
+func (s *Service) IsMember(ctx context.Context, tripID, userID string) (bool, error) {
+	var ok bool
+	err := s.db.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM trip_members WHERE trip_id=$1 AND user_id::text=$2)
+		    OR EXISTS (SELECT 1 FROM trips WHERE id=$1 AND created_by::text=$2)
+	`, tripID, userID).Scan(&ok)
+	return ok, err
+}
+
+// Send stores a message and fans it out to every connected member. A retry
+// carrying the same client_id returns the stored message without posting a
+// duplicate.
+func (s *Service) Send(ctx context.Context, input Message) (Message, error) {
+	input.Body = strings.TrimSpace(input.Body)
+	if input.Body == "" || utf8.RuneCountInString(input.Body) > maxBodyLen {
+		return Message{}, ErrInvalidBody
+	}
+	member, err := s.IsMember(ctx, input.TripID, input.UserID)
+	if err != nil {
+		return Message{}, err
+	}
+	if !member {
+		return Message{}, ErrNotTripMember
+	}
+
+	input.ID = uuid.NewString()
+	row := s.db.QueryRow(ctx, `
+		INSERT INTO trip_messages (id, trip_id, user_id, body, client_id)
+		VALUES ($1, $2, $3, $4, NULLIF($5,''))
+		ON CONFLICT (trip_id, user_id, client_id) WHERE client_id IS NOT NULL
+		DO UPDATE SET client_id = EXCLUDED.client_id
+		RETURNING id, seq, body, created_at
+	`, input.ID, input.TripID, input.UserID, input.Body, input.ClientID)
+	if err := row.Scan(&input.ID, &input.Seq, &input.Body, &input.CreatedAt); err != nil {
+		return Message{}, err
+	}
+
+	if s.hub != nil {
+		payload, _ := json.Marshal(Event{Type: EventMessage, Message: &input})
+		s.hub.Broadcast(Channel(input.TripID), payload)
+	}
+	return input, nil
+}
+
+// History pages through a trip's messages. With a before cursor it walks
+// back from the newest message; with an after cursor it returns what was
+// posted since, oldest first, which is how a reconnecting client catches up.
+func (s *Service) History(ctx context.Context, tripID, userID, before, after string, limit int) (History, error) {
+	member, err := s.IsMember(ctx, tripID, userID)
+	if err != nil {
+		return History{}, err
+	}
+	if !member {
+		return History{}, ErrNotTripMember
+	}
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	beforeSeq, err := parseCursor(before)
+	if err != nil {
+		return History{}, err
+	}
+	afterSeq, err := parseCursor(after)
+	if err != nil {
+		return History{}, err
+	}
+
+	query := `
+		SELECT id, seq, trip_id, COALESCE(user_id::text,''), body, COALESCE(client_id,''), created_at
+		FROM trip_messages
+		WHERE trip_id=$1 AND ($2 = 0 OR seq < $2)
+		ORDER BY seq DESC
+		LIMIT $3
+	`
+	cursor := beforeSeq
+	if after != "" {
+		query = `
+		SELECT id, seq, trip_id, COALESCE(user_id::text,''), body, COALESCE(client_id,''), created_at
+		FROM trip_messages
+		WHERE trip_id=$1 AND seq > $2
+		ORDER BY seq
+		LIMIT $3
+	`
+		cursor = afterSeq
+	}
+
+	rows, err := s.db.Query(ctx, query, tripID, cursor, limit)
+	if err != nil {
+		return History{}, err
+	}
+	defer rows.Close()
+
+	history := History{Messages: []Message{}}
+	for rows.Next() {
+		var m Message
+		if err := rows.Scan(&m.ID, &m.Seq, &m.TripID, &m.UserID, &m.Body, &m.ClientID, &m.CreatedAt); err != nil {
+			return History{}, err
+		}
+		history.Messages = append(history.Messages, m)
+	}
+	if len(history.Messages) == limit {
+		history.NextCursor = strconv.FormatInt(history.Messages[limit-1].Seq, 10)
+	}
+	return history, nil
+}
+
+func parseCursor(cursor string) (int64, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	seq, err := strconv.ParseInt(cursor, 10, 64)
+	if err != nil || seq < 0 {
+		return 0, ErrInvalidCursor
+	}
+	return seq, nil
+}
@@ -0,0 +1,145 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"backend-summithub/internal/stream"
+
+	"github.com/pashagolub/pgxmock/v3"
+)
+
+var messageCols = []string{"id", "seq", "trip_id", "user_id", "body", "client_id", "created_at"}
+
+func expectMember(mock pgxmock.PgxPoolIface, userID string, ok bool) {
+	mock.ExpectQuery(`FROM trip_members WHERE trip_id=\$1 AND user_id::text=\$2`).
+		WithArgs("trip-1", userID).
+		WillReturnRows(pgxmock.NewRows([]string{"exists"}).AddRow(ok))
+}
+
+func TestSendPersistsAndBroadcasts(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	now := time.Now()
+	expectMember(mock, "user-1", true)
+	mock.ExpectQuery(`INSERT INTO trip_messages .* ON CONFLICT \(trip_id, user_id, client_id\)`).
+		WithArgs(pgxmock.AnyArg(), "trip-1", "user-1", "summit at dawn?", "c-1").
+		WillReturnRows(pgxmock.NewRows([]string{"id", "seq", "body", "created_at"}).AddRow("msg-1", int64(12), "summit at dawn?", now))
+
+	hub := stream.NewHub(nil)
+	listener := hub.Register(Channel("trip-1"))
+	defer hub.Unregister(listener)
+
+	svc := NewService(mock, hub)
+	msg, err := svc.Send(context.Background(), Message{TripID: "trip-1", UserID: "user-1", Body: "  summit at dawn?  ", ClientID: "c-1"})
+	if err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if msg.ID != "msg-1" || msg.Seq != 12 {
+		t.Fatalf("unexpected message: %+v", msg)
+	}
+
+	select {
+	case raw := <-listener.Send:
+		var event Event
+		if err := json.Unmarshal(raw, &event); err != nil || event.Type != EventMessage || event.Message.ID != "msg-1" {
+			t.Fatalf("unexpected event %s: %v", raw, err)
+		}
+	case <-time.After(100 * time.Millisecond):
+		t.Fatalf("timeout waiting for broadcast")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestSendRejectsOutsidersAndEmptyBodies(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	svc := NewService(mock, nil)
+	if _, err := svc.Send(context.Background(), Message{TripID: "trip-1", UserID: "user-1", Body: "   "}); !errors.Is(err, ErrInvalidBody) {
+		t.Fatalf("expected ErrInvalidBody, got %v", err)
+	}
+
+	expectMember(mock, "stranger", false)
+	if _, err := svc.Send(context.Background(), Message{TripID: "trip-1", UserID: "stranger", Body: "hi"}); !errors.Is(err, ErrNotTripMember) {
+		t.Fatalf("expected ErrNotTripMember, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestHistoryPagination(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	now := time.Now()
+	expectMember(mock, "user-1", true)
+	mock.ExpectQuery(`FROM trip_messages WHERE trip_id=\$1 AND \(\$2 = 0 OR seq < \$2\) ORDER BY seq DESC`).
+		WithArgs("trip-1", int64(0), 2).
+		WillReturnRows(pgxmock.NewRows(messageCols).
+			AddRow("msg-3", int64(3), "trip-1", "user-1", "c", "", now).
+			AddRow("msg-2", int64(2), "trip-1", "user-2", "b", "", now))
+	expectMember(mock, "user-1", true)
+	mock.ExpectQuery(`FROM trip_messages WHERE trip_id=\$1 AND \(\$2 = 0 OR seq < \$2\) ORDER BY seq DESC`).
+		WithArgs("trip-1", int64(2), 2).
+		WillReturnRows(pgxmock.NewRows(messageCols).
+			AddRow("msg-1", int64(1), "trip-1", "user-1", "a", "", now))
+	expectMember(mock, "user-1", true)
+	mock.ExpectQuery(`FROM trip_messages WHERE trip_id=\$1 AND seq > \$2 ORDER BY seq LIMIT`).
+		WithArgs("trip-1", int64(1), 50).
+		WillReturnRows(pgxmock.NewRows(messageCols).
+			AddRow("msg-2", int64(2), "trip-1", "user-2", "b", "", now).
+			AddRow("msg-3", int64(3), "trip-1", "user-1", "c", "", now))
+
+	svc := NewService(mock, nil)
+	page, err := svc.History(context.Background(), "trip-1", "user-1", "", "", 2)
+	if err != nil {
+		t.Fatalf("history: %v", err)
+	}
+	if len(page.Messages) != 2 || page.NextCursor != "2" {
+		t.Fatalf("unexpected first page: %+v", page)
+	}
+
+	page, err = svc.History(context.Background(), "trip-1", "user-1", page.NextCursor, "", 2)
+	if err != nil {
+		t.Fatalf("history: %v", err)
+	}
+	if len(page.Messages) != 1 || page.NextCursor != "" {
+		t.Fatalf("unexpected last page: %+v", page)
+	}
+
+	page, err = svc.History(context.Background(), "trip-1", "user-1", "", "1", 0)
+	if err != nil {
+		t.Fatalf("history after: %v", err)
+	}
+	if len(page.Messages) != 2 || page.Messages[0].Seq != 2 {
+		t.Fatalf("unexpected catch-up page: %+v", page)
+	}
+
+	expectMember(mock, "user-1", true)
+	if _, err := svc.History(context.Background(), "trip-1", "user-1", "abc", "", 0); !errors.Is(err, ErrInvalidCursor) {
+		t.Fatalf("expected ErrInvalidCursor, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
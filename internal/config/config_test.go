@@ -1,6 +1,9 @@
 package config
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 func TestLoadDefaults(t *testing.T) {
 	cfg := Load()
@@ -10,6 +13,12 @@ func TestLoadDefaults(t *testing.T) {
 	if cfg.PostgresURL == "" {
 		t.Fatalf("expected default postgres url")
 	}
+	if cfg.SessionIdleTimeout != 2*time.Hour || cfg.SessionSweepInterval != 5*time.Minute {
+		t.Fatalf("expected default auto-close durations, got %v %v", cfg.SessionIdleTimeout, cfg.SessionSweepInterval)
+	}
+	if cfg.TrackPointRetention != 0 || cfg.PartitionInterval != 24*time.Hour {
+		t.Fatalf("expected raw points kept forever and daily maintenance, got %v %v", cfg.TrackPointRetention, cfg.PartitionInterval)
+	}
 }
 
 func TestLoadEnvOverrides(t *testing.T) {
@@ -17,6 +26,9 @@ func TestLoadEnvOverrides(t *testing.T) {
 	t.Setenv("POSTGRES_URL", "postgres://example")
 	t.Setenv("REDIS_ADDR", "redis:6379")
 	t.Setenv("JWT_SECRET", "secret")
+	t.Setenv("SESSION_IDLE_TIMEOUT", "45m")
+	t.Setenv("SOS_WEBHOOK_URL", "https://rescue.example/sos")
+	t.Setenv("TRACK_POINT_RETENTION", "8760h")
 
 	cfg := Load()
 	if cfg.ServerPort != ":9000" {
@@ -31,4 +43,13 @@ func TestLoadEnvOverrides(t *testing.T) {
 	if cfg.JWTSecret != "secret" {
 		t.Fatalf("expected override secret")
 	}
+	if cfg.SessionIdleTimeout != 45*time.Minute {
+		t.Fatalf("expected override idle timeout")
+	}
+	if cfg.TrackPointRetention != 365*24*time.Hour {
+		t.Fatalf("expected override retention")
+	}
+	if cfg.SOSWebhookURL != "https://rescue.example/sos" {
+		t.Fatalf("expected override sos webhook")
+	}
 }
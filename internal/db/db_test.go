@@ -2,11 +2,14 @@ package db
 
 import (
 	"context"
+	"errors"
 	"testing"
 
 	"backend-summithub/internal/config"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pashagolub/pgxmock/v3"
 )
 
 func TestConnectRedisEmpty(t *testing.T) {
@@ -73,3 +76,34 @@ func TestConnectRedisConfigured(t *testing.T) {
 	}
 	_ = client.Close()
 }
+
+func TestWithTx(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	if err := WithTx(context.Background(), mock, func(pgx.Tx) error { return nil }); err != nil {
+		t.Fatalf("expected commit: %v", err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	if err := WithTx(context.Background(), mock, func(pgx.Tx) error { return errTx }); err != errTx {
+		t.Fatalf("expected fn error, got %v", err)
+	}
+
+	mock.ExpectBegin().WillReturnError(errTx)
+	if err := WithTx(context.Background(), mock, func(pgx.Tx) error { return nil }); err != errTx {
+		t.Fatalf("expected begin error, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+var errTx = errors.New("tx error")
@@ -0,0 +1,161 @@
+package heatmap
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Cache stores rendered tiles by Tile.Key.
+type Cache interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, data []byte) error
+	// Delete drops the given tiles.
+	Delete(ctx context.Context, keys ...string) error
+	// Clear drops every tile.
+	Clear(ctx context.Context) error
+}
+
+// NewCache picks Redis when a client is given, otherwise a directory on
+// disk, otherwise no cache at all.
+func NewCache(rdb *redis.Client, dir string, ttl time.Duration) Cache {
+	switch {
+	case rdb != nil:
+		return &RedisCache{rdb: rdb, ttl: ttl}
+	case dir != "":
+		return &DiskCache{dir: dir}
+	}
+	return noCache{}
+}
+
+const redisGenerationKey = "heatmap:generation"
+
+// RedisCache keeps tiles under a generation number so Clear is a single
+// INCR; tiles of old generations expire after ttl.
+type RedisCache struct {
+	rdb *redis.Client
+	ttl time.Duration
+}
+
+func (c *RedisCache) prefix(ctx context.Context) (string, error) {
+	gen, err := c.rdb.Get(ctx, redisGenerationKey).Int64()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return "", err
+	}
+	return "heatmap:" + strconv.FormatInt(gen, 10) + ":", nil
+}
+
+func (c *RedisCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	prefix, err := c.prefix(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	data, err := c.rdb.Get(ctx, prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	return data, err == nil, err
+}
+
+func (c *RedisCache) Set(ctx context.Context, key string, data []byte) error {
+	prefix, err := c.prefix(ctx)
+	if err != nil {
+		return err
+	}
+	return c.rdb.Set(ctx, prefix+key, data, c.ttl).Err()
+}
+
+func (c *RedisCache) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	prefix, err := c.prefix(ctx)
+	if err != nil {
+		return err
+	}
+	full := make([]string, len(keys))
+	for i, key := range keys {
+		full[i] = prefix + key
+	}
+	return c.rdb.Del(ctx, full...).Err()
+}
+
+func (c *RedisCache) Clear(ctx context.Context) error {
+	return c.rdb.Incr(ctx, redisGenerationKey).Err()
+}
+
+// DiskCache keeps each tile in a file named after its key under dir.
+type DiskCache struct {
+	dir string
+}
+
+func (c *DiskCache) path(key string) string {
+	return filepath.Join(c.dir, filepath.FromSlash(key))
+}
+
+func (c *DiskCache) Get(_ context.Context, key string) ([]byte, bool, error) {
+	data, err := os.ReadFile(c.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	return data, err == nil, err
+}
+
+// Set writes through a temporary file so readers never see half a tile.
+func (c *DiskCache) Set(_ context.Context, key string, data []byte) error {
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tile-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (c *DiskCache) Delete(_ context.Context, keys ...string) error {
+	for _, key := range keys {
+		if err := os.Remove(c.path(key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *DiskCache) Clear(context.Context) error {
+	entries, err := os.ReadDir(c.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := os.RemoveAll(filepath.Join(c.dir, e.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type noCache struct{}
+
+func (noCache) Get(context.Context, string) ([]byte, bool, error) { return nil, false, nil }
+func (noCache) Set(context.Context, string, []byte) error         { return nil }
+func (noCache) Delete(context.Context, ...string) error           { return nil }
+func (noCache) Clear(context.Context) error                       { return nil }
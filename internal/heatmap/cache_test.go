@@ -0,0 +1,71 @@
+package heatmap
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func exerciseCache(t *testing.T, cache Cache) {
+	t.Helper()
+	ctx := context.Background()
+	if _, ok, err := cache.Get(ctx, "1/0/0.png"); ok || err != nil {
+		t.Fatalf("expected a miss, got %v %v", ok, err)
+	}
+	for _, key := range []string{"1/0/0.png", "1/1/0.png", "2/1/1.mvt"} {
+		if err := cache.Set(ctx, key, []byte(key)); err != nil {
+			t.Fatalf("set %s: %v", key, err)
+		}
+	}
+	if data, ok, err := cache.Get(ctx, "1/0/0.png"); !ok || err != nil || string(data) != "1/0/0.png" {
+		t.Fatalf("expected a hit, got %q %v %v", data, ok, err)
+	}
+	if err := cache.Delete(ctx, "1/0/0.png", "9/9/9.png"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, ok, _ := cache.Get(ctx, "1/0/0.png"); ok {
+		t.Fatalf("expected the deleted tile to be gone")
+	}
+	if _, ok, _ := cache.Get(ctx, "1/1/0.png"); !ok {
+		t.Fatalf("expected other tiles to stay")
+	}
+	if err := cache.Clear(ctx); err != nil {
+		t.Fatalf("clear: %v", err)
+	}
+	for _, key := range []string{"1/1/0.png", "2/1/1.mvt"} {
+		if _, ok, _ := cache.Get(ctx, key); ok {
+			t.Fatalf("expected %s to be cleared", key)
+		}
+	}
+	if err := cache.Set(ctx, "1/1/0.png", []byte("new")); err != nil {
+		t.Fatalf("set after clear: %v", err)
+	}
+	if data, ok, _ := cache.Get(ctx, "1/1/0.png"); !ok || string(data) != "new" {
+		t.Fatalf("expected the cache to work after a clear, got %q", data)
+	}
+}
+
+func TestDiskCache(t *testing.T) {
+	exerciseCache(t, NewCache(nil, t.TempDir(), time.Hour))
+}
+
+func TestRedisCache(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+	exerciseCache(t, NewCache(rdb, t.TempDir(), time.Hour))
+	if ttl := mr.TTL("heatmap:1:1/1/0.png"); ttl != time.Hour {
+		t.Fatalf("expected tiles to expire after an hour, got %v", ttl)
+	}
+}
+
+func TestNoCache(t *testing.T) {
+	cache := NewCache(nil, "", time.Hour)
+	_ = cache.Set(context.Background(), "0/0/0.png", []byte("x"))
+	if _, ok, _ := cache.Get(context.Background(), "0/0/0.png"); ok {
+		t.Fatalf("expected nothing to be cached")
+	}
+}
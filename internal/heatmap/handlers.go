@@ -0,0 +1,35 @@
+package heatmap
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// mvtContentType is the registered media type of Mapbox Vector Tiles.
+const mvtContentType = "application/vnd.mapbox-vector-tile"
+
+// RegisterRoutes mounts GET /heatmap/:z/:x/:y under /tiles. Tiles only show
+// public data, so they need no authentication.
+func RegisterRoutes(r fiber.Router, svc *Service) {
+	r.Get("/heatmap/:z/:x/:y", func(c *fiber.Ctx) error {
+		t, err := ParseTile(c.Params("z"), c.Params("x"), c.Params("y"))
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		data, err := svc.Tile(c.Context(), t)
+		if errors.Is(err, ErrInvalidTile) {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		}
+		if t.Format == FormatMVT {
+			c.Set(fiber.HeaderContentType, mvtContentType)
+		} else {
+			c.Set(fiber.HeaderContentType, "image/png")
+		}
+		c.Set(fiber.HeaderCacheControl, "public, max-age=3600")
+		return c.Send(data)
+	})
+}
@@ -0,0 +1,45 @@
+package heatmap
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestHeatmapHandler(t *testing.T) {
+	mock := newMock(t)
+	app := fiber.New()
+	RegisterRoutes(app.Group("/tiles"), NewService(mock, nil))
+
+	expectBins(mock, Tile{Z: 12, X: 3304, Y: 2133, Format: FormatMVT}, Bin{X: 1, Y: 1, Sessions: 2})
+	expectBins(mock, Tile{Z: 12, X: 3304, Y: 2133, Format: FormatPNG})
+
+	for _, tc := range []struct {
+		path, contentType string
+		status            int
+	}{
+		{"/tiles/heatmap/12/3304/2133.pbf", mvtContentType, http.StatusOK},
+		{"/tiles/heatmap/12/3304/2133.png", "image/png", http.StatusOK},
+		{"/tiles/heatmap/12/4096/2133.png", "", http.StatusBadRequest},
+		{"/tiles/heatmap/12/3304/2133.gif", "", http.StatusBadRequest},
+		{"/tiles/heatmap/3/6/4.png", "", http.StatusBadRequest},
+	} {
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if err != nil || resp.StatusCode != tc.status {
+			t.Fatalf("%s: expected %d, got %v %v", tc.path, tc.status, resp.StatusCode, err)
+		}
+		if tc.contentType == "" {
+			continue
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if resp.Header.Get(fiber.HeaderContentType) != tc.contentType || len(body) == 0 {
+			t.Fatalf("%s: unexpected %s response of %d bytes", tc.path, resp.Header.Get(fiber.HeaderContentType), len(body))
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
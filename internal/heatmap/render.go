@@ -0,0 +1,174 @@
+package heatmap
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+)
+
+// Bin is one tile pixel and the number of distinct sessions that pass
+// through it.
+type Bin struct {
+	X, Y     int
+	Sessions int
+}
+
+// minSaturation is the session count a pixel needs to reach full heat in a
+// tile whose busiest pixel has fewer, so a tile crossed by one hike does not
+// glow like a busy trail.
+const minSaturation = 10
+
+// normalise maps each bin's session count to 0..1 on a log scale against
+// the busiest pixel of the tile, so trails stand out across both quiet and
+// popular areas.
+func normalise(bins []Bin) []float64 {
+	peak := minSaturation
+	for _, b := range bins {
+		peak = max(peak, b.Sessions)
+	}
+	values := make([]float64, len(bins))
+	for i, b := range bins {
+		values[i] = math.Min(1, math.Log1p(float64(b.Sessions))/math.Log1p(float64(peak)))
+	}
+	return values
+}
+
+// ramp runs from dark blue through red to a pale yellow.
+var ramp = []color.NRGBA{
+	{R: 30, G: 60, B: 200, A: 110},
+	{R: 200, G: 30, B: 60, A: 190},
+	{R: 255, G: 150, B: 30, A: 230},
+	{R: 255, G: 250, B: 200, A: 255},
+}
+
+func heatColor(v float64) color.NRGBA {
+	pos := v * float64(len(ramp)-1)
+	i := min(int(pos), len(ramp)-2)
+	f := pos - float64(i)
+	lerp := func(a, b uint8) uint8 { return uint8(math.Round(float64(a) + (float64(b)-float64(a))*f)) }
+	a, b := ramp[i], ramp[i+1]
+	return color.NRGBA{R: lerp(a.R, b.R), G: lerp(a.G, b.G), B: lerp(a.B, b.B), A: lerp(a.A, b.A)}
+}
+
+// renderPNG draws bins on a transparent tile.
+func renderPNG(bins []Bin) ([]byte, error) {
+	img := image.NewNRGBA(image.Rect(0, 0, TileSize, TileSize))
+	for i, v := range normalise(bins) {
+		img.SetNRGBA(bins[i].X, bins[i].Y, heatColor(v))
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// MVT layout: one "heatmap" layer of points at pixel centres, each with
+// "sessions" and "intensity" properties.
+const (
+	mvtLayer  = "heatmap"
+	mvtExtent = 4096
+)
+
+// encodeMVT writes bins as a Mapbox Vector Tile (spec 2.1).
+func encodeMVT(bins []Bin) []byte {
+	var layer protoBuffer
+	layer.uint(15, 2)
+	layer.string(1, mvtLayer)
+
+	values := map[any]int{}
+	var encodedValues []protoBuffer
+	valueIndex := func(v any) int {
+		if i, ok := values[v]; ok {
+			return i
+		}
+		var pb protoBuffer
+		switch v := v.(type) {
+		case uint64:
+			pb.uint(5, v)
+		case float64:
+			pb.double(3, v)
+		}
+		values[v] = len(encodedValues)
+		encodedValues = append(encodedValues, pb)
+		return values[v]
+	}
+
+	scale := mvtExtent / TileSize
+	for i, v := range normalise(bins) {
+		b := bins[i]
+		var feature protoBuffer
+		feature.uint(1, uint64(i+1))
+		feature.packed(2, []uint64{0, uint64(valueIndex(uint64(b.Sessions))), 1, uint64(valueIndex(math.Round(v*1000) / 1000))})
+		feature.uint(3, 1) // POINT
+		x, y := b.X*scale+scale/2, b.Y*scale+scale/2
+		feature.packed(4, []uint64{1<<3 | 1, zigzag(x), zigzag(y)}) // MoveTo(1)
+		layer.message(2, feature)
+	}
+	layer.string(3, "sessions")
+	layer.string(3, "intensity")
+	for _, pb := range encodedValues {
+		layer.message(4, pb)
+	}
+	layer.uint(5, mvtExtent)
+
+	var tile protoBuffer
+	tile.message(3, layer)
+	return tile
+}
+
+func zigzag(v int) uint64 {
+	return uint64((v << 1) ^ (v >> 63))
+}
+
+// protoBuffer appends protocol buffer fields.
+type protoBuffer []byte
+
+func (b *protoBuffer) varint(v uint64) {
+	for v >= 0x80 {
+		*b = append(*b, byte(v)|0x80)
+		v >>= 7
+	}
+	*b = append(*b, byte(v))
+}
+
+func (b *protoBuffer) key(field, wireType int) {
+	b.varint(uint64(field<<3 | wireType))
+}
+
+func (b *protoBuffer) uint(field int, v uint64) {
+	b.key(field, 0)
+	b.varint(v)
+}
+
+func (b *protoBuffer) double(field int, v float64) {
+	b.key(field, 1)
+	bits := math.Float64bits(v)
+	for i := 0; i < 8; i++ {
+		*b = append(*b, byte(bits>>(8*i)))
+	}
+}
+
+func (b *protoBuffer) bytes(field int, data []byte) {
+	b.key(field, 2)
+	b.varint(uint64(len(data)))
+	*b = append(*b, data...)
+}
+
+func (b *protoBuffer) string(field int, s string) {
+	b.bytes(field, []byte(s))
+}
+
+func (b *protoBuffer) message(field int, m protoBuffer) {
+	b.bytes(field, m)
+}
+
+func (b *protoBuffer) packed(field int, values []uint64) {
+	var inner protoBuffer
+	for _, v := range values {
+		inner.varint(v)
+	}
+	b.bytes(field, inner)
+}
@@ -0,0 +1,115 @@
+package heatmap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/png"
+	"math"
+	"testing"
+)
+
+func TestNormalise(t *testing.T) {
+	values := normalise([]Bin{{Sessions: 1}, {Sessions: 10}, {Sessions: 40}})
+	if values[2] != 1 || !(values[0] < values[1] && values[1] < values[2]) {
+		t.Fatalf("unexpected values %v", values)
+	}
+	// A tile crossed by a single hike stays faint.
+	if lone := normalise([]Bin{{Sessions: 1}}); lone[0] > 0.3 {
+		t.Fatalf("expected a lone session to stay faint, got %v", lone[0])
+	}
+}
+
+func TestRenderPNG(t *testing.T) {
+	data, err := renderPNG([]Bin{{X: 10, Y: 20, Sessions: 1}, {X: 200, Y: 30, Sessions: 50}})
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != TileSize || b.Dy() != TileSize {
+		t.Fatalf("unexpected size %v", b)
+	}
+	_, _, _, empty := img.At(0, 0).RGBA()
+	_, _, _, faint := img.At(10, 20).RGBA()
+	_, _, _, hot := img.At(200, 30).RGBA()
+	if empty != 0 || faint == 0 || hot <= faint {
+		t.Fatalf("unexpected alpha empty=%d faint=%d hot=%d", empty, faint, hot)
+	}
+}
+
+// protoFields reads one level of protocol buffer fields, keeping varints and
+// length-delimited payloads.
+func protoFields(t *testing.T, data []byte) map[int][][]byte {
+	t.Helper()
+	fields := map[int][][]byte{}
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		data = data[n:]
+		field, wire := int(key>>3), key&7
+		switch wire {
+		case 0:
+			_, n = binary.Uvarint(data)
+			fields[field] = append(fields[field], data[:n])
+			data = data[n:]
+		case 1:
+			fields[field] = append(fields[field], data[:8])
+			data = data[8:]
+		case 2:
+			size, n := binary.Uvarint(data)
+			fields[field] = append(fields[field], data[n:n+int(size)])
+			data = data[n+int(size):]
+		default:
+			t.Fatalf("unexpected wire type %d", wire)
+		}
+	}
+	return fields
+}
+
+func varints(data []byte) []uint64 {
+	var out []uint64
+	for len(data) > 0 {
+		v, n := binary.Uvarint(data)
+		out = append(out, v)
+		data = data[n:]
+	}
+	return out
+}
+
+func TestEncodeMVT(t *testing.T) {
+	tile := protoFields(t, encodeMVT([]Bin{{X: 0, Y: 255, Sessions: 3}, {X: 128, Y: 64, Sessions: 3}}))
+	if len(tile[3]) != 1 {
+		t.Fatalf("expected one layer, got %d", len(tile[3]))
+	}
+	layer := protoFields(t, tile[3][0])
+	if string(layer[1][0]) != mvtLayer || varints(layer[15][0])[0] != 2 || varints(layer[5][0])[0] != mvtExtent {
+		t.Fatalf("unexpected layer header %v", layer)
+	}
+	if len(layer[3]) != 2 || string(layer[3][0]) != "sessions" || string(layer[3][1]) != "intensity" {
+		t.Fatalf("unexpected keys %q", layer[3])
+	}
+	// Both points share their values: 3 sessions and the same intensity.
+	if len(layer[2]) != 2 || len(layer[4]) != 2 {
+		t.Fatalf("expected 2 features and 2 values, got %d and %d", len(layer[2]), len(layer[4]))
+	}
+	sessions := protoFields(t, layer[4][0])
+	intensity := protoFields(t, layer[4][1])
+	if varints(sessions[5][0])[0] != 3 {
+		t.Fatalf("unexpected sessions value %v", sessions)
+	}
+	if v := math.Float64frombits(binary.LittleEndian.Uint64(intensity[3][0])); math.Abs(v-math.Log1p(3)/math.Log1p(minSaturation)) > 1e-3 {
+		t.Fatalf("unexpected intensity %v", v)
+	}
+
+	second := protoFields(t, layer[2][1])
+	if tags := varints(second[2][0]); len(tags) != 4 || tags[1] != 0 || tags[3] != 1 {
+		t.Fatalf("unexpected tags %v", tags)
+	}
+	if geom := varints(second[4][0]); len(geom) != 3 || geom[0] != 9 || geom[1] != zigzag(128*16+8) || geom[2] != zigzag(64*16+8) {
+		t.Fatalf("unexpected geometry %v", geom)
+	}
+	if zigzag(-3) != 5 || zigzag(3) != 6 {
+		t.Fatalf("unexpected zigzag encoding")
+	}
+}
@@ -0,0 +1,188 @@
+package heatmap
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+
+	"backend-summithub/internal/db"
+	"backend-summithub/internal/privacy"
+	"backend-summithub/internal/tracking"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// maxGapM drops the stretch between consecutive points further apart
+	// than this, such as a GPS outage, rather than drawing a straight line.
+	maxGapM = 250.0
+	// maxInvalidateTiles bounds how many tiles a change deletes one by one;
+	// a larger area clears the whole cache instead.
+	maxInvalidateTiles = 20000
+	// metresPerDegree is the length of a degree of latitude.
+	metresPerDegree = 111320.0
+)
+
+type Service struct {
+	db    db.Querier
+	cache Cache
+}
+
+func NewService(db db.Querier, cache Cache) *Service {
+	if cache == nil {
+		cache = noCache{}
+	}
+	return &Service{db: db, cache: cache}
+}
+
+// Tile returns the rendered tile, from the cache when it holds it. Cache
+// failures are logged and the tile is rendered anyway.
+func (s *Service) Tile(ctx context.Context, t Tile) ([]byte, error) {
+	if !t.valid() {
+		return nil, ErrInvalidTile
+	}
+	data, ok, err := s.cache.Get(ctx, t.Key())
+	if err != nil {
+		log.Printf("heatmap cache get %s: %v", t.Key(), err)
+	}
+	if ok {
+		return data, nil
+	}
+
+	bins, err := s.bins(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	if t.Format == FormatMVT {
+		data = encodeMVT(bins)
+	} else if data, err = renderPNG(bins); err != nil {
+		return nil, err
+	}
+	if err := s.cache.Set(ctx, t.Key(), data); err != nil {
+		log.Printf("heatmap cache set %s: %v", t.Key(), err)
+	}
+	return data, nil
+}
+
+// bins counts, for each pixel of the tile, the distinct public sessions
+// whose track crosses it. Tracks are drawn as the segments between
+// consecutive points, densified to the pixel size so they stay continuous
+// at high zoom. Only ended sessions count, and a segment is dropped when
+// either end lies in one of the owner's privacy zones or the points are
+// more than maxGapM apart.
+func (s *Service) bins(ctx context.Context, t Tile) ([]Bin, error) {
+	minX, minY, maxX, maxY := t.Bounds()
+	pixel := t.PixelSize()
+	rows, err := s.db.Query(ctx, `
+		WITH tile AS (
+		    SELECT ST_MakeEnvelope($1, $2, $3, $4, 3857) AS env
+		), points AS (
+		    SELECT p.session_id,
+		           p.location::geometry AS geom,
+		           `+privacy.HiddenSQL("p.location", "s.user_id")+` AS hidden,
+		           p.recorded_at, p.id
+		    FROM track_points p
+		    JOIN track_sessions s ON s.id = p.session_id
+		    CROSS JOIN tile
+		    WHERE s.visibility = 'public' AND s.status IN ('ended', 'auto_closed')
+		      -- a margin so segments entering the tile from outside are kept
+		      AND p.location && ST_Transform(ST_Expand(tile.env, $6), 4326)::geography
+		), segments AS (
+		    SELECT session_id, geom, hidden,
+		           LAG(geom) OVER w AS prev_geom,
+		           LAG(hidden) OVER w AS prev_hidden
+		    FROM points
+		    WINDOW w AS (PARTITION BY session_id ORDER BY recorded_at, id)
+		), cells AS (
+		    SELECT DISTINCT seg.session_id,
+		           floor((ST_X(d.geom) - $1) / $5)::int AS px,
+		           floor(($4 - ST_Y(d.geom)) / $5)::int AS py
+		    FROM segments seg
+		    CROSS JOIN LATERAL ST_DumpPoints(ST_Segmentize(
+		        ST_Transform(ST_MakeLine(seg.prev_geom, seg.geom), 3857), $5)) d
+		    WHERE seg.prev_geom IS NOT NULL
+		      AND NOT seg.hidden AND NOT seg.prev_hidden
+		      AND ST_DistanceSphere(seg.prev_geom, seg.geom) <= $7
+		)
+		SELECT px, py, COUNT(*)::int
+		FROM cells
+		WHERE px BETWEEN 0 AND $8 AND py BETWEEN 0 AND $8
+		GROUP BY px, py
+	`, minX, minY, maxX, maxY, pixel, 2*maxGapM, maxGapM, TileSize-1)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var bins []Bin
+	for rows.Next() {
+		var b Bin
+		if err := rows.Scan(&b.X, &b.Y, &b.Sessions); err != nil {
+			return nil, err
+		}
+		bins = append(bins, b)
+	}
+	return bins, rows.Err()
+}
+
+// SessionEnded drops the cached tiles a newly ended public session crosses.
+func (s *Service) SessionEnded(ctx context.Context, session tracking.Session) {
+	s.invalidateSession(ctx, session.ID, true)
+}
+
+// VisibilityChanged drops the cached tiles of a session that became public
+// or stopped being public.
+func (s *Service) VisibilityChanged(ctx context.Context, session tracking.Session) {
+	s.invalidateSession(ctx, session.ID, false)
+}
+
+// ZoneChanged drops the cached tiles under a privacy zone that was created
+// or deleted, so tracks through it are redrawn with or without that part.
+func (s *Service) ZoneChanged(ctx context.Context, zone privacy.Zone) {
+	dLat := zone.RadiusM / metresPerDegree
+	dLng := dLat / math.Max(math.Cos(zone.Lat*math.Pi/180), 0.01)
+	area := Area{
+		MinLat: math.Max(zone.Lat-dLat, -90), MinLng: math.Max(zone.Lng-dLng, -180),
+		MaxLat: math.Min(zone.Lat+dLat, 90), MaxLng: math.Min(zone.Lng+dLng, 180),
+	}
+	if err := s.Invalidate(ctx, area); err != nil {
+		log.Printf("heatmap invalidation for privacy zone %s: %v", zone.ID, err)
+	}
+}
+
+func (s *Service) invalidateSession(ctx context.Context, sessionID string, publicOnly bool) {
+	var area Area
+	err := s.db.QueryRow(ctx, `
+		SELECT ST_YMin(e), ST_XMin(e), ST_YMax(e), ST_XMax(e)
+		FROM (
+		    SELECT ST_Extent(p.location::geometry) AS e
+		    FROM track_points p
+		    JOIN track_sessions s ON s.id = p.session_id
+		    WHERE p.session_id=$1 AND s.status IN ('ended', 'auto_closed') AND (NOT $2 OR s.visibility = 'public')
+		) extent
+		WHERE e IS NOT NULL
+	`, sessionID, publicOnly).Scan(&area.MinLat, &area.MinLng, &area.MaxLat, &area.MaxLng)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return
+	}
+	if err == nil {
+		err = s.Invalidate(ctx, area)
+	}
+	if err != nil {
+		log.Printf("heatmap invalidation for session %s: %v", sessionID, err)
+	}
+}
+
+// Invalidate drops the cached tiles overlapping area at every zoom, or the
+// whole cache when that is too many tiles.
+func (s *Service) Invalidate(ctx context.Context, area Area) error {
+	tiles, ok := tilesCovering(area, maxInvalidateTiles)
+	if !ok {
+		return s.cache.Clear(ctx)
+	}
+	keys := make([]string, len(tiles))
+	for i, t := range tiles {
+		keys[i] = t.Key()
+	}
+	return s.cache.Delete(ctx, keys...)
+}
@@ -0,0 +1,138 @@
+package heatmap
+
+import (
+	"bytes"
+	"context"
+	"image/png"
+	"testing"
+	"time"
+
+	"backend-summithub/internal/privacy"
+	"backend-summithub/internal/tracking"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v3"
+)
+
+func newMock(t *testing.T) pgxmock.PgxPoolIface {
+	t.Helper()
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	t.Cleanup(mock.Close)
+	return mock
+}
+
+func expectBins(mock pgxmock.PgxPoolIface, tile Tile, bins ...Bin) {
+	minX, minY, maxX, maxY := tile.Bounds()
+	rows := pgxmock.NewRows([]string{"px", "py", "sessions"})
+	for _, b := range bins {
+		rows.AddRow(b.X, b.Y, b.Sessions)
+	}
+	mock.ExpectQuery(`WHERE s.visibility = 'public' AND s.status IN \('ended', 'auto_closed'\)`).
+		WithArgs(minX, minY, maxX, maxY, tile.PixelSize(), 2*maxGapM, maxGapM, TileSize-1).
+		WillReturnRows(rows)
+}
+
+func TestTileRendersAndCaches(t *testing.T) {
+	mock := newMock(t)
+	cache := NewCache(nil, t.TempDir(), time.Hour)
+	svc := NewService(mock, cache)
+	tile := Tile{Z: 12, X: 3304, Y: 2133, Format: FormatPNG}
+	expectBins(mock, tile, Bin{X: 5, Y: 6, Sessions: 12})
+
+	first, err := svc.Tile(context.Background(), tile)
+	if err != nil {
+		t.Fatalf("tile: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(first))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if _, _, _, a := img.At(5, 6).RGBA(); a == 0 {
+		t.Fatalf("expected heat at the bin")
+	}
+	// The second request is served from the cache without a query.
+	second, err := svc.Tile(context.Background(), tile)
+	if err != nil || !bytes.Equal(first, second) {
+		t.Fatalf("expected the cached tile, got %v", err)
+	}
+
+	mvt := tile
+	mvt.Format = FormatMVT
+	expectBins(mock, mvt)
+	if data, err := svc.Tile(context.Background(), mvt); err != nil || len(data) == 0 {
+		t.Fatalf("mvt: %d bytes, %v", len(data), err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
+
+func TestSessionChangesInvalidateTiles(t *testing.T) {
+	mock := newMock(t)
+	cache := NewCache(nil, t.TempDir(), time.Hour)
+	svc := NewService(mock, cache)
+	ctx := context.Background()
+
+	inside := Tile{Z: 12, X: 3304, Y: 2133, Format: FormatPNG}
+	elsewhere := Tile{Z: 12, X: 100, Y: 100, Format: FormatPNG}
+	for _, tile := range []Tile{inside, elsewhere} {
+		_ = cache.Set(ctx, tile.Key(), []byte("old"))
+	}
+
+	extentCols := []string{"min_lat", "min_lng", "max_lat", "max_lng"}
+	mock.ExpectQuery(`SELECT ST_Extent\(p.location::geometry\)`).
+		WithArgs("session-1", true).
+		WillReturnRows(pgxmock.NewRows(extentCols).AddRow(-7.46, 110.43, -7.45, 110.44))
+	// A private session has no public extent.
+	mock.ExpectQuery(`SELECT ST_Extent`).
+		WithArgs("session-2", true).
+		WillReturnError(pgx.ErrNoRows)
+	mock.ExpectQuery(`SELECT ST_Extent`).
+		WithArgs("session-3", false).
+		WillReturnRows(pgxmock.NewRows(extentCols).AddRow(-9.0, 105.0, -5.0, 115.0))
+
+	svc.SessionEnded(ctx, tracking.Session{ID: "session-1"})
+	if _, ok, _ := cache.Get(ctx, inside.Key()); ok {
+		t.Fatalf("expected the tile under the session to be dropped")
+	}
+	if _, ok, _ := cache.Get(ctx, elsewhere.Key()); !ok {
+		t.Fatalf("expected other tiles to stay")
+	}
+
+	svc.SessionEnded(ctx, tracking.Session{ID: "session-2"})
+	if _, ok, _ := cache.Get(ctx, elsewhere.Key()); !ok {
+		t.Fatalf("expected a private session to leave the cache alone")
+	}
+
+	// Too many tiles to delete one by one: everything goes.
+	svc.VisibilityChanged(ctx, tracking.Session{ID: "session-3"})
+	if _, ok, _ := cache.Get(ctx, elsewhere.Key()); ok {
+		t.Fatalf("expected the cache to be cleared")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
+
+func TestZoneChangeInvalidatesTiles(t *testing.T) {
+	cache := NewCache(nil, t.TempDir(), time.Hour)
+	svc := NewService(newMock(t), cache)
+	ctx := context.Background()
+
+	inside := Tile{Z: 12, X: 3304, Y: 2133, Format: FormatMVT}
+	elsewhere := Tile{Z: 12, X: 100, Y: 100, Format: FormatMVT}
+	for _, tile := range []Tile{inside, elsewhere} {
+		_ = cache.Set(ctx, tile.Key(), []byte("old"))
+	}
+
+	svc.ZoneChanged(ctx, privacy.Zone{ID: "zone-1", Lat: -7.455, Lng: 110.435, RadiusM: 500})
+	if _, ok, _ := cache.Get(ctx, inside.Key()); ok {
+		t.Fatalf("expected the tile under the zone to be dropped")
+	}
+	if _, ok, _ := cache.Get(ctx, elsewhere.Key()); !ok {
+		t.Fatalf("expected other tiles to stay")
+	}
+}
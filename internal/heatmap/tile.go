@@ -0,0 +1,123 @@
+package heatmap
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Tile formats.
+const (
+	FormatPNG = "png"
+	FormatMVT = "mvt"
+)
+
+const (
+	// TileSize is the width and height of a tile in pixels; heat is
+	// aggregated per pixel.
+	TileSize = 256
+	// MinZoom is the widest zoom served. A tile is rendered from the raw
+	// points under it, so wider tiles would scan whole regions per request;
+	// map clients overzoom out from here.
+	MinZoom = 8
+	// MaxZoom is the deepest zoom served.
+	MaxZoom = 17
+	// mercatorExtent is half the width of the Web Mercator plane in metres.
+	mercatorExtent = 20037508.342789244
+)
+
+var ErrInvalidTile = errors.New("tile must be {z}/{x}/{y}.png or .mvt within zoom 8 to 17")
+
+// Tile addresses one XYZ tile in Web Mercator.
+type Tile struct {
+	Z, X, Y int
+	Format  string
+}
+
+// ParseTile reads z, x and y path segments; y carries the format extension.
+// .pbf is accepted for MVT.
+func ParseTile(z, x, y string) (Tile, error) {
+	yValue, ext, ok := strings.Cut(y, ".")
+	if !ok {
+		return Tile{}, ErrInvalidTile
+	}
+	t := Tile{Format: ext}
+	if ext == "pbf" {
+		t.Format = FormatMVT
+	}
+	var errs [3]error
+	t.Z, errs[0] = strconv.Atoi(z)
+	t.X, errs[1] = strconv.Atoi(x)
+	t.Y, errs[2] = strconv.Atoi(yValue)
+	if errors.Join(errs[:]...) != nil || !t.valid() {
+		return Tile{}, ErrInvalidTile
+	}
+	return t, nil
+}
+
+func (t Tile) valid() bool {
+	if t.Format != FormatPNG && t.Format != FormatMVT {
+		return false
+	}
+	n := 1 << t.Z
+	return t.Z >= MinZoom && t.Z <= MaxZoom && t.X >= 0 && t.X < n && t.Y >= 0 && t.Y < n
+}
+
+// Key identifies the tile in the cache.
+func (t Tile) Key() string {
+	return fmt.Sprintf("%d/%d/%d.%s", t.Z, t.X, t.Y, t.Format)
+}
+
+// Bounds returns the tile's Web Mercator (EPSG:3857) bounds in metres.
+func (t Tile) Bounds() (minX, minY, maxX, maxY float64) {
+	size := t.span()
+	minX = -mercatorExtent + float64(t.X)*size
+	maxY = mercatorExtent - float64(t.Y)*size
+	return minX, maxY - size, minX + size, maxY
+}
+
+// PixelSize is the width of one tile pixel in Web Mercator metres.
+func (t Tile) PixelSize() float64 {
+	return t.span() / TileSize
+}
+
+func (t Tile) span() float64 {
+	return 2 * mercatorExtent / float64(int(1)<<t.Z)
+}
+
+// tileAt returns the x and y of the tile containing lat, lng at zoom z.
+func tileAt(lat, lng float64, z int) (int, int) {
+	n := float64(int(1) << z)
+	lat = math.Max(-85.0511, math.Min(85.0511, lat))
+	x := int(math.Floor((lng + 180) / 360 * n))
+	rad := lat * math.Pi / 180
+	y := int(math.Floor((1 - math.Log(math.Tan(rad)+1/math.Cos(rad))/math.Pi) / 2 * n))
+	clamp := func(v int) int { return max(0, min(int(n)-1, v)) }
+	return clamp(x), clamp(y)
+}
+
+// Area is a latitude/longitude bounding box.
+type Area struct {
+	MinLat, MinLng, MaxLat, MaxLng float64
+}
+
+// tilesCovering lists the tiles of every served zoom that overlap a, in
+// both formats, or reports false when there are more than limit.
+func tilesCovering(a Area, limit int) ([]Tile, bool) {
+	var tiles []Tile
+	for z := MinZoom; z <= MaxZoom; z++ {
+		x0, y0 := tileAt(a.MaxLat, a.MinLng, z)
+		x1, y1 := tileAt(a.MinLat, a.MaxLng, z)
+		if len(tiles)+2*(x1-x0+1)*(y1-y0+1) > limit {
+			return nil, false
+		}
+		for x := x0; x <= x1; x++ {
+			for y := y0; y <= y1; y++ {
+				tiles = append(tiles, Tile{Z: z, X: x, Y: y, Format: FormatPNG}, Tile{Z: z, X: x, Y: y, Format: FormatMVT})
+			}
+		}
+	}
+	return tiles, true
+}
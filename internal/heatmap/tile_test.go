@@ -0,0 +1,72 @@
+package heatmap
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParseTile(t *testing.T) {
+	cases := map[[3]string]Tile{
+		{"12", "3301", "2124.png"}: {Z: 12, X: 3301, Y: 2124, Format: FormatPNG},
+		{"8", "0", "0.mvt"}:        {Z: 8, X: 0, Y: 0, Format: FormatMVT},
+		{"17", "25", "16.pbf"}:     {Z: 17, X: 25, Y: 16, Format: FormatMVT},
+	}
+	for in, want := range cases {
+		got, err := ParseTile(in[0], in[1], in[2])
+		if err != nil || got != want {
+			t.Fatalf("%v: expected %+v, got %+v %v", in, want, got, err)
+		}
+	}
+	for _, in := range [][3]string{
+		{"12", "3301", "2124"},
+		{"12", "3301", "2124.jpg"},
+		{"18", "0", "0.png"},
+		// wider zooms would scan whole regions per tile
+		{"0", "0", "0.png"},
+		{"7", "0", "0.png"},
+		{"8", "256", "0.png"},
+		{"8", "-1", "0.png"},
+		{"a", "0", "0.png"},
+	} {
+		if _, err := ParseTile(in[0], in[1], in[2]); !errors.Is(err, ErrInvalidTile) {
+			t.Fatalf("%v: expected ErrInvalidTile, got %v", in, err)
+		}
+	}
+}
+
+func TestTileBounds(t *testing.T) {
+	minX, minY, maxX, maxY := Tile{Z: 1, X: 1, Y: 0}.Bounds()
+	if minX != 0 || maxX != mercatorExtent || minY != 0 || maxY != mercatorExtent {
+		t.Fatalf("unexpected bounds %v %v %v %v", minX, minY, maxX, maxY)
+	}
+	if size := (Tile{Z: 0}).PixelSize(); math.Abs(size-2*mercatorExtent/256) > 1e-6 {
+		t.Fatalf("unexpected pixel size %v", size)
+	}
+}
+
+func TestTileAt(t *testing.T) {
+	// Puncak Merbabu.
+	if x, y := tileAt(-7.455, 110.44, 12); x != 3304 || y != 2133 {
+		t.Fatalf("unexpected tile %d/%d", x, y)
+	}
+	if x, y := tileAt(89, 180, 3); x != 7 || y != 0 {
+		t.Fatalf("expected the edges to be clamped, got %d/%d", x, y)
+	}
+}
+
+func TestTilesCovering(t *testing.T) {
+	small := Area{MinLat: -7.46, MinLng: 110.43, MaxLat: -7.45, MaxLng: 110.44}
+	tiles, ok := tilesCovering(small, maxInvalidateTiles)
+	if !ok || len(tiles) < 2*(MaxZoom-MinZoom+1) {
+		t.Fatalf("expected every served zoom, got %d tiles", len(tiles))
+	}
+	x, y := tileAt(-7.45, 110.43, MinZoom)
+	if tiles[0] != (Tile{Z: MinZoom, X: x, Y: y, Format: FormatPNG}) || tiles[1].Format != FormatMVT {
+		t.Fatalf("expected both formats of the widest served tile first, got %+v", tiles[:2])
+	}
+	java := Area{MinLat: -8.8, MinLng: 105, MaxLat: -5.8, MaxLng: 114.6}
+	if _, ok := tilesCovering(java, maxInvalidateTiles); ok {
+		t.Fatalf("expected an island-wide area to exceed the limit")
+	}
+}
@@ -0,0 +1,78 @@
+package mountain
+
+import "github.com/gofiber/fiber/v2"
+
+// RegisterRoutes mounts the mountain catalog. Adding entries additionally
+// passes through publisherMiddleware, which restricts it to park authorities
+// and admins.
+func RegisterRoutes(r fiber.Router, svc *Service, authMiddleware, publisherMiddleware fiber.Handler) {
+	r.Post("/", authMiddleware, publisherMiddleware, func(c *fiber.Ctx) error {
+		var req Mountain
+		if err := c.BodyParser(&req); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		if req.Name == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "name required")
+		}
+		if req.Status != "" && !validStatus(req.Status) {
+			return fiber.NewError(fiber.StatusBadRequest, "status must be open, closed or restricted")
+		}
+		m, err := svc.CreateMountain(c.Context(), req)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		}
+		return c.Status(fiber.StatusCreated).JSON(m)
+	})
+
+	r.Get("/", func(c *fiber.Ctx) error {
+		mountains, err := svc.List(c.Context())
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		}
+		return c.JSON(mountains)
+	})
+
+	r.Get("/search", func(c *fiber.Ctx) error {
+		q := c.Query("q")
+		if q == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "q required")
+		}
+		mountains, err := svc.Search(c.Context(), q)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		}
+		return c.JSON(mountains)
+	})
+
+	r.Get("/:id", func(c *fiber.Ctx) error {
+		m, err := svc.GetMountain(c.Context(), c.Params("id"))
+		if err != nil {
+			return fiber.NewError(fiber.StatusNotFound, "mountain not found")
+		}
+		return c.JSON(m)
+	})
+
+	r.Get("/:id/trips", func(c *fiber.Ctx) error {
+		trips, err := svc.Trips(c.Context(), c.Params("id"))
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		}
+		return c.JSON(trips)
+	})
+
+	r.Get("/:id/routes", func(c *fiber.Ctx) error {
+		routes, err := svc.Routes(c.Context(), c.Params("id"))
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		}
+		return c.JSON(routes)
+	})
+
+	r.Get("/:id/waypoints", func(c *fiber.Ctx) error {
+		waypoints, err := svc.Waypoints(c.Context(), c.Params("id"))
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		}
+		return c.JSON(waypoints)
+	})
+}
@@ -0,0 +1,136 @@
+package mountain
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pashagolub/pgxmock/v3"
+)
+
+func TestMountainHandlers(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	mock.ExpectQuery(`INSERT INTO mountains`).
+		WithArgs(pgxmock.AnyArg(), "Merbabu", []string{}, 110.44, -7.454, 3145.0, "", "open", "").
+		WillReturnRows(pgxmock.NewRows([]string{"created_at"}).AddRow(time.Now()))
+
+	mock.ExpectQuery(`FROM mountains ORDER BY name`).
+		WillReturnRows(pgxmock.NewRows(mountainCols).
+			AddRow("mountain-1", "Merbabu", []string{}, -7.454, 110.44, 3145.0, "", "open", "", time.Now()))
+
+	mock.ExpectQuery(`FROM mountains WHERE name ILIKE`).
+		WithArgs("merb").
+		WillReturnRows(pgxmock.NewRows(mountainCols))
+
+	mock.ExpectQuery(`FROM mountains WHERE id=\$1`).
+		WithArgs("mountain-1").
+		WillReturnRows(pgxmock.NewRows(mountainCols).
+			AddRow("mountain-1", "Merbabu", []string{}, -7.454, 110.44, 3145.0, "", "open", "", time.Now()))
+
+	mock.ExpectQuery(`FROM trips`).
+		WithArgs("mountain-1").
+		WillReturnRows(pgxmock.NewRows([]string{"id", "name", "mountain_name", "start_date", "end_date", "description", "created_by", "created_at"}))
+
+	mock.ExpectQuery(`FROM gpx_routes`).
+		WithArgs("mountain-1").
+		WillReturnRows(pgxmock.NewRows([]string{"id", "trip_id", "name", "description", "total_distance_m", "total_elevation_gain_m", "route", "uploaded_by", "created_at"}))
+
+	mock.ExpectQuery(`FROM waypoints`).
+		WithArgs("mountain-1", defaultRadiusM).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "name", "description", "type", "lat", "lng", "elevation_m", "created_by", "is_verified", "created_at"}))
+
+	app := fiber.New()
+	RegisterRoutes(app.Group("/mountains"), NewService(mock), passThrough, passThrough)
+
+	body, _ := json.Marshal(Mountain{Name: "Merbabu", Lat: -7.454, Lng: 110.44, ElevationM: 3145})
+	req := httptest.NewRequest(http.MethodPost, "/mountains/", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	if err != nil || resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create status: %v", err)
+	}
+
+	for _, path := range []string{
+		"/mountains/",
+		"/mountains/search?q=merb",
+		"/mountains/mountain-1",
+		"/mountains/mountain-1/trips",
+		"/mountains/mountain-1/routes",
+		"/mountains/mountain-1/waypoints",
+	} {
+		resp, err = app.Test(httptest.NewRequest(http.MethodGet, path, nil))
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s status: %v", path, err)
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestMountainHandlersBadRequest(t *testing.T) {
+	app := fiber.New()
+	RegisterRoutes(app.Group("/mountains"), NewService(nil), passThrough, passThrough)
+
+	req := httptest.NewRequest(http.MethodPost, "/mountains/", bytes.NewReader([]byte(`{"name":"Semeru","status":"erupting"}`)))
+	req.Header.Set("Content-Type", "application/json")
+	resp, _ := app.Test(req)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected bad request for invalid status")
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/mountains/", bytes.NewReader([]byte(`{}`)))
+	req.Header.Set("Content-Type", "application/json")
+	resp, _ = app.Test(req)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected bad request for missing name")
+	}
+
+	resp, _ = app.Test(httptest.NewRequest(http.MethodGet, "/mountains/search", nil))
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected bad request for missing q")
+	}
+}
+
+func TestMountainHandlersNotFound(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	mock.ExpectQuery(`FROM mountains WHERE id=\$1`).WithArgs("missing").WillReturnError(errMountain)
+
+	app := fiber.New()
+	RegisterRoutes(app.Group("/mountains"), NewService(mock), passThrough, passThrough)
+
+	resp, _ := app.Test(httptest.NewRequest(http.MethodGet, "/mountains/missing", nil))
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected not found")
+	}
+}
+
+func passThrough(c *fiber.Ctx) error { return c.Next() }
+
+func TestMountainHandlersPublisherOnly(t *testing.T) {
+	app := fiber.New()
+	deny := func(c *fiber.Ctx) error { return fiber.NewError(fiber.StatusForbidden, "insufficient role") }
+	RegisterRoutes(app.Group("/mountains"), NewService(nil), passThrough, deny)
+
+	req := httptest.NewRequest(http.MethodPost, "/mountains/", bytes.NewReader([]byte(`{"name":"Semeru"}`)))
+	req.Header.Set("Content-Type", "application/json")
+	resp, _ := app.Test(req)
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected forbidden")
+	}
+}
@@ -0,0 +1,30 @@
+package mountain
+
+import "time"
+
+type Mountain struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Aliases     []string  `json:"aliases"`
+	Lat         float64   `json:"lat"`
+	Lng         float64   `json:"lng"`
+	ElevationM  float64   `json:"elevation_m"`
+	Region      string    `json:"region"`
+	Status      string    `json:"status"`
+	BoundaryWKT string    `json:"boundary"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+const (
+	StatusOpen       = "open"
+	StatusClosed     = "closed"
+	StatusRestricted = "restricted"
+)
+
+func validStatus(status string) bool {
+	switch status {
+	case StatusOpen, StatusClosed, StatusRestricted:
+		return true
+	}
+	return false
+}
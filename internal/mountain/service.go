@@ -0,0 +1,186 @@
+package mountain
+
+import (
+	"context"
+	"errors"
+
+	"backend-summithub/internal/db"
+	"backend-summithub/internal/trip"
+	"backend-summithub/internal/waypoint"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+type Service struct {
+	db db.Querier
+}
+
+func NewService(db db.Querier) *Service {
+	return &Service{db: db}
+}
+
+const mountainColumns = `id, name, aliases, ST_Y(summit::geometry), ST_X(summit::geometry), COALESCE(elevation_m,0),
+		       COALESCE(region,''), status, COALESCE(ST_AsText(boundary),''), created_at`
+
+func (s *Service) CreateMountain(ctx context.Context, input Mountain) (Mountain, error) {
+	if input.Status == "" {
+		input.Status = StatusOpen
+	}
+	if !validStatus(input.Status) {
+		return Mountain{}, errors.New("invalid mountain status")
+	}
+	if input.Aliases == nil {
+		input.Aliases = []string{}
+	}
+	input.ID = uuid.NewString()
+	row := s.db.QueryRow(ctx, `
+		INSERT INTO mountains (id, name, aliases, summit, elevation_m, region, status, boundary)
+		VALUES ($1,$2,$3, ST_SetSRID(ST_MakePoint($4,$5), 4326)::geography, $6, $7, $8, ST_GeogFromText(NULLIF($9,'')))
+		RETURNING created_at
+	`, input.ID, input.Name, input.Aliases, input.Lng, input.Lat, input.ElevationM, input.Region, input.Status, input.BoundaryWKT)
+	if err := row.Scan(&input.CreatedAt); err != nil {
+		return Mountain{}, err
+	}
+	return input, nil
+}
+
+func (s *Service) GetMountain(ctx context.Context, id string) (Mountain, error) {
+	row := s.db.QueryRow(ctx, `
+		SELECT `+mountainColumns+`
+		FROM mountains WHERE id=$1
+	`, id)
+	var m Mountain
+	if err := row.Scan(&m.ID, &m.Name, &m.Aliases, &m.Lat, &m.Lng, &m.ElevationM, &m.Region, &m.Status, &m.BoundaryWKT, &m.CreatedAt); err != nil {
+		return Mountain{}, err
+	}
+	return m, nil
+}
+
+func (s *Service) List(ctx context.Context) ([]Mountain, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT `+mountainColumns+`
+		FROM mountains
+		ORDER BY name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	return scanMountains(rows)
+}
+
+// Search matches mountains by name or alias, case-insensitively.
+func (s *Service) Search(ctx context.Context, query string) ([]Mountain, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT `+mountainColumns+`
+		FROM mountains
+		WHERE name ILIKE '%' || $1 || '%'
+		   OR EXISTS (SELECT 1 FROM unnest(aliases) AS a WHERE a ILIKE '%' || $1 || '%')
+		ORDER BY (lower(name) = lower($1)) DESC, name
+	`, query)
+	if err != nil {
+		return nil, err
+	}
+	return scanMountains(rows)
+}
+
+// Trips returns trips linked to the mountain, including legacy trips that
+// only carry a matching free-text mountain name.
+func (s *Service) Trips(ctx context.Context, mountainID string) ([]trip.Trip, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT id, name, COALESCE(mountain_name,''), start_date, end_date, COALESCE(description,''), created_by, created_at
+		FROM trips
+		WHERE mountain_id = $1
+		   OR (mountain_id IS NULL AND resolve_mountain_id(mountain_name) = $1)
+		ORDER BY start_date DESC NULLS LAST, created_at DESC
+	`, mountainID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var trips []trip.Trip
+	for rows.Next() {
+		var t trip.Trip
+		if err := rows.Scan(&t.ID, &t.Name, &t.Mountain, &t.StartDate, &t.EndDate, &t.Description, &t.CreatedBy, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		t.MountainID = mountainID
+		trips = append(trips, t)
+	}
+	return trips, nil
+}
+
+// Routes returns GPX routes uploaded to trips on the mountain or crossing its boundary.
+func (s *Service) Routes(ctx context.Context, mountainID string) ([]trip.GPXRoute, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT r.id, r.trip_id, r.name, r.description, r.total_distance_m, r.total_elevation_gain_m, ST_AsText(r.route), r.uploaded_by, r.created_at
+		FROM gpx_routes r
+		JOIN mountains m ON m.id = $1
+		LEFT JOIN trips t ON t.id = r.trip_id
+		WHERE t.mountain_id = m.id
+		   OR (m.boundary IS NOT NULL AND ST_Intersects(r.route, m.boundary))
+		ORDER BY r.created_at DESC
+	`, mountainID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var routes []trip.GPXRoute
+	for rows.Next() {
+		var r trip.GPXRoute
+		if err := rows.Scan(&r.ID, &r.TripID, &r.Name, &r.Description, &r.TotalDistanceM, &r.TotalElevationGainM, &r.RouteWKT, &r.UploadedBy, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		routes = append(routes, r)
+	}
+	return routes, nil
+}
+
+// Waypoints returns waypoints inside the mountain's park boundary, falling
+// back to a radius around the summit when no boundary is recorded.
+func (s *Service) Waypoints(ctx context.Context, mountainID string) ([]waypoint.Waypoint, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT w.id, w.name, w.description, w.type, ST_Y(w.location::geometry), ST_X(w.location::geometry),
+		       COALESCE(w.elevation_m,0), w.created_by, w.is_verified, w.created_at
+		FROM waypoints w
+		JOIN mountains m ON m.id = $1
+		WHERE CASE
+		        WHEN m.boundary IS NOT NULL THEN ST_Covers(m.boundary, w.location)
+		        ELSE ST_DWithin(m.summit, w.location, $2)
+		      END
+		ORDER BY w.created_at DESC
+	`, mountainID, defaultRadiusM)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []waypoint.Waypoint
+	for rows.Next() {
+		var wp waypoint.Waypoint
+		if err := rows.Scan(&wp.ID, &wp.Name, &wp.Description, &wp.Type, &wp.Lat, &wp.Lng, &wp.ElevationM, &wp.CreatedBy, &wp.IsVerified, &wp.CreatedAt); err != nil {
+			return nil, err
+		}
+		results = append(results, wp)
+	}
+	return results, nil
+}
+
+// defaultRadiusM bounds mountain lookups for mountains without a park boundary.
+const defaultRadiusM = 8000.0
+
+func scanMountains(rows pgx.Rows) ([]Mountain, error) {
+	defer rows.Close()
+
+	var mountains []Mountain
+	for rows.Next() {
+		var m Mountain
+		if err := rows.Scan(&m.ID, &m.Name, &m.Aliases, &m.Lat, &m.Lng, &m.ElevationM, &m.Region, &m.Status, &m.BoundaryWKT, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		mountains = append(mountains, m)
+	}
+	return mountains, nil
+}
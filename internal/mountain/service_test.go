@@ -0,0 +1,167 @@
+package mountain
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pashagolub/pgxmock/v3"
+)
+
+var mountainCols = []string{"id", "name", "aliases", "lat", "lng", "elevation_m", "region", "status", "boundary", "created_at"}
+
+func TestCreateGetListSearchMountain(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	svc := NewService(mock)
+
+	mock.ExpectQuery(`INSERT INTO mountains`).
+		WithArgs(pgxmock.AnyArg(), "Semeru", []string{"Mahameru"}, 112.922, -8.108, 3676.0, "East Java", "open", "").
+		WillReturnRows(pgxmock.NewRows([]string{"created_at"}).AddRow(time.Now()))
+
+	m, err := svc.CreateMountain(context.Background(), Mountain{
+		Name:       "Semeru",
+		Aliases:    []string{"Mahameru"},
+		Lat:        -8.108,
+		Lng:        112.922,
+		ElevationM: 3676,
+		Region:     "East Java",
+	})
+	if err != nil {
+		t.Fatalf("create mountain: %v", err)
+	}
+	if m.Status != StatusOpen {
+		t.Fatalf("expected default open status")
+	}
+
+	mock.ExpectQuery(`SELECT id, name, aliases`).
+		WithArgs(m.ID).
+		WillReturnRows(pgxmock.NewRows(mountainCols).
+			AddRow(m.ID, "Semeru", []string{"Mahameru"}, -8.108, 112.922, 3676.0, "East Java", "open", "", time.Now()))
+
+	loaded, err := svc.GetMountain(context.Background(), m.ID)
+	if err != nil || loaded.Name != "Semeru" {
+		t.Fatalf("get mountain: %v", err)
+	}
+
+	mock.ExpectQuery(`FROM mountains ORDER BY name`).
+		WillReturnRows(pgxmock.NewRows(mountainCols).
+			AddRow(m.ID, "Semeru", []string{"Mahameru"}, -8.108, 112.922, 3676.0, "East Java", "open", "", time.Now()))
+
+	list, err := svc.List(context.Background())
+	if err != nil || len(list) != 1 {
+		t.Fatalf("list mountains: %v", err)
+	}
+
+	mock.ExpectQuery(`FROM mountains WHERE name ILIKE`).
+		WithArgs("mahameru").
+		WillReturnRows(pgxmock.NewRows(mountainCols).
+			AddRow(m.ID, "Semeru", []string{"Mahameru"}, -8.108, 112.922, 3676.0, "East Java", "open", "", time.Now()))
+
+	found, err := svc.Search(context.Background(), "mahameru")
+	if err != nil || len(found) != 1 {
+		t.Fatalf("search mountains: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestCreateMountainInvalidStatus(t *testing.T) {
+	svc := NewService(nil)
+	if _, err := svc.CreateMountain(context.Background(), Mountain{Name: "Semeru", Status: "erupting"}); err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
+func TestMountainTripsRoutesWaypoints(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	svc := NewService(mock)
+
+	mock.ExpectQuery(`FROM trips WHERE mountain_id = \$1 OR \(mountain_id IS NULL AND resolve_mountain_id\(mountain_name\) = \$1\)`).
+		WithArgs("mountain-1").
+		WillReturnRows(pgxmock.NewRows([]string{"id", "name", "mountain_name", "start_date", "end_date", "description", "created_by", "created_at"}).
+			AddRow("trip-1", "Trip", "semeru", time.Now(), time.Now(), "desc", "user-1", time.Now()))
+
+	trips, err := svc.Trips(context.Background(), "mountain-1")
+	if err != nil || len(trips) != 1 {
+		t.Fatalf("trips: %v", err)
+	}
+	if trips[0].MountainID != "mountain-1" {
+		t.Fatalf("expected legacy trip linked to mountain")
+	}
+
+	mock.ExpectQuery(`FROM gpx_routes r JOIN mountains m`).
+		WithArgs("mountain-1").
+		WillReturnRows(pgxmock.NewRows([]string{"id", "trip_id", "name", "description", "total_distance_m", "total_elevation_gain_m", "route", "uploaded_by", "created_at"}).
+			AddRow("route-1", "trip-1", "Route", "desc", 100.0, 10.0, "LINESTRING(0 0,1 1)", "user-1", time.Now()))
+
+	routes, err := svc.Routes(context.Background(), "mountain-1")
+	if err != nil || len(routes) != 1 {
+		t.Fatalf("routes: %v", err)
+	}
+
+	mock.ExpectQuery(`FROM waypoints w JOIN mountains m`).
+		WithArgs("mountain-1", defaultRadiusM).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "name", "description", "type", "lat", "lng", "elevation_m", "created_by", "is_verified", "created_at"}).
+			AddRow("wp-1", "Kalimati", "camp", "camp", -8.08, 112.92, 2700.0, "user-1", true, time.Now()))
+
+	waypoints, err := svc.Waypoints(context.Background(), "mountain-1")
+	if err != nil || len(waypoints) != 1 {
+		t.Fatalf("waypoints: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestMountainQueryErrors(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	svc := NewService(mock)
+
+	mock.ExpectQuery(`FROM mountains ORDER BY name`).WillReturnError(errMountain)
+	if _, err := svc.List(context.Background()); err == nil {
+		t.Fatalf("expected list error")
+	}
+
+	mock.ExpectQuery(`FROM mountains WHERE name ILIKE`).
+		WithArgs("x").
+		WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow("mountain-1"))
+	if _, err := svc.Search(context.Background(), "x"); err == nil {
+		t.Fatalf("expected scan error")
+	}
+
+	mock.ExpectQuery(`FROM trips`).WithArgs("mountain-1").WillReturnError(errMountain)
+	if _, err := svc.Trips(context.Background(), "mountain-1"); err == nil {
+		t.Fatalf("expected trips error")
+	}
+
+	mock.ExpectQuery(`FROM gpx_routes`).WithArgs("mountain-1").WillReturnError(errMountain)
+	if _, err := svc.Routes(context.Background(), "mountain-1"); err == nil {
+		t.Fatalf("expected routes error")
+	}
+
+	mock.ExpectQuery(`FROM waypoints`).WithArgs("mountain-1", defaultRadiusM).WillReturnError(errMountain)
+	if _, err := svc.Waypoints(context.Background(), "mountain-1"); err == nil {
+		t.Fatalf("expected waypoints error")
+	}
+}
+
+var errMountain = errors.New("mountain error")
@@ -0,0 +1,53 @@
+package notice
+
+import "github.com/gofiber/fiber/v2"
+
+// RegisterRoutes mounts the notice endpoints. Publishing and ending notices
+// additionally pass through publisherMiddleware, which restricts them to park
+// authorities and admins.
+func RegisterRoutes(r fiber.Router, svc *Service, authMiddleware, publisherMiddleware fiber.Handler) {
+	r.Post("/", authMiddleware, publisherMiddleware, func(c *fiber.Ctx) error {
+		var req Notice
+		if err := c.BodyParser(&req); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		if req.MountainID == "" && req.AreaWKT == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "mountain_id or area required")
+		}
+		if !validStatus(req.Status) {
+			return fiber.NewError(fiber.StatusBadRequest, "status must be open, closed, restricted or quota_reached")
+		}
+		if userID, ok := c.Locals("user_id").(string); ok {
+			req.CreatedBy = userID
+		}
+		n, err := svc.Publish(c.Context(), req)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		}
+		return c.Status(fiber.StatusCreated).JSON(n)
+	})
+
+	r.Get("/", func(c *fiber.Ctx) error {
+		notices, err := svc.List(c.Context(), c.Query("mountain_id"), c.QueryBool("active"))
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		}
+		return c.JSON(notices)
+	})
+
+	r.Get("/:id", func(c *fiber.Ctx) error {
+		n, err := svc.GetNotice(c.Context(), c.Params("id"))
+		if err != nil {
+			return fiber.NewError(fiber.StatusNotFound, "notice not found")
+		}
+		return c.JSON(n)
+	})
+
+	r.Post("/:id/end", authMiddleware, publisherMiddleware, func(c *fiber.Ctx) error {
+		n, err := svc.End(c.Context(), c.Params("id"))
+		if err != nil {
+			return fiber.NewError(fiber.StatusNotFound, "active notice not found")
+		}
+		return c.JSON(n)
+	})
+}
@@ -0,0 +1,101 @@
+package notice
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pashagolub/pgxmock/v3"
+)
+
+func passThrough(c *fiber.Ctx) error { return c.Next() }
+
+func TestNoticeHandlers(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	now := time.Now()
+	mock.ExpectQuery(`INSERT INTO area_status_notices`).
+		WithArgs(pgxmock.AnyArg(), "mountain-1", "", "closed", "eruption", pgxmock.AnyArg(), pgxmock.AnyArg(), "ranger").
+		WillReturnRows(pgxmock.NewRows([]string{"created_at"}).AddRow(now))
+	mock.ExpectExec(`INSERT INTO notifications`).
+		WithArgs(pgxmock.AnyArg()).
+		WillReturnResult(pgxmock.NewResult("INSERT", 0))
+	mock.ExpectQuery(`FROM area_notices`).
+		WithArgs("mountain-1", true).
+		WillReturnRows(pgxmock.NewRows(noticeCols))
+	mock.ExpectQuery(`FROM area_status_notices WHERE id=\$1`).
+		WithArgs("notice-1").
+		WillReturnRows(pgxmock.NewRows(noticeCols).
+			AddRow("notice-1", "mountain-1", "", "closed", "eruption", now, nil, "ranger", now))
+	mock.ExpectQuery(`UPDATE area_status_notices`).
+		WithArgs("notice-1").
+		WillReturnRows(pgxmock.NewRows(noticeCols).
+			AddRow("notice-1", "mountain-1", "", "closed", "eruption", now, &now, "ranger", now))
+
+	app := fiber.New()
+	setUser := func(c *fiber.Ctx) error {
+		c.Locals("user_id", "ranger")
+		return c.Next()
+	}
+	RegisterRoutes(app.Group("/notices"), NewService(mock), setUser, passThrough)
+
+	req := httptest.NewRequest(http.MethodPost, "/notices/", bytes.NewReader([]byte(`{"mountain_id":"mountain-1","status":"closed","reason":"eruption"}`)))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	if err != nil || resp.StatusCode != http.StatusCreated {
+		t.Fatalf("publish status: %v", err)
+	}
+
+	resp, err = app.Test(httptest.NewRequest(http.MethodGet, "/notices/?mountain_id=mountain-1&active=true", nil))
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("list status: %v", err)
+	}
+
+	resp, err = app.Test(httptest.NewRequest(http.MethodGet, "/notices/notice-1", nil))
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("get status: %v", err)
+	}
+
+	resp, err = app.Test(httptest.NewRequest(http.MethodPost, "/notices/notice-1/end", nil))
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("end status: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestNoticeHandlersValidation(t *testing.T) {
+	app := fiber.New()
+	RegisterRoutes(app.Group("/notices"), NewService(nil), passThrough, passThrough)
+
+	for _, body := range []string{`{`, `{"status":"closed"}`, `{"mountain_id":"m","status":"erupting"}`} {
+		req := httptest.NewRequest(http.MethodPost, "/notices/", bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", "application/json")
+		resp, _ := app.Test(req)
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("expected bad request for %s", body)
+		}
+	}
+}
+
+func TestNoticeHandlersPublisherOnly(t *testing.T) {
+	app := fiber.New()
+	deny := func(c *fiber.Ctx) error { return fiber.NewError(fiber.StatusForbidden, "insufficient role") }
+	RegisterRoutes(app.Group("/notices"), NewService(nil), passThrough, deny)
+
+	req := httptest.NewRequest(http.MethodPost, "/notices/", bytes.NewReader([]byte(`{"mountain_id":"m","status":"closed"}`)))
+	req.Header.Set("Content-Type", "application/json")
+	resp, _ := app.Test(req)
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected forbidden")
+	}
+}
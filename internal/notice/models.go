@@ -0,0 +1,33 @@
+package notice
+
+import "time"
+
+// Notice is a park authority announcement that changes access to a mountain
+// or to an arbitrary area polygon for a period of time.
+type Notice struct {
+	ID         string     `json:"id"`
+	MountainID string     `json:"mountain_id,omitempty"`
+	AreaWKT    string     `json:"area,omitempty"`
+	Status     string     `json:"status"`
+	Reason     string     `json:"reason"`
+	StartsAt   time.Time  `json:"starts_at"`
+	EndsAt     *time.Time `json:"ends_at,omitempty"`
+	CreatedBy  string     `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Notified   int64      `json:"notified,omitempty"`
+}
+
+const (
+	StatusOpen         = "open"
+	StatusClosed       = "closed"
+	StatusRestricted   = "restricted"
+	StatusQuotaReached = "quota_reached"
+)
+
+func validStatus(status string) bool {
+	switch status {
+	case StatusOpen, StatusClosed, StatusRestricted, StatusQuotaReached:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,201 @@
+package notice
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"backend-summithub/internal/db"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrAreaClosed is returned when an operation targets an area closed by a notice.
+var ErrAreaClosed = errors.New("area closed by status notice")
+
+type Service struct {
+	db db.Querier
+}
+
+func NewService(db db.Querier) *Service {
+	return &Service{db: db}
+}
+
+const noticeColumns = `id, COALESCE(mountain_id::text,''), COALESCE(ST_AsText(area),''), status, COALESCE(reason,''),
+		       starts_at, ends_at, COALESCE(created_by::text,''), created_at`
+
+// Publish stores a notice and notifies members of upcoming trips it affects.
+func (s *Service) Publish(ctx context.Context, input Notice) (Notice, error) {
+	if input.MountainID == "" && input.AreaWKT == "" {
+		return Notice{}, errors.New("mountain_id or area required")
+	}
+	if !validStatus(input.Status) {
+		return Notice{}, errors.New("invalid notice status")
+	}
+	if input.StartsAt.IsZero() {
+		input.StartsAt = time.Now()
+	}
+	if input.EndsAt != nil && !input.EndsAt.After(input.StartsAt) {
+		return Notice{}, errors.New("ends_at must be after starts_at")
+	}
+
+	input.ID = uuid.NewString()
+	row := s.db.QueryRow(ctx, `
+		INSERT INTO area_status_notices (id, mountain_id, area, status, reason, starts_at, ends_at, created_by)
+		VALUES ($1, NULLIF($2,'')::uuid, ST_GeogFromText(NULLIF($3,'')), $4, $5, $6, $7, NULLIF($8,'')::uuid)
+		RETURNING created_at
+	`, input.ID, input.MountainID, input.AreaWKT, input.Status, input.Reason, input.StartsAt, input.EndsAt, input.CreatedBy)
+	if err := row.Scan(&input.CreatedAt); err != nil {
+		return Notice{}, err
+	}
+
+	notified, err := s.notifyAffectedTrips(ctx, input.ID)
+	if err != nil {
+		return Notice{}, err
+	}
+	input.Notified = notified
+	return input, nil
+}
+
+// notifyAffectedTrips queues a notification for every member of a trip that
+// has not finished yet and overlaps the notice in both area and time.
+func (s *Service) notifyAffectedTrips(ctx context.Context, noticeID string) (int64, error) {
+	tag, err := s.db.Exec(ctx, `
+		INSERT INTO notifications (id, user_id, kind, payload)
+		SELECT gen_random_uuid(), a.user_id, 'area_status_notice',
+		       jsonb_build_object(
+		           'notice_id', n.id, 'status', n.status, 'reason', n.reason,
+		           'starts_at', n.starts_at, 'ends_at', n.ends_at,
+		           'trip_id', a.trip_id, 'trip_name', a.trip_name)
+		FROM area_notices n
+		JOIN LATERAL (
+		    SELECT DISTINCT t.id AS trip_id, t.name AS trip_name, u.user_id
+		    FROM trips t
+		    JOIN mountains m ON m.id = t.mountain_id
+		    CROSS JOIN LATERAL (
+		        SELECT tm.user_id FROM trip_members tm WHERE tm.trip_id = t.id
+		        UNION
+		        SELECT t.created_by
+		    ) u
+		    WHERE (t.mountain_id = n.mountain_id
+		           OR ST_Intersects(n.effective_area, COALESCE(m.boundary, ST_Buffer(m.summit, 8000))))
+		      AND COALESCE(t.end_date, t.start_date, CURRENT_DATE) >= CURRENT_DATE
+		      AND (t.start_date IS NULL OR n.ends_at IS NULL OR t.start_date < n.ends_at)
+		      AND COALESCE(t.end_date, t.start_date, CURRENT_DATE) + 1 > n.starts_at
+		) a ON a.user_id IS NOT NULL
+		WHERE n.id = $1
+	`, noticeID)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// End closes a notice early by setting its end time to now.
+func (s *Service) End(ctx context.Context, id string) (Notice, error) {
+	row := s.db.QueryRow(ctx, `
+		UPDATE area_status_notices
+		SET ends_at = GREATEST(NOW(), starts_at + INTERVAL '1 second')
+		WHERE id=$1 AND (ends_at IS NULL OR ends_at > NOW())
+		RETURNING `+noticeColumns+`
+	`, id)
+	return scanNotice(row)
+}
+
+func (s *Service) GetNotice(ctx context.Context, id string) (Notice, error) {
+	row := s.db.QueryRow(ctx, `
+		SELECT `+noticeColumns+`
+		FROM area_status_notices WHERE id=$1
+	`, id)
+	return scanNotice(row)
+}
+
+// List returns notices, optionally limited to one mountain and to those in effect now.
+func (s *Service) List(ctx context.Context, mountainID string, activeOnly bool) ([]Notice, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT `+noticeColumns+`
+		FROM area_notices
+		WHERE ($1 = '' OR mountain_id = NULLIF($1,'')::uuid
+		       OR ST_Intersects(effective_area, (SELECT COALESCE(boundary, ST_Buffer(summit, 8000)) FROM mountains WHERE id = NULLIF($1,'')::uuid)))
+		  AND (NOT $2 OR (starts_at <= NOW() AND (ends_at IS NULL OR ends_at > NOW())))
+		ORDER BY starts_at DESC
+	`, mountainID, activeOnly)
+	if err != nil {
+		return nil, err
+	}
+	return scanNotices(rows)
+}
+
+// ForMountain returns notices overlapping [from, to) that apply to a mountain,
+// identified by id or, for legacy callers, by free-text name. The most severe
+// notices come first.
+func (s *Service) ForMountain(ctx context.Context, mountainID, mountainName string, from, to time.Time) ([]Notice, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT n.id, COALESCE(n.mountain_id::text,''), COALESCE(ST_AsText(n.area),''), n.status, COALESCE(n.reason,''),
+		       n.starts_at, n.ends_at, COALESCE(n.created_by::text,''), n.created_at
+		FROM area_notices n
+		JOIN mountains m ON m.id = COALESCE(NULLIF($1,'')::uuid, resolve_mountain_id($2))
+		WHERE (n.mountain_id = m.id OR ST_Intersects(n.effective_area, COALESCE(m.boundary, ST_Buffer(m.summit, 8000))))
+		  AND n.starts_at < $4
+		  AND (n.ends_at IS NULL OR n.ends_at > $3)
+		ORDER BY n.severity DESC, n.starts_at
+	`, mountainID, mountainName, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return scanNotices(rows)
+}
+
+// ForTrip returns notices in effect at the given time for the mountain a trip targets.
+func (s *Service) ForTrip(ctx context.Context, tripID string, at time.Time) ([]Notice, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT n.id, COALESCE(n.mountain_id::text,''), COALESCE(ST_AsText(n.area),''), n.status, COALESCE(n.reason,''),
+		       n.starts_at, n.ends_at, COALESCE(n.created_by::text,''), n.created_at
+		FROM trips t
+		JOIN mountains m ON m.id = t.mountain_id
+		JOIN area_notices n
+		  ON n.mountain_id = m.id OR ST_Intersects(n.effective_area, COALESCE(m.boundary, ST_Buffer(m.summit, 8000)))
+		WHERE t.id = $1
+		  AND n.starts_at <= $2
+		  AND (n.ends_at IS NULL OR n.ends_at > $2)
+		ORDER BY n.severity DESC, n.starts_at
+	`, tripID, at)
+	if err != nil {
+		return nil, err
+	}
+	return scanNotices(rows)
+}
+
+// Check returns ErrAreaClosed when any of the notices closes the area.
+// Other statuses are advisory and are left to the caller to surface.
+func Check(notices []Notice) error {
+	for _, n := range notices {
+		if n.Status == StatusClosed {
+			return ErrAreaClosed
+		}
+	}
+	return nil
+}
+
+func scanNotice(row pgx.Row) (Notice, error) {
+	var n Notice
+	if err := row.Scan(&n.ID, &n.MountainID, &n.AreaWKT, &n.Status, &n.Reason, &n.StartsAt, &n.EndsAt, &n.CreatedBy, &n.CreatedAt); err != nil {
+		return Notice{}, err
+	}
+	return n, nil
+}
+
+func scanNotices(rows pgx.Rows) ([]Notice, error) {
+	defer rows.Close()
+
+	var notices []Notice
+	for rows.Next() {
+		n, err := scanNotice(rows)
+		if err != nil {
+			return nil, err
+		}
+		notices = append(notices, n)
+	}
+	return notices, nil
+}
@@ -0,0 +1,169 @@
+package notice
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pashagolub/pgxmock/v3"
+)
+
+var noticeCols = []string{"id", "mountain_id", "area", "status", "reason", "starts_at", "ends_at", "created_by", "created_at"}
+
+func TestPublishNotifiesAffectedTrips(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	mock.ExpectQuery(`INSERT INTO area_status_notices`).
+		WithArgs(pgxmock.AnyArg(), "mountain-1", "", "closed", "eruption", pgxmock.AnyArg(), pgxmock.AnyArg(), "ranger").
+		WillReturnRows(pgxmock.NewRows([]string{"created_at"}).AddRow(time.Now()))
+
+	mock.ExpectExec(`INSERT INTO notifications .* FROM area_notices n JOIN LATERAL`).
+		WithArgs(pgxmock.AnyArg()).
+		WillReturnResult(pgxmock.NewResult("INSERT", 4))
+
+	svc := NewService(mock)
+	n, err := svc.Publish(context.Background(), Notice{MountainID: "mountain-1", Status: StatusClosed, Reason: "eruption", CreatedBy: "ranger"})
+	if err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if n.Notified != 4 || n.StartsAt.IsZero() {
+		t.Fatalf("unexpected notice: %+v", n)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestPublishValidation(t *testing.T) {
+	svc := NewService(nil)
+	if _, err := svc.Publish(context.Background(), Notice{Status: StatusClosed}); err == nil {
+		t.Fatalf("expected error without mountain or area")
+	}
+	if _, err := svc.Publish(context.Background(), Notice{MountainID: "m", Status: "erupting"}); err == nil {
+		t.Fatalf("expected error for invalid status")
+	}
+	start := time.Now()
+	end := start.Add(-time.Hour)
+	if _, err := svc.Publish(context.Background(), Notice{MountainID: "m", Status: StatusClosed, StartsAt: start, EndsAt: &end}); err == nil {
+		t.Fatalf("expected error for inverted window")
+	}
+}
+
+func TestPublishErrors(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	svc := NewService(mock)
+
+	mock.ExpectQuery(`INSERT INTO area_status_notices`).WillReturnError(errNotice)
+	if _, err := svc.Publish(context.Background(), Notice{AreaWKT: "POLYGON((0 0,1 0,1 1,0 0))", Status: StatusRestricted}); err == nil {
+		t.Fatalf("expected insert error")
+	}
+
+	mock.ExpectQuery(`INSERT INTO area_status_notices`).
+		WillReturnRows(pgxmock.NewRows([]string{"created_at"}).AddRow(time.Now()))
+	mock.ExpectExec(`INSERT INTO notifications`).WillReturnError(errNotice)
+	if _, err := svc.Publish(context.Background(), Notice{AreaWKT: "POLYGON((0 0,1 0,1 1,0 0))", Status: StatusRestricted}); err == nil {
+		t.Fatalf("expected notify error")
+	}
+}
+
+func TestListGetEndNotice(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	svc := NewService(mock)
+	now := time.Now()
+
+	mock.ExpectQuery(`FROM area_notices WHERE`).
+		WithArgs("mountain-1", true).
+		WillReturnRows(pgxmock.NewRows(noticeCols).
+			AddRow("notice-1", "mountain-1", "", "closed", "eruption", now, nil, "ranger", now))
+
+	list, err := svc.List(context.Background(), "mountain-1", true)
+	if err != nil || len(list) != 1 || list[0].EndsAt != nil {
+		t.Fatalf("list: %v", err)
+	}
+
+	mock.ExpectQuery(`FROM area_status_notices WHERE id=\$1`).
+		WithArgs("notice-1").
+		WillReturnRows(pgxmock.NewRows(noticeCols).
+			AddRow("notice-1", "mountain-1", "", "closed", "eruption", now, nil, "ranger", now))
+
+	if _, err := svc.GetNotice(context.Background(), "notice-1"); err != nil {
+		t.Fatalf("get: %v", err)
+	}
+
+	ended := now.Add(time.Minute)
+	mock.ExpectQuery(`UPDATE area_status_notices`).
+		WithArgs("notice-1").
+		WillReturnRows(pgxmock.NewRows(noticeCols).
+			AddRow("notice-1", "mountain-1", "", "closed", "eruption", now, &ended, "ranger", now))
+
+	n, err := svc.End(context.Background(), "notice-1")
+	if err != nil || n.EndsAt == nil {
+		t.Fatalf("end: %v", err)
+	}
+
+	mock.ExpectQuery(`FROM area_notices`).WithArgs("", false).WillReturnError(errNotice)
+	if _, err := svc.List(context.Background(), "", false); err == nil {
+		t.Fatalf("expected list error")
+	}
+}
+
+func TestForMountainAndTrip(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	svc := NewService(mock)
+	now := time.Now()
+
+	mock.ExpectQuery(`FROM area_notices n JOIN mountains m`).
+		WithArgs("", "Semeru", now, now.Add(24*time.Hour)).
+		WillReturnRows(pgxmock.NewRows(noticeCols).
+			AddRow("notice-1", "mountain-1", "", "quota_reached", "full", now, nil, "ranger", now))
+
+	notices, err := svc.ForMountain(context.Background(), "", "Semeru", now, now.Add(24*time.Hour))
+	if err != nil || len(notices) != 1 {
+		t.Fatalf("for mountain: %v", err)
+	}
+	if Check(notices) != nil {
+		t.Fatalf("quota notice should not block")
+	}
+
+	mock.ExpectQuery(`FROM trips t JOIN mountains m`).
+		WithArgs("trip-1", now).
+		WillReturnRows(pgxmock.NewRows(noticeCols).
+			AddRow("notice-2", "", "POLYGON((0 0,1 0,1 1,0 0))", "closed", "crater", now, nil, "ranger", now))
+
+	notices, err = svc.ForTrip(context.Background(), "trip-1", now)
+	if err != nil || len(notices) != 1 {
+		t.Fatalf("for trip: %v", err)
+	}
+	if !errors.Is(Check(notices), ErrAreaClosed) {
+		t.Fatalf("closed notice should block")
+	}
+
+	mock.ExpectQuery(`FROM trips t`).WithArgs("trip-2", now).
+		WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow("notice-3"))
+	if _, err := svc.ForTrip(context.Background(), "trip-2", now); err == nil {
+		t.Fatalf("expected scan error")
+	}
+}
+
+var errNotice = errors.New("notice error")
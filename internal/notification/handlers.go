@@ -0,0 +1,29 @@
+package notification
+
+import "github.com/gofiber/fiber/v2"
+
+// RegisterRoutes mounts the inbox of the authenticated user.
+func RegisterRoutes(r fiber.Router, svc *Service, authMiddleware fiber.Handler) {
+	r.Get("/", authMiddleware, func(c *fiber.Ctx) error {
+		userID, _ := c.Locals("user_id").(string)
+		if userID == "" {
+			return fiber.NewError(fiber.StatusUnauthorized, "missing user")
+		}
+		notifications, err := svc.List(c.Context(), userID, c.QueryBool("unread"))
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		}
+		return c.JSON(notifications)
+	})
+
+	r.Post("/:id/read", authMiddleware, func(c *fiber.Ctx) error {
+		userID, _ := c.Locals("user_id").(string)
+		if userID == "" {
+			return fiber.NewError(fiber.StatusUnauthorized, "missing user")
+		}
+		if err := svc.MarkRead(c.Context(), c.Params("id"), userID); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		}
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+}
@@ -0,0 +1,53 @@
+package notification
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pashagolub/pgxmock/v3"
+)
+
+func TestNotificationHandlers(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	mock.ExpectQuery(`FROM notifications`).
+		WithArgs("user-1", true).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "user_id", "kind", "payload", "created_at", "read_at"}).
+			AddRow("n-1", "user-1", "area_status_notice", []byte(`{}`), time.Now(), nil))
+	mock.ExpectExec(`UPDATE notifications`).
+		WithArgs("n-1", "user-1").
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+	app := fiber.New()
+	RegisterRoutes(app.Group("/notifications"), NewService(mock), func(c *fiber.Ctx) error {
+		c.Locals("user_id", "user-1")
+		return c.Next()
+	})
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/notifications/?unread=true", nil))
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("list status: %v", err)
+	}
+
+	resp, err = app.Test(httptest.NewRequest(http.MethodPost, "/notifications/n-1/read", nil))
+	if err != nil || resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("read status: %v", err)
+	}
+}
+
+func TestNotificationHandlersRequireUser(t *testing.T) {
+	app := fiber.New()
+	RegisterRoutes(app.Group("/notifications"), NewService(nil), func(c *fiber.Ctx) error { return c.Next() })
+
+	resp, _ := app.Test(httptest.NewRequest(http.MethodGet, "/notifications/", nil))
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected unauthorized")
+	}
+}
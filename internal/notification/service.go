@@ -0,0 +1,72 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+
+	"backend-summithub/internal/db"
+
+	"github.com/google/uuid"
+)
+
+type Service struct {
+	db db.Querier
+}
+
+func NewService(db db.Querier) *Service {
+	return &Service{db: db}
+}
+
+func (s *Service) Notify(ctx context.Context, userID, kind string, payload any) (Notification, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return Notification{}, err
+	}
+	n := Notification{
+		ID:      uuid.NewString(),
+		UserID:  userID,
+		Kind:    kind,
+		Payload: body,
+	}
+	row := s.db.QueryRow(ctx, `
+		INSERT INTO notifications (id, user_id, kind, payload)
+		VALUES ($1,$2,$3,$4)
+		RETURNING created_at
+	`, n.ID, n.UserID, n.Kind, body)
+	if err := row.Scan(&n.CreatedAt); err != nil {
+		return Notification{}, err
+	}
+	return n, nil
+}
+
+func (s *Service) List(ctx context.Context, userID string, unreadOnly bool) ([]Notification, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT id, user_id, kind, payload, created_at, read_at
+		FROM notifications
+		WHERE user_id=$1 AND (NOT $2 OR read_at IS NULL)
+		ORDER BY created_at DESC
+		LIMIT 200
+	`, userID, unreadOnly)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notifications []Notification
+	for rows.Next() {
+		var n Notification
+		if err := rows.Scan(&n.ID, &n.UserID, &n.Kind, &n.Payload, &n.CreatedAt, &n.ReadAt); err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, nil
+}
+
+func (s *Service) MarkRead(ctx context.Context, id, userID string) error {
+	_, err := s.db.Exec(ctx, `
+		UPDATE notifications SET read_at = NOW()
+		WHERE id=$1 AND user_id=$2 AND read_at IS NULL
+	`, id, userID)
+	return err
+}
@@ -0,0 +1,77 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pashagolub/pgxmock/v3"
+)
+
+func TestNotifyListMarkRead(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	svc := NewService(mock)
+
+	mock.ExpectQuery(`INSERT INTO notifications`).
+		WithArgs(pgxmock.AnyArg(), "user-1", "area_status_notice", []byte(`{"status":"closed"}`)).
+		WillReturnRows(pgxmock.NewRows([]string{"created_at"}).AddRow(time.Now()))
+
+	n, err := svc.Notify(context.Background(), "user-1", "area_status_notice", map[string]string{"status": "closed"})
+	if err != nil || n.ID == "" {
+		t.Fatalf("notify: %v", err)
+	}
+
+	mock.ExpectQuery(`SELECT id, user_id, kind, payload, created_at, read_at`).
+		WithArgs("user-1", true).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "user_id", "kind", "payload", "created_at", "read_at"}).
+			AddRow(n.ID, "user-1", "area_status_notice", []byte(`{"status":"closed"}`), time.Now(), nil))
+
+	list, err := svc.List(context.Background(), "user-1", true)
+	if err != nil || len(list) != 1 {
+		t.Fatalf("list: %v", err)
+	}
+
+	mock.ExpectExec(`UPDATE notifications SET read_at`).
+		WithArgs(n.ID, "user-1").
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+	if err := svc.MarkRead(context.Background(), n.ID, "user-1"); err != nil {
+		t.Fatalf("mark read: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestNotificationErrors(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	svc := NewService(mock)
+
+	if _, err := svc.Notify(context.Background(), "user-1", "bad", make(chan int)); err == nil {
+		t.Fatalf("expected marshal error")
+	}
+
+	mock.ExpectQuery(`INSERT INTO notifications`).WillReturnError(errNotification)
+	if _, err := svc.Notify(context.Background(), "user-1", "kind", nil); err == nil {
+		t.Fatalf("expected insert error")
+	}
+
+	mock.ExpectQuery(`FROM notifications`).WithArgs("user-1", false).WillReturnError(errNotification)
+	if _, err := svc.List(context.Background(), "user-1", false); err == nil {
+		t.Fatalf("expected list error")
+	}
+}
+
+var errNotification = errors.New("notification error")
@@ -0,0 +1,144 @@
+package permit
+
+import (
+	"errors"
+	"time"
+
+	"backend-summithub/internal/notice"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+)
+
+// maxAvailabilityDays bounds the range a single availability request may span.
+const maxAvailabilityDays = 62
+
+// RegisterRoutes mounts the permit endpoints. Trailheads and their quotas are
+// managed by park authorities through publisherMiddleware; bookings are made
+// by trip members.
+func RegisterRoutes(r fiber.Router, svc *Service, authMiddleware, publisherMiddleware fiber.Handler) {
+	r.Post("/trailheads", authMiddleware, publisherMiddleware, func(c *fiber.Ctx) error {
+		var req Trailhead
+		if err := c.BodyParser(&req); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		if req.Name == "" || req.DailyQuota < 0 {
+			return fiber.NewError(fiber.StatusBadRequest, "name and non-negative daily_quota required")
+		}
+		th, err := svc.CreateTrailhead(c.Context(), req)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		}
+		return c.Status(fiber.StatusCreated).JSON(th)
+	})
+
+	r.Get("/trailheads", func(c *fiber.Ctx) error {
+		trailheads, err := svc.Trailheads(c.Context(), c.Query("mountain_id"))
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		}
+		return c.JSON(trailheads)
+	})
+
+	r.Get("/trailheads/:id/availability", func(c *fiber.Ctx) error {
+		from := dateOnly(time.Now())
+		if v := c.Query("from"); v != "" {
+			parsed, err := time.Parse("2006-01-02", v)
+			if err != nil {
+				return fiber.NewError(fiber.StatusBadRequest, "from must be YYYY-MM-DD")
+			}
+			from = parsed
+		}
+		to := from.AddDate(0, 0, 13)
+		if v := c.Query("to"); v != "" {
+			parsed, err := time.Parse("2006-01-02", v)
+			if err != nil {
+				return fiber.NewError(fiber.StatusBadRequest, "to must be YYYY-MM-DD")
+			}
+			to = parsed
+		}
+		if to.Before(from) || to.Sub(from) > maxAvailabilityDays*24*time.Hour {
+			return fiber.NewError(fiber.StatusBadRequest, "to must be within 62 days after from")
+		}
+		days, err := svc.Availability(c.Context(), c.Params("id"), from, to)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		}
+		return c.JSON(days)
+	})
+
+	r.Post("/bookings", authMiddleware, func(c *fiber.Ctx) error {
+		var req BookingRequest
+		if err := c.BodyParser(&req); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		if req.TripID == "" || req.TrailheadID == "" || req.ClimbDate.IsZero() {
+			return fiber.NewError(fiber.StatusBadRequest, "trip_id, trailhead_id and climb_date required")
+		}
+		if userID, ok := c.Locals("user_id").(string); ok {
+			req.RequestedBy = userID
+		}
+		booking, err := svc.Book(c.Context(), req)
+		if err != nil {
+			switch {
+			case errors.Is(err, ErrNotFound):
+				return fiber.NewError(fiber.StatusNotFound, err.Error())
+			case errors.Is(err, ErrNotTripMember):
+				return fiber.NewError(fiber.StatusForbidden, err.Error())
+			case errors.Is(err, ErrWrongMountain):
+				return fiber.NewError(fiber.StatusBadRequest, err.Error())
+			case errors.Is(err, ErrDuplicateBooking), errors.Is(err, notice.ErrAreaClosed):
+				return fiber.NewError(fiber.StatusConflict, err.Error())
+			}
+			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		}
+		return c.Status(fiber.StatusCreated).JSON(booking)
+	})
+
+	r.Get("/bookings", authMiddleware, func(c *fiber.Ctx) error {
+		tripID := c.Query("trip_id")
+		if tripID == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "trip_id required")
+		}
+		userID, _ := c.Locals("user_id").(string)
+		bookings, err := svc.TripBookings(c.Context(), tripID, userID)
+		if errors.Is(err, ErrNotTripMember) {
+			return fiber.NewError(fiber.StatusForbidden, err.Error())
+		}
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		}
+		return c.JSON(bookings)
+	})
+
+	r.Get("/bookings/:code", authMiddleware, func(c *fiber.Ctx) error {
+		userID, _ := c.Locals("user_id").(string)
+		booking, err := svc.GetBooking(c.Context(), c.Params("code"), userID)
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return fiber.NewError(fiber.StatusNotFound, "booking not found")
+		case errors.Is(err, ErrNotTripMember):
+			return fiber.NewError(fiber.StatusForbidden, err.Error())
+		case err != nil:
+			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		}
+		return c.JSON(booking)
+	})
+
+	r.Post("/bookings/:id/cancel", authMiddleware, func(c *fiber.Ctx) error {
+		userID, _ := c.Locals("user_id").(string)
+		booking, err := svc.Cancel(c.Context(), c.Params("id"), userID)
+		if err != nil {
+			switch {
+			case errors.Is(err, pgx.ErrNoRows):
+				return fiber.NewError(fiber.StatusNotFound, "booking not found")
+			case errors.Is(err, ErrNotTripMember):
+				return fiber.NewError(fiber.StatusForbidden, err.Error())
+			case errors.Is(err, ErrAlreadyCancelled):
+				return fiber.NewError(fiber.StatusConflict, err.Error())
+			}
+			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		}
+		return c.JSON(booking)
+	})
+}
@@ -0,0 +1,143 @@
+package permit
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v3"
+)
+
+func passThrough(c *fiber.Ctx) error { return c.Next() }
+
+func TestPermitHandlers(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	now := time.Now()
+	day := time.Date(2026, 8, 17, 0, 0, 0, 0, time.UTC)
+	bookingCols := []string{"id", "trip_id", "trailhead_id", "climb_date", "party_size", "status", "booking_code", "created_by", "created_at", "cancelled_at", "waitlist_position", "members"}
+
+	mock.ExpectQuery(`INSERT INTO trailheads`).
+		WithArgs(pgxmock.AnyArg(), "mountain-1", "Cemoro Sewu", 110.1, -7.6, 150).
+		WillReturnRows(pgxmock.NewRows([]string{"created_at"}).AddRow(now))
+	mock.ExpectQuery(`FROM trailheads WHERE \$1 = ''`).
+		WithArgs("mountain-1").
+		WillReturnRows(pgxmock.NewRows([]string{"id", "mountain_id", "name", "lat", "lng", "daily_quota", "created_at"}).
+			AddRow("trailhead-1", "mountain-1", "Cemoro Sewu", -7.6, 110.1, 150, now))
+	mock.ExpectQuery(`generate_series`).
+		WithArgs("trailhead-1", day, day.AddDate(0, 0, 1)).
+		WillReturnRows(pgxmock.NewRows([]string{"day", "capacity", "booked", "waitlisted"}).
+			AddRow(day, 150, 150, 2).
+			AddRow(day.AddDate(0, 0, 1), 150, 10, 0))
+	mock.ExpectQuery(`WHERE b.id::text = \$1 OR b.booking_code = upper\(\$1\)`).
+		WithArgs("SH-AAAA-BBBB").
+		WillReturnRows(pgxmock.NewRows(bookingCols).
+			AddRow("booking-1", "trip-1", "trailhead-1", day, 2, StatusConfirmed, "SH-AAAA-BBBB", "user-1", now, nil, 0, []string{"user-1", "user-2"}))
+	expectMembers(mock, "user-1")
+	mock.ExpectQuery(`WHERE b.trip_id = \$1`).
+		WithArgs("trip-1").
+		WillReturnRows(pgxmock.NewRows(bookingCols))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM permit_bookings b WHERE id=\$1 FOR UPDATE`).
+		WithArgs("missing", "user-1").
+		WillReturnError(pgx.ErrNoRows)
+	mock.ExpectRollback()
+
+	app := fiber.New()
+	setUser := func(c *fiber.Ctx) error {
+		c.Locals("user_id", "user-1")
+		return c.Next()
+	}
+	RegisterRoutes(app.Group("/permits"), NewService(mock), setUser, passThrough)
+
+	req := httptest.NewRequest(http.MethodPost, "/permits/trailheads", bytes.NewReader([]byte(`{"mountain_id":"mountain-1","name":"Cemoro Sewu","lat":-7.6,"lng":110.1,"daily_quota":150}`)))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	if err != nil || resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create trailhead status: %v %v", err, resp.StatusCode)
+	}
+
+	resp, err = app.Test(httptest.NewRequest(http.MethodGet, "/permits/trailheads?mountain_id=mountain-1", nil))
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("list trailheads status: %v", err)
+	}
+
+	resp, err = app.Test(httptest.NewRequest(http.MethodGet, "/permits/trailheads/trailhead-1/availability?from=2026-08-17&to=2026-08-18", nil))
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("availability status: %v", err)
+	}
+
+	resp, err = app.Test(httptest.NewRequest(http.MethodGet, "/permits/trailheads/trailhead-1/availability?from=2026-08-17&to=2026-12-31", nil))
+	if err != nil || resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for long range: %v", err)
+	}
+
+	resp, err = app.Test(httptest.NewRequest(http.MethodGet, "/permits/bookings/SH-AAAA-BBBB", nil))
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("get booking status: %v", err)
+	}
+
+	resp, err = app.Test(httptest.NewRequest(http.MethodGet, "/permits/bookings?trip_id=trip-1", nil))
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("trip bookings status: %v", err)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/permits/bookings", bytes.NewReader([]byte(`{"trip_id":"trip-1"}`)))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err = app.Test(req)
+	if err != nil || resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for incomplete booking: %v", err)
+	}
+
+	resp, err = app.Test(httptest.NewRequest(http.MethodPost, "/permits/bookings/missing/cancel", nil))
+	if err != nil || resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 cancelling missing booking: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestPermitBookingReadsRequireOwnership(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	bookingCols := []string{"id", "trip_id", "trailhead_id", "climb_date", "party_size", "status", "booking_code", "created_by", "created_at", "cancelled_at", "waitlist_position", "members"}
+	mock.ExpectQuery(`WHERE b.id::text = \$1 OR b.booking_code = upper\(\$1\)`).
+		WithArgs("SH-AAAA-BBBB").
+		WillReturnRows(pgxmock.NewRows(bookingCols).
+			AddRow("booking-1", "trip-1", "trailhead-1", time.Now(), 1, StatusConfirmed, "SH-AAAA-BBBB", "user-1", time.Now(), nil, 0, []string{"user-1"}))
+	expectMembers(mock, "user-1")
+	expectMembers(mock, "user-1")
+
+	app := fiber.New()
+	setUser := func(c *fiber.Ctx) error {
+		c.Locals("user_id", "stranger")
+		return c.Next()
+	}
+	RegisterRoutes(app.Group("/permits"), NewService(mock), setUser, passThrough)
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/permits/bookings/SH-AAAA-BBBB", nil))
+	if err != nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403 for someone else's booking: %v", err)
+	}
+	resp, err = app.Test(httptest.NewRequest(http.MethodGet, "/permits/bookings?trip_id=trip-1", nil))
+	if err != nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403 for another trip's bookings: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
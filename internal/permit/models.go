@@ -0,0 +1,49 @@
+package permit
+
+import "time"
+
+type Trailhead struct {
+	ID         string    `json:"id"`
+	MountainID string    `json:"mountain_id"`
+	Name       string    `json:"name"`
+	Lat        float64   `json:"lat"`
+	Lng        float64   `json:"lng"`
+	DailyQuota int       `json:"daily_quota"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type BookingRequest struct {
+	TripID      string    `json:"trip_id"`
+	TrailheadID string    `json:"trailhead_id"`
+	ClimbDate   time.Time `json:"climb_date"`
+	RequestedBy string    `json:"-"`
+}
+
+type Booking struct {
+	ID               string     `json:"id"`
+	TripID           string     `json:"trip_id"`
+	TrailheadID      string     `json:"trailhead_id"`
+	ClimbDate        time.Time  `json:"climb_date"`
+	PartySize        int        `json:"party_size"`
+	Status           string     `json:"status"`
+	Code             string     `json:"booking_code"`
+	WaitlistPosition int        `json:"waitlist_position,omitempty"`
+	Members          []string   `json:"members"`
+	CreatedBy        string     `json:"created_by"`
+	CreatedAt        time.Time  `json:"created_at"`
+	CancelledAt      *time.Time `json:"cancelled_at,omitempty"`
+}
+
+type Availability struct {
+	Date       time.Time `json:"date"`
+	Capacity   int       `json:"capacity"`
+	Booked     int       `json:"booked"`
+	Remaining  int       `json:"remaining"`
+	Waitlisted int       `json:"waitlisted"`
+}
+
+const (
+	StatusConfirmed  = "confirmed"
+	StatusWaitlisted = "waitlisted"
+	StatusCancelled  = "cancelled"
+)
@@ -0,0 +1,156 @@
+package permit
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pashagolub/pgxmock/v3"
+)
+
+// TestBookLastSlotConditionalUpdate replays the race serially: the booking
+// whose conditional UPDATE claims the final slot is confirmed, and the one
+// whose UPDATE then matches no row is waitlisted rather than overbooked.
+func TestBookLastSlotConditionalUpdate(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	day := time.Date(2026, 8, 17, 0, 0, 0, 0, time.UTC)
+	for i, claimed := range []int64{1, 0} {
+		status := StatusConfirmed
+		if claimed == 0 {
+			status = StatusWaitlisted
+		}
+		expectBookingLookup(mock, "")
+		expectOpenArea(mock)
+		mock.ExpectBegin()
+		expectMembers(mock, "user-1")
+		mock.ExpectExec(`INSERT INTO trailhead_quota_days`).
+			WithArgs("trailhead-1", day).
+			WillReturnResult(pgxmock.NewResult("INSERT", 1-int64(i)))
+		mock.ExpectExec(`UPDATE trailhead_quota_days SET booked = booked \+ \$3 WHERE trailhead_id=\$1 AND day=\$2 AND booked \+ \$3 <= capacity`).
+			WithArgs("trailhead-1", day, 1).
+			WillReturnResult(pgxmock.NewResult("UPDATE", claimed))
+		mock.ExpectQuery(`INSERT INTO permit_bookings`).
+			WithArgs(pgxmock.AnyArg(), "trip-1", "trailhead-1", day, 1, status, pgxmock.AnyArg(), "user-1").
+			WillReturnRows(pgxmock.NewRows([]string{"seq", "created_at"}).AddRow(int64(i+1), time.Now()))
+		mock.ExpectExec(`INSERT INTO permit_booking_members`).
+			WithArgs(pgxmock.AnyArg(), []string{"user-1"}).
+			WillReturnResult(pgxmock.NewResult("INSERT", 1))
+		if claimed == 0 {
+			mock.ExpectQuery(`status='waitlisted' AND seq <= \$3`).
+				WithArgs("trailhead-1", day, int64(i+1)).
+				WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(1))
+		}
+		mock.ExpectCommit()
+	}
+
+	svc := NewService(mock)
+	req := BookingRequest{TripID: "trip-1", TrailheadID: "trailhead-1", ClimbDate: day, RequestedBy: "user-1"}
+	first, err := svc.Book(context.Background(), req)
+	if err != nil {
+		t.Fatalf("first book: %v", err)
+	}
+	second, err := svc.Book(context.Background(), req)
+	if err != nil {
+		t.Fatalf("second book: %v", err)
+	}
+	if first.Status != StatusConfirmed {
+		t.Fatalf("expected first booking confirmed, got %+v", first)
+	}
+	if second.Status != StatusWaitlisted || second.WaitlistPosition != 1 {
+		t.Fatalf("expected second booking waitlisted at 1, got %+v", second)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+// TestBookLastSlotRace runs two bookings for the final slot concurrently
+// against a real, migrated database. It is skipped unless
+// SUMMITHUB_TEST_POSTGRES_URL points at one.
+func TestBookLastSlotRace(t *testing.T) {
+	url := os.Getenv("SUMMITHUB_TEST_POSTGRES_URL")
+	if url == "" {
+		t.Skip("SUMMITHUB_TEST_POSTGRES_URL not set")
+	}
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, url)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer pool.Close()
+
+	userA, userB := uuid.NewString(), uuid.NewString()
+	tripA, tripB := uuid.NewString(), uuid.NewString()
+	trailheadID := uuid.NewString()
+	day := time.Now().AddDate(0, 1, 0)
+
+	seed := []struct {
+		sql  string
+		args []any
+	}{
+		{`INSERT INTO users (id, email, username, password_hash) VALUES ($1, $3, $5, 'x'), ($2, $4, $6, 'x')`,
+			[]any{userA, userB, userA + "@race.test", userB + "@race.test", "race-" + userA, "race-" + userB}},
+		{`INSERT INTO trips (id, name, created_by) VALUES ($1, 'race a', $3), ($2, 'race b', $4)`, []any{tripA, tripB, userA, userB}},
+		{`INSERT INTO trailheads (id, name, location, daily_quota) VALUES ($1, 'race', ST_SetSRID(ST_MakePoint(0,0), 4326)::geography, 1)`, []any{trailheadID}},
+	}
+	for _, s := range seed {
+		if _, err := pool.Exec(ctx, s.sql, s.args...); err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+	t.Cleanup(func() {
+		_, _ = pool.Exec(ctx, `DELETE FROM permit_bookings WHERE trailhead_id=$1`, trailheadID)
+		_, _ = pool.Exec(ctx, `DELETE FROM trailheads WHERE id=$1`, trailheadID)
+		_, _ = pool.Exec(ctx, `DELETE FROM trips WHERE id IN ($1, $2)`, tripA, tripB)
+		_, _ = pool.Exec(ctx, `DELETE FROM users WHERE id IN ($1, $2)`, userA, userB)
+	})
+
+	svc := NewService(pool)
+	requests := []BookingRequest{
+		{TripID: tripA, TrailheadID: trailheadID, ClimbDate: day, RequestedBy: userA},
+		{TripID: tripB, TrailheadID: trailheadID, ClimbDate: day, RequestedBy: userB},
+	}
+	results := make([]Booking, len(requests))
+	errs := make([]error, len(requests))
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i, req := range requests {
+		wg.Add(1)
+		go func(i int, req BookingRequest) {
+			defer wg.Done()
+			<-start
+			results[i], errs[i] = svc.Book(ctx, req)
+		}(i, req)
+	}
+	close(start)
+	wg.Wait()
+
+	statuses := map[string]int{}
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("book %d: %v", i, err)
+		}
+		statuses[results[i].Status]++
+	}
+	if statuses[StatusConfirmed] != 1 || statuses[StatusWaitlisted] != 1 {
+		t.Fatalf("expected one confirmed and one waitlisted booking, got %v", statuses)
+	}
+
+	var booked, capacity int
+	if err := pool.QueryRow(ctx, `SELECT booked, capacity FROM trailhead_quota_days WHERE trailhead_id=$1 AND day=$2`,
+		trailheadID, dateOnly(day)).Scan(&booked, &capacity); err != nil {
+		t.Fatalf("quota row: %v", err)
+	}
+	if booked != capacity {
+		t.Fatalf("expected quota exhausted, got booked=%d capacity=%d", booked, capacity)
+	}
+}
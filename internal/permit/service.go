@@ -0,0 +1,457 @@
+package permit
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"time"
+
+	"backend-summithub/internal/db"
+	"backend-summithub/internal/notice"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var (
+	ErrNotFound         = errors.New("trip or trailhead not found")
+	ErrNotTripMember    = errors.New("user is not a member of the trip")
+	ErrWrongMountain    = errors.New("trailhead is not on the trip's mountain")
+	ErrDuplicateBooking = errors.New("trip already holds a booking for this trailhead and date")
+	ErrAlreadyCancelled = errors.New("booking already cancelled")
+)
+
+type Service struct {
+	db      db.TxBeginner
+	notices *notice.Service
+}
+
+func NewService(db db.TxBeginner) *Service {
+	return &Service{db: db, notices: notice.NewService(db)}
+}
+
+func (s *Service) CreateTrailhead(ctx context.Context, input Trailhead) (Trailhead, error) {
+	if input.DailyQuota < 0 {
+		return Trailhead{}, errors.New("daily_quota must not be negative")
+	}
+	input.ID = uuid.NewString()
+	row := s.db.QueryRow(ctx, `
+		INSERT INTO trailheads (id, mountain_id, name, location, daily_quota)
+		VALUES ($1, NULLIF($2,'')::uuid, $3, ST_SetSRID(ST_MakePoint($4,$5), 4326)::geography, $6)
+		RETURNING created_at
+	`, input.ID, input.MountainID, input.Name, input.Lng, input.Lat, input.DailyQuota)
+	if err := row.Scan(&input.CreatedAt); err != nil {
+		return Trailhead{}, err
+	}
+	return input, nil
+}
+
+func (s *Service) Trailheads(ctx context.Context, mountainID string) ([]Trailhead, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT id, COALESCE(mountain_id::text,''), name, ST_Y(location::geometry), ST_X(location::geometry), daily_quota, created_at
+		FROM trailheads
+		WHERE $1 = '' OR mountain_id = NULLIF($1,'')::uuid
+		ORDER BY name
+	`, mountainID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var trailheads []Trailhead
+	for rows.Next() {
+		var t Trailhead
+		if err := rows.Scan(&t.ID, &t.MountainID, &t.Name, &t.Lat, &t.Lng, &t.DailyQuota, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		trailheads = append(trailheads, t)
+	}
+	return trailheads, nil
+}
+
+// Availability reports capacity, confirmed climbers and waitlisted groups per
+// day for the inclusive date range.
+func (s *Service) Availability(ctx context.Context, trailheadID string, from, to time.Time) ([]Availability, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT d::date, COALESCE(q.capacity, th.daily_quota), COALESCE(q.booked, 0),
+		       (SELECT COUNT(*) FROM permit_bookings b
+		        WHERE b.trailhead_id = th.id AND b.climb_date = d::date AND b.status = 'waitlisted')
+		FROM trailheads th
+		CROSS JOIN generate_series($2::date, $3::date, INTERVAL '1 day') AS d
+		LEFT JOIN trailhead_quota_days q ON q.trailhead_id = th.id AND q.day = d::date
+		WHERE th.id = $1
+		ORDER BY d
+	`, trailheadID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var days []Availability
+	for rows.Next() {
+		var a Availability
+		if err := rows.Scan(&a.Date, &a.Capacity, &a.Booked, &a.Waitlisted); err != nil {
+			return nil, err
+		}
+		a.Remaining = a.Capacity - a.Booked
+		days = append(days, a)
+	}
+	return days, nil
+}
+
+// Book reserves slots for every member of the trip on the climb date. When
+// the remaining quota cannot hold the whole party the booking is waitlisted.
+// The quota is taken with a single conditional UPDATE on the trailhead's day
+// row, so concurrent bookings for the last slots serialise on that row lock
+// and only one of them can succeed.
+func (s *Service) Book(ctx context.Context, req BookingRequest) (Booking, error) {
+	day := dateOnly(req.ClimbDate)
+
+	var trailheadMountain, tripMountain string
+	if err := s.db.QueryRow(ctx, `
+		SELECT COALESCE(th.mountain_id::text,''), COALESCE(t.mountain_id::text,'')
+		FROM trailheads th, trips t
+		WHERE th.id = $1 AND t.id = $2
+	`, req.TrailheadID, req.TripID).Scan(&trailheadMountain, &tripMountain); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Booking{}, ErrNotFound
+		}
+		return Booking{}, err
+	}
+	if tripMountain != "" && trailheadMountain != "" && tripMountain != trailheadMountain {
+		return Booking{}, ErrWrongMountain
+	}
+	if trailheadMountain != "" {
+		notices, err := s.notices.ForMountain(ctx, trailheadMountain, "", day, day.Add(24*time.Hour))
+		if err != nil {
+			return Booking{}, err
+		}
+		if err := notice.Check(notices); err != nil {
+			return Booking{}, err
+		}
+	}
+
+	code, err := newBookingCode()
+	if err != nil {
+		return Booking{}, err
+	}
+	booking := Booking{
+		ID:          uuid.NewString(),
+		TripID:      req.TripID,
+		TrailheadID: req.TrailheadID,
+		ClimbDate:   day,
+		Code:        code,
+		CreatedBy:   req.RequestedBy,
+	}
+
+	err = db.WithTx(ctx, s.db, func(tx pgx.Tx) error {
+		members, err := tripMembers(ctx, tx, req.TripID)
+		if err != nil {
+			return err
+		}
+		if !contains(members, req.RequestedBy) {
+			return ErrNotTripMember
+		}
+		booking.Members = members
+		booking.PartySize = len(members)
+
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO trailhead_quota_days (trailhead_id, day, capacity, booked)
+			SELECT id, $2, daily_quota, 0 FROM trailheads WHERE id=$1
+			ON CONFLICT (trailhead_id, day) DO NOTHING
+		`, req.TrailheadID, day); err != nil {
+			return err
+		}
+
+		taken, err := reserve(ctx, tx, req.TrailheadID, day, booking.PartySize)
+		if err != nil {
+			return err
+		}
+		booking.Status = StatusWaitlisted
+		if taken {
+			booking.Status = StatusConfirmed
+		}
+
+		var seq int64
+		if err := tx.QueryRow(ctx, `
+			INSERT INTO permit_bookings (id, trip_id, trailhead_id, climb_date, party_size, status, booking_code, created_by)
+			VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
+			RETURNING seq, created_at
+		`, booking.ID, booking.TripID, booking.TrailheadID, day, booking.PartySize, booking.Status, booking.Code, booking.CreatedBy).Scan(&seq, &booking.CreatedAt); err != nil {
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+				return ErrDuplicateBooking
+			}
+			return err
+		}
+
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO permit_booking_members (booking_id, user_id)
+			SELECT $1, m::uuid FROM unnest($2::text[]) AS m
+		`, booking.ID, booking.Members); err != nil {
+			return err
+		}
+
+		if booking.Status == StatusWaitlisted {
+			return tx.QueryRow(ctx, `
+				SELECT COUNT(*) FROM permit_bookings
+				WHERE trailhead_id=$1 AND climb_date=$2 AND status='waitlisted' AND seq <= $3
+			`, req.TrailheadID, day, seq).Scan(&booking.WaitlistPosition)
+		}
+		return nil
+	})
+	if err != nil {
+		return Booking{}, err
+	}
+	return booking, nil
+}
+
+// Cancel releases a booking. Freed slots are handed to waitlisted groups in
+// request order; the first group that does not fit stops the promotion so
+// larger groups are not starved by smaller ones behind them.
+func (s *Service) Cancel(ctx context.Context, bookingID, userID string) (Booking, error) {
+	var booking Booking
+	err := db.WithTx(ctx, s.db, func(tx pgx.Tx) error {
+		var isMember bool
+		row := tx.QueryRow(ctx, `
+			SELECT id, trip_id, trailhead_id, climb_date, party_size, status, booking_code, COALESCE(created_by::text,''), created_at,
+			       EXISTS (SELECT 1 FROM permit_booking_members m WHERE m.booking_id = b.id AND m.user_id::text = $2)
+			FROM permit_bookings b
+			WHERE id=$1
+			FOR UPDATE
+		`, bookingID, userID)
+		if err := row.Scan(&booking.ID, &booking.TripID, &booking.TrailheadID, &booking.ClimbDate, &booking.PartySize, &booking.Status, &booking.Code, &booking.CreatedBy, &booking.CreatedAt, &isMember); err != nil {
+			return err
+		}
+		if !isMember && booking.CreatedBy != userID {
+			return ErrNotTripMember
+		}
+		if booking.Status == StatusCancelled {
+			return ErrAlreadyCancelled
+		}
+		wasConfirmed := booking.Status == StatusConfirmed
+
+		if err := tx.QueryRow(ctx, `
+			UPDATE permit_bookings SET status='cancelled', cancelled_at=NOW()
+			WHERE id=$1
+			RETURNING status, cancelled_at
+		`, booking.ID).Scan(&booking.Status, &booking.CancelledAt); err != nil {
+			return err
+		}
+		if !wasConfirmed {
+			return nil
+		}
+
+		if _, err := tx.Exec(ctx, `
+			UPDATE trailhead_quota_days SET booked = booked - $3
+			WHERE trailhead_id=$1 AND day=$2
+		`, booking.TrailheadID, booking.ClimbDate, booking.PartySize); err != nil {
+			return err
+		}
+		return promoteWaitlist(ctx, tx, booking.TrailheadID, booking.ClimbDate)
+	})
+	if err != nil {
+		return Booking{}, err
+	}
+	return booking, nil
+}
+
+func promoteWaitlist(ctx context.Context, tx pgx.Tx, trailheadID string, day time.Time) error {
+	rows, err := tx.Query(ctx, `
+		SELECT id, party_size FROM permit_bookings
+		WHERE trailhead_id=$1 AND climb_date=$2 AND status='waitlisted'
+		ORDER BY seq
+		FOR UPDATE
+	`, trailheadID, day)
+	if err != nil {
+		return err
+	}
+	type waiting struct {
+		id        string
+		partySize int
+	}
+	var queue []waiting
+	for rows.Next() {
+		var w waiting
+		if err := rows.Scan(&w.id, &w.partySize); err != nil {
+			rows.Close()
+			return err
+		}
+		queue = append(queue, w)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	var promoted []string
+	for _, w := range queue {
+		taken, err := reserve(ctx, tx, trailheadID, day, w.partySize)
+		if err != nil {
+			return err
+		}
+		if !taken {
+			break
+		}
+		if _, err := tx.Exec(ctx, `UPDATE permit_bookings SET status='confirmed' WHERE id=$1`, w.id); err != nil {
+			return err
+		}
+		promoted = append(promoted, w.id)
+	}
+	if len(promoted) == 0 {
+		return nil
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO notifications (id, user_id, kind, payload)
+		SELECT gen_random_uuid(), m.user_id, 'permit_confirmed',
+		       jsonb_build_object('booking_id', b.id, 'booking_code', b.booking_code,
+		                          'trip_id', b.trip_id, 'trailhead_id', b.trailhead_id, 'climb_date', b.climb_date)
+		FROM permit_bookings b
+		JOIN permit_booking_members m ON m.booking_id = b.id
+		WHERE b.id::text = ANY($1::text[])
+	`, promoted)
+	return err
+}
+
+// reserve takes size slots from the trailhead's day quota if they are all
+// still available.
+func reserve(ctx context.Context, tx pgx.Tx, trailheadID string, day time.Time, size int) (bool, error) {
+	tag, err := tx.Exec(ctx, `
+		UPDATE trailhead_quota_days SET booked = booked + $3
+		WHERE trailhead_id=$1 AND day=$2 AND booked + $3 <= capacity
+	`, trailheadID, day, size)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func tripMembers(ctx context.Context, q db.Querier, tripID string) ([]string, error) {
+	rows, err := q.Query(ctx, `
+		SELECT user_id::text FROM trip_members WHERE trip_id=$1
+		UNION
+		SELECT created_by::text FROM trips WHERE id=$1 AND created_by IS NOT NULL
+	`, tripID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		members = append(members, id)
+	}
+	return members, rows.Err()
+}
+
+// GetBooking looks a booking up by id or booking code. Only its members,
+// its creator and members of its trip may read it.
+func (s *Service) GetBooking(ctx context.Context, idOrCode, userID string) (Booking, error) {
+	row := s.db.QueryRow(ctx, `
+		SELECT `+bookingColumns+`
+		FROM permit_bookings b
+		WHERE b.id::text = $1 OR b.booking_code = upper($1)
+	`, idOrCode)
+	booking, err := scanBooking(row)
+	if err != nil {
+		return Booking{}, err
+	}
+	if booking.CreatedBy == userID || contains(booking.Members, userID) {
+		return booking, nil
+	}
+	members, err := tripMembers(ctx, s.db, booking.TripID)
+	if err != nil {
+		return Booking{}, err
+	}
+	if !contains(members, userID) {
+		return Booking{}, ErrNotTripMember
+	}
+	return booking, nil
+}
+
+// TripBookings lists a trip's bookings for one of its members.
+func (s *Service) TripBookings(ctx context.Context, tripID, userID string) ([]Booking, error) {
+	members, err := tripMembers(ctx, s.db, tripID)
+	if err != nil {
+		return nil, err
+	}
+	if !contains(members, userID) {
+		return nil, ErrNotTripMember
+	}
+	rows, err := s.db.Query(ctx, `
+		SELECT `+bookingColumns+`
+		FROM permit_bookings b
+		WHERE b.trip_id = $1
+		ORDER BY b.climb_date, b.seq
+	`, tripID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bookings []Booking
+	for rows.Next() {
+		b, err := scanBooking(rows)
+		if err != nil {
+			return nil, err
+		}
+		bookings = append(bookings, b)
+	}
+	return bookings, nil
+}
+
+const bookingColumns = `b.id, b.trip_id, b.trailhead_id, b.climb_date, b.party_size, b.status, b.booking_code,
+		       COALESCE(b.created_by::text,''), b.created_at, b.cancelled_at,
+		       CASE WHEN b.status = 'waitlisted' THEN (
+		           SELECT COUNT(*) FROM permit_bookings w
+		           WHERE w.trailhead_id = b.trailhead_id AND w.climb_date = b.climb_date
+		             AND w.status = 'waitlisted' AND w.seq <= b.seq)
+		       ELSE 0 END,
+		       ARRAY(SELECT m.user_id::text FROM permit_booking_members m WHERE m.booking_id = b.id)`
+
+func scanBooking(row pgx.Row) (Booking, error) {
+	var b Booking
+	if err := row.Scan(&b.ID, &b.TripID, &b.TrailheadID, &b.ClimbDate, &b.PartySize, &b.Status, &b.Code, &b.CreatedBy, &b.CreatedAt, &b.CancelledAt, &b.WaitlistPosition, &b.Members); err != nil {
+		return Booking{}, err
+	}
+	return b, nil
+}
+
+// bookingCodeAlphabet leaves out characters that are easily confused when
+// read aloud at a ranger post (0/O, 1/I).
+const bookingCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+func newBookingCode() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	code := []byte("SH-XXXX-XXXX")
+	pos := []int{3, 4, 5, 6, 8, 9, 10, 11}
+	for i, b := range buf {
+		code[pos[i]] = bookingCodeAlphabet[int(b)%len(bookingCodeAlphabet)]
+	}
+	return string(code), nil
+}
+
+func dateOnly(t time.Time) time.Time {
+	if t.IsZero() {
+		t = time.Now()
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,283 @@
+package permit
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"backend-summithub/internal/notice"
+
+	"github.com/pashagolub/pgxmock/v3"
+)
+
+var noticeCols = []string{"id", "mountain_id", "area", "status", "reason", "starts_at", "ends_at", "created_by", "created_at"}
+
+func expectBookingLookup(mock pgxmock.PgxPoolIface, tripMountain string) {
+	mock.ExpectQuery(`FROM trailheads th, trips t`).
+		WithArgs("trailhead-1", "trip-1").
+		WillReturnRows(pgxmock.NewRows([]string{"th_mountain", "trip_mountain"}).AddRow("mountain-1", tripMountain))
+}
+
+func expectOpenArea(mock pgxmock.PgxPoolIface) {
+	mock.ExpectQuery(`FROM area_notices n`).
+		WithArgs("mountain-1", "", pgxmock.AnyArg(), pgxmock.AnyArg()).
+		WillReturnRows(pgxmock.NewRows(noticeCols))
+}
+
+func expectMembers(mock pgxmock.PgxPoolIface, members ...string) {
+	rows := pgxmock.NewRows([]string{"user_id"})
+	for _, m := range members {
+		rows.AddRow(m)
+	}
+	mock.ExpectQuery(`FROM trip_members WHERE trip_id=\$1`).
+		WithArgs("trip-1").
+		WillReturnRows(rows)
+}
+
+func TestBookConfirmed(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	day := time.Date(2026, 8, 17, 0, 0, 0, 0, time.UTC)
+	expectBookingLookup(mock, "mountain-1")
+	expectOpenArea(mock)
+	mock.ExpectBegin()
+	expectMembers(mock, "user-1", "user-2")
+	mock.ExpectExec(`INSERT INTO trailhead_quota_days`).
+		WithArgs("trailhead-1", day).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectExec(`UPDATE trailhead_quota_days SET booked = booked \+ \$3`).
+		WithArgs("trailhead-1", day, 2).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectQuery(`INSERT INTO permit_bookings`).
+		WithArgs(pgxmock.AnyArg(), "trip-1", "trailhead-1", day, 2, StatusConfirmed, pgxmock.AnyArg(), "user-1").
+		WillReturnRows(pgxmock.NewRows([]string{"seq", "created_at"}).AddRow(int64(1), time.Now()))
+	mock.ExpectExec(`INSERT INTO permit_booking_members`).
+		WithArgs(pgxmock.AnyArg(), []string{"user-1", "user-2"}).
+		WillReturnResult(pgxmock.NewResult("INSERT", 2))
+	mock.ExpectCommit()
+
+	svc := NewService(mock)
+	b, err := svc.Book(context.Background(), BookingRequest{
+		TripID: "trip-1", TrailheadID: "trailhead-1", ClimbDate: day.Add(9 * time.Hour), RequestedBy: "user-1",
+	})
+	if err != nil {
+		t.Fatalf("book: %v", err)
+	}
+	if b.Status != StatusConfirmed || b.PartySize != 2 || !strings.HasPrefix(b.Code, "SH-") || len(b.Code) != 12 {
+		t.Fatalf("unexpected booking: %+v", b)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestBookWaitlistedWhenQuotaFull(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	day := time.Date(2026, 8, 17, 0, 0, 0, 0, time.UTC)
+	expectBookingLookup(mock, "")
+	expectOpenArea(mock)
+	mock.ExpectBegin()
+	expectMembers(mock, "user-1")
+	mock.ExpectExec(`INSERT INTO trailhead_quota_days`).
+		WithArgs("trailhead-1", day).
+		WillReturnResult(pgxmock.NewResult("INSERT", 0))
+	mock.ExpectExec(`UPDATE trailhead_quota_days SET booked = booked \+ \$3`).
+		WithArgs("trailhead-1", day, 1).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+	mock.ExpectQuery(`INSERT INTO permit_bookings`).
+		WithArgs(pgxmock.AnyArg(), "trip-1", "trailhead-1", day, 1, StatusWaitlisted, pgxmock.AnyArg(), "user-1").
+		WillReturnRows(pgxmock.NewRows([]string{"seq", "created_at"}).AddRow(int64(7), time.Now()))
+	mock.ExpectExec(`INSERT INTO permit_booking_members`).
+		WithArgs(pgxmock.AnyArg(), []string{"user-1"}).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectQuery(`status='waitlisted' AND seq <= \$3`).
+		WithArgs("trailhead-1", day, int64(7)).
+		WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectCommit()
+
+	svc := NewService(mock)
+	b, err := svc.Book(context.Background(), BookingRequest{
+		TripID: "trip-1", TrailheadID: "trailhead-1", ClimbDate: day, RequestedBy: "user-1",
+	})
+	if err != nil {
+		t.Fatalf("book: %v", err)
+	}
+	if b.Status != StatusWaitlisted || b.WaitlistPosition != 3 {
+		t.Fatalf("unexpected booking: %+v", b)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestBookRejectsNonMember(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	expectBookingLookup(mock, "mountain-1")
+	expectOpenArea(mock)
+	mock.ExpectBegin()
+	expectMembers(mock, "user-1")
+	mock.ExpectRollback()
+
+	svc := NewService(mock)
+	_, err = svc.Book(context.Background(), BookingRequest{
+		TripID: "trip-1", TrailheadID: "trailhead-1", ClimbDate: time.Now(), RequestedBy: "stranger",
+	})
+	if !errors.Is(err, ErrNotTripMember) {
+		t.Fatalf("expected ErrNotTripMember, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestBookRejectsClosedArea(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	now := time.Now()
+	expectBookingLookup(mock, "mountain-1")
+	mock.ExpectQuery(`FROM area_notices n`).
+		WithArgs("mountain-1", "", pgxmock.AnyArg(), pgxmock.AnyArg()).
+		WillReturnRows(pgxmock.NewRows(noticeCols).
+			AddRow("notice-1", "mountain-1", "", "closed", "eruption", now, nil, "ranger", now))
+
+	svc := NewService(mock)
+	_, err = svc.Book(context.Background(), BookingRequest{
+		TripID: "trip-1", TrailheadID: "trailhead-1", ClimbDate: now, RequestedBy: "user-1",
+	})
+	if !errors.Is(err, notice.ErrAreaClosed) {
+		t.Fatalf("expected area closed error, got %v", err)
+	}
+}
+
+func TestBookRejectsTrailheadOnOtherMountain(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	expectBookingLookup(mock, "mountain-2")
+
+	svc := NewService(mock)
+	_, err = svc.Book(context.Background(), BookingRequest{TripID: "trip-1", TrailheadID: "trailhead-1", ClimbDate: time.Now()})
+	if !errors.Is(err, ErrWrongMountain) {
+		t.Fatalf("expected ErrWrongMountain, got %v", err)
+	}
+}
+
+func TestCancelPromotesWaitlistInOrder(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	day := time.Date(2026, 8, 17, 0, 0, 0, 0, time.UTC)
+	now := time.Now()
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM permit_bookings b WHERE id=\$1 FOR UPDATE`).
+		WithArgs("booking-1", "user-1").
+		WillReturnRows(pgxmock.NewRows([]string{"id", "trip_id", "trailhead_id", "climb_date", "party_size", "status", "booking_code", "created_by", "created_at", "is_member"}).
+			AddRow("booking-1", "trip-1", "trailhead-1", day, 3, StatusConfirmed, "SH-AAAA-BBBB", "user-1", now, true))
+	mock.ExpectQuery(`UPDATE permit_bookings SET status='cancelled'`).
+		WithArgs("booking-1").
+		WillReturnRows(pgxmock.NewRows([]string{"status", "cancelled_at"}).AddRow(StatusCancelled, &now))
+	mock.ExpectExec(`UPDATE trailhead_quota_days SET booked = booked - \$3`).
+		WithArgs("trailhead-1", day, 3).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectQuery(`status='waitlisted' ORDER BY seq FOR UPDATE`).
+		WithArgs("trailhead-1", day).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "party_size"}).
+			AddRow("booking-2", 2).
+			AddRow("booking-3", 4).
+			AddRow("booking-4", 1))
+	mock.ExpectExec(`UPDATE trailhead_quota_days SET booked = booked \+ \$3`).
+		WithArgs("trailhead-1", day, 2).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectExec(`UPDATE permit_bookings SET status='confirmed'`).
+		WithArgs("booking-2").
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectExec(`UPDATE trailhead_quota_days SET booked = booked \+ \$3`).
+		WithArgs("trailhead-1", day, 4).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+	mock.ExpectExec(`INSERT INTO notifications .* 'permit_confirmed'`).
+		WithArgs([]string{"booking-2"}).
+		WillReturnResult(pgxmock.NewResult("INSERT", 2))
+	mock.ExpectCommit()
+
+	svc := NewService(mock)
+	b, err := svc.Cancel(context.Background(), "booking-1", "user-1")
+	if err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+	if b.Status != StatusCancelled || b.CancelledAt == nil {
+		t.Fatalf("unexpected booking: %+v", b)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestCancelRejectsOutsider(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM permit_bookings b WHERE id=\$1 FOR UPDATE`).
+		WithArgs("booking-1", "stranger").
+		WillReturnRows(pgxmock.NewRows([]string{"id", "trip_id", "trailhead_id", "climb_date", "party_size", "status", "booking_code", "created_by", "created_at", "is_member"}).
+			AddRow("booking-1", "trip-1", "trailhead-1", time.Now(), 1, StatusConfirmed, "SH-AAAA-BBBB", "user-1", time.Now(), false))
+	mock.ExpectRollback()
+
+	svc := NewService(mock)
+	if _, err := svc.Cancel(context.Background(), "booking-1", "stranger"); !errors.Is(err, ErrNotTripMember) {
+		t.Fatalf("expected ErrNotTripMember, got %v", err)
+	}
+}
+
+func TestNewBookingCode(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		code, err := newBookingCode()
+		if err != nil {
+			t.Fatalf("code: %v", err)
+		}
+		if len(code) != 12 || code[:3] != "SH-" || code[7] != '-' {
+			t.Fatalf("malformed code %q", code)
+		}
+		if strings.ContainsAny(code[3:], "01IO") {
+			t.Fatalf("ambiguous character in %q", code)
+		}
+		seen[code] = true
+	}
+	if len(seen) < 99 {
+		t.Fatalf("codes not random enough: %d unique", len(seen))
+	}
+}
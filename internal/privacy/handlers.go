@@ -0,0 +1,47 @@
+package privacy
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RegisterRoutes mounts the caller's own privacy zones under /privacy.
+func RegisterRoutes(r fiber.Router, svc *Service, authMiddleware fiber.Handler) {
+	r.Get("/zones", authMiddleware, func(c *fiber.Ctx) error {
+		userID, _ := c.Locals("user_id").(string)
+		zones, err := svc.Zones(c.Context(), userID)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		}
+		return c.JSON(zones)
+	})
+
+	r.Post("/zones", authMiddleware, func(c *fiber.Ctx) error {
+		var req Zone
+		if err := c.BodyParser(&req); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		req.UserID, _ = c.Locals("user_id").(string)
+		zone, err := svc.CreateZone(c.Context(), req)
+		if errors.Is(err, ErrInvalidZone) {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		}
+		return c.Status(fiber.StatusCreated).JSON(zone)
+	})
+
+	r.Delete("/zones/:id", authMiddleware, func(c *fiber.Ctx) error {
+		userID, _ := c.Locals("user_id").(string)
+		err := svc.DeleteZone(c.Context(), userID, c.Params("id"))
+		if errors.Is(err, ErrZoneNotFound) {
+			return fiber.NewError(fiber.StatusNotFound, err.Error())
+		}
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		}
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+}
@@ -0,0 +1,78 @@
+package privacy
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v3"
+)
+
+func TestPrivacyHandlers(t *testing.T) {
+	mock := newMock(t)
+	now := time.Now()
+	mock.ExpectQuery(`INSERT INTO privacy_zones`).
+		WithArgs(pgxmock.AnyArg(), "user-1", "home", 112.9, -7.9, 250.0).
+		WillReturnRows(pgxmock.NewRows([]string{"created_at"}).AddRow(now))
+	mock.ExpectQuery(`FROM privacy_zones WHERE user_id::text=\$1`).
+		WithArgs("user-1").
+		WillReturnRows(pgxmock.NewRows(zoneCols).AddRow("zone-1", "user-1", "home", -7.9, 112.9, 250.0, now))
+	mock.ExpectQuery(`DELETE FROM privacy_zones`).
+		WithArgs("zone-2", "user-1").
+		WillReturnError(pgx.ErrNoRows)
+	mock.ExpectQuery(`DELETE FROM privacy_zones`).
+		WithArgs("zone-1", "user-1").
+		WillReturnRows(pgxmock.NewRows(zoneCols).AddRow("zone-1", "user-1", "home", -7.9, 112.9, 250.0, now))
+
+	app := fiber.New()
+	setUser := func(c *fiber.Ctx) error {
+		c.Locals("user_id", "user-1")
+		return c.Next()
+	}
+	RegisterRoutes(app.Group("/privacy"), NewService(mock), setUser)
+
+	post := func(body string) int {
+		req := httptest.NewRequest(http.MethodPost, "/privacy/zones", bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("request: %v", err)
+		}
+		return resp.StatusCode
+	}
+	if code := post(`{"name":"home","lat":-7.9,"lng":112.9,"radius_m":250}`); code != http.StatusCreated {
+		t.Fatalf("expected created, got %d", code)
+	}
+	if code := post(`{"lat":-7.9,"lng":112.9,"radius_m":50000}`); code != http.StatusBadRequest {
+		t.Fatalf("expected bad request for a huge zone, got %d", code)
+	}
+	if code := post(`{`); code != http.StatusBadRequest {
+		t.Fatalf("expected bad request for a malformed body, got %d", code)
+	}
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/privacy/zones", nil))
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("list: %v %v", resp, err)
+	}
+	var zones []Zone
+	if err := json.NewDecoder(resp.Body).Decode(&zones); err != nil || len(zones) != 1 || zones[0].ID != "zone-1" {
+		t.Fatalf("unexpected zones %+v %v", zones, err)
+	}
+
+	resp, _ = app.Test(httptest.NewRequest(http.MethodDelete, "/privacy/zones/zone-2", nil))
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected not found, got %d", resp.StatusCode)
+	}
+	resp, _ = app.Test(httptest.NewRequest(http.MethodDelete, "/privacy/zones/zone-1", nil))
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected no content, got %d", resp.StatusCode)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
@@ -0,0 +1,15 @@
+package privacy
+
+import "time"
+
+// Zone is a circle, such as around a hiker's home, inside which their
+// positions are hidden from everyone else.
+type Zone struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	Name      string    `json:"name"`
+	Lat       float64   `json:"lat"`
+	Lng       float64   `json:"lng"`
+	RadiusM   float64   `json:"radius_m"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,180 @@
+package privacy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"backend-summithub/internal/db"
+	"backend-summithub/internal/shared/geo"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrInvalidZone  = errors.New("privacy zone needs a position and a radius_m between 1 and 10000")
+	ErrZoneNotFound = errors.New("privacy zone not found")
+	// ErrUnfiltered is returned for a position query that skips the zones.
+	ErrUnfiltered = errors.New("position query does not filter privacy zones")
+)
+
+const (
+	defaultRadiusM = 500.0
+	maxRadiusM     = 10000.0
+)
+
+type Service struct {
+	db        db.Querier
+	listeners []ZoneListener
+}
+
+func NewService(db db.Querier) *Service {
+	return &Service{db: db}
+}
+
+// ZoneListener is told when a zone is created or deleted, so anything built
+// from positions, such as cached heatmap tiles, can be refreshed.
+type ZoneListener interface {
+	ZoneChanged(ctx context.Context, zone Zone)
+}
+
+// AddZoneListener registers l for every zone change from now on.
+func (s *Service) AddZoneListener(l ZoneListener) {
+	s.listeners = append(s.listeners, l)
+}
+
+func (s *Service) notify(ctx context.Context, zone Zone) {
+	for _, l := range s.listeners {
+		l.ZoneChanged(ctx, zone)
+	}
+}
+
+func (s *Service) CreateZone(ctx context.Context, input Zone) (Zone, error) {
+	if input.RadiusM == 0 {
+		input.RadiusM = defaultRadiusM
+	}
+	if input.UserID == "" || input.RadiusM < 1 || input.RadiusM > maxRadiusM ||
+		input.Lat < -90 || input.Lat > 90 || input.Lng < -180 || input.Lng > 180 {
+		return Zone{}, ErrInvalidZone
+	}
+	input.ID = uuid.NewString()
+	err := s.db.QueryRow(ctx, `
+		INSERT INTO privacy_zones (id, user_id, name, center, radius_m)
+		VALUES ($1, $2, $3, ST_SetSRID(ST_MakePoint($4,$5), 4326)::geography, $6)
+		RETURNING created_at
+	`, input.ID, input.UserID, input.Name, input.Lng, input.Lat, input.RadiusM).Scan(&input.CreatedAt)
+	if err != nil {
+		return Zone{}, err
+	}
+	s.notify(ctx, input)
+	return input, nil
+}
+
+// Zones lists a user's zones, oldest first.
+func (s *Service) Zones(ctx context.Context, userID string) ([]Zone, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT id, user_id::text, name, ST_Y(center::geometry), ST_X(center::geometry), radius_m, created_at
+		FROM privacy_zones WHERE user_id::text=$1
+		ORDER BY created_at, id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	zones := []Zone{}
+	for rows.Next() {
+		var z Zone
+		if err := rows.Scan(&z.ID, &z.UserID, &z.Name, &z.Lat, &z.Lng, &z.RadiusM, &z.CreatedAt); err != nil {
+			return nil, err
+		}
+		zones = append(zones, z)
+	}
+	return zones, rows.Err()
+}
+
+// DeleteZone removes one of the user's zones; other users' zones are
+// reported as not found.
+func (s *Service) DeleteZone(ctx context.Context, userID, zoneID string) error {
+	var z Zone
+	err := s.db.QueryRow(ctx, `
+		DELETE FROM privacy_zones WHERE id::text=$1 AND user_id::text=$2
+		RETURNING id, user_id::text, name, ST_Y(center::geometry), ST_X(center::geometry), radius_m, created_at
+	`, zoneID, userID).Scan(&z.ID, &z.UserID, &z.Name, &z.Lat, &z.Lng, &z.RadiusM, &z.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrZoneNotFound
+	}
+	if err != nil {
+		return err
+	}
+	s.notify(ctx, z)
+	return nil
+}
+
+// Mask returns what viewerID may not see of ownerID's positions. Owners see
+// all of their own; an empty viewerID stands for anyone else.
+func (s *Service) Mask(ctx context.Context, ownerID, viewerID string) (Mask, error) {
+	if ownerID == "" || ownerID == viewerID {
+		return Mask{}, nil
+	}
+	zones, err := s.Zones(ctx, ownerID)
+	if err != nil {
+		return Mask{}, err
+	}
+	return Mask{zones: zones}, nil
+}
+
+// Mask hides positions inside a set of zones. The zero Mask hides nothing.
+type Mask struct {
+	zones []Zone
+}
+
+// Hides reports whether lat, lng lies in one of the zones.
+func (m Mask) Hides(lat, lng float64) bool {
+	for _, z := range m.zones {
+		if geo.HaversineKm(lat, lng, z.Lat, z.Lng)*1000 <= z.RadiusM {
+			return true
+		}
+	}
+	return false
+}
+
+// Empty reports whether the mask hides nothing.
+func (m Mask) Empty() bool {
+	return len(m.zones) == 0
+}
+
+// HiddenSQL is an SQL condition that holds when location, a geography
+// expression, lies in one of owner's zones. Queries without a viewer, such
+// as the heatmap's, add NOT HiddenSQL(...); queries with one go through
+// QueryPositions.
+func HiddenSQL(location, owner string) string {
+	return `EXISTS (SELECT 1 FROM privacy_zones pz WHERE pz.user_id = ` + owner +
+		` AND ST_DWithin(pz.center, ` + location + `, pz.radius_m))`
+}
+
+// visibleSQL is the SQL form of Mask: a condition that holds when viewer, a
+// text expression such as a query parameter, may see location of owner's.
+func visibleSQL(location, owner, viewer string) string {
+	return `(` + owner + `::text = ` + viewer + ` OR NOT ` + HiddenSQL(location, owner) + `)`
+}
+
+// QueryPositions runs a query returning positions of users other than
+// viewerID, and is the only way such queries are run. build writes the
+// query, calling visible with each position's location, a geography
+// expression, and owner for the condition that keeps what viewerID may see.
+// viewerID is bound as the parameter after args, which the query may use
+// too. A query that never calls visible is refused with ErrUnfiltered, so
+// no read can leave the zones out.
+func QueryPositions(ctx context.Context, q db.Querier, viewerID string, build func(visible func(location, owner string) string) string, args ...any) (pgx.Rows, error) {
+	viewer := fmt.Sprintf("$%d", len(args)+1)
+	filtered := false
+	sql := build(func(location, owner string) string {
+		filtered = true
+		return visibleSQL(location, owner, viewer)
+	})
+	if !filtered {
+		return nil, ErrUnfiltered
+	}
+	return q.Query(ctx, sql, append(args, viewerID)...)
+}
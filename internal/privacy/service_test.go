@@ -0,0 +1,172 @@
+package privacy
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v3"
+)
+
+var zoneCols = []string{"id", "user_id", "name", "lat", "lng", "radius_m", "created_at"}
+
+func newMock(t *testing.T) pgxmock.PgxPoolIface {
+	t.Helper()
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	t.Cleanup(mock.Close)
+	return mock
+}
+
+type recordingListener struct{ zones []Zone }
+
+func (r *recordingListener) ZoneChanged(_ context.Context, zone Zone) {
+	r.zones = append(r.zones, zone)
+}
+
+func TestCreateZone(t *testing.T) {
+	mock := newMock(t)
+	svc := NewService(mock)
+	listener := &recordingListener{}
+	svc.AddZoneListener(listener)
+
+	for _, bad := range []Zone{
+		{Lat: -7.9, Lng: 112.9},
+		{UserID: "user-1", Lat: 91, Lng: 112.9},
+		{UserID: "user-1", Lat: -7.9, Lng: 112.9, RadiusM: -5},
+		{UserID: "user-1", Lat: -7.9, Lng: 112.9, RadiusM: maxRadiusM + 1},
+	} {
+		if _, err := svc.CreateZone(context.Background(), bad); !errors.Is(err, ErrInvalidZone) {
+			t.Fatalf("expected invalid zone for %+v, got %v", bad, err)
+		}
+	}
+
+	now := time.Now()
+	mock.ExpectQuery(`INSERT INTO privacy_zones`).
+		WithArgs(pgxmock.AnyArg(), "user-1", "home", 112.9, -7.9, defaultRadiusM).
+		WillReturnRows(pgxmock.NewRows([]string{"created_at"}).AddRow(now))
+	zone, err := svc.CreateZone(context.Background(), Zone{UserID: "user-1", Name: "home", Lat: -7.9, Lng: 112.9})
+	if err != nil || zone.ID == "" || zone.RadiusM != defaultRadiusM || !zone.CreatedAt.Equal(now) {
+		t.Fatalf("unexpected zone %+v %v", zone, err)
+	}
+	if len(listener.zones) != 1 || listener.zones[0].ID != zone.ID {
+		t.Fatalf("expected listeners to hear about the zone, got %+v", listener.zones)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
+
+func TestZonesAndDelete(t *testing.T) {
+	mock := newMock(t)
+	svc := NewService(mock)
+	listener := &recordingListener{}
+	svc.AddZoneListener(listener)
+	now := time.Now()
+
+	mock.ExpectQuery(`FROM privacy_zones WHERE user_id::text=\$1`).
+		WithArgs("user-1").
+		WillReturnRows(pgxmock.NewRows(zoneCols).AddRow("zone-1", "user-1", "home", -7.9, 112.9, 300.0, now))
+	zones, err := svc.Zones(context.Background(), "user-1")
+	if err != nil || len(zones) != 1 || zones[0].RadiusM != 300 || zones[0].Lat != -7.9 {
+		t.Fatalf("unexpected zones %+v %v", zones, err)
+	}
+
+	mock.ExpectQuery(`DELETE FROM privacy_zones WHERE id::text=\$1 AND user_id::text=\$2`).
+		WithArgs("zone-1", "user-2").
+		WillReturnError(pgx.ErrNoRows)
+	if err := svc.DeleteZone(context.Background(), "user-2", "zone-1"); !errors.Is(err, ErrZoneNotFound) {
+		t.Fatalf("expected another user's zone to be not found, got %v", err)
+	}
+	mock.ExpectQuery(`DELETE FROM privacy_zones`).
+		WithArgs("zone-1", "user-1").
+		WillReturnRows(pgxmock.NewRows(zoneCols).AddRow("zone-1", "user-1", "home", -7.9, 112.9, 300.0, now))
+	if err := svc.DeleteZone(context.Background(), "user-1", "zone-1"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if len(listener.zones) != 1 || listener.zones[0].Lat != -7.9 {
+		t.Fatalf("expected listeners to hear about the deleted zone, got %+v", listener.zones)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
+
+func TestMask(t *testing.T) {
+	mock := newMock(t)
+	svc := NewService(mock)
+
+	// owners and sessions without an owner load nothing
+	for _, ids := range [][2]string{{"user-1", "user-1"}, {"", "user-2"}} {
+		mask, err := svc.Mask(context.Background(), ids[0], ids[1])
+		if err != nil || !mask.Empty() {
+			t.Fatalf("expected an empty mask for %v, got %+v %v", ids, mask, err)
+		}
+	}
+
+	mock.ExpectQuery(`FROM privacy_zones WHERE user_id::text=\$1`).
+		WithArgs("user-1").
+		WillReturnRows(pgxmock.NewRows(zoneCols).AddRow("zone-1", "user-1", "home", -7.94, 112.95, 500.0, time.Now()))
+	mask, err := svc.Mask(context.Background(), "user-1", "")
+	if err != nil || mask.Empty() {
+		t.Fatalf("expected a mask, got %+v %v", mask, err)
+	}
+	// roughly 300 m and 1.1 km from the centre
+	if !mask.Hides(-7.9427, 112.95) {
+		t.Fatalf("expected a point inside the zone to be hidden")
+	}
+	if mask.Hides(-7.95, 112.95) {
+		t.Fatalf("expected a point outside the zone to be visible")
+	}
+	if (Mask{}).Hides(-7.94, 112.95) {
+		t.Fatalf("expected the zero mask to hide nothing")
+	}
+
+	mock.ExpectQuery(`FROM privacy_zones`).
+		WithArgs("user-1").
+		WillReturnError(errors.New("connection refused"))
+	if _, err := svc.Mask(context.Background(), "user-1", "user-2"); err == nil {
+		t.Fatalf("expected the query error")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
+
+func TestHiddenSQL(t *testing.T) {
+	got := HiddenSQL("p.location", "s.user_id")
+	want := `EXISTS (SELECT 1 FROM privacy_zones pz WHERE pz.user_id = s.user_id AND ST_DWithin(pz.center, p.location, pz.radius_m))`
+	if got != want {
+		t.Fatalf("unexpected condition %s", got)
+	}
+}
+
+func TestQueryPositions(t *testing.T) {
+	mock := newMock(t)
+	mock.ExpectQuery(`FROM posts WHERE id=\$1 AND \(posts.user_id::text = \$2 OR NOT EXISTS \(SELECT 1 FROM privacy_zones pz WHERE pz.user_id = posts.user_id AND ST_DWithin\(pz.center, posts.location, pz.radius_m\)\)\)`).
+		WithArgs("post-1", "user-2").
+		WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow("post-1"))
+
+	rows, err := QueryPositions(context.Background(), mock, "user-2", func(visible func(location, owner string) string) string {
+		return `SELECT id FROM posts WHERE id=$1 AND ` + visible("posts.location", "posts.user_id")
+	}, "post-1")
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	rows.Close()
+
+	// a query that forgets the zones is never sent
+	_, err = QueryPositions(context.Background(), mock, "user-2", func(func(location, owner string) string) string {
+		return `SELECT id FROM posts WHERE id=$1`
+	}, "post-1")
+	if !errors.Is(err, ErrUnfiltered) {
+		t.Fatalf("expected ErrUnfiltered, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
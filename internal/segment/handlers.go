@@ -0,0 +1,83 @@
+package segment
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RegisterRoutes mounts the segment endpoints under /segments.
+func RegisterRoutes(r fiber.Router, svc *Service, authMiddleware fiber.Handler) {
+	r.Post("/", authMiddleware, func(c *fiber.Ctx) error {
+		var req Segment
+		if err := c.BodyParser(&req); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		if userID, ok := c.Locals("user_id").(string); ok {
+			req.CreatedBy = userID
+		}
+		seg, err := svc.CreateSegment(c.Context(), req)
+		if errors.Is(err, ErrInvalidSegment) {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		}
+		return c.Status(fiber.StatusCreated).JSON(seg)
+	})
+
+	r.Get("/", func(c *fiber.Ctx) error {
+		lat, _ := strconv.ParseFloat(c.Query("lat"), 64)
+		lng, _ := strconv.ParseFloat(c.Query("lng"), 64)
+		radius, _ := strconv.ParseFloat(c.Query("radius_km"), 64)
+		if radius == 0 {
+			radius = 5
+		}
+		segments, err := svc.Nearby(c.Context(), lat, lng, radius)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		}
+		return c.JSON(segments)
+	})
+
+	r.Get("/:id", func(c *fiber.Ctx) error {
+		seg, err := svc.GetSegment(c.Context(), c.Params("id"))
+		if err != nil {
+			return segmentError(err)
+		}
+		return c.JSON(seg)
+	})
+
+	r.Get("/:id/leaderboard", authMiddleware, func(c *fiber.Ctx) error {
+		userID, _ := c.Locals("user_id").(string)
+		board, err := svc.Leaderboard(c.Context(), c.Params("id"), userID, LeaderboardQuery{
+			Period:    c.Query("period"),
+			Following: c.QueryBool("following"),
+			Limit:     c.QueryInt("limit"),
+		})
+		if err != nil {
+			return segmentError(err)
+		}
+		return c.JSON(board)
+	})
+
+	r.Get("/:id/efforts", authMiddleware, func(c *fiber.Ctx) error {
+		userID, _ := c.Locals("user_id").(string)
+		efforts, err := svc.Efforts(c.Context(), c.Params("id"), userID)
+		if err != nil {
+			return segmentError(err)
+		}
+		return c.JSON(efforts)
+	})
+}
+
+func segmentError(err error) error {
+	switch {
+	case errors.Is(err, ErrSegmentNotFound):
+		return fiber.NewError(fiber.StatusNotFound, err.Error())
+	case errors.Is(err, ErrInvalidLeaderboard):
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+}
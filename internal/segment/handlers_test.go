@@ -0,0 +1,65 @@
+package segment
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v3"
+)
+
+func TestSegmentHandlers(t *testing.T) {
+	mock := newMock(t)
+	now := time.Now()
+	mock.ExpectQuery(`INSERT INTO segments`).
+		WithArgs(pgxmock.AnyArg(), "Pos 2 to Puncak Merbabu", 110.0, 0.001, 110.0, 0.005,
+			"LINESTRING(110 0.001,110 0.005)", pgxmock.AnyArg(), 25.0, "user-1").
+		WillReturnRows(pgxmock.NewRows([]string{"created_at"}).AddRow(now))
+	mock.ExpectQuery(`FROM segments\s+WHERE ST_DWithin\(path`).
+		WithArgs(110.0, 0.001, 5000.0).
+		WillReturnRows(pgxmock.NewRows(segmentCols))
+	mock.ExpectQuery(`FROM segments WHERE id=\$1`).
+		WithArgs("missing").
+		WillReturnError(pgx.ErrNoRows)
+	mock.ExpectQuery(`FROM segments WHERE id=\$1`).
+		WithArgs("seg-1").
+		WillReturnRows(pgxmock.NewRows(segmentCols).
+			AddRow("seg-1", "Pos 2", 0.001, 110.0, 0.005, 110.0, "LINESTRING(110 0.001,110 0.005)", 444.0, 25.0, "", now))
+	mock.ExpectQuery(`FROM segment_efforts`).
+		WithArgs("seg-1", "user-1", pgxmock.AnyArg(), maxBoardLimit, "user-1").
+		WillReturnRows(pgxmock.NewRows([]string{"id", "segment_id", "session_id", "user_id", "started_at", "ended_at", "elapsed_sec"}))
+
+	app := fiber.New()
+	setUser := func(c *fiber.Ctx) error {
+		c.Locals("user_id", "user-1")
+		return c.Next()
+	}
+	RegisterRoutes(app.Group("/segments"), NewService(mock), setUser)
+
+	requests := []struct {
+		method, path, body string
+		status             int
+	}{
+		{http.MethodPost, "/segments/", `{"name":"Pos 2 to Puncak Merbabu","start_lat":0.001,"start_lng":110,"end_lat":0.005,"end_lng":110}`, http.StatusCreated},
+		{http.MethodPost, "/segments/", `{"name":"too short","start_lat":0.001,"start_lng":110,"end_lat":0.001,"end_lng":110}`, http.StatusBadRequest},
+		{http.MethodGet, "/segments/?lat=0.001&lng=110", "", http.StatusOK},
+		{http.MethodGet, "/segments/missing", "", http.StatusNotFound},
+		{http.MethodGet, "/segments/seg-1/leaderboard?period=decade", "", http.StatusBadRequest},
+		{http.MethodGet, "/segments/seg-1/efforts", "", http.StatusOK},
+	}
+	for _, r := range requests {
+		req := httptest.NewRequest(r.method, r.path, bytes.NewReader([]byte(r.body)))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil || resp.StatusCode != r.status {
+			t.Fatalf("%s %s: expected %d, got %v %v", r.method, r.path, r.status, resp.StatusCode, err)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
@@ -0,0 +1,52 @@
+package segment
+
+import (
+	"time"
+
+	"backend-summithub/internal/shared/geo"
+)
+
+// trackPoint is a session position as segment matching needs it.
+type trackPoint struct {
+	Lat, Lng   float64
+	RecordedAt time.Time
+}
+
+// matchEfforts finds every pass of points over seg in recorded order. A pass
+// starts at the last point within tolerance of the start before the track
+// leaves it, and ends at the first point within tolerance of the end after
+// that; a track that returns to the start first starts over. The end is
+// checked first, so a loop, whose end is its start, or a segment shorter
+// than its tolerance still ends: once the track has left the start, or at a
+// point nearer the end than the start. Laps of the same segment in one
+// session are separate efforts, and a loop's lap ends where the next starts.
+func matchEfforts(seg Segment, points []trackPoint) []Effort {
+	var efforts []Effort
+	start, left := -1, false
+	for i, p := range points {
+		toStart := distanceM(p.Lat, p.Lng, seg.StartLat, seg.StartLng)
+		toEnd := distanceM(p.Lat, p.Lng, seg.EndLat, seg.EndLng)
+		if start >= 0 && toEnd <= seg.ToleranceM && (left || toEnd < toStart) {
+			from := points[start].RecordedAt
+			efforts = append(efforts, Effort{
+				SegmentID:  seg.ID,
+				StartedAt:  from,
+				EndedAt:    p.RecordedAt,
+				ElapsedSec: p.RecordedAt.Sub(from).Seconds(),
+			})
+			start = -1
+		}
+		if toStart <= seg.ToleranceM {
+			start, left = i, false
+			continue
+		}
+		if start >= 0 {
+			left = true
+		}
+	}
+	return efforts
+}
+
+func distanceM(lat1, lng1, lat2, lng2 float64) float64 {
+	return geo.HaversineKm(lat1, lng1, lat2, lng2) * 1000
+}
@@ -0,0 +1,79 @@
+package segment
+
+import (
+	"testing"
+	"time"
+)
+
+// Points 0.001 degrees of latitude apart are about 111 m apart.
+func northbound(start time.Time, lats ...float64) []trackPoint {
+	points := make([]trackPoint, len(lats))
+	for i, lat := range lats {
+		points[i] = trackPoint{Lat: lat, Lng: 110, RecordedAt: start.Add(time.Duration(i) * time.Minute)}
+	}
+	return points
+}
+
+func TestMatchEfforts(t *testing.T) {
+	seg := Segment{ID: "seg-1", StartLat: 0.001, StartLng: 110, EndLat: 0.005, EndLng: 110, ToleranceM: 30}
+	start := time.Date(2026, 7, 1, 6, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name    string
+		lats    []float64
+		elapsed []float64
+	}{
+		{"straight through", []float64{0, 0.001, 0.002, 0.003, 0.004, 0.005, 0.006}, []float64{240}},
+		// Lingering at the start: the effort begins when the track leaves it.
+		{"waits at start", []float64{0.001, 0.001, 0.001, 0.003, 0.005}, []float64{120}},
+		{"reverse direction", []float64{0.006, 0.005, 0.004, 0.002, 0.001, 0}, nil},
+		{"never reaches end", []float64{0.001, 0.002, 0.003, 0.004}, nil},
+		{"two laps", []float64{0.001, 0.003, 0.005, 0.003, 0.001, 0.005}, []float64{120, 60}},
+		{"misses start by 50 m", []float64{0.00145, 0.003, 0.005}, nil},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			efforts := matchEfforts(seg, northbound(start, tc.lats...))
+			if len(efforts) != len(tc.elapsed) {
+				t.Fatalf("expected %d efforts, got %+v", len(tc.elapsed), efforts)
+			}
+			for i, e := range efforts {
+				if e.ElapsedSec != tc.elapsed[i] || e.SegmentID != "seg-1" || e.EndedAt.Sub(e.StartedAt).Seconds() != e.ElapsedSec {
+					t.Fatalf("unexpected effort %d: %+v", i, e)
+				}
+			}
+		})
+	}
+}
+
+func TestMatchEffortsLoopAndShortSegments(t *testing.T) {
+	start := time.Date(2026, 7, 1, 6, 0, 0, 0, time.UTC)
+	loop := Segment{ID: "seg-1", StartLat: 0.001, StartLng: 110, EndLat: 0.001, EndLng: 110, ToleranceM: 30}
+	short := Segment{ID: "seg-1", StartLat: 0.001, StartLng: 110, EndLat: 0.0013, EndLng: 110, ToleranceM: 30}
+
+	cases := []struct {
+		name    string
+		seg     Segment
+		lats    []float64
+		elapsed []float64
+	}{
+		{"loop out and back", loop, []float64{0.001, 0.003, 0.005, 0.003, 0.001}, []float64{240}},
+		{"loop twice", loop, []float64{0.001, 0.003, 0.001, 0.003, 0.001}, []float64{120, 120}},
+		{"loop never leaves", loop, []float64{0.001, 0.001, 0.001}, nil},
+		// The end lies inside the start's tolerance.
+		{"shorter than tolerance", short, []float64{0.0008, 0.001, 0.0013, 0.002}, []float64{60}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			efforts := matchEfforts(tc.seg, northbound(start, tc.lats...))
+			if len(efforts) != len(tc.elapsed) {
+				t.Fatalf("expected %d efforts, got %+v", len(tc.elapsed), efforts)
+			}
+			for i, e := range efforts {
+				if e.ElapsedSec != tc.elapsed[i] {
+					t.Fatalf("unexpected effort %d: %+v", i, e)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package segment
+
+import "time"
+
+// Segment is a stretch of trail between two points. Path runs from start to
+// end as [lat, lng] pairs; without one the segment is a straight line.
+type Segment struct {
+	ID         string       `json:"id"`
+	Name       string       `json:"name"`
+	StartLat   float64      `json:"start_lat"`
+	StartLng   float64      `json:"start_lng"`
+	EndLat     float64      `json:"end_lat"`
+	EndLng     float64      `json:"end_lng"`
+	Path       [][2]float64 `json:"path,omitempty"`
+	DistanceM  float64      `json:"distance_m"`
+	ToleranceM float64      `json:"tolerance_m"`
+	CreatedBy  string       `json:"created_by,omitempty"`
+	CreatedAt  time.Time    `json:"created_at"`
+}
+
+// Effort is one pass of a session over a segment: from the last point near
+// the start to the first point near the end after it.
+type Effort struct {
+	ID         string    `json:"id"`
+	SegmentID  string    `json:"segment_id"`
+	SessionID  string    `json:"session_id"`
+	UserID     string    `json:"user_id"`
+	StartedAt  time.Time `json:"started_at"`
+	EndedAt    time.Time `json:"ended_at"`
+	ElapsedSec float64   `json:"elapsed_sec"`
+	// PersonalBest marks the user's fastest effort on the segment.
+	PersonalBest bool `json:"personal_best,omitempty"`
+}
+
+// Leaderboard periods.
+const (
+	PeriodAll  = "all"
+	PeriodYear = "year"
+)
+
+// LeaderboardEntry is a user's best effort within the leaderboard's filters.
+// Equal times share a rank.
+type LeaderboardEntry struct {
+	Rank       int       `json:"rank"`
+	UserID     string    `json:"user_id"`
+	Username   string    `json:"username"`
+	EffortID   string    `json:"effort_id"`
+	SessionID  string    `json:"session_id"`
+	ElapsedSec float64   `json:"elapsed_sec"`
+	StartedAt  time.Time `json:"started_at"`
+}
+
+// Leaderboard is the response of GET /segments/:id/leaderboard.
+// PersonalBest is the viewer's fastest effort of the period, if any.
+type Leaderboard struct {
+	SegmentID    string             `json:"segment_id"`
+	Period       string             `json:"period"`
+	Following    bool               `json:"following"`
+	Entries      []LeaderboardEntry `json:"entries"`
+	PersonalBest *Effort            `json:"personal_best,omitempty"`
+}
@@ -0,0 +1,415 @@
+package segment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend-summithub/internal/db"
+	"backend-summithub/internal/tracking"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrSegmentNotFound    = errors.New("segment not found")
+	ErrInvalidSegment     = errors.New("invalid segment")
+	ErrInvalidLeaderboard = errors.New("period must be all or year")
+)
+
+const (
+	// defaultToleranceM applies when a segment is created without one.
+	defaultToleranceM = 25.0
+	// maxToleranceM bounds tolerance_m. Matching uses it as the radius of the
+	// indexed search for segments near a track, so it must stay small.
+	maxToleranceM     = 100.0
+	defaultBoardLimit = 10
+	maxBoardLimit     = 100
+)
+
+type Service struct {
+	db db.TxBeginner
+}
+
+func NewService(db db.TxBeginner) *Service {
+	return &Service{db: db}
+}
+
+const segmentColumns = `id, name, ST_Y(start_point::geometry), ST_X(start_point::geometry),
+		       ST_Y(end_point::geometry), ST_X(end_point::geometry), ST_AsText(path),
+		       distance_m, tolerance_m, COALESCE(created_by::text,''), created_at`
+
+func scanSegment(row pgx.Row) (Segment, error) {
+	var seg Segment
+	var path string
+	err := row.Scan(&seg.ID, &seg.Name, &seg.StartLat, &seg.StartLng, &seg.EndLat, &seg.EndLng, &path,
+		&seg.DistanceM, &seg.ToleranceM, &seg.CreatedBy, &seg.CreatedAt)
+	if err != nil {
+		return Segment{}, err
+	}
+	seg.Path = parseLineWKT(path)
+	return seg, nil
+}
+
+// CreateSegment stores a segment. Without a path it runs straight from start
+// to end; a path must begin and finish within tolerance of them. Start and
+// end must lie further apart than twice the tolerance so a single point is
+// never near both.
+func (s *Service) CreateSegment(ctx context.Context, input Segment) (Segment, error) {
+	if input.ToleranceM == 0 {
+		input.ToleranceM = defaultToleranceM
+	}
+	if len(input.Path) == 0 {
+		input.Path = [][2]float64{{input.StartLat, input.StartLng}, {input.EndLat, input.EndLng}}
+	}
+	if err := validateSegment(input); err != nil {
+		return Segment{}, err
+	}
+	input.DistanceM = 0
+	for i := 1; i < len(input.Path); i++ {
+		a, b := input.Path[i-1], input.Path[i]
+		input.DistanceM += distanceM(a[0], a[1], b[0], b[1])
+	}
+
+	input.ID = uuid.NewString()
+	err := s.db.QueryRow(ctx, `
+		INSERT INTO segments (id, name, start_point, end_point, path, distance_m, tolerance_m, created_by)
+		VALUES ($1, $2, ST_SetSRID(ST_MakePoint($3,$4), 4326)::geography, ST_SetSRID(ST_MakePoint($5,$6), 4326)::geography,
+		        ST_GeogFromText($7), $8, $9, NULLIF($10,'')::uuid)
+		RETURNING created_at
+	`, input.ID, input.Name, input.StartLng, input.StartLat, input.EndLng, input.EndLat,
+		lineWKT(input.Path), input.DistanceM, input.ToleranceM, input.CreatedBy).Scan(&input.CreatedAt)
+	if err != nil {
+		return Segment{}, err
+	}
+	return input, nil
+}
+
+func validateSegment(seg Segment) error {
+	switch {
+	case strings.TrimSpace(seg.Name) == "":
+		return fmt.Errorf("%w: name required", ErrInvalidSegment)
+	case seg.ToleranceM < 0 || seg.ToleranceM > maxToleranceM:
+		return fmt.Errorf("%w: tolerance_m must be between 0 and %g", ErrInvalidSegment, maxToleranceM)
+	case len(seg.Path) < 2:
+		return fmt.Errorf("%w: path needs at least two points", ErrInvalidSegment)
+	}
+	for _, p := range seg.Path {
+		if p[0] < -90 || p[0] > 90 || p[1] < -180 || p[1] > 180 {
+			return fmt.Errorf("%w: coordinates out of range", ErrInvalidSegment)
+		}
+	}
+	first, last := seg.Path[0], seg.Path[len(seg.Path)-1]
+	if distanceM(first[0], first[1], seg.StartLat, seg.StartLng) > seg.ToleranceM ||
+		distanceM(last[0], last[1], seg.EndLat, seg.EndLng) > seg.ToleranceM {
+		return fmt.Errorf("%w: path must run from start to end", ErrInvalidSegment)
+	}
+	if distanceM(seg.StartLat, seg.StartLng, seg.EndLat, seg.EndLng) <= 2*seg.ToleranceM {
+		return fmt.Errorf("%w: start and end must be more than twice tolerance_m apart", ErrInvalidSegment)
+	}
+	return nil
+}
+
+func (s *Service) GetSegment(ctx context.Context, id string) (Segment, error) {
+	seg, err := scanSegment(s.db.QueryRow(ctx, `SELECT `+segmentColumns+` FROM segments WHERE id=$1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Segment{}, ErrSegmentNotFound
+	}
+	return seg, err
+}
+
+// Nearby lists segments whose path passes within radiusKm, closest first.
+func (s *Service) Nearby(ctx context.Context, lat, lng, radiusKm float64) ([]Segment, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT `+segmentColumns+`
+		FROM segments
+		WHERE ST_DWithin(path, ST_SetSRID(ST_MakePoint($1,$2), 4326)::geography, $3)
+		ORDER BY ST_Distance(path, ST_SetSRID(ST_MakePoint($1,$2), 4326)::geography), created_at
+		LIMIT 100
+	`, lng, lat, radiusKm*1000)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	segments := []Segment{}
+	for rows.Next() {
+		seg, err := scanSegment(rows)
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, seg)
+	}
+	return segments, rows.Err()
+}
+
+// SessionEnded matches a session against segments as soon as it ends.
+// Failures are only logged.
+func (s *Service) SessionEnded(ctx context.Context, session tracking.Session) {
+	if _, err := s.MatchSession(ctx, session.ID); err != nil {
+		log.Printf("segment efforts for session %s: %v", session.ID, err)
+	}
+}
+
+// MatchSession records the efforts of an ended session on every segment it
+// passes and returns the new ones. Only segments whose start and end both lie
+// near the track are considered, found through the segments' spatial
+// indexes. Matching a session again records nothing twice.
+func (s *Service) MatchSession(ctx context.Context, sessionID string) ([]Effort, error) {
+	var userID string
+	err := s.db.QueryRow(ctx, `
+		SELECT COALESCE(user_id::text,'') FROM track_sessions WHERE id=$1 AND status IN ('ended', 'auto_closed')
+	`, sessionID).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && userID == "") {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	candidates, err := s.candidates(ctx, sessionID)
+	if err != nil || len(candidates) == 0 {
+		return nil, err
+	}
+	points, err := s.sessionPoints(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	// All of a session's efforts are stored together, so a failure part way
+	// leaves none behind and matching again records the whole session.
+	var efforts []Effort
+	err = db.WithTx(ctx, s.db, func(tx pgx.Tx) error {
+		for _, seg := range candidates {
+			for _, e := range matchEfforts(seg, points) {
+				e.ID, e.SessionID, e.UserID = uuid.NewString(), sessionID, userID
+				err := tx.QueryRow(ctx, `
+					INSERT INTO segment_efforts (id, segment_id, session_id, user_id, started_at, ended_at, elapsed_sec)
+					VALUES ($1, $2, $3, $4, $5, $6, $7)
+					ON CONFLICT (segment_id, session_id, started_at) DO NOTHING
+					RETURNING NOT EXISTS (
+					    SELECT 1 FROM segment_efforts
+					    WHERE segment_id=$2 AND user_id=$4 AND elapsed_sec <= $7
+					)
+				`, e.ID, e.SegmentID, e.SessionID, e.UserID, e.StartedAt, e.EndedAt, e.ElapsedSec).Scan(&e.PersonalBest)
+				if errors.Is(err, pgx.ErrNoRows) {
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				efforts = append(efforts, e)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return efforts, nil
+}
+
+// candidates returns the segments whose start and end are both within
+// tolerance of the session's track. The fixed maxToleranceM radius lets the
+// start and end indexes serve the search; each segment's own tolerance is
+// applied after.
+func (s *Service) candidates(ctx context.Context, sessionID string) ([]Segment, error) {
+	rows, err := s.db.Query(ctx, `
+		WITH track AS (
+		    SELECT ST_MakeLine(location::geometry ORDER BY recorded_at, id)::geography AS line
+		    FROM track_points WHERE session_id=$1
+		    HAVING COUNT(*) > 1
+		)
+		SELECT s.id, ST_Y(s.start_point::geometry), ST_X(s.start_point::geometry),
+		       ST_Y(s.end_point::geometry), ST_X(s.end_point::geometry), s.tolerance_m
+		FROM track
+		JOIN segments s ON ST_DWithin(s.start_point, track.line, $2) AND ST_DWithin(s.end_point, track.line, $2)
+		WHERE ST_DWithin(s.start_point, track.line, s.tolerance_m)
+		  AND ST_DWithin(s.end_point, track.line, s.tolerance_m)
+	`, sessionID, maxToleranceM)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var segments []Segment
+	for rows.Next() {
+		var seg Segment
+		if err := rows.Scan(&seg.ID, &seg.StartLat, &seg.StartLng, &seg.EndLat, &seg.EndLng, &seg.ToleranceM); err != nil {
+			return nil, err
+		}
+		segments = append(segments, seg)
+	}
+	return segments, rows.Err()
+}
+
+func (s *Service) sessionPoints(ctx context.Context, sessionID string) ([]trackPoint, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT ST_Y(location::geometry), ST_X(location::geometry), recorded_at
+		FROM track_points WHERE session_id=$1
+		ORDER BY recorded_at, id
+	`, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var points []trackPoint
+	for rows.Next() {
+		var p trackPoint
+		if err := rows.Scan(&p.Lat, &p.Lng, &p.RecordedAt); err != nil {
+			return nil, err
+		}
+		points = append(points, p)
+	}
+	return points, rows.Err()
+}
+
+// LeaderboardQuery selects a leaderboard. Following limits it to the viewer
+// and the users they follow.
+type LeaderboardQuery struct {
+	Period    string
+	Following bool
+	Limit     int
+}
+
+// Leaderboard ranks each user's best effort on a segment, counting only
+// efforts from sessions the viewer may read under tracking.ViewableSQL.
+func (s *Service) Leaderboard(ctx context.Context, segmentID, viewerID string, q LeaderboardQuery) (Leaderboard, error) {
+	if q.Period == "" {
+		q.Period = PeriodAll
+	}
+	var since *time.Time
+	switch q.Period {
+	case PeriodAll:
+	case PeriodYear:
+		now := time.Now()
+		start := time.Date(now.Year(), 1, 1, 0, 0, 0, 0, now.Location())
+		since = &start
+	default:
+		return Leaderboard{}, ErrInvalidLeaderboard
+	}
+	if q.Limit <= 0 {
+		q.Limit = defaultBoardLimit
+	}
+	if q.Limit > maxBoardLimit {
+		q.Limit = maxBoardLimit
+	}
+	if _, err := s.GetSegment(ctx, segmentID); err != nil {
+		return Leaderboard{}, err
+	}
+
+	rows, err := s.db.Query(ctx, `
+		SELECT RANK() OVER (ORDER BY best.elapsed_sec), best.user_id::text, u.username,
+		       best.id::text, best.session_id::text, best.elapsed_sec, best.started_at
+		FROM (
+		    SELECT DISTINCT ON (e.user_id) e.id, e.user_id, e.session_id, e.elapsed_sec, e.started_at
+		    FROM segment_efforts e
+		    JOIN track_sessions ts ON ts.id = e.session_id
+		    WHERE e.segment_id=$1
+		      AND `+tracking.ViewableSQL("ts", "$4::text")+`
+		      AND ($2::timestamp IS NULL OR e.started_at >= $2)
+		      AND (NOT $3 OR e.user_id = $4::uuid
+		           OR e.user_id IN (SELECT following_id FROM user_follows WHERE follower_id = $4::uuid))
+		    ORDER BY e.user_id, e.elapsed_sec, e.started_at
+		) best
+		JOIN users u ON u.id = best.user_id
+		ORDER BY best.elapsed_sec, best.started_at
+		LIMIT $5
+	`, segmentID, since, q.Following, viewerID, q.Limit)
+	if err != nil {
+		return Leaderboard{}, err
+	}
+	defer rows.Close()
+	board := Leaderboard{SegmentID: segmentID, Period: q.Period, Following: q.Following, Entries: []LeaderboardEntry{}}
+	for rows.Next() {
+		var e LeaderboardEntry
+		if err := rows.Scan(&e.Rank, &e.UserID, &e.Username, &e.EffortID, &e.SessionID, &e.ElapsedSec, &e.StartedAt); err != nil {
+			return Leaderboard{}, err
+		}
+		board.Entries = append(board.Entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return Leaderboard{}, err
+	}
+
+	efforts, err := s.efforts(ctx, segmentID, viewerID, viewerID, since, 1)
+	if err != nil {
+		return Leaderboard{}, err
+	}
+	if len(efforts) > 0 {
+		board.PersonalBest = &efforts[0]
+	}
+	return board, nil
+}
+
+// Efforts lists a user's efforts on a segment, fastest first; the first is
+// their personal best.
+func (s *Service) Efforts(ctx context.Context, segmentID, userID string) ([]Effort, error) {
+	if _, err := s.GetSegment(ctx, segmentID); err != nil {
+		return nil, err
+	}
+	return s.efforts(ctx, segmentID, userID, userID, nil, maxBoardLimit)
+}
+
+// efforts lists userID's efforts on a segment from sessions viewerID may
+// read, fastest first.
+func (s *Service) efforts(ctx context.Context, segmentID, userID, viewerID string, since *time.Time, limit int) ([]Effort, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT e.id::text, e.segment_id::text, e.session_id::text, e.user_id::text, e.started_at, e.ended_at, e.elapsed_sec
+		FROM segment_efforts e
+		JOIN track_sessions ts ON ts.id = e.session_id
+		WHERE e.segment_id=$1 AND e.user_id=$2::uuid AND ($3::timestamp IS NULL OR e.started_at >= $3)
+		  AND `+tracking.ViewableSQL("ts", "$5::text")+`
+		ORDER BY e.elapsed_sec, e.started_at
+		LIMIT $4
+	`, segmentID, userID, since, limit, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	efforts := []Effort{}
+	for rows.Next() {
+		var e Effort
+		if err := rows.Scan(&e.ID, &e.SegmentID, &e.SessionID, &e.UserID, &e.StartedAt, &e.EndedAt, &e.ElapsedSec); err != nil {
+			return nil, err
+		}
+		e.PersonalBest = len(efforts) == 0
+		efforts = append(efforts, e)
+	}
+	return efforts, rows.Err()
+}
+
+// lineWKT writes [lat, lng] pairs as a WKT LINESTRING.
+func lineWKT(path [][2]float64) string {
+	coords := make([]string, len(path))
+	for i, p := range path {
+		coords[i] = strconv.FormatFloat(p[1], 'f', -1, 64) + " " + strconv.FormatFloat(p[0], 'f', -1, 64)
+	}
+	return "LINESTRING(" + strings.Join(coords, ",") + ")"
+}
+
+// parseLineWKT reads a WKT LINESTRING, as written by PostGIS, into [lat, lng]
+// pairs. Anything else yields nil.
+func parseLineWKT(wkt string) [][2]float64 {
+	body, ok := strings.CutPrefix(wkt, "LINESTRING(")
+	if !ok {
+		return nil
+	}
+	var path [][2]float64
+	for _, pair := range strings.Split(strings.TrimSuffix(body, ")"), ",") {
+		fields := strings.Fields(pair)
+		if len(fields) < 2 {
+			return nil
+		}
+		lng, err1 := strconv.ParseFloat(fields[0], 64)
+		lat, err2 := strconv.ParseFloat(fields[1], 64)
+		if err1 != nil || err2 != nil {
+			return nil
+		}
+		path = append(path, [2]float64{lat, lng})
+	}
+	return path
+}
@@ -0,0 +1,232 @@
+package segment
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v3"
+)
+
+var segmentCols = []string{"id", "name", "start_lat", "start_lng", "end_lat", "end_lng", "path", "distance_m", "tolerance_m", "created_by", "created_at"}
+
+func newMock(t *testing.T) pgxmock.PgxPoolIface {
+	t.Helper()
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	t.Cleanup(mock.Close)
+	return mock
+}
+
+func TestCreateSegment(t *testing.T) {
+	mock := newMock(t)
+	now := time.Now()
+	mock.ExpectQuery(`INSERT INTO segments`).
+		WithArgs(pgxmock.AnyArg(), "Pos 2 to Puncak Merbabu", 110.0, 0.001, 110.0, 0.005,
+			"LINESTRING(110 0.001,110.0005 0.003,110 0.005)", pgxmock.AnyArg(), 25.0, "user-1").
+		WillReturnRows(pgxmock.NewRows([]string{"created_at"}).AddRow(now))
+
+	seg, err := NewService(mock).CreateSegment(context.Background(), Segment{
+		Name: "Pos 2 to Puncak Merbabu", StartLat: 0.001, StartLng: 110, EndLat: 0.005, EndLng: 110,
+		Path:      [][2]float64{{0.001, 110}, {0.003, 110.0005}, {0.005, 110}},
+		CreatedBy: "user-1",
+	})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	// Two legs of about 229 m each.
+	if seg.ID == "" || seg.DistanceM < 455 || seg.DistanceM > 462 || !seg.CreatedAt.Equal(now) {
+		t.Fatalf("unexpected segment %+v", seg)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
+
+func TestCreateSegmentValidates(t *testing.T) {
+	svc := NewService(newMock(t))
+	cases := map[string]Segment{
+		"no name":        {StartLat: 0.001, StartLng: 110, EndLat: 0.005, EndLng: 110},
+		"tolerance":      {Name: "a", StartLat: 0.001, StartLng: 110, EndLat: 0.005, EndLng: 110, ToleranceM: 500},
+		"too short":      {Name: "a", StartLat: 0.001, StartLng: 110, EndLat: 0.0012, EndLng: 110},
+		"out of range":   {Name: "a", StartLat: 91, StartLng: 110, EndLat: 0.005, EndLng: 110},
+		"path elsewhere": {Name: "a", StartLat: 0.001, StartLng: 110, EndLat: 0.005, EndLng: 110, Path: [][2]float64{{0.001, 110}, {0.009, 110}}},
+		"single point":   {Name: "a", StartLat: 0.001, StartLng: 110, EndLat: 0.005, EndLng: 110, Path: [][2]float64{{0.001, 110}}},
+	}
+	for name, input := range cases {
+		if _, err := svc.CreateSegment(context.Background(), input); !errors.Is(err, ErrInvalidSegment) {
+			t.Fatalf("%s: expected ErrInvalidSegment, got %v", name, err)
+		}
+	}
+}
+
+func TestGetSegment(t *testing.T) {
+	mock := newMock(t)
+	now := time.Now()
+	mock.ExpectQuery(`FROM segments WHERE id=\$1`).
+		WithArgs("seg-1").
+		WillReturnRows(pgxmock.NewRows(segmentCols).
+			AddRow("seg-1", "Pos 2", 0.001, 110.0, 0.005, 110.0, "LINESTRING(110 0.001,110 0.005)", 444.0, 25.0, "user-1", now))
+	mock.ExpectQuery(`FROM segments WHERE id=\$1`).
+		WithArgs("missing").
+		WillReturnError(pgx.ErrNoRows)
+
+	svc := NewService(mock)
+	seg, err := svc.GetSegment(context.Background(), "seg-1")
+	if err != nil || len(seg.Path) != 2 || seg.Path[1] != [2]float64{0.005, 110} {
+		t.Fatalf("unexpected segment %+v %v", seg, err)
+	}
+	if _, err := svc.GetSegment(context.Background(), "missing"); !errors.Is(err, ErrSegmentNotFound) {
+		t.Fatalf("expected ErrSegmentNotFound, got %v", err)
+	}
+}
+
+func TestMatchSessionStoresEfforts(t *testing.T) {
+	mock := newMock(t)
+	start := time.Date(2026, 7, 1, 6, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`FROM track_sessions WHERE id=\$1 AND status IN \('ended', 'auto_closed'\)`).
+		WithArgs("session-1").
+		WillReturnRows(pgxmock.NewRows([]string{"user_id"}).AddRow("user-1"))
+	mock.ExpectQuery(`JOIN segments s ON ST_DWithin\(s.start_point, track.line, \$2\)`).
+		WithArgs("session-1", maxToleranceM).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "start_lat", "start_lng", "end_lat", "end_lng", "tolerance_m"}).
+			AddRow("seg-1", 0.001, 110.0, 0.005, 110.0, 30.0).
+			AddRow("seg-2", 0.002, 110.0, 0.004, 110.0, 30.0))
+	rows := pgxmock.NewRows([]string{"lat", "lng", "recorded_at"})
+	for i, p := range northbound(start, 0, 0.001, 0.002, 0.003, 0.004, 0.005) {
+		rows.AddRow(p.Lat, p.Lng, start.Add(time.Duration(i)*time.Minute))
+	}
+	mock.ExpectQuery(`SELECT ST_Y\(location::geometry\), ST_X\(location::geometry\), recorded_at`).
+		WithArgs("session-1").
+		WillReturnRows(rows)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO segment_efforts`).
+		WithArgs(pgxmock.AnyArg(), "seg-1", "session-1", "user-1", start.Add(time.Minute), start.Add(5*time.Minute), 240.0).
+		WillReturnRows(pgxmock.NewRows([]string{"personal_best"}).AddRow(true))
+	// The second effort was stored by an earlier run.
+	mock.ExpectQuery(`INSERT INTO segment_efforts`).
+		WithArgs(pgxmock.AnyArg(), "seg-2", "session-1", "user-1", start.Add(2*time.Minute), start.Add(4*time.Minute), 120.0).
+		WillReturnError(pgx.ErrNoRows)
+	mock.ExpectCommit()
+
+	efforts, err := NewService(mock).MatchSession(context.Background(), "session-1")
+	if err != nil {
+		t.Fatalf("match: %v", err)
+	}
+	if len(efforts) != 1 || !efforts[0].PersonalBest || efforts[0].UserID != "user-1" || efforts[0].ID == "" {
+		t.Fatalf("unexpected efforts %+v", efforts)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
+
+func TestMatchSessionRollsBackOnInsertFailure(t *testing.T) {
+	mock := newMock(t)
+	start := time.Date(2026, 7, 1, 6, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`FROM track_sessions WHERE id=\$1`).
+		WithArgs("session-1").
+		WillReturnRows(pgxmock.NewRows([]string{"user_id"}).AddRow("user-1"))
+	mock.ExpectQuery(`WITH track AS`).
+		WithArgs("session-1", maxToleranceM).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "start_lat", "start_lng", "end_lat", "end_lng", "tolerance_m"}).
+			AddRow("seg-1", 0.001, 110.0, 0.005, 110.0, 30.0).
+			AddRow("seg-2", 0.002, 110.0, 0.004, 110.0, 30.0))
+	rows := pgxmock.NewRows([]string{"lat", "lng", "recorded_at"})
+	for i, p := range northbound(start, 0, 0.001, 0.002, 0.003, 0.004, 0.005) {
+		rows.AddRow(p.Lat, p.Lng, start.Add(time.Duration(i)*time.Minute))
+	}
+	mock.ExpectQuery(`SELECT ST_Y\(location::geometry\)`).
+		WithArgs("session-1").
+		WillReturnRows(rows)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO segment_efforts`).
+		WithArgs(pgxmock.AnyArg(), "seg-1", "session-1", "user-1", start.Add(time.Minute), start.Add(5*time.Minute), 240.0).
+		WillReturnRows(pgxmock.NewRows([]string{"personal_best"}).AddRow(true))
+	mock.ExpectQuery(`INSERT INTO segment_efforts`).
+		WithArgs(pgxmock.AnyArg(), "seg-2", "session-1", "user-1", start.Add(2*time.Minute), start.Add(4*time.Minute), 120.0).
+		WillReturnError(errors.New("connection reset"))
+	mock.ExpectRollback()
+
+	if efforts, err := NewService(mock).MatchSession(context.Background(), "session-1"); err == nil || efforts != nil {
+		t.Fatalf("expected the failure, got %+v %v", efforts, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
+
+func TestMatchSessionSkipsOpenSessionsAndFarTracks(t *testing.T) {
+	mock := newMock(t)
+	mock.ExpectQuery(`FROM track_sessions WHERE id=\$1`).
+		WithArgs("session-open").
+		WillReturnError(pgx.ErrNoRows)
+	mock.ExpectQuery(`FROM track_sessions WHERE id=\$1`).
+		WithArgs("session-far").
+		WillReturnRows(pgxmock.NewRows([]string{"user_id"}).AddRow("user-1"))
+	mock.ExpectQuery(`WITH track AS`).
+		WithArgs("session-far", maxToleranceM).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "start_lat", "start_lng", "end_lat", "end_lng", "tolerance_m"}))
+
+	svc := NewService(mock)
+	for _, id := range []string{"session-open", "session-far"} {
+		if efforts, err := svc.MatchSession(context.Background(), id); err != nil || efforts != nil {
+			t.Fatalf("%s: expected no efforts, got %+v %v", id, efforts, err)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
+
+func TestLeaderboard(t *testing.T) {
+	mock := newMock(t)
+	now := time.Now()
+	mock.ExpectQuery(`FROM segments WHERE id=\$1`).
+		WithArgs("seg-1").
+		WillReturnRows(pgxmock.NewRows(segmentCols).
+			AddRow("seg-1", "Pos 2", 0.001, 110.0, 0.005, 110.0, "LINESTRING(110 0.001,110 0.005)", 444.0, 25.0, "", now))
+	// Efforts from sessions the viewer may not read are never ranked.
+	mock.ExpectQuery(`SELECT DISTINCT ON \(e.user_id\) .* FROM segment_efforts e JOIN track_sessions ts ON ts.id = e.session_id WHERE e.segment_id=\$1 AND \(ts.visibility = 'public' OR COALESCE\(ts.user_id::text = \$4::text, false\)`).
+		WithArgs("seg-1", pgxmock.AnyArg(), true, "user-1", 5).
+		WillReturnRows(pgxmock.NewRows([]string{"rank", "user_id", "username", "effort_id", "session_id", "elapsed_sec", "started_at"}).
+			AddRow(1, "user-2", "rinjani", "effort-2", "session-2", 3000.0, now).
+			AddRow(2, "user-1", "merbabu", "effort-1", "session-1", 3600.0, now))
+	mock.ExpectQuery(`FROM segment_efforts e JOIN track_sessions ts ON ts.id = e.session_id WHERE e.segment_id=\$1 AND e.user_id=\$2::uuid .* AND \(ts.visibility = 'public'`).
+		WithArgs("seg-1", "user-1", pgxmock.AnyArg(), 1, "user-1").
+		WillReturnRows(pgxmock.NewRows([]string{"id", "segment_id", "session_id", "user_id", "started_at", "ended_at", "elapsed_sec"}).
+			AddRow("effort-1", "seg-1", "session-1", "user-1", now, now, 3600.0))
+
+	board, err := NewService(mock).Leaderboard(context.Background(), "seg-1", "user-1", LeaderboardQuery{Period: PeriodYear, Following: true, Limit: 5})
+	if err != nil {
+		t.Fatalf("leaderboard: %v", err)
+	}
+	if len(board.Entries) != 2 || board.Entries[0].Username != "rinjani" || board.PersonalBest == nil || !board.PersonalBest.PersonalBest {
+		t.Fatalf("unexpected board %+v", board)
+	}
+	if _, err := NewService(mock).Leaderboard(context.Background(), "seg-1", "user-1", LeaderboardQuery{Period: "week"}); !errors.Is(err, ErrInvalidLeaderboard) {
+		t.Fatalf("expected ErrInvalidLeaderboard, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
+
+func TestLineWKT(t *testing.T) {
+	path := [][2]float64{{-7.45, 110.43}, {-7.455, 110.44}}
+	wkt := lineWKT(path)
+	if wkt != "LINESTRING(110.43 -7.45,110.44 -7.455)" {
+		t.Fatalf("unexpected wkt %s", wkt)
+	}
+	back := parseLineWKT(wkt)
+	if len(back) != 2 || back[0] != path[0] || back[1] != path[1] {
+		t.Fatalf("round trip gave %v", back)
+	}
+	if parseLineWKT("POINT(1 2)") != nil {
+		t.Fatalf("expected nil for a point")
+	}
+}
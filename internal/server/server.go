@@ -1,8 +1,17 @@
 package server
 
 import (
+	"backend-summithub/internal/achievement"
 	"backend-summithub/internal/auth"
+	"backend-summithub/internal/chat"
 	"backend-summithub/internal/config"
+	"backend-summithub/internal/heatmap"
+	"backend-summithub/internal/mountain"
+	"backend-summithub/internal/notice"
+	"backend-summithub/internal/notification"
+	"backend-summithub/internal/permit"
+	"backend-summithub/internal/privacy"
+	"backend-summithub/internal/segment"
 	"backend-summithub/internal/social"
 	"backend-summithub/internal/storage"
 	"backend-summithub/internal/stream"
@@ -23,12 +32,25 @@ type Server struct {
 	DB     *pgxpool.Pool
 	Redis  *redis.Client
 	Stream *stream.Hub
+	// Tracking is shared with the background session workers started by cmd/api.
+	Tracking *tracking.Service
+	// Achievements evaluates every session as it ends.
+	Achievements *achievement.Service
+	// Segments matches every session against segments as it ends.
+	Segments *segment.Service
+	// Heatmap drops cached tiles as public sessions end or change visibility.
+	Heatmap *heatmap.Service
+	// Privacy hides positions inside users' privacy zones from everyone else.
+	Privacy *privacy.Service
 }
 
 func NewServer(cfg config.Config, db *pgxpool.Pool, redisClient *redis.Client) *Server {
 	app := fiber.New()
 	app.Use(recover.New())
 	app.Use(logger.New())
+	// Identify every caller that sends a token, so public routes can filter
+	// what they return by who is asking.
+	app.Use(auth.IdentifyMiddleware(cfg.JWTSecret))
 
 	s := &Server{
 		App:    app,
@@ -37,6 +59,22 @@ func NewServer(cfg config.Config, db *pgxpool.Pool, redisClient *redis.Client) *
 		Redis:  redisClient,
 		Stream: stream.NewHub(redisClient),
 	}
+	s.Privacy = privacy.NewService(db)
+	s.Tracking = tracking.NewService(db, s.Stream)
+	s.Tracking.SetPrivacy(s.Privacy)
+	s.Stream.SetReplaySource(s.Tracking)
+	s.Stream.SetGuard(s.Tracking)
+	s.Achievements = achievement.NewService(db)
+	s.Tracking.AddSessionEndListener(s.Achievements)
+	s.Segments = segment.NewService(db)
+	s.Tracking.AddSessionEndListener(s.Segments)
+	s.Heatmap = heatmap.NewService(db, heatmap.NewCache(redisClient, cfg.HeatmapCacheDir, cfg.HeatmapCacheTTL))
+	s.Tracking.AddSessionEndListener(s.Heatmap)
+	s.Tracking.AddVisibilityListener(s.Heatmap)
+	s.Privacy.AddZoneListener(s.Heatmap)
+	if cfg.SOSWebhookURL != "" {
+		s.Tracking.SetEscalator(tracking.NewWebhookEscalator(cfg.SOSWebhookURL))
+	}
 
 	registerRoutes(s)
 	return s
@@ -48,12 +86,24 @@ func registerRoutes(s *Server) {
 	})
 
 	jwtMiddleware := auth.JWTMiddleware(s.Cfg.JWTSecret)
+	publisherMiddleware := auth.RequireRole(s.DB, auth.RoleAdmin, auth.RoleParkAuthority)
 
 	auth.RegisterRoutes(s.App.Group("/auth"), auth.NewService(s.Cfg.JWTSecret, s.DB))
 	trip.RegisterRoutes(s.App.Group("/trips"), trip.NewService(s.DB), jwtMiddleware)
-	tracking.RegisterRoutes(s.App.Group("/tracking"), tracking.NewService(s.DB, s.Stream), jwtMiddleware)
+	mountain.RegisterRoutes(s.App.Group("/mountains"), mountain.NewService(s.DB), jwtMiddleware, publisherMiddleware)
+	notice.RegisterRoutes(s.App.Group("/notices"), notice.NewService(s.DB), jwtMiddleware, publisherMiddleware)
+	permit.RegisterRoutes(s.App.Group("/permits"), permit.NewService(s.DB), jwtMiddleware, publisherMiddleware)
+	notification.RegisterRoutes(s.App.Group("/notifications"), notification.NewService(s.DB), jwtMiddleware)
+	tracking.RegisterRoutes(s.App.Group("/tracking"), s.Tracking, jwtMiddleware)
+	achievement.RegisterRoutes(s.App.Group("/users"), s.Achievements, jwtMiddleware)
+	segment.RegisterRoutes(s.App.Group("/segments"), s.Segments, jwtMiddleware)
+	heatmap.RegisterRoutes(s.App.Group("/tiles"), s.Heatmap)
+	privacy.RegisterRoutes(s.App.Group("/privacy"), s.Privacy, jwtMiddleware)
+	tracking.RegisterGeofenceRoutes(s.App.Group("/tracking"), s.Tracking, jwtMiddleware, publisherMiddleware)
 	waypoint.RegisterRoutes(s.App.Group("/waypoints"), waypoint.NewService(s.DB), jwtMiddleware)
 	social.RegisterRoutes(s.App.Group("/social"), social.NewService(s.DB), jwtMiddleware)
 	storage.RegisterRoutes(s.App.Group("/storage"), storage.NewService(s.DB), jwtMiddleware)
+	chat.RegisterRoutes(s.App.Group("/chat"), chat.NewService(s.DB, s.Stream), jwtMiddleware)
+	tracking.RegisterStreamRoutes(s.App.Group("/stream"), s.Tracking, jwtMiddleware)
 	stream.RegisterRoutes(s.App.Group("/stream"), s.Stream)
 }
@@ -0,0 +1,72 @@
+package geo
+
+import (
+	"errors"
+	"math"
+	"strings"
+)
+
+var ErrInvalidPolyline = errors.New("invalid encoded polyline")
+
+// EncodePolyline encodes [lat, lng] pairs in Google's encoded polyline
+// format at five decimal places (about 1 m).
+func EncodePolyline(coords [][2]float64) string {
+	var b strings.Builder
+	var prevLat, prevLng int64
+	for _, c := range coords {
+		lat := int64(math.Round(c[0] * 1e5))
+		lng := int64(math.Round(c[1] * 1e5))
+		encodePolylineValue(&b, lat-prevLat)
+		encodePolylineValue(&b, lng-prevLng)
+		prevLat, prevLng = lat, lng
+	}
+	return b.String()
+}
+
+func encodePolylineValue(b *strings.Builder, v int64) {
+	u := uint64(v) << 1
+	if v < 0 {
+		u = ^u
+	}
+	for u >= 0x20 {
+		b.WriteByte(byte(0x20|(u&0x1F)) + 63)
+		u >>= 5
+	}
+	b.WriteByte(byte(u) + 63)
+}
+
+// DecodePolyline reverses EncodePolyline.
+func DecodePolyline(encoded string) ([][2]float64, error) {
+	var coords [][2]float64
+	var lat, lng int64
+	for i := 0; i < len(encoded); {
+		var deltas [2]int64
+		for k := range deltas {
+			var u uint64
+			var shift uint
+			for {
+				if i >= len(encoded) {
+					return nil, ErrInvalidPolyline
+				}
+				c := uint64(encoded[i]) - 63
+				i++
+				if c > 0x3F || shift > 60 {
+					return nil, ErrInvalidPolyline
+				}
+				u |= (c & 0x1F) << shift
+				shift += 5
+				if c < 0x20 {
+					break
+				}
+			}
+			deltas[k] = int64(u >> 1)
+			if u&1 != 0 {
+				deltas[k] = ^deltas[k]
+			}
+		}
+		lat += deltas[0]
+		lng += deltas[1]
+		coords = append(coords, [2]float64{float64(lat) / 1e5, float64(lng) / 1e5})
+	}
+	return coords, nil
+}
@@ -0,0 +1,19 @@
+package geo
+
+import "testing"
+
+func TestEncodePolyline(t *testing.T) {
+	// The example from Google's polyline algorithm documentation.
+	coords := [][2]float64{{38.5, -120.2}, {40.7, -120.95}, {43.252, -126.453}}
+	encoded := EncodePolyline(coords)
+	if encoded != "_p~iF~ps|U_ulLnnqC_mqNvxq`@" {
+		t.Fatalf("unexpected encoding %q", encoded)
+	}
+	decoded, err := DecodePolyline(encoded)
+	if err != nil || len(decoded) != 3 || decoded[2] != coords[2] {
+		t.Fatalf("unexpected decoding %v %v", decoded, err)
+	}
+	if _, err := DecodePolyline("_p~iF~ps|U_"); err == nil {
+		t.Fatalf("expected truncated polyline to fail")
+	}
+}
@@ -0,0 +1,261 @@
+package trackfile
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// The FIT decoder below reads the parts of the Garmin FIT protocol needed
+// for tracks: file header, definition and data messages (including
+// developer fields, which are skipped), compressed timestamp headers, the
+// trailing CRC, and the core fields of record messages. Other messages are
+// read past without being interpreted.
+
+var ErrInvalidFIT = errors.New("invalid FIT file")
+
+const (
+	fitMesgRecord = 20
+
+	fitFieldTimestamp        = 253
+	fitFieldPositionLat      = 0
+	fitFieldPositionLong     = 1
+	fitFieldAltitude         = 2
+	fitFieldHeartRate        = 3
+	fitFieldCadence          = 4
+	fitFieldSpeed            = 6
+	fitFieldTemperature      = 13
+	fitFieldEnhancedSpeed    = 73
+	fitFieldEnhancedAltitude = 78
+)
+
+// fitEpoch is the FIT timestamp origin, 1989-12-31T00:00:00Z.
+var fitEpoch = time.Date(1989, 12, 31, 0, 0, 0, 0, time.UTC)
+
+// semicircles converts FIT's sint32 angle unit to degrees.
+const semicircles = 180.0 / (1 << 31)
+
+type fitField struct {
+	num      byte
+	size     int
+	baseType byte
+}
+
+type fitDefinition struct {
+	global   uint16
+	order    binary.ByteOrder
+	fields   []fitField
+	devBytes int
+}
+
+func isFIT(data []byte) bool {
+	return len(data) >= 12 && string(data[8:12]) == ".FIT"
+}
+
+func parseFIT(data []byte) (Track, error) {
+	headerSize := int(data[0])
+	if headerSize < 12 || len(data) < headerSize {
+		return Track{}, fmt.Errorf("%w: bad header", ErrInvalidFIT)
+	}
+	dataSize := int(binary.LittleEndian.Uint32(data[4:8]))
+	end := headerSize + dataSize
+	if len(data) < end+2 {
+		return Track{}, fmt.Errorf("%w: truncated", ErrInvalidFIT)
+	}
+	if fitCRC(data[:end]) != binary.LittleEndian.Uint16(data[end:end+2]) {
+		return Track{}, fmt.Errorf("%w: checksum mismatch", ErrInvalidFIT)
+	}
+
+	track := Track{Format: FormatFIT}
+	definitions := map[byte]*fitDefinition{}
+	var lastTimestamp uint32
+	pos := headerSize
+	for pos < end {
+		header := data[pos]
+		pos++
+
+		var local byte
+		var timestamp uint32
+		compressed := header&0x80 != 0
+		switch {
+		case compressed:
+			local = (header >> 5) & 0x03
+			offset := uint32(header & 0x1F)
+			timestamp = lastTimestamp&^0x1F + offset
+			if offset < lastTimestamp&0x1F {
+				timestamp += 0x20
+			}
+			lastTimestamp = timestamp
+		case header&0x40 != 0:
+			def, n, err := readFITDefinition(data[pos:end], header&0x20 != 0)
+			if err != nil {
+				return Track{}, err
+			}
+			definitions[header&0x0F] = def
+			pos += n
+			continue
+		default:
+			local = header & 0x0F
+		}
+
+		def := definitions[local]
+		if def == nil {
+			return Track{}, fmt.Errorf("%w: data for undefined local message %d", ErrInvalidFIT, local)
+		}
+		values := map[byte]uint64{}
+		for _, f := range def.fields {
+			if pos+f.size > end {
+				return Track{}, fmt.Errorf("%w: truncated message", ErrInvalidFIT)
+			}
+			if v, ok := fitValue(data[pos:pos+f.size], f, def.order); ok {
+				values[f.num] = v
+			}
+			pos += f.size
+		}
+		pos += def.devBytes
+		if pos > end {
+			return Track{}, fmt.Errorf("%w: truncated message", ErrInvalidFIT)
+		}
+
+		if ts, ok := values[fitFieldTimestamp]; ok {
+			timestamp = uint32(ts)
+			lastTimestamp = timestamp
+		} else if !compressed {
+			timestamp = 0
+		}
+		if def.global == fitMesgRecord {
+			if p, ok := fitRecord(values, timestamp); ok {
+				track.Points = append(track.Points, p)
+			}
+		}
+	}
+	return track, nil
+}
+
+func readFITDefinition(data []byte, developer bool) (*fitDefinition, int, error) {
+	if len(data) < 5 {
+		return nil, 0, fmt.Errorf("%w: truncated definition", ErrInvalidFIT)
+	}
+	def := &fitDefinition{order: binary.LittleEndian}
+	if data[1] == 1 {
+		def.order = binary.BigEndian
+	}
+	def.global = def.order.Uint16(data[2:4])
+	count := int(data[4])
+	pos := 5
+	if len(data) < pos+3*count {
+		return nil, 0, fmt.Errorf("%w: truncated definition", ErrInvalidFIT)
+	}
+	for i := 0; i < count; i++ {
+		def.fields = append(def.fields, fitField{num: data[pos], size: int(data[pos+1]), baseType: data[pos+2]})
+		pos += 3
+	}
+	if developer {
+		if len(data) < pos+1 {
+			return nil, 0, fmt.Errorf("%w: truncated definition", ErrInvalidFIT)
+		}
+		devCount := int(data[pos])
+		pos++
+		if len(data) < pos+3*devCount {
+			return nil, 0, fmt.Errorf("%w: truncated definition", ErrInvalidFIT)
+		}
+		for i := 0; i < devCount; i++ {
+			def.devBytes += int(data[pos+1])
+			pos += 3
+		}
+	}
+	return def, pos, nil
+}
+
+// fitValue reads a single integer field, reporting false for the base
+// type's invalid marker and for arrays, strings and floats, which record
+// messages do not use for the fields read here.
+func fitValue(b []byte, f fitField, order binary.ByteOrder) (uint64, bool) {
+	switch f.baseType & 0x1F {
+	case 0x00, 0x02, 0x0A: // enum, uint8, uint8z
+		if f.size != 1 || (b[0] == 0xFF && f.baseType&0x1F != 0x0A) || (b[0] == 0 && f.baseType&0x1F == 0x0A) {
+			return 0, false
+		}
+		return uint64(b[0]), true
+	case 0x01: // sint8
+		if f.size != 1 || b[0] == 0x7F {
+			return 0, false
+		}
+		return uint64(int64(int8(b[0]))), true
+	case 0x03: // sint16
+		if f.size != 2 || order.Uint16(b) == 0x7FFF {
+			return 0, false
+		}
+		return uint64(int64(int16(order.Uint16(b)))), true
+	case 0x04, 0x0B: // uint16, uint16z
+		if f.size != 2 || order.Uint16(b) == 0xFFFF {
+			return 0, false
+		}
+		return uint64(order.Uint16(b)), true
+	case 0x05: // sint32
+		if f.size != 4 || order.Uint32(b) == 0x7FFFFFFF {
+			return 0, false
+		}
+		return uint64(int64(int32(order.Uint32(b)))), true
+	case 0x06, 0x0C: // uint32, uint32z
+		if f.size != 4 || order.Uint32(b) == 0xFFFFFFFF {
+			return 0, false
+		}
+		return uint64(order.Uint32(b)), true
+	}
+	return 0, false
+}
+
+func fitRecord(values map[byte]uint64, timestamp uint32) (Point, bool) {
+	lat, okLat := values[fitFieldPositionLat]
+	lng, okLng := values[fitFieldPositionLong]
+	if !okLat || !okLng || timestamp == 0 {
+		return Point{}, false
+	}
+	p := Point{
+		Time: fitEpoch.Add(time.Duration(timestamp) * time.Second),
+		Lat:  float64(int32(lat)) * semicircles,
+		Lng:  float64(int32(lng)) * semicircles,
+	}
+	if v, ok := values[fitFieldEnhancedAltitude]; ok {
+		p.ElevationM = float64(v)/5 - 500
+	} else if v, ok := values[fitFieldAltitude]; ok {
+		p.ElevationM = float64(v)/5 - 500
+	}
+	if v, ok := values[fitFieldEnhancedSpeed]; ok {
+		p.SpeedMps = float64(v) / 1000
+	} else if v, ok := values[fitFieldSpeed]; ok {
+		p.SpeedMps = float64(v) / 1000
+	}
+	if v, ok := values[fitFieldHeartRate]; ok {
+		p.HeartRateBpm = int(v)
+	}
+	if v, ok := values[fitFieldCadence]; ok {
+		p.CadenceRpm = int(v)
+	}
+	if v, ok := values[fitFieldTemperature]; ok {
+		c := float64(int64(v))
+		p.TemperatureC = &c
+	}
+	return p, true
+}
+
+var fitCRCTable = [16]uint16{
+	0x0000, 0xCC01, 0xD801, 0x1400, 0xF001, 0x3C00, 0x2800, 0xE401,
+	0xA001, 0x6C00, 0x7800, 0xB401, 0x5000, 0x9C01, 0x8801, 0x4400,
+}
+
+// fitCRC is the CRC-16 defined by the FIT protocol.
+func fitCRC(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		tmp := fitCRCTable[crc&0xF]
+		crc = (crc >> 4) & 0x0FFF
+		crc = crc ^ tmp ^ fitCRCTable[b&0xF]
+		tmp = fitCRCTable[crc&0xF]
+		crc = (crc >> 4) & 0x0FFF
+		crc = crc ^ tmp ^ fitCRCTable[(b>>4)&0xF]
+	}
+	return crc
+}
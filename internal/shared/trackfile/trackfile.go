@@ -0,0 +1,84 @@
+// Package trackfile decodes recorded tracks exported by GPS watches and apps
+// in GPX, TCX or FIT format.
+package trackfile
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"time"
+)
+
+const (
+	FormatGPX = "gpx"
+	FormatTCX = "tcx"
+	FormatFIT = "fit"
+)
+
+var (
+	ErrUnknownFormat = errors.New("unrecognised track file: expected GPX, TCX or FIT")
+	ErrNoPoints      = errors.New("track file has no timestamped positions")
+)
+
+// Point is one recorded position. Zero values mean the file did not carry
+// the measurement; TemperatureC is a pointer because 0 °C is a reading.
+type Point struct {
+	Time         time.Time
+	Lat          float64
+	Lng          float64
+	ElevationM   float64
+	SpeedMps     float64
+	HeartRateBpm int
+	CadenceRpm   int
+	TemperatureC *float64
+}
+
+// Track is the decoded content of a file, with points in time order.
+type Track struct {
+	Format string
+	Name   string
+	Points []Point
+}
+
+// Parse detects the file's format from its content and decodes it. Points
+// without a timestamp or position are dropped.
+func Parse(data []byte) (Track, error) {
+	var track Track
+	var err error
+	switch {
+	case isFIT(data):
+		track, err = parseFIT(data)
+	case sniffXML(data, "<TrainingCenterDatabase"):
+		track, err = parseTCX(data)
+	case sniffXML(data, "<gpx"):
+		track, err = parseGPX(data)
+	default:
+		return Track{}, ErrUnknownFormat
+	}
+	if err != nil {
+		return Track{}, err
+	}
+
+	points := track.Points[:0]
+	for _, p := range track.Points {
+		if !p.Time.IsZero() && (p.Lat != 0 || p.Lng != 0) {
+			points = append(points, p)
+		}
+	}
+	if len(points) == 0 {
+		return Track{}, ErrNoPoints
+	}
+	sort.SliceStable(points, func(i, j int) bool { return points[i].Time.Before(points[j].Time) })
+	track.Points = points
+	return track, nil
+}
+
+// sniffXML looks for the root element near the start of the document,
+// after any XML declaration and comments.
+func sniffXML(data []byte, root string) bool {
+	head := data
+	if len(head) > 4096 {
+		head = head[:4096]
+	}
+	return bytes.Contains(head, []byte(root))
+}
@@ -0,0 +1,128 @@
+package trackfile
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	return data
+}
+
+func near(a, b float64) bool {
+	d := a - b
+	return d < 1e-6 && d > -1e-6
+}
+
+var start = time.Date(2026, 8, 6, 7, 20, 0, 0, time.UTC)
+
+func TestParseGPX(t *testing.T) {
+	track, err := Parse(readFixture(t, "hike.gpx"))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if track.Format != FormatGPX || track.Name != "Semeru summit push" {
+		t.Fatalf("unexpected track %q %q", track.Format, track.Name)
+	}
+	// The untimed last point is dropped and the rest sorted by time.
+	if len(track.Points) != 3 {
+		t.Fatalf("expected 3 points, got %d", len(track.Points))
+	}
+	first, second, third := track.Points[0], track.Points[1], track.Points[2]
+	if !first.Time.Equal(start) || !second.Time.Equal(start.Add(10*time.Second)) || !third.Time.Equal(start.Add(20*time.Second)) {
+		t.Fatalf("points not in time order: %v %v %v", first.Time, second.Time, third.Time)
+	}
+	if !near(first.Lat, -7.9425) || !near(first.Lng, 112.953) || first.ElevationM != 2100 {
+		t.Fatalf("unexpected position %+v", first)
+	}
+	if first.HeartRateBpm != 110 || first.CadenceRpm != 55 || first.SpeedMps != 1.2 || first.TemperatureC == nil || *first.TemperatureC != 18 {
+		t.Fatalf("unexpected extensions %+v", first)
+	}
+	if third.TemperatureC == nil || *third.TemperatureC != 0 {
+		t.Fatalf("0 °C should be kept as a reading, got %v", third.TemperatureC)
+	}
+	if second.HeartRateBpm != 0 || second.TemperatureC != nil {
+		t.Fatalf("point without extensions should have no sensor data, got %+v", second)
+	}
+}
+
+func TestParseTCX(t *testing.T) {
+	track, err := Parse(readFixture(t, "hike.tcx"))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if track.Format != FormatTCX || track.Name != "2026-08-06T07:20:00Z" {
+		t.Fatalf("unexpected track %q %q", track.Format, track.Name)
+	}
+	// The trackpoint without a position is skipped.
+	if len(track.Points) != 2 {
+		t.Fatalf("expected 2 points, got %d", len(track.Points))
+	}
+	first, second := track.Points[0], track.Points[1]
+	if !first.Time.Equal(start) || first.HeartRateBpm != 110 || first.CadenceRpm != 55 || first.SpeedMps != 1.2 || first.ElevationM != 2100 {
+		t.Fatalf("unexpected first point %+v", first)
+	}
+	if !second.Time.Equal(start.Add(10*time.Second)) || !near(second.Lat, -7.943) || second.HeartRateBpm != 118 {
+		t.Fatalf("unexpected second point %+v", second)
+	}
+}
+
+func TestParseFIT(t *testing.T) {
+	track, err := Parse(readFixture(t, "hike.fit"))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if track.Format != FormatFIT || len(track.Points) != 4 {
+		t.Fatalf("expected 4 FIT records, got %q %d", track.Format, len(track.Points))
+	}
+	for i, p := range track.Points {
+		if want := start.Add(time.Duration(i*10) * time.Second); !p.Time.Equal(want) {
+			t.Fatalf("point %d at %v, want %v", i, p.Time, want)
+		}
+	}
+	first := track.Points[0]
+	if !near(first.Lat, -7.9425) || !near(first.Lng, 112.953) {
+		t.Fatalf("unexpected position %v,%v", first.Lat, first.Lng)
+	}
+	if first.ElevationM != 2100 || first.SpeedMps != 1.2 || first.HeartRateBpm != 110 || first.CadenceRpm != 55 ||
+		first.TemperatureC == nil || *first.TemperatureC != 18 {
+		t.Fatalf("unexpected first record %+v", first)
+	}
+	// Records with compressed timestamps come from a big-endian definition
+	// with a developer field; the last one has an invalid heart rate.
+	third, fourth := track.Points[2], track.Points[3]
+	if third.ElevationM != 2109 || third.HeartRateBpm != 125 || !near(third.Lat, -7.9436) {
+		t.Fatalf("unexpected compressed record %+v", third)
+	}
+	if fourth.HeartRateBpm != 0 || fourth.CadenceRpm != 58 {
+		t.Fatalf("invalid heart rate should be dropped, got %+v", fourth)
+	}
+}
+
+func TestParseFITRejectsBadChecksum(t *testing.T) {
+	data := readFixture(t, "hike.fit")
+	data[len(data)-3] ^= 0xFF
+	if _, err := Parse(data); !errors.Is(err, ErrInvalidFIT) {
+		t.Fatalf("expected ErrInvalidFIT, got %v", err)
+	}
+	if _, err := Parse(data[:20]); !errors.Is(err, ErrInvalidFIT) {
+		t.Fatalf("expected truncated file to fail, got %v", err)
+	}
+}
+
+func TestParseRejectsUnknownAndEmpty(t *testing.T) {
+	if _, err := Parse([]byte(`{"type":"FeatureCollection"}`)); !errors.Is(err, ErrUnknownFormat) {
+		t.Fatalf("expected ErrUnknownFormat, got %v", err)
+	}
+	empty := []byte(`<?xml version="1.0"?><gpx version="1.1"><trk><trkseg></trkseg></trk></gpx>`)
+	if _, err := Parse(empty); !errors.Is(err, ErrNoPoints) {
+		t.Fatalf("expected ErrNoPoints, got %v", err)
+	}
+}
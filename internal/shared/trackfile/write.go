@@ -0,0 +1,82 @@
+package trackfile
+
+import (
+	"encoding/xml"
+	"io"
+	"time"
+)
+
+const gpxCreator = "SummitHub"
+
+type gpxOut struct {
+	XMLName  xml.Name `xml:"gpx"`
+	Version  string   `xml:"version,attr"`
+	Creator  string   `xml:"creator,attr"`
+	NS       string   `xml:"xmlns,attr"`
+	NSTPX    string   `xml:"xmlns:gpxtpx,attr"`
+	Metadata struct {
+		Name string `xml:"name,omitempty"`
+	} `xml:"metadata"`
+	Track struct {
+		Name   string        `xml:"name,omitempty"`
+		Points []gpxOutPoint `xml:"trkseg>trkpt"`
+	} `xml:"trk"`
+}
+
+type gpxOutPoint struct {
+	Lat        float64        `xml:"lat,attr"`
+	Lng        float64        `xml:"lon,attr"`
+	Elevation  float64        `xml:"ele"`
+	Time       string         `xml:"time"`
+	Extensions *gpxOutSensors `xml:"extensions>gpxtpx:TrackPointExtension,omitempty"`
+}
+
+// gpxOutSensors follows the element order of Garmin's TrackPointExtension
+// v2 schema.
+type gpxOutSensors struct {
+	Temp      *float64 `xml:"gpxtpx:atemp,omitempty"`
+	HeartRate int      `xml:"gpxtpx:hr,omitempty"`
+	Cadence   int      `xml:"gpxtpx:cad,omitempty"`
+	Speed     float64  `xml:"gpxtpx:speed,omitempty"`
+}
+
+// WriteGPX encodes the track as GPX 1.1. Heart rate, cadence, temperature
+// and speed go into Garmin's TrackPointExtension, which most apps read.
+func WriteGPX(w io.Writer, track Track) error {
+	out := gpxOut{
+		Version: "1.1",
+		Creator: gpxCreator,
+		NS:      "http://www.topografix.com/GPX/1/1",
+		NSTPX:   "http://www.garmin.com/xmlschemas/TrackPointExtension/v2",
+	}
+	out.Metadata.Name = track.Name
+	out.Track.Name = track.Name
+	for _, p := range track.Points {
+		point := gpxOutPoint{
+			Lat:       p.Lat,
+			Lng:       p.Lng,
+			Elevation: p.ElevationM,
+			Time:      p.Time.UTC().Format(time.RFC3339Nano),
+		}
+		if p.HeartRateBpm > 0 || p.CadenceRpm > 0 || p.TemperatureC != nil || p.SpeedMps > 0 {
+			point.Extensions = &gpxOutSensors{
+				Temp:      p.TemperatureC,
+				HeartRate: p.HeartRateBpm,
+				Cadence:   p.CadenceRpm,
+				Speed:     p.SpeedMps,
+			}
+		}
+		out.Track.Points = append(out.Track.Points, point)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(out); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,40 @@
+package trackfile
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteGPXRoundTrip(t *testing.T) {
+	cold := -2.5
+	track := Track{Name: "Rinjani", Points: []Point{
+		{Time: start, Lat: -8.41, Lng: 116.46, ElevationM: 3726, SpeedMps: 0.8, HeartRateBpm: 131, CadenceRpm: 48, TemperatureC: &cold},
+		{Time: start.Add(30 * time.Second), Lat: -8.412, Lng: 116.461, ElevationM: 3710},
+	}}
+
+	var buf bytes.Buffer
+	if err := WriteGPX(&buf, track); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if strings.Count(buf.String(), "TrackPointExtension>") != 2 {
+		t.Fatalf("expected one extension block for the point with sensors:\n%s", buf.String())
+	}
+
+	parsed, err := Parse(buf.Bytes())
+	if err != nil {
+		t.Fatalf("parse written file: %v", err)
+	}
+	if parsed.Name != "Rinjani" || len(parsed.Points) != 2 {
+		t.Fatalf("unexpected track %+v", parsed)
+	}
+	first, second := parsed.Points[0], parsed.Points[1]
+	if !first.Time.Equal(start) || first.HeartRateBpm != 131 || first.CadenceRpm != 48 || first.SpeedMps != 0.8 ||
+		first.TemperatureC == nil || *first.TemperatureC != cold || first.ElevationM != 3726 {
+		t.Fatalf("sensors lost in round trip: %+v", first)
+	}
+	if second.HeartRateBpm != 0 || second.TemperatureC != nil || !near(second.Lat, -8.412) {
+		t.Fatalf("unexpected second point %+v", second)
+	}
+}
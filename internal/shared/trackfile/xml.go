@@ -0,0 +1,161 @@
+package trackfile
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Element names below are matched on their local name, so the Garmin and
+// Suunto extension namespaces (gpxtpx:, ns3:, ...) all decode the same way.
+
+type gpxFile struct {
+	Metadata struct {
+		Name string `xml:"name"`
+	} `xml:"metadata"`
+	Tracks []struct {
+		Name     string `xml:"name"`
+		Segments []struct {
+			Points []gpxPoint `xml:"trkpt"`
+		} `xml:"trkseg"`
+	} `xml:"trk"`
+}
+
+type gpxPoint struct {
+	Lat       float64  `xml:"lat,attr"`
+	Lng       float64  `xml:"lon,attr"`
+	Elevation float64  `xml:"ele"`
+	Time      string   `xml:"time"`
+	Speed     float64  `xml:"speed"`
+	HeartRate int      `xml:"extensions>TrackPointExtension>hr"`
+	Cadence   int      `xml:"extensions>TrackPointExtension>cad"`
+	Temp      *float64 `xml:"extensions>TrackPointExtension>atemp"`
+	ExtSpeed  float64  `xml:"extensions>TrackPointExtension>speed"`
+}
+
+func parseGPX(data []byte) (Track, error) {
+	var file gpxFile
+	if err := decodeXML(data, &file); err != nil {
+		return Track{}, fmt.Errorf("gpx: %w", err)
+	}
+
+	track := Track{Format: FormatGPX, Name: file.Metadata.Name}
+	for _, trk := range file.Tracks {
+		if track.Name == "" {
+			track.Name = trk.Name
+		}
+		for _, seg := range trk.Segments {
+			for _, p := range seg.Points {
+				at, err := parseXMLTime(p.Time)
+				if err != nil {
+					return Track{}, fmt.Errorf("gpx: %w", err)
+				}
+				speed := p.Speed
+				if speed == 0 {
+					speed = p.ExtSpeed
+				}
+				track.Points = append(track.Points, Point{
+					Time:         at,
+					Lat:          p.Lat,
+					Lng:          p.Lng,
+					ElevationM:   p.Elevation,
+					SpeedMps:     speed,
+					HeartRateBpm: p.HeartRate,
+					CadenceRpm:   p.Cadence,
+					TemperatureC: p.Temp,
+				})
+			}
+		}
+	}
+	return track, nil
+}
+
+type tcxFile struct {
+	Activities []struct {
+		ID   string `xml:"Id"`
+		Laps []struct {
+			Tracks []struct {
+				Points []tcxPoint `xml:"Trackpoint"`
+			} `xml:"Track"`
+		} `xml:"Lap"`
+	} `xml:"Activities>Activity"`
+}
+
+type tcxPoint struct {
+	Time     string `xml:"Time"`
+	Position *struct {
+		Lat float64 `xml:"LatitudeDegrees"`
+		Lng float64 `xml:"LongitudeDegrees"`
+	} `xml:"Position"`
+	Altitude  float64 `xml:"AltitudeMeters"`
+	HeartRate int     `xml:"HeartRateBpm>Value"`
+	Cadence   int     `xml:"Cadence"`
+	Speed     float64 `xml:"Extensions>TPX>Speed"`
+}
+
+func parseTCX(data []byte) (Track, error) {
+	var file tcxFile
+	if err := decodeXML(data, &file); err != nil {
+		return Track{}, fmt.Errorf("tcx: %w", err)
+	}
+
+	track := Track{Format: FormatTCX}
+	for _, activity := range file.Activities {
+		if track.Name == "" {
+			track.Name = activity.ID
+		}
+		for _, lap := range activity.Laps {
+			for _, trk := range lap.Tracks {
+				for _, p := range trk.Points {
+					// Indoor or signal-lost points carry no position.
+					if p.Position == nil {
+						continue
+					}
+					at, err := parseXMLTime(p.Time)
+					if err != nil {
+						return Track{}, fmt.Errorf("tcx: %w", err)
+					}
+					track.Points = append(track.Points, Point{
+						Time:         at,
+						Lat:          p.Position.Lat,
+						Lng:          p.Position.Lng,
+						ElevationM:   p.Altitude,
+						SpeedMps:     p.Speed,
+						HeartRateBpm: p.HeartRate,
+						CadenceRpm:   p.Cadence,
+					})
+				}
+			}
+		}
+	}
+	return track, nil
+}
+
+func decodeXML(data []byte, v any) error {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	// Some exporters declare ISO-8859-1. The fields read here are numbers and
+	// timestamps, so the bytes are passed through unchanged.
+	decoder.CharsetReader = func(_ string, r io.Reader) (io.Reader, error) { return r, nil }
+	return decoder.Decode(v)
+}
+
+// parseXMLTime reads the xsd:dateTime used by GPX and TCX. A missing time
+// is returned as zero and the point is dropped later.
+func parseXMLTime(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if at, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return at.UTC(), nil
+	}
+	// Local time without a zone, as some older devices write it.
+	at, err := time.Parse("2006-01-02T15:04:05", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q", value)
+	}
+	return at, nil
+}
@@ -66,7 +66,8 @@ func RegisterRoutes(r fiber.Router, svc *Service, authMiddleware fiber.Handler)
 		if radius == 0 {
 			radius = 5
 		}
-		posts, err := svc.Nearby(c.Context(), lat, lng, radius)
+		viewerID, _ := c.Locals("user_id").(string)
+		posts, err := svc.Nearby(c.Context(), lat, lng, radius, viewerID)
 		if err != nil {
 			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
 		}
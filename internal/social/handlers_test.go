@@ -131,7 +131,7 @@ func TestSocialHandlersNearby(t *testing.T) {
 
 	createdAt := time.Now()
 	mock.ExpectQuery(`SELECT id, user_id, content, ST_Y\(location::geometry\), ST_X\(location::geometry\), visibility, created_at`).
-		WithArgs(106.8, -6.2, 5000.0).
+		WithArgs(106.8, -6.2, 5000.0, "").
 		WillReturnRows(pgxmock.NewRows([]string{"id", "user_id", "content", "lat", "lng", "visibility", "created_at"}).
 			AddRow("post-1", "user-1", "hello", -6.2, 106.8, "public", createdAt))
 
@@ -149,6 +149,34 @@ func TestSocialHandlersNearby(t *testing.T) {
 	}
 }
 
+func TestSocialHandlersNearbyPassesViewer(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	mock.ExpectQuery(`FROM posts WHERE ST_DWithin.* AND \(posts.user_id::text = \$4 OR NOT EXISTS \(SELECT 1 FROM privacy_zones`).
+		WithArgs(106.8, -6.2, 5000.0, "user-1").
+		WillReturnRows(pgxmock.NewRows([]string{"id", "user_id", "content", "lat", "lng", "visibility", "created_at"}))
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("user_id", "user-1")
+		return c.Next()
+	})
+	RegisterRoutes(app.Group("/social"), NewService(mock), func(c *fiber.Ctx) error { return c.Next() })
+
+	req := httptest.NewRequest(http.MethodGet, "/social/posts/nearby?lat=-6.2&lng=106.8", nil)
+	resp, err := app.Test(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("nearby status: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
 func TestSocialHandlersErrors(t *testing.T) {
 	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
 	if err != nil {
@@ -173,7 +201,7 @@ func TestSocialHandlersErrors(t *testing.T) {
 		WillReturnError(errSocial)
 
 	mock.ExpectQuery(`SELECT id, user_id, content, ST_Y\(location::geometry\), ST_X\(location::geometry\), visibility, created_at`).
-		WithArgs(106.8, -6.2, 5000.0).
+		WithArgs(106.8, -6.2, 5000.0, "").
 		WillReturnError(errSocial)
 
 	app := fiber.New()
@@ -249,7 +277,7 @@ func TestSocialHandlersNearbyDefaultRadius(t *testing.T) {
 
 	createdAt := time.Now()
 	mock.ExpectQuery(`SELECT id, user_id, content, ST_Y\(location::geometry\), ST_X\(location::geometry\), visibility, created_at`).
-		WithArgs(106.8, -6.2, 5000.0).
+		WithArgs(106.8, -6.2, 5000.0, "").
 		WillReturnRows(pgxmock.NewRows([]string{"id", "user_id", "content", "lat", "lng", "visibility", "created_at"}).
 			AddRow("post-1", "user-1", "hello", -6.2, 106.8, "public", createdAt))
 
@@ -5,6 +5,7 @@ import (
 	"sort"
 
 	"backend-summithub/internal/db"
+	"backend-summithub/internal/privacy"
 
 	"github.com/google/uuid"
 )
@@ -93,13 +94,18 @@ func (s *Service) Feed(ctx context.Context, userID string) ([]Post, error) {
 	return posts, nil
 }
 
-func (s *Service) Nearby(ctx context.Context, lat, lng, radiusKm float64) ([]Post, error) {
-	rows, err := s.db.Query(ctx, `
+// Nearby lists posts within radiusKm of a position. Other users' posts
+// placed inside one of their privacy zones are left out for viewerID.
+func (s *Service) Nearby(ctx context.Context, lat, lng, radiusKm float64, viewerID string) ([]Post, error) {
+	rows, err := privacy.QueryPositions(ctx, s.db, viewerID, func(visible func(location, owner string) string) string {
+		return `
 		SELECT id, user_id, content, ST_Y(location::geometry), ST_X(location::geometry), visibility, created_at
 		FROM posts
 		WHERE ST_DWithin(location, ST_SetSRID(ST_MakePoint($1,$2), 4326)::geography, $3)
+		  AND ` + visible("posts.location", "posts.user_id") + `
 		ORDER BY created_at DESC
-	`, lng, lat, radiusKm*1000)
+	`
+	}, lng, lat, radiusKm*1000)
 	if err != nil {
 		return nil, err
 	}
@@ -76,7 +76,7 @@ func TestFeedAndNearby(t *testing.T) {
 	}
 
 	mock.ExpectQuery(`SELECT id, user_id, content, ST_Y\(location::geometry\), ST_X\(location::geometry\), visibility, created_at`).
-		WithArgs(106.8, -6.2, 1000.0).
+		WithArgs(106.8, -6.2, 1000.0, "").
 		WillReturnRows(pgxmock.NewRows([]string{"id", "user_id", "content", "lat", "lng", "visibility", "created_at"}).
 			AddRow("post-2", "user-2", "near", -6.2, 106.8, "public", createdAt))
 
@@ -84,7 +84,7 @@ func TestFeedAndNearby(t *testing.T) {
 		WithArgs(pgxmock.AnyArg()).
 		WillReturnRows(pgxmock.NewRows([]string{"id", "post_id", "photo_url", "created_at"}))
 
-	nearby, err := svc.Nearby(context.Background(), -6.2, 106.8, 1)
+	nearby, err := svc.Nearby(context.Background(), -6.2, 106.8, 1, "")
 	if err != nil {
 		t.Fatalf("nearby: %v", err)
 	}
@@ -218,11 +218,11 @@ func TestNearbyQueryError(t *testing.T) {
 	defer mock.Close()
 
 	mock.ExpectQuery(`SELECT id, user_id, content, ST_Y\(location::geometry\), ST_X\(location::geometry\), visibility, created_at`).
-		WithArgs(106.8, -6.2, 1000.0).
+		WithArgs(106.8, -6.2, 1000.0, "").
 		WillReturnError(errSocial)
 
 	svc := NewService(mock)
-	_, err = svc.Nearby(context.Background(), -6.2, 106.8, 1)
+	_, err = svc.Nearby(context.Background(), -6.2, 106.8, 1, "")
 	if err == nil {
 		t.Fatalf("expected error")
 	}
@@ -302,11 +302,11 @@ func TestNearbyScanError(t *testing.T) {
 	defer mock.Close()
 
 	mock.ExpectQuery(`SELECT id, user_id, content, ST_Y\(location::geometry\), ST_X\(location::geometry\), visibility, created_at`).
-		WithArgs(106.8, -6.2, 1000.0).
+		WithArgs(106.8, -6.2, 1000.0, "").
 		WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow("post-1"))
 
 	svc := NewService(mock)
-	_, err = svc.Nearby(context.Background(), -6.2, 106.8, 1)
+	_, err = svc.Nearby(context.Background(), -6.2, 106.8, 1, "")
 	if err == nil {
 		t.Fatalf("expected error")
 	}
@@ -339,7 +339,7 @@ func TestNearbyPhotosQueryError(t *testing.T) {
 
 	createdAt := time.Now()
 	mock.ExpectQuery(`SELECT id, user_id, content, ST_Y\(location::geometry\), ST_X\(location::geometry\), visibility, created_at`).
-		WithArgs(106.8, -6.2, 1000.0).
+		WithArgs(106.8, -6.2, 1000.0, "").
 		WillReturnRows(pgxmock.NewRows([]string{"id", "user_id", "content", "lat", "lng", "visibility", "created_at"}).
 			AddRow("post-1", "user-1", "content", -6.2, 106.8, "public", createdAt))
 
@@ -348,7 +348,7 @@ func TestNearbyPhotosQueryError(t *testing.T) {
 		WillReturnError(errSocial)
 
 	svc := NewService(mock)
-	_, err = svc.Nearby(context.Background(), -6.2, 106.8, 1)
+	_, err = svc.Nearby(context.Background(), -6.2, 106.8, 1, "")
 	if err == nil {
 		t.Fatalf("expected error")
 	}
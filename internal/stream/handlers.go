@@ -1,14 +1,34 @@
 package stream
 
 import (
+	"context"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/websocket/v2"
 )
 
+// Guard decides who may watch a session's stream, live or replayed.
+type Guard interface {
+	CanView(ctx context.Context, sessionID, viewerID string) (bool, error)
+}
+
+// SetGuard limits the session stream to the viewers guard allows. Without
+// one anyone may watch.
+func (h *Hub) SetGuard(guard Guard) {
+	h.guard = guard
+}
+
 func RegisterRoutes(r fiber.Router, hub *Hub) {
-	r.Get("/ws/:sessionID", websocket.New(func(c *websocket.Conn) {
+	r.Get("/ws/:sessionID", sessionChannelOnly, viewerAllowed(hub), websocket.New(func(c *websocket.Conn) {
 		sessionID := c.Params("sessionID")
-		client := hub.Register(sessionID)
+		// Set by auth.IdentifyMiddleware when the upgrade carried a token.
+		viewerID, _ := c.Locals("user_id").(string)
+		if c.Query("replay") == "1" && hub.replay != nil {
+			serveReplay(c, hub.replay, sessionID, viewerID)
+			onStreamClosed(sessionID)
+			return
+		}
+		client := hub.RegisterViewer(sessionID, viewerID)
 
 		done := make(chan struct{})
 		go func() {
@@ -31,6 +51,34 @@ func RegisterRoutes(r fiber.Router, hub *Hub) {
 	}))
 }
 
+// sessionChannelOnly keeps internal channels, which carry data guarded by
+// their own routes, out of the public session stream.
+func sessionChannelOnly(c *fiber.Ctx) error {
+	if IsInternalChannel(c.Params("sessionID")) {
+		return fiber.NewError(fiber.StatusNotFound, "stream not found")
+	}
+	return c.Next()
+}
+
+// viewerAllowed refuses the upgrade to viewers the hub's guard turns away,
+// before they receive anything. Refused sessions look missing.
+func viewerAllowed(hub *Hub) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if hub.guard == nil {
+			return c.Next()
+		}
+		viewerID, _ := c.Locals("user_id").(string)
+		ok, err := hub.guard.CanView(c.Context(), c.Params("sessionID"), viewerID)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		}
+		if !ok {
+			return fiber.NewError(fiber.StatusNotFound, "stream not found")
+		}
+		return c.Next()
+	}
+}
+
 var writeMessageFn = func(c *websocket.Conn, msg []byte) error {
 	return c.WriteMessage(websocket.TextMessage, msg)
 }
@@ -1,6 +1,8 @@
 package stream
 
 import (
+	"context"
+	"errors"
 	"net"
 	"net/http"
 	"net/http/httptest"
@@ -310,3 +312,56 @@ func TestStreamHandlersFullPath(t *testing.T) {
 		t.Fatalf("expected close hook")
 	}
 }
+
+func TestStreamHandlersRejectInternalChannel(t *testing.T) {
+	app := fiber.New()
+	RegisterRoutes(app.Group("/stream"), NewHub(nil))
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/stream/ws/"+InternalChannel("trip-chat", "x"), nil))
+	if err != nil {
+		t.Fatalf("request error: %v", err)
+	}
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 for internal channel, got %d", resp.StatusCode)
+	}
+}
+
+type viewerGuard map[string]bool
+
+func (g viewerGuard) CanView(_ context.Context, sessionID, viewerID string) (bool, error) {
+	if sessionID == "session-err" {
+		return false, errors.New("db down")
+	}
+	return g[sessionID+"/"+viewerID], nil
+}
+
+func TestStreamHandlersGuardViewers(t *testing.T) {
+	hub := NewHub(nil)
+	hub.SetGuard(viewerGuard{"session-1/user-1": true})
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		if id := c.Get("X-User"); id != "" {
+			c.Locals("user_id", id)
+		}
+		return c.Next()
+	})
+	RegisterRoutes(app.Group("/stream"), hub)
+
+	for _, tc := range []struct {
+		session, viewer string
+		status          int
+	}{
+		// An allowed viewer reaches the upgrade, which a plain request fails.
+		{"session-1", "user-1", http.StatusUpgradeRequired},
+		{"session-1", "user-2", http.StatusNotFound},
+		{"session-1", "", http.StatusNotFound},
+		{"session-err", "user-1", http.StatusInternalServerError},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/stream/ws/"+tc.session+"?replay=1", nil)
+		req.Header.Set("X-User", tc.viewer)
+		resp, err := app.Test(req)
+		if err != nil || resp.StatusCode != tc.status {
+			t.Fatalf("%s as %q: expected %d, got %v %v", tc.session, tc.viewer, tc.status, resp.StatusCode, err)
+		}
+	}
+}
@@ -3,25 +3,34 @@ package stream
 import (
 	"context"
 	"log"
+	"strings"
 	"sync"
 
+	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
 )
 
 type Hub struct {
 	redis   *redis.Client
+	origin  string
 	clients map[string]map[*Client]struct{}
 	mu      sync.RWMutex
+	replay  ReplaySource
+	guard   Guard
 }
 
 type Client struct {
 	SessionID string
-	Send      chan []byte
+	// ViewerID is the user watching, or empty for an anonymous viewer. It
+	// decides who receives BroadcastPrivate messages.
+	ViewerID string
+	Send     chan []byte
 }
 
 func NewHub(redisClient *redis.Client) *Hub {
 	h := &Hub{
 		redis:   redisClient,
+		origin:  uuid.NewString(),
 		clients: map[string]map[*Client]struct{}{},
 	}
 
@@ -31,11 +40,34 @@ func NewHub(redisClient *redis.Client) *Hub {
 	return h
 }
 
-func (h *Hub) Register(sessionID string) *Client {
-	client := &Client{
+// InternalChannel names a hub channel owned by another feature, such as a
+// trip's chat. The public session stream refuses these names, so the owning
+// feature's authenticated route is the only way to subscribe to them.
+func InternalChannel(kind, id string) string {
+	return kind + ":" + id
+}
+
+// IsInternalChannel reports whether name belongs to an internal channel.
+func IsInternalChannel(name string) bool {
+	return strings.Contains(name, ":")
+}
+
+func newClient(sessionID string) *Client {
+	return &Client{
 		SessionID: sessionID,
 		Send:      make(chan []byte, 64),
 	}
+}
+
+// Register adds an anonymous client to the channel.
+func (h *Hub) Register(sessionID string) *Client {
+	return h.RegisterViewer(sessionID, "")
+}
+
+// RegisterViewer adds a client watching as viewerID to the channel.
+func (h *Hub) RegisterViewer(sessionID, viewerID string) *Client {
+	client := newClient(sessionID)
+	client.ViewerID = viewerID
 
 	h.mu.Lock()
 	defer h.mu.Unlock()
@@ -59,49 +91,153 @@ func (h *Hub) Unregister(client *Client) {
 	close(client.Send)
 }
 
+// Broadcast delivers payload to local clients of the channel and publishes it
+// to Redis so clients connected to other API instances receive it too.
 func (h *Hub) Broadcast(sessionID string, payload []byte) {
-	h.mu.RLock()
-	clients := h.clients[sessionID]
-	h.mu.RUnlock()
+	h.deliver(sessionID, payload)
 
-	for client := range clients {
-		select {
-		case client.Send <- payload:
-		default:
+	if h.redis != nil {
+		err := h.redis.Publish(context.Background(), redisChannel(sessionID), h.envelope(payload)).Err()
+		if err != nil {
+			log.Printf("redis publish error: %v", err)
 		}
 	}
+}
+
+// BroadcastUrgent is Broadcast for messages a slow client must not miss,
+// such as emergencies: when a client's buffer is full its oldest queued
+// message is dropped to make room instead of this one.
+func (h *Hub) BroadcastUrgent(sessionID string, payload []byte) {
+	h.deliverUrgent(sessionID, payload)
 
 	if h.redis != nil {
-		err := h.redis.Publish(context.Background(), redisChannel(sessionID), payload).Err()
+		err := h.redis.Publish(context.Background(), urgentChannel(sessionID), h.envelope(payload)).Err()
 		if err != nil {
 			log.Printf("redis publish error: %v", err)
 		}
 	}
 }
 
+// BroadcastPrivate is Broadcast for messages only ownerID may see, such as a
+// position inside their privacy zones: clients watching as anyone else,
+// including anonymous ones, do not receive it.
+func (h *Hub) BroadcastPrivate(sessionID, ownerID string, payload []byte) {
+	h.deliverPrivate(sessionID, ownerID, payload)
+
+	if h.redis != nil {
+		msg := h.envelope([]byte(ownerID + envelopeSep + string(payload)))
+		if err := h.redis.Publish(context.Background(), privateChannel(sessionID), msg).Err(); err != nil {
+			log.Printf("redis publish error: %v", err)
+		}
+	}
+}
+
 func (h *Hub) subscribeRedis() {
 	ctx := context.Background()
-	pubsub := h.redis.Subscribe(ctx, "tracking:*:broadcast")
+	pubsub := h.redis.PSubscribe(ctx, "tracking:*:broadcast", "tracking:*:urgent", "tracking:*"+privateSuffix)
 	defer pubsub.Close()
 
 	for msg := range pubsub.Channel() {
-		sessionID := sessionIDFromChannel(msg.Channel)
-		h.mu.RLock()
-		clients := h.clients[sessionID]
-		h.mu.RUnlock()
-		for client := range clients {
+		origin, payload := openEnvelope(msg.Payload)
+		if origin == h.origin {
+			// already delivered locally by Broadcast
+			continue
+		}
+		if sessionID, ok := strings.CutSuffix(msg.Channel, urgentSuffix); ok {
+			h.deliverUrgent(strings.TrimPrefix(sessionID, "tracking:"), []byte(payload))
+			continue
+		}
+		if sessionID, ok := strings.CutSuffix(msg.Channel, privateSuffix); ok {
+			ownerID, private, ok := strings.Cut(payload, envelopeSep)
+			if ok && ownerID != "" {
+				h.deliverPrivate(strings.TrimPrefix(sessionID, "tracking:"), ownerID, []byte(private))
+			}
+			continue
+		}
+		h.deliver(sessionIDFromChannel(msg.Channel), []byte(payload))
+	}
+}
+
+func (h *Hub) deliverPrivate(sessionID, ownerID string, payload []byte) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for client := range h.clients[sessionID] {
+		if ownerID == "" || client.ViewerID != ownerID {
+			continue
+		}
+		select {
+		case client.Send <- payload:
+		default:
+		}
+	}
+}
+
+func (h *Hub) deliver(sessionID string, payload []byte) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for client := range h.clients[sessionID] {
+		select {
+		case client.Send <- payload:
+		default:
+		}
+	}
+}
+
+func (h *Hub) deliverUrgent(sessionID string, payload []byte) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for client := range h.clients[sessionID] {
+		for sent := false; !sent; {
 			select {
-			case client.Send <- []byte(msg.Payload):
+			case client.Send <- payload:
+				sent = true
 			default:
+				select {
+				case <-client.Send:
+				default:
+				}
 			}
 		}
 	}
 }
 
+// envelopeSep separates the publishing hub's origin id from the payload on
+// Redis, so a hub can skip its own messages.
+const envelopeSep = "\x1f"
+
+func (h *Hub) envelope(payload []byte) string {
+	return h.origin + envelopeSep + string(payload)
+}
+
+// openEnvelope splits a Redis message into origin and payload. Messages
+// published without an envelope are returned unchanged with no origin.
+func openEnvelope(msg string) (string, string) {
+	origin, payload, ok := strings.Cut(msg, envelopeSep)
+	if !ok || uuid.Validate(origin) != nil {
+		return "", msg
+	}
+	return origin, payload
+}
+
 func redisChannel(sessionID string) string {
 	return "tracking:" + sessionID + ":broadcast"
 }
 
+const urgentSuffix = ":urgent"
+
+func urgentChannel(sessionID string) string {
+	return "tracking:" + sessionID + urgentSuffix
+}
+
+const privateSuffix = ":private"
+
+func privateChannel(sessionID string) string {
+	return "tracking:" + sessionID + privateSuffix
+}
+
 func sessionIDFromChannel(ch string) string {
 	// tracking:{session}:broadcast
 	const prefix = "tracking:"
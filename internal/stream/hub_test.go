@@ -101,3 +101,160 @@ func TestHubRedisPublishError(t *testing.T) {
 
 	hub.Broadcast("session-bad", []byte("ping"))
 }
+
+func TestHubRedisFansOutAcrossInstances(t *testing.T) {
+	s := miniredis.RunT(t)
+	clientA := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	defer clientA.Close()
+	clientB := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	defer clientB.Close()
+
+	hubA := NewHub(clientA)
+	hubB := NewHub(clientB)
+	local := hubA.Register("trip-chat:1")
+	defer hubA.Unregister(local)
+	remote := hubB.Register("trip-chat:1")
+	defer hubB.Unregister(remote)
+
+	time.Sleep(20 * time.Millisecond)
+	hubA.Broadcast("trip-chat:1", []byte("hi"))
+
+	for name, ws := range map[string]*Client{"local": local, "remote": remote} {
+		select {
+		case msg := <-ws.Send:
+			if string(msg) != "hi" {
+				t.Fatalf("%s: unexpected message %q", name, msg)
+			}
+		case <-time.After(200 * time.Millisecond):
+			t.Fatalf("%s: timeout waiting for message", name)
+		}
+	}
+
+	select {
+	case msg := <-local.Send:
+		t.Fatalf("local client received duplicate %q", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestOpenEnvelope(t *testing.T) {
+	hub := NewHub(nil)
+	origin, payload := openEnvelope(hub.envelope([]byte("a\x1fb")))
+	if origin != hub.origin || payload != "a\x1fb" {
+		t.Fatalf("unexpected envelope: %q %q", origin, payload)
+	}
+	origin, payload = openEnvelope("raw")
+	if origin != "" || payload != "raw" {
+		t.Fatalf("unexpected raw message: %q %q", origin, payload)
+	}
+}
+
+func TestBroadcastUrgentMakesRoomOnFullBuffer(t *testing.T) {
+	hub := NewHub(nil)
+	client := hub.Register("trip-sessions:1")
+	defer hub.Unregister(client)
+
+	for i := 0; i < cap(client.Send); i++ {
+		hub.Broadcast("trip-sessions:1", []byte("position"))
+	}
+	hub.Broadcast("trip-sessions:1", []byte("dropped"))
+	hub.BroadcastUrgent("trip-sessions:1", []byte("sos"))
+
+	var last string
+	for len(client.Send) > 0 {
+		last = string(<-client.Send)
+	}
+	if last != "sos" {
+		t.Fatalf("expected urgent message last in a full buffer, got %q", last)
+	}
+}
+
+func TestHubRedisFansOutUrgent(t *testing.T) {
+	s := miniredis.RunT(t)
+	clientA := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	defer clientA.Close()
+	clientB := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	defer clientB.Close()
+
+	hubA := NewHub(clientA)
+	hubB := NewHub(clientB)
+	remote := hubB.Register("trip-sessions:1")
+	defer hubB.Unregister(remote)
+	for i := 0; i < cap(remote.Send); i++ {
+		remote.Send <- []byte("position")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	hubA.BroadcastUrgent("trip-sessions:1", []byte("sos"))
+
+	deadline := time.After(200 * time.Millisecond)
+	for {
+		select {
+		case msg := <-remote.Send:
+			if string(msg) == "sos" {
+				return
+			}
+		case <-deadline:
+			t.Fatalf("timeout waiting for urgent message")
+		}
+	}
+}
+
+func TestBroadcastPrivateOnlyReachesOwner(t *testing.T) {
+	hub := NewHub(nil)
+	owner := hub.RegisterViewer("session-1", "user-1")
+	other := hub.RegisterViewer("session-1", "user-2")
+	anonymous := hub.Register("session-1")
+
+	hub.BroadcastPrivate("session-1", "user-1", []byte("home"))
+	if msg := <-owner.Send; string(msg) != "home" {
+		t.Fatalf("expected owner to receive the message, got %q", msg)
+	}
+	select {
+	case msg := <-other.Send:
+		t.Fatalf("unexpected message for another user: %q", msg)
+	case msg := <-anonymous.Send:
+		t.Fatalf("unexpected message for an anonymous viewer: %q", msg)
+	default:
+	}
+
+	// an empty owner must not match anonymous viewers
+	hub.BroadcastPrivate("session-1", "", []byte("nobody"))
+	select {
+	case msg := <-anonymous.Send:
+		t.Fatalf("unexpected message for an anonymous viewer: %q", msg)
+	default:
+	}
+}
+
+func TestHubRedisFansOutPrivate(t *testing.T) {
+	s := miniredis.RunT(t)
+	clientA := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	defer clientA.Close()
+	clientB := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	defer clientB.Close()
+
+	hubA := NewHub(clientA)
+	hubB := NewHub(clientB)
+	other := hubB.Register("session-1")
+	defer hubB.Unregister(other)
+	owner := hubB.RegisterViewer("session-1", "user-1")
+	defer hubB.Unregister(owner)
+
+	time.Sleep(20 * time.Millisecond)
+	hubA.BroadcastPrivate("session-1", "user-1", []byte("home"))
+
+	select {
+	case msg := <-owner.Send:
+		if string(msg) != "home" {
+			t.Fatalf("unexpected payload %q", msg)
+		}
+	case <-time.After(200 * time.Millisecond):
+		t.Fatalf("timeout waiting for private message")
+	}
+	select {
+	case msg := <-other.Send:
+		t.Fatalf("unexpected message for an anonymous viewer: %q", msg)
+	default:
+	}
+}
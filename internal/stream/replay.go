@@ -0,0 +1,220 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/websocket/v2"
+)
+
+// maxReplaySpeed bounds the speed factor of a replay.
+const maxReplaySpeed = 1000
+
+var ErrInvalidReplaySpeed = errors.New("replay speed must be a number between 0 and 1000")
+
+// Frame is one stored broadcast of a session: the payload live clients
+// received and the time it was recorded.
+type Frame struct {
+	At      time.Time
+	Payload []byte
+}
+
+// ReplaySource loads the frames of a finished session in recorded order, as
+// viewerID may see them.
+type ReplaySource interface {
+	ReplayFrames(ctx context.Context, sessionID, viewerID string) ([]Frame, error)
+}
+
+// SetReplaySource enables ?replay=1 on the session stream.
+func (h *Hub) SetReplaySource(source ReplaySource) {
+	h.replay = source
+}
+
+// Replay state frames sent next to the session's own payloads.
+const (
+	ReplayPlaying = "playing"
+	ReplayPaused  = "paused"
+	ReplayEnded   = "ended"
+)
+
+// ReplayState is sent when a replay starts, after every control message and
+// when the last frame has been sent. Position is the index of the next frame.
+type ReplayState struct {
+	Type       string     `json:"type"`
+	State      string     `json:"state,omitempty"`
+	Position   int        `json:"position"`
+	Total      int        `json:"total"`
+	Speed      float64    `json:"speed,omitempty"`
+	RecordedAt *time.Time `json:"recorded_at,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// ReplayControl is a message from a replay client: "pause", "resume",
+// "seek" to the first frame at or after RecordedAt, or "speed".
+type ReplayControl struct {
+	Type       string    `json:"type"`
+	RecordedAt time.Time `json:"recorded_at"`
+	Speed      float64   `json:"speed"`
+}
+
+func parseReplaySpeed(raw string) (float64, error) {
+	if raw == "" {
+		return 1, nil
+	}
+	speed, err := strconv.ParseFloat(raw, 64)
+	if err != nil || !validReplaySpeed(speed) {
+		return 0, ErrInvalidReplaySpeed
+	}
+	return speed, nil
+}
+
+func validReplaySpeed(speed float64) bool {
+	return speed > 0 && speed <= maxReplaySpeed
+}
+
+// serveReplay plays a finished session to one connection. Frames go through
+// a Client's Send channel like live broadcasts, so the writer is shared; the
+// client is not registered with the hub and receives nothing live.
+func serveReplay(c *websocket.Conn, source ReplaySource, sessionID, viewerID string) {
+	client := newClient(sessionID)
+	done := make(chan struct{})
+	go func() {
+		for msg := range client.Send {
+			if err := writeMessageFn(c, msg); err != nil {
+				break
+			}
+		}
+		close(done)
+	}()
+
+	speed, err := parseReplaySpeed(c.Query("speed"))
+	var frames []Frame
+	if err == nil {
+		frames, err = source.ReplayFrames(context.Background(), sessionID, viewerID)
+	}
+	if err != nil {
+		// The error is flushed before the handler returns and closes the
+		// connection.
+		payload, _ := json.Marshal(ReplayState{Type: "replay", Error: err.Error()})
+		client.Send <- payload
+		close(client.Send)
+		<-done
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	controls := make(chan ReplayControl)
+	played := make(chan struct{})
+	go func() {
+		replay(ctx, frames, speed, client.Send, controls)
+		close(played)
+	}()
+
+	for {
+		_, raw, err := c.ReadMessage()
+		if err != nil {
+			break
+		}
+		var control ReplayControl
+		if json.Unmarshal(raw, &control) != nil {
+			continue
+		}
+		select {
+		case controls <- control:
+		case <-played:
+		}
+	}
+	cancel()
+	<-played
+	close(client.Send)
+	<-done
+}
+
+// replay sends frames to send, waiting the recorded gap divided by speed
+// between them, and applies controls until ctx ends. It keeps running after
+// the last frame so the client can seek back.
+func replay(ctx context.Context, frames []Frame, speed float64, send chan<- []byte, controls <-chan ReplayControl) {
+	next, paused := 0, false
+	// gap is the recorded time between frames[next] and the frame before;
+	// the first frame, and the first after a seek or resume, go out at once.
+	var gap time.Duration
+
+	state := func() bool {
+		s := ReplayState{Type: "replay", State: ReplayPlaying, Position: next, Total: len(frames), Speed: speed}
+		switch {
+		case next >= len(frames):
+			s.State = ReplayEnded
+		case paused:
+			s.State = ReplayPaused
+		}
+		if next < len(frames) {
+			s.RecordedAt = &frames[next].At
+		}
+		payload, _ := json.Marshal(s)
+		select {
+		case send <- payload:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	if !state() {
+		return
+	}
+
+	for {
+		var timer <-chan time.Time
+		var t *time.Timer
+		if !paused && next < len(frames) {
+			t = time.NewTimer(time.Duration(float64(gap) / speed))
+			timer = t.C
+		}
+		select {
+		case <-ctx.Done():
+			stopTimer(t)
+			return
+		case <-timer:
+			select {
+			case send <- frames[next].Payload:
+			case <-ctx.Done():
+				return
+			}
+			next++
+			if next == len(frames) {
+				if !state() {
+					return
+				}
+				continue
+			}
+			gap = frames[next].At.Sub(frames[next-1].At)
+		case control := <-controls:
+			stopTimer(t)
+			switch control.Type {
+			case "pause":
+				paused = true
+			case "resume":
+				paused, gap = false, 0
+			case "seek":
+				next = sort.Search(len(frames), func(i int) bool { return !frames[i].At.Before(control.RecordedAt) })
+				gap = 0
+			case "speed":
+				if validReplaySpeed(control.Speed) {
+					speed = control.Speed
+				}
+			}
+			if !state() {
+				return
+			}
+		}
+	}
+}
+
+func stopTimer(t *time.Timer) {
+	if t != nil {
+		t.Stop()
+	}
+}
@@ -0,0 +1,214 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	gws "github.com/gorilla/websocket"
+)
+
+type fakeReplaySource struct {
+	frames []Frame
+	err    error
+}
+
+func (f fakeReplaySource) ReplayFrames(context.Context, string, string) ([]Frame, error) {
+	return f.frames, f.err
+}
+
+func replayFrames(n int, gap time.Duration) []Frame {
+	start := time.Date(2026, 8, 20, 5, 0, 0, 0, time.UTC)
+	frames := make([]Frame, n)
+	for i := range frames {
+		frames[i] = Frame{At: start.Add(time.Duration(i) * gap), Payload: []byte{byte('a' + i)}}
+	}
+	return frames
+}
+
+func readState(t *testing.T, send <-chan []byte) ReplayState {
+	t.Helper()
+	select {
+	case msg := <-send:
+		var state ReplayState
+		if err := json.Unmarshal(msg, &state); err != nil || state.Type != "replay" {
+			t.Fatalf("expected a replay state, got %q", msg)
+		}
+		return state
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for state")
+	}
+	return ReplayState{}
+}
+
+func readFrame(t *testing.T, send <-chan []byte) string {
+	t.Helper()
+	select {
+	case msg := <-send:
+		return string(msg)
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for frame")
+	}
+	return ""
+}
+
+func TestReplayPacesFramesBySpeed(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	send := make(chan []byte, 64)
+	// Ten seconds apart at 200x is 50 ms per frame.
+	go replay(ctx, replayFrames(3, 10*time.Second), 200, send, nil)
+
+	if state := readState(t, send); state.State != ReplayPlaying || state.Total != 3 || state.Speed != 200 {
+		t.Fatalf("unexpected start state %+v", state)
+	}
+	started := time.Now()
+	got := readFrame(t, send) + readFrame(t, send) + readFrame(t, send)
+	if got != "abc" {
+		t.Fatalf("expected frames in order, got %q", got)
+	}
+	if elapsed := time.Since(started); elapsed < 90*time.Millisecond {
+		t.Fatalf("frames were not paced, took %v", elapsed)
+	}
+	if state := readState(t, send); state.State != ReplayEnded || state.Position != 3 || state.RecordedAt != nil {
+		t.Fatalf("unexpected end state %+v", state)
+	}
+}
+
+func TestReplayPauseSeekAndResume(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	send := make(chan []byte, 64)
+	controls := make(chan ReplayControl)
+	frames := replayFrames(5, time.Hour)
+	go replay(ctx, frames, 1, send, controls)
+
+	readState(t, send)
+	if frame := readFrame(t, send); frame != "a" {
+		t.Fatalf("expected the first frame at once, got %q", frame)
+	}
+
+	controls <- ReplayControl{Type: "pause"}
+	if state := readState(t, send); state.State != ReplayPaused || state.Position != 1 {
+		t.Fatalf("unexpected paused state %+v", state)
+	}
+	// Seeking between frames lands on the next one and stays paused.
+	controls <- ReplayControl{Type: "seek", RecordedAt: frames[2].At.Add(time.Minute)}
+	if state := readState(t, send); state.State != ReplayPaused || state.Position != 3 || !state.RecordedAt.Equal(frames[3].At) {
+		t.Fatalf("unexpected state after seek %+v", state)
+	}
+	controls <- ReplayControl{Type: "speed", Speed: 5000}
+	if state := readState(t, send); state.Speed != 1 {
+		t.Fatalf("expected an out of range speed to be ignored, got %+v", state)
+	}
+
+	controls <- ReplayControl{Type: "resume"}
+	if state := readState(t, send); state.State != ReplayPlaying {
+		t.Fatalf("unexpected state after resume %+v", state)
+	}
+	if frame := readFrame(t, send); frame != "d" {
+		t.Fatalf("expected the seeked frame at once, got %q", frame)
+	}
+	select {
+	case msg := <-send:
+		t.Fatalf("expected the next frame to wait an hour, got %q", msg)
+	case <-time.After(30 * time.Millisecond):
+	}
+}
+
+func TestParseReplaySpeed(t *testing.T) {
+	if speed, err := parseReplaySpeed(""); err != nil || speed != 1 {
+		t.Fatalf("expected real time by default, got %v %v", speed, err)
+	}
+	if speed, err := parseReplaySpeed("10"); err != nil || speed != 10 {
+		t.Fatalf("unexpected speed %v %v", speed, err)
+	}
+	for _, raw := range []string{"0", "-2", "fast", "1001"} {
+		if _, err := parseReplaySpeed(raw); !errors.Is(err, ErrInvalidReplaySpeed) {
+			t.Fatalf("expected %q to be rejected", raw)
+		}
+	}
+}
+
+func serveStream(t *testing.T, hub *Hub) string {
+	t.Helper()
+	app := fiber.New()
+	RegisterRoutes(app.Group("/stream"), hub)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen error: %v", err)
+	}
+	go func() {
+		_ = app.Listener(ln)
+	}()
+	t.Cleanup(func() {
+		_ = app.Shutdown()
+		ln.Close()
+	})
+	return "ws://" + ln.Addr().String() + "/stream/ws/"
+}
+
+func TestStreamHandlersReplay(t *testing.T) {
+	hub := NewHub(nil)
+	hub.SetReplaySource(fakeReplaySource{frames: replayFrames(3, time.Second)})
+	base := serveStream(t, hub)
+
+	conn, _, err := gws.DefaultDialer.Dial(base+"session-1?replay=1&speed=1000", nil)
+	if err != nil {
+		t.Fatalf("dial error: %v", err)
+	}
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+
+	var got []string
+	for len(got) < 5 {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("read error: %v", err)
+		}
+		got = append(got, string(msg))
+	}
+	if got[1] != "a" || got[2] != "b" || got[3] != "c" {
+		t.Fatalf("unexpected replay %q", got)
+	}
+
+	// Live broadcasts do not reach a replay.
+	hub.Broadcast("session-1", []byte("live"))
+	if err := conn.WriteJSON(ReplayControl{Type: "seek", RecordedAt: replayFrames(3, time.Second)[1].At}); err != nil {
+		t.Fatalf("write error: %v", err)
+	}
+	for _, want := range []string{"", "b", "c"} {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("read error: %v", err)
+		}
+		if want != "" && string(msg) != want {
+			t.Fatalf("expected %q after seek, got %q", want, msg)
+		}
+	}
+}
+
+func TestStreamHandlersReplayError(t *testing.T) {
+	hub := NewHub(nil)
+	hub.SetReplaySource(fakeReplaySource{err: errors.New("tracking session has not ended")})
+	base := serveStream(t, hub)
+
+	conn, _, err := gws.DefaultDialer.Dial(base+"session-1?replay=1", nil)
+	if err != nil {
+		t.Fatalf("dial error: %v", err)
+	}
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+
+	var state ReplayState
+	if err := conn.ReadJSON(&state); err != nil || state.Error != "tracking session has not ended" {
+		t.Fatalf("expected the error frame, got %+v %v", state, err)
+	}
+	if _, _, err := conn.ReadMessage(); err == nil {
+		t.Fatalf("expected the connection to close")
+	}
+}
@@ -0,0 +1,163 @@
+package tracking
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"backend-summithub/internal/db"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// autoCloseLockKey is the Postgres advisory lock held during a sweep so only
+// one API replica closes sessions at a time.
+const autoCloseLockKey int64 = 0x53485f4155544f43
+
+// autoCloseBatchSize bounds how many sessions one sweep closes.
+const autoCloseBatchSize = 100
+
+// AutoCloser periodically ends active sessions that have received no points
+// for the idle period, typically because the app was killed on the mountain.
+type AutoCloser struct {
+	svc      *Service
+	idle     time.Duration
+	interval time.Duration
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewAutoCloser(svc *Service, idle, interval time.Duration) *AutoCloser {
+	return &AutoCloser{svc: svc, idle: idle, interval: interval}
+}
+
+// Start runs a sweep every interval until Stop is called or ctx ends.
+func (a *AutoCloser) Start(ctx context.Context) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.cancel != nil {
+		return
+	}
+	ctx, a.cancel = context.WithCancel(ctx)
+	done := make(chan struct{})
+	a.done = done
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(a.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := a.svc.CloseIdleSessions(ctx, time.Now().Add(-a.idle)); err != nil && ctx.Err() == nil {
+					log.Printf("auto-close sessions: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop ends the worker and waits for a running sweep to finish.
+func (a *AutoCloser) Stop() {
+	a.mu.Lock()
+	cancel, done := a.cancel, a.done
+	a.cancel, a.done = nil, nil
+	a.mu.Unlock()
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-done
+}
+
+// CloseIdleSessions marks active sessions with no points received since
+// cutoff as auto_closed. ended_at is set to the last point's recorded_at (or
+// the start time for sessions without points) and totals are finalised. The
+// sweep is skipped when another replica holds the advisory lock.
+func (s *Service) CloseIdleSessions(ctx context.Context, cutoff time.Time) ([]Session, error) {
+	var closed []Session
+	err := db.WithTx(ctx, s.db, func(tx pgx.Tx) error {
+		var locked bool
+		if err := tx.QueryRow(ctx, `SELECT pg_try_advisory_xact_lock($1)`, autoCloseLockKey).Scan(&locked); err != nil {
+			return err
+		}
+		if !locked {
+			return nil
+		}
+
+		ids, err := idleSessionIDs(ctx, tx, cutoff)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			session, err := lockSession(ctx, tx, id)
+			if err != nil {
+				return err
+			}
+			if session.Status != StatusActive {
+				continue
+			}
+			// A point may have arrived between the scan and the lock.
+			var lastReceived, lastRecorded *time.Time
+			if err := tx.QueryRow(ctx, `
+				SELECT MAX(created_at), MAX(recorded_at) FROM track_points WHERE session_id=$1
+			`, id).Scan(&lastReceived, &lastRecorded); err != nil {
+				return err
+			}
+			if lastReceived != nil && !lastReceived.Before(cutoff) {
+				continue
+			}
+			endedAt := session.StartedAt
+			if lastRecorded != nil {
+				endedAt = *lastRecorded
+			}
+			if err := finishSession(ctx, tx, &session, StatusAutoClosed, &endedAt); err != nil {
+				return err
+			}
+			closed = append(closed, session)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, session := range closed {
+		s.broadcastEnded(session)
+		s.notifyEnded(session)
+	}
+	return closed, nil
+}
+
+func idleSessionIDs(ctx context.Context, tx pgx.Tx, cutoff time.Time) ([]string, error) {
+	rows, err := tx.Query(ctx, `
+		SELECT ts.id
+		FROM track_sessions ts
+		WHERE ts.status = 'active'
+		  AND ts.started_at < $1
+		  AND NOT EXISTS (
+		      SELECT 1 FROM track_points tp
+		      WHERE tp.session_id = ts.id AND tp.created_at >= $1
+		  )
+		ORDER BY ts.started_at
+		LIMIT $2
+	`, cutoff, autoCloseBatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,127 @@
+package tracking
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"backend-summithub/internal/stream"
+
+	"github.com/pashagolub/pgxmock/v3"
+)
+
+func TestCloseIdleSessionsSkippedWithoutLock(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT pg_try_advisory_xact_lock\(\$1\)`).
+		WithArgs(autoCloseLockKey).
+		WillReturnRows(pgxmock.NewRows([]string{"locked"}).AddRow(false))
+	mock.ExpectCommit()
+
+	closed, err := NewService(mock, nil).CloseIdleSessions(context.Background(), time.Now().Add(-time.Hour))
+	if err != nil || len(closed) != 0 {
+		t.Fatalf("expected no sessions closed, got %v %v", closed, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
+
+func TestCloseIdleSessions(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	hub := stream.NewHub(nil)
+	client := hub.Register("session-idle")
+	defer hub.Unregister(client)
+
+	cutoff := time.Now().Add(-2 * time.Hour)
+	lastRecorded := cutoff.Add(-30 * time.Minute)
+	lastReceived := cutoff.Add(-10 * time.Minute)
+	recent := cutoff.Add(time.Minute)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT pg_try_advisory_xact_lock\(\$1\)`).
+		WithArgs(autoCloseLockKey).
+		WillReturnRows(pgxmock.NewRows([]string{"locked"}).AddRow(true))
+	mock.ExpectQuery(`FROM track_sessions ts WHERE ts.status = 'active'`).
+		WithArgs(cutoff, autoCloseBatchSize).
+		WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow("session-idle").AddRow("session-busy"))
+
+	mock.ExpectQuery(`FROM track_sessions WHERE id=\$1\s+FOR UPDATE`).
+		WithArgs("session-idle").
+		WillReturnRows(lockedSession("session-idle", StatusActive))
+	mock.ExpectQuery(`SELECT MAX\(created_at\), MAX\(recorded_at\) FROM track_points`).
+		WithArgs("session-idle").
+		WillReturnRows(pgxmock.NewRows([]string{"created", "recorded"}).AddRow(&lastReceived, &lastRecorded))
+	expectRecompute(mock, "session-idle", [][3]float64{{-7.94, 112.95, 2100}, {-7.95, 112.95, 2130}})
+	mock.ExpectQuery(`UPDATE track_sessions SET status=\$2, ended_at=COALESCE\(\$3, NOW\(\)\)`).
+		WithArgs("session-idle", StatusAutoClosed, &lastRecorded).
+		WillReturnRows(pgxmock.NewRows([]string{"status", "ended_at"}).AddRow(StatusAutoClosed, lastRecorded))
+
+	// A point arrived for the second session after the scan.
+	mock.ExpectQuery(`FROM track_sessions WHERE id=\$1\s+FOR UPDATE`).
+		WithArgs("session-busy").
+		WillReturnRows(lockedSession("session-busy", StatusActive))
+	mock.ExpectQuery(`SELECT MAX\(created_at\), MAX\(recorded_at\) FROM track_points`).
+		WithArgs("session-busy").
+		WillReturnRows(pgxmock.NewRows([]string{"created", "recorded"}).AddRow(&recent, &recent))
+	mock.ExpectCommit()
+
+	closed, err := NewService(mock, hub).CloseIdleSessions(context.Background(), cutoff)
+	if err != nil {
+		t.Fatalf("close idle: %v", err)
+	}
+	if len(closed) != 1 || closed[0].ID != "session-idle" || closed[0].Status != StatusAutoClosed || !closed[0].EndedAt.Equal(lastRecorded) {
+		t.Fatalf("unexpected closed sessions %+v", closed)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+
+	select {
+	case msg := <-client.Send:
+		var event SessionEvent
+		if err := json.Unmarshal(msg, &event); err != nil || event.Type != EventSessionEnded || event.Session.Status != StatusAutoClosed {
+			t.Fatalf("unexpected event %s", msg)
+		}
+	case <-time.After(100 * time.Millisecond):
+		t.Fatalf("expected session_ended broadcast")
+	}
+}
+
+func TestAutoCloserStartStop(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT pg_try_advisory_xact_lock`).
+		WithArgs(autoCloseLockKey).
+		WillReturnRows(pgxmock.NewRows([]string{"locked"}).AddRow(false))
+	mock.ExpectCommit()
+
+	closer := NewAutoCloser(NewService(mock, nil), time.Hour, 20*time.Millisecond)
+	closer.Start(context.Background())
+	deadline := time.Now().Add(time.Second)
+	for mock.ExpectationsWereMet() != nil && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	closer.Stop()
+	closer.Stop()
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expected a sweep before stop: %v", err)
+	}
+}
@@ -0,0 +1,218 @@
+package tracking
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"backend-summithub/internal/db"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrSessionNotFound = errors.New("tracking session not found")
+	ErrInvalidBatch    = errors.New("invalid point batch")
+)
+
+const (
+	// maxBatchPoints bounds a single upload; a day of 1 Hz tracking is split
+	// into a few requests.
+	maxBatchPoints = 20000
+	// batchChunkSize is how many points go into one multi-row INSERT.
+	batchChunkSize = 5000
+)
+
+// AddPoints stores a batch of points recorded offline. The whole batch is
+// written in one transaction holding the session row lock, so concurrent or
+// retried uploads of the same points cannot both insert them: points whose
+// client_point_id or recorded_at is already stored for the session are
+// skipped. Session totals are recomputed once at the end.
+func (s *Service) AddPoints(ctx context.Context, sessionID string, points []TrackPoint) (BatchResult, error) {
+	result := BatchResult{SessionID: sessionID, Received: len(points)}
+	if len(points) == 0 || len(points) > maxBatchPoints {
+		return BatchResult{}, fmt.Errorf("%w: between 1 and %d points required", ErrInvalidBatch, maxBatchPoints)
+	}
+	for i, p := range points {
+		if p.RecordedAt.IsZero() {
+			return BatchResult{}, fmt.Errorf("%w: point %d has no recorded_at", ErrInvalidBatch, i)
+		}
+		if err := validateSensors(p); err != nil {
+			return BatchResult{}, fmt.Errorf("%w: point %d: %v", ErrInvalidBatch, i, err)
+		}
+	}
+	unique := dedupeBatch(points)
+
+	var session Session
+	var routeEvents []RouteEvent
+	var crossings []GeofenceCrossing
+	var profile *TrackingProfile
+	err := db.WithTx(ctx, s.db, func(tx pgx.Tx) error {
+		var err error
+		session, err = lockSession(ctx, tx, sessionID)
+		if err != nil {
+			return err
+		}
+		if isEnded(session.Status) {
+			return ErrSessionEnded
+		}
+
+		for start := 0; start < len(unique); start += batchChunkSize {
+			end := start + batchChunkSize
+			if end > len(unique) {
+				end = len(unique)
+			}
+			inserted, err := insertChunk(ctx, tx, sessionID, unique[start:end])
+			if err != nil {
+				return err
+			}
+			result.Inserted += inserted
+		}
+
+		result.TotalDistanceM, result.TotalElevationGainM, err = recomputeTotals(ctx, tx, sessionID)
+		if err != nil {
+			return err
+		}
+		routeEvents, err = s.checkRoute(ctx, tx, session, unique)
+		if err != nil {
+			return err
+		}
+		crossings, err = s.checkGeofences(ctx, tx, session, unique)
+		if err != nil {
+			return err
+		}
+		profile, err = s.adaptProfile(ctx, tx, session, routeEvents)
+		return err
+	})
+	if err != nil {
+		return BatchResult{}, err
+	}
+	result.Duplicates = int64(result.Received) - result.Inserted
+
+	if result.Inserted > 0 {
+		latest := unique[0]
+		for _, p := range unique[1:] {
+			if p.RecordedAt.After(latest.RecordedAt) {
+				latest = p
+			}
+		}
+		latest.SessionID = sessionID
+		session = s.withLiveMask(ctx, session)
+		s.broadcastPoint(session, latest)
+	}
+	s.broadcastRouteEvents(session, routeEvents)
+	s.broadcastCrossings(session, crossings)
+	if profile != nil {
+		s.broadcastProfile(sessionID, *profile)
+	}
+	return result, nil
+}
+
+func insertChunk(ctx context.Context, tx pgx.Tx, sessionID string, points []TrackPoint) (int64, error) {
+	lats := make([]float64, len(points))
+	lngs := make([]float64, len(points))
+	elevations := make([]float64, len(points))
+	recorded := make([]time.Time, len(points))
+	speeds := make([]float64, len(points))
+	clientIDs := make([]string, len(points))
+	accuracies := make([]float64, len(points))
+	heartRates := make([]int32, len(points))
+	cadences := make([]int32, len(points))
+	temperatures := make([]*float64, len(points))
+	pressures := make([]float64, len(points))
+	batteries := make([]*int, len(points))
+	for i, p := range points {
+		lats[i], lngs[i] = p.Lat, p.Lng
+		elevations[i] = p.ElevationM
+		recorded[i] = p.RecordedAt
+		speeds[i] = p.SpeedMps
+		clientIDs[i] = p.ClientPointID
+		accuracies[i] = p.AccuracyM
+		heartRates[i] = int32(p.HeartRateBpm)
+		cadences[i] = int32(p.CadenceRpm)
+		temperatures[i] = p.TemperatureC
+		pressures[i] = p.PressureHPa
+		batteries[i] = p.BatteryPct
+	}
+
+	tag, err := tx.Exec(ctx, `
+		INSERT INTO track_points (session_id, location, elevation_m, recorded_at, speed_mps, client_point_id, accuracy_m,
+		                          heart_rate_bpm, cadence_rpm, temperature_c, pressure_hpa, battery_pct)
+		SELECT $1, ST_SetSRID(ST_MakePoint(p.lng, p.lat), 4326)::geography, p.elevation_m, p.recorded_at, p.speed_mps, NULLIF(p.client_point_id, ''), NULLIF(p.accuracy_m, 0),
+		       NULLIF(p.heart_rate_bpm, 0), NULLIF(p.cadence_rpm, 0), p.temperature_c, NULLIF(p.pressure_hpa, 0), p.battery_pct
+		FROM unnest($2::float8[], $3::float8[], $4::float8[], $5::timestamp[], $6::float8[], $7::text[], $8::float8[],
+		            $9::int[], $10::int[], $11::float8[], $12::float8[], $13::int[])
+		     AS p(lat, lng, elevation_m, recorded_at, speed_mps, client_point_id, accuracy_m,
+		          heart_rate_bpm, cadence_rpm, temperature_c, pressure_hpa, battery_pct)
+		WHERE NOT EXISTS (
+		    SELECT 1 FROM track_points tp
+		    WHERE tp.session_id = $1
+		      AND (tp.recorded_at = p.recorded_at
+		           OR (p.client_point_id <> '' AND tp.client_point_id = p.client_point_id))
+		)
+	`, sessionID, lats, lngs, elevations, recorded, speeds, clientIDs, accuracies,
+		heartRates, cadences, temperatures, pressures, batteries)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// dedupeBatch drops repeats within one upload, keeping the first occurrence
+// of each client_point_id and recorded_at. Times are compared at the
+// microsecond precision Postgres stores, so two fixes that differ only in
+// nanoseconds count as one.
+func dedupeBatch(points []TrackPoint) []TrackPoint {
+	seenIDs := map[string]bool{}
+	seenTimes := map[int64]bool{}
+	unique := make([]TrackPoint, 0, len(points))
+	for _, p := range points {
+		at := p.RecordedAt.Truncate(time.Microsecond).UnixNano()
+		if seenTimes[at] || (p.ClientPointID != "" && seenIDs[p.ClientPointID]) {
+			continue
+		}
+		seenTimes[at] = true
+		if p.ClientPointID != "" {
+			seenIDs[p.ClientPointID] = true
+		}
+		unique = append(unique, p)
+	}
+	return unique
+}
+
+// parseBatch decodes a JSON array of points or, for NDJSON uploads, one
+// point per line.
+func parseBatch(body []byte, ndjson bool) ([]TrackPoint, error) {
+	if !ndjson {
+		var points []TrackPoint
+		if err := json.Unmarshal(body, &points); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidBatch, err)
+		}
+		return points, nil
+	}
+
+	var points []TrackPoint
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		raw := bytes.TrimSpace(scanner.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+		var p TrackPoint
+		if err := json.Unmarshal(raw, &p); err != nil {
+			return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidBatch, line, err)
+		}
+		points = append(points, p)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBatch, err)
+	}
+	return points, nil
+}
@@ -0,0 +1,191 @@
+package tracking
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"backend-summithub/internal/stream"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v3"
+)
+
+func expectRecompute(mock pgxmock.PgxPoolIface, sessionID string, points [][3]float64) {
+	rows := pgxmock.NewRows([]string{"lat", "lng", "elev"})
+	for _, p := range points {
+		rows.AddRow(p[0], p[1], p[2])
+	}
+	mock.ExpectQuery(`FROM track_points WHERE session_id=\$1 ORDER BY recorded_at, id`).
+		WithArgs(sessionID).
+		WillReturnRows(rows)
+	mock.ExpectExec(`UPDATE track_sessions SET total_distance_m = \$2, total_elevation_gain_m = \$3`).
+		WithArgs(sessionID, pgxmock.AnyArg(), pgxmock.AnyArg()).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+}
+
+func TestAddPointsSkipsDuplicatesAndRecomputesOnce(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	start := time.Date(2026, 8, 17, 4, 0, 0, 0, time.UTC)
+	points := []TrackPoint{
+		{Lat: -7.94, Lng: 112.95, ElevationM: 2100, RecordedAt: start, ClientPointID: "p1"},
+		{Lat: -7.95, Lng: 112.95, ElevationM: 2150, RecordedAt: start.Add(time.Minute), ClientPointID: "p2"},
+		{Lat: -7.95, Lng: 112.95, ElevationM: 2150, RecordedAt: start.Add(time.Minute), ClientPointID: "p2"},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM track_sessions WHERE id=\$1\s+FOR UPDATE`).
+		WithArgs("session-1").
+		WillReturnRows(lockedSession("session-1", StatusActive))
+	mock.ExpectExec(`INSERT INTO track_points .* FROM unnest\(.*\) .* WHERE NOT EXISTS`).
+		WithArgs("session-1", []float64{-7.94, -7.95}, []float64{112.95, 112.95}, []float64{2100, 2150},
+			[]time.Time{start, start.Add(time.Minute)}, []float64{0, 0}, []string{"p1", "p2"}, []float64{0, 0},
+			[]int32{0, 0}, []int32{0, 0}, []*float64{nil, nil}, []float64{0, 0}, []*int{nil, nil}).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	expectRecompute(mock, "session-1", [][3]float64{{-7.94, 112.95, 2100}, {-7.95, 112.95, 2150}})
+	mock.ExpectCommit()
+
+	hub := stream.NewHub(nil)
+	listener := hub.Register("session-1")
+	defer hub.Unregister(listener)
+
+	svc := NewService(mock, hub)
+	result, err := svc.AddPoints(context.Background(), "session-1", points)
+	if err != nil {
+		t.Fatalf("add points: %v", err)
+	}
+	if result.Received != 3 || result.Inserted != 1 || result.Duplicates != 2 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if result.TotalDistanceM < 1100 || result.TotalDistanceM > 1120 || result.TotalElevationGainM != 50 {
+		t.Fatalf("unexpected totals: %+v", result)
+	}
+
+	select {
+	case raw := <-listener.Send:
+		var latest TrackPoint
+		if err := json.Unmarshal(raw, &latest); err != nil || latest.ClientPointID != "p2" {
+			t.Fatalf("expected latest point broadcast, got %s", raw)
+		}
+	case <-time.After(100 * time.Millisecond):
+		t.Fatalf("timeout waiting for broadcast")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestAddPointsValidation(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	svc := NewService(mock, nil)
+	if _, err := svc.AddPoints(context.Background(), "session-1", nil); !errors.Is(err, ErrInvalidBatch) {
+		t.Fatalf("expected ErrInvalidBatch for empty batch, got %v", err)
+	}
+	if _, err := svc.AddPoints(context.Background(), "session-1", []TrackPoint{{Lat: 1, Lng: 1}}); !errors.Is(err, ErrInvalidBatch) {
+		t.Fatalf("expected ErrInvalidBatch without recorded_at, got %v", err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM track_sessions WHERE id=\$1\s+FOR UPDATE`).
+		WithArgs("missing").
+		WillReturnError(pgx.ErrNoRows)
+	mock.ExpectRollback()
+	if _, err := svc.AddPoints(context.Background(), "missing", []TrackPoint{{RecordedAt: time.Now()}}); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("expected ErrSessionNotFound, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestDedupeBatchComparesAtMicroseconds(t *testing.T) {
+	at := time.Date(2026, 8, 17, 4, 0, 0, 1000, time.UTC)
+	points := dedupeBatch([]TrackPoint{
+		{Lat: 1, RecordedAt: at},
+		{Lat: 2, RecordedAt: at.Add(400 * time.Nanosecond)},
+		{Lat: 3, RecordedAt: at.Add(time.Microsecond)},
+	})
+	if len(points) != 2 || points[0].Lat != 1 || points[1].Lat != 3 {
+		t.Fatalf("unexpected points %+v", points)
+	}
+}
+
+func TestParseBatch(t *testing.T) {
+	points, err := parseBatch([]byte(`[{"lat":1,"lng":2,"recorded_at":"2026-08-17T04:00:00Z"}]`), false)
+	if err != nil || len(points) != 1 || points[0].Lng != 2 {
+		t.Fatalf("json array: %+v %v", points, err)
+	}
+
+	ndjson := "{\"lat\":1,\"lng\":2,\"recorded_at\":\"2026-08-17T04:00:00Z\"}\n\n{\"lat\":3,\"lng\":4,\"recorded_at\":\"2026-08-17T04:00:01Z\",\"client_point_id\":\"x\"}\n"
+	points, err = parseBatch([]byte(ndjson), true)
+	if err != nil || len(points) != 2 || points[1].ClientPointID != "x" {
+		t.Fatalf("ndjson: %+v %v", points, err)
+	}
+
+	if _, err := parseBatch([]byte("{\"lat\":1}\nnot json\n"), true); !errors.Is(err, ErrInvalidBatch) {
+		t.Fatalf("expected ErrInvalidBatch, got %v", err)
+	}
+}
+
+func TestTrackingHandlersBatch(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM track_sessions WHERE id=\$1\s+FOR UPDATE`).
+		WithArgs("session-1").
+		WillReturnRows(lockedSession("session-1", StatusActive))
+	mock.ExpectExec(`INSERT INTO track_points`).
+		WithArgs("session-1", pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(),
+			pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg()).
+		WillReturnResult(pgxmock.NewResult("INSERT", 2))
+	expectRecompute(mock, "session-1", [][3]float64{{1, 2, 0}, {3, 4, 0}})
+	mock.ExpectCommit()
+
+	app := fiber.New()
+	RegisterRoutes(app.Group("/tracking"), NewService(mock, nil), func(c *fiber.Ctx) error { return c.Next() })
+
+	ndjson := "{\"lat\":1,\"lng\":2,\"recorded_at\":\"2026-08-17T04:00:00Z\"}\n{\"lat\":3,\"lng\":4,\"recorded_at\":\"2026-08-17T04:00:01Z\"}\n"
+	req := httptest.NewRequest(http.MethodPost, "/tracking/sessions/session-1/points/batch", bytes.NewReader([]byte(ndjson)))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	resp, err := app.Test(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("batch status: %v", err)
+	}
+	var result BatchResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil || result.Inserted != 2 {
+		t.Fatalf("unexpected result: %+v %v", result, err)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/tracking/sessions/session-1/points/batch", bytes.NewReader([]byte(`{"lat":1}`)))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err = app.Test(req)
+	if err != nil || resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for non-array body: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
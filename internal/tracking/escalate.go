@@ -0,0 +1,115 @@
+package tracking
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Escalator passes an SOS alert on outside the app, for example to a rescue
+// coordinator. It is called once per alert, after the alert is stored.
+type Escalator interface {
+	Escalate(ctx context.Context, alert SOSAlert) error
+}
+
+// LogEscalator only writes alerts to the log. It is the default, meant for
+// development.
+type LogEscalator struct{}
+
+func (LogEscalator) Escalate(_ context.Context, alert SOSAlert) error {
+	log.Printf("SOS %s: %s", alert.ID, sosText(alert))
+	return nil
+}
+
+// WebhookEscalator POSTs each alert as an SOSEvent JSON body to URL and
+// expects a 2xx response.
+type WebhookEscalator struct {
+	URL    string
+	Client *http.Client
+}
+
+func NewWebhookEscalator(url string) *WebhookEscalator {
+	return &WebhookEscalator{URL: url, Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (w *WebhookEscalator) Escalate(ctx context.Context, alert SOSAlert) error {
+	body, err := json.Marshal(SOSEvent{Type: EventSOS, Priority: PriorityHigh, Alert: alert})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("sos webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// SMSGateway sends a text message. Implementations wrap a provider's API.
+type SMSGateway interface {
+	SendSMS(ctx context.Context, to, body string) error
+}
+
+// SMSEscalator texts every recipient through Gateway.
+type SMSEscalator struct {
+	Gateway    SMSGateway
+	Recipients []string
+}
+
+func (e SMSEscalator) Escalate(ctx context.Context, alert SOSAlert) error {
+	text := sosText(alert)
+	var errs []error
+	for _, to := range e.Recipients {
+		if err := e.Gateway.SendSMS(ctx, to, text); err != nil {
+			errs = append(errs, fmt.Errorf("sms to %s: %w", to, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Escalators sends each alert to all of its escalators and reports every
+// failure.
+type Escalators []Escalator
+
+func (es Escalators) Escalate(ctx context.Context, alert SOSAlert) error {
+	var errs []error
+	for _, e := range es {
+		if err := e.Escalate(ctx, alert); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// sosText is the short human-readable form of an alert used by the log and
+// SMS escalators.
+func sosText(alert SOSAlert) string {
+	text := fmt.Sprintf("SOS from user %s", alert.UserID)
+	if alert.TripID != "" {
+		text += " on trip " + alert.TripID
+	}
+	if alert.Lat != 0 || alert.Lng != 0 {
+		text += fmt.Sprintf(" at %.5f,%.5f", alert.Lat, alert.Lng)
+	}
+	if alert.BatteryPct != nil {
+		text += fmt.Sprintf(", battery %d%%", *alert.BatteryPct)
+	}
+	if alert.Message != "" {
+		text += ": " + alert.Message
+	}
+	return text
+}
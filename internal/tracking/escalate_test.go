@@ -0,0 +1,68 @@
+package tracking
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type fakeGateway struct {
+	sent map[string]string
+	fail string
+}
+
+func (g *fakeGateway) SendSMS(_ context.Context, to, body string) error {
+	if to == g.fail {
+		return errors.New("undeliverable")
+	}
+	g.sent[to] = body
+	return nil
+}
+
+func TestWebhookEscalator(t *testing.T) {
+	var got SOSEvent
+	status := http.StatusAccepted
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected content type %q", r.Header.Get("Content-Type"))
+		}
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	escalator := NewWebhookEscalator(server.URL)
+	if err := escalator.Escalate(context.Background(), SOSAlert{ID: "sos-1", UserID: "user-1"}); err != nil {
+		t.Fatalf("escalate: %v", err)
+	}
+	if got.Type != EventSOS || got.Priority != PriorityHigh || got.Alert.ID != "sos-1" {
+		t.Fatalf("unexpected webhook body %+v", got)
+	}
+
+	status = http.StatusBadGateway
+	if err := escalator.Escalate(context.Background(), SOSAlert{ID: "sos-2"}); err == nil {
+		t.Fatalf("expected error for non-2xx response")
+	}
+}
+
+func TestSMSEscalatorAndEscalators(t *testing.T) {
+	battery := 8
+	alert := SOSAlert{ID: "sos-1", UserID: "user-1", TripID: "trip-1", Lat: -7.94, Lng: 112.95, BatteryPct: &battery, Message: "lost"}
+	gateway := &fakeGateway{sent: map[string]string{}, fail: "+62-bad"}
+
+	err := Escalators{
+		LogEscalator{},
+		SMSEscalator{Gateway: gateway, Recipients: []string{"+62-rescue", "+62-bad"}},
+	}.Escalate(context.Background(), alert)
+	if err == nil || !strings.Contains(err.Error(), "+62-bad") {
+		t.Fatalf("expected failed recipient in error, got %v", err)
+	}
+	want := "SOS from user user-1 on trip trip-1 at -7.94000,112.95000, battery 8%: lost"
+	if gateway.sent["+62-rescue"] != want {
+		t.Fatalf("unexpected sms %q", gateway.sent["+62-rescue"])
+	}
+}
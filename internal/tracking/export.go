@@ -0,0 +1,102 @@
+package tracking
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"strconv"
+	"time"
+
+	"backend-summithub/internal/shared/trackfile"
+)
+
+const (
+	ExportGPX = "gpx"
+	ExportCSV = "csv"
+)
+
+var ErrUnknownExportFormat = errors.New("export format must be gpx or csv")
+
+var csvHeader = []string{
+	"recorded_at", "lat", "lng", "elevation_m", "speed_mps", "accuracy_m",
+	"heart_rate_bpm", "cadence_rpm", "temperature_c", "pressure_hpa", "battery_pct",
+}
+
+// Export encodes the session's points viewerID may see as a file and returns it with its
+// content type. GPX carries the sensor channels watches understand; CSV
+// carries every stored channel, with empty cells where a point has none.
+func (s *Service) Export(ctx context.Context, sessionID, viewerID, format string) ([]byte, string, error) {
+	if format != ExportGPX && format != ExportCSV {
+		return nil, "", ErrUnknownExportFormat
+	}
+	points, err := s.Points(ctx, sessionID, viewerID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var buf bytes.Buffer
+	if format == ExportCSV {
+		if err := writeCSV(&buf, points); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), "text/csv; charset=utf-8", nil
+	}
+
+	track := trackfile.Track{Name: "Session " + sessionID}
+	for _, p := range points {
+		track.Points = append(track.Points, trackfile.Point{
+			Time:         p.RecordedAt,
+			Lat:          p.Lat,
+			Lng:          p.Lng,
+			ElevationM:   p.ElevationM,
+			SpeedMps:     p.SpeedMps,
+			HeartRateBpm: p.HeartRateBpm,
+			CadenceRpm:   p.CadenceRpm,
+			TemperatureC: p.TemperatureC,
+		})
+	}
+	if err := trackfile.WriteGPX(&buf, track); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), "application/gpx+xml", nil
+}
+
+func writeCSV(buf *bytes.Buffer, points []TrackPoint) error {
+	w := csv.NewWriter(buf)
+	if err := w.Write(csvHeader); err != nil {
+		return err
+	}
+	number := func(v float64) string {
+		if v == 0 {
+			return ""
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	for _, p := range points {
+		record := []string{
+			p.RecordedAt.UTC().Format(time.RFC3339Nano),
+			strconv.FormatFloat(p.Lat, 'f', -1, 64),
+			strconv.FormatFloat(p.Lng, 'f', -1, 64),
+			strconv.FormatFloat(p.ElevationM, 'f', -1, 64),
+			number(p.SpeedMps),
+			number(p.AccuracyM),
+			number(float64(p.HeartRateBpm)),
+			number(float64(p.CadenceRpm)),
+			"",
+			number(p.PressureHPa),
+			"",
+		}
+		if p.TemperatureC != nil {
+			record[8] = strconv.FormatFloat(*p.TemperatureC, 'f', -1, 64)
+		}
+		if p.BatteryPct != nil {
+			record[10] = strconv.Itoa(*p.BatteryPct)
+		}
+		if err := w.Write(record); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,215 @@
+package tracking
+
+import "math"
+
+// FilterConfig tunes the pipeline that cleans raw GPS points before the
+// filtered summary figures are computed. Zero disables a stage.
+type FilterConfig struct {
+	// MaxAccuracyM rejects points whose reported horizontal accuracy is worse.
+	// Points without accuracy_m are kept.
+	MaxAccuracyM float64
+	// MaxSpeedMps rejects points that would need a faster move from the last
+	// kept point, which on foot means a GPS jump.
+	MaxSpeedMps float64
+	// ReanchorAfter is how many consecutive speed rejections, consistent with
+	// one another, make the filter trust them over the last kept point. The
+	// kept point is then dropped as the outlier, so a bad first fix cannot
+	// reject the rest of the track.
+	ReanchorAfter int
+	// ProcessNoiseMps is how fast the Kalman filter expects the true position
+	// to drift; lower values smooth harder.
+	ProcessNoiseMps float64
+	// DefaultAccuracyM is the measurement error assumed for points sent
+	// without accuracy_m.
+	DefaultAccuracyM float64
+	// MinMoveM is how far the smoothed position must move from the last
+	// counted position before distance is added, so jitter at rest is ignored.
+	// The threshold is raised to three standard errors of the position.
+	MinMoveM float64
+	// ElevationWindow is the number of points in the centred moving average
+	// applied to elevation before gain is counted.
+	ElevationWindow int
+	// ElevationThresholdM is the hysteresis band: a climb is only counted once
+	// elevation has risen this far above the last turning point.
+	ElevationThresholdM float64
+}
+
+// DefaultFilterConfig suits hiking recorded on a phone.
+var DefaultFilterConfig = FilterConfig{
+	MaxAccuracyM:        50,
+	MaxSpeedMps:         12,
+	ReanchorAfter:       3,
+	ProcessNoiseMps:     1,
+	DefaultAccuracyM:    15,
+	MinMoveM:            5,
+	ElevationWindow:     5,
+	ElevationThresholdM: 5,
+}
+
+// filteredTrack is the result of running points through the filter.
+type filteredTrack struct {
+	// Points are the kept points after smoothing; Moves is the subset where
+	// the position moved enough to count towards distance.
+	Points         []TrackPoint
+	Moves          []TrackPoint
+	Rejected       int
+	DistanceM      float64
+	ElevationGainM float64
+	ElevationLossM float64
+}
+
+// filterTrack runs points, in recorded order, through accuracy rejection,
+// the speed-outlier filter, Kalman smoothing of the position and a moving
+// average of elevation, then measures the cleaned path with a minimum-move
+// distance and hysteresis elevation gain.
+func filterTrack(points []TrackPoint, cfg FilterConfig) filteredTrack {
+	var out filteredTrack
+	kept := make([]TrackPoint, 0, len(points))
+	// run holds the current streak of speed rejections that agree with
+	// each other; a long enough run replaces the last kept point.
+	var run []TrackPoint
+	for _, p := range points {
+		if cfg.MaxAccuracyM > 0 && p.AccuracyM > cfg.MaxAccuracyM {
+			out.Rejected++
+			continue
+		}
+		if cfg.MaxSpeedMps > 0 && len(kept) > 0 && isSpeedOutlier(kept[len(kept)-1], p, cfg.MaxSpeedMps) {
+			if len(run) > 0 && isSpeedOutlier(run[len(run)-1], p, cfg.MaxSpeedMps) {
+				run = run[:0]
+			}
+			run = append(run, p)
+			if cfg.ReanchorAfter > 0 && len(run) >= cfg.ReanchorAfter {
+				// The run was right and the anchor was wrong: drop the
+				// anchor and keep the run, whose earlier points had been
+				// counted as rejected.
+				kept = append(kept[:len(kept)-1], run...)
+				out.Rejected -= len(run) - 1
+				out.Rejected++
+				run = run[:0]
+				continue
+			}
+			out.Rejected++
+			continue
+		}
+		run = run[:0]
+		kept = append(kept, p)
+	}
+
+	out.Points = smoothElevation(kalmanSmooth(kept, cfg), cfg.ElevationWindow)
+	out.Moves = moveAnchors(out.Points, cfg.MinMoveM)
+	out.DistanceM, _ = pathTotals(out.Moves)
+	out.ElevationGainM, out.ElevationLossM = hysteresisClimb(out.Points, cfg.ElevationThresholdM)
+	return out
+}
+
+func isSpeedOutlier(from, to TrackPoint, maxSpeedMps float64) bool {
+	distanceM := segmentDistanceM(from, to)
+	seconds := to.RecordedAt.Sub(from.RecordedAt).Seconds()
+	if seconds <= 0 {
+		return distanceM > 0
+	}
+	return distanceM/seconds > maxSpeedMps
+}
+
+// kalmanSmooth applies a constant-position Kalman filter to the coordinates.
+// Each point's accuracy is its measurement error, and uncertainty grows with
+// the time since the previous point at ProcessNoiseMps. The smoothed points
+// carry the estimate's standard error as their accuracy.
+func kalmanSmooth(points []TrackPoint, cfg FilterConfig) []TrackPoint {
+	if cfg.ProcessNoiseMps <= 0 || len(points) == 0 {
+		return points
+	}
+	smoothed := make([]TrackPoint, len(points))
+	var lat, lng, variance float64
+	for i, p := range points {
+		accuracy := p.AccuracyM
+		if accuracy <= 0 {
+			accuracy = cfg.DefaultAccuracyM
+		}
+		if accuracy <= 0 {
+			accuracy = 1
+		}
+		if i == 0 {
+			lat, lng, variance = p.Lat, p.Lng, accuracy*accuracy
+		} else {
+			if seconds := p.RecordedAt.Sub(points[i-1].RecordedAt).Seconds(); seconds > 0 {
+				variance += seconds * cfg.ProcessNoiseMps * cfg.ProcessNoiseMps
+			}
+			gain := variance / (variance + accuracy*accuracy)
+			lat += gain * (p.Lat - lat)
+			lng += gain * (p.Lng - lng)
+			variance *= 1 - gain
+		}
+		p.Lat, p.Lng, p.AccuracyM = lat, lng, math.Sqrt(variance)
+		smoothed[i] = p
+	}
+	return smoothed
+}
+
+// smoothElevation replaces each elevation with the mean of the window
+// centred on it, shrinking the window at the ends of the track.
+func smoothElevation(points []TrackPoint, window int) []TrackPoint {
+	if window <= 1 || len(points) == 0 {
+		return points
+	}
+	half := window / 2
+	smoothed := make([]TrackPoint, len(points))
+	for i := range points {
+		from, to := i-half, i+half
+		if from < 0 {
+			from = 0
+		}
+		if to > len(points)-1 {
+			to = len(points) - 1
+		}
+		var sum float64
+		for _, p := range points[from : to+1] {
+			sum += p.ElevationM
+		}
+		smoothed[i] = points[i]
+		smoothed[i].ElevationM = sum / float64(to-from+1)
+	}
+	return smoothed
+}
+
+// moveSigmas is how many standard errors a position must move to count.
+const moveSigmas = 3
+
+// moveAnchors keeps the first point and each point at least minMoveM, or
+// moveSigmas standard errors, from the last kept one.
+func moveAnchors(points []TrackPoint, minMoveM float64) []TrackPoint {
+	if len(points) == 0 {
+		return nil
+	}
+	anchors := []TrackPoint{points[0]}
+	for _, p := range points[1:] {
+		threshold := math.Max(minMoveM, moveSigmas*p.AccuracyM)
+		if d := segmentDistanceM(anchors[len(anchors)-1], p); d >= threshold && d > 0 {
+			anchors = append(anchors, p)
+		}
+	}
+	return anchors
+}
+
+// hysteresisClimb returns the elevation gain and loss, counting a change only
+// once elevation has moved thresholdM away from the last turning point.
+func hysteresisClimb(points []TrackPoint, thresholdM float64) (float64, float64) {
+	if len(points) == 0 {
+		return 0, 0
+	}
+	var gainM, lossM float64
+	anchor := points[0].ElevationM
+	for _, p := range points[1:] {
+		delta := p.ElevationM - anchor
+		if math.Abs(delta) < thresholdM || delta == 0 {
+			continue
+		}
+		if delta > 0 {
+			gainM += delta
+		} else {
+			lossM -= delta
+		}
+		anchor = p.ElevationM
+	}
+	return gainM, lossM
+}
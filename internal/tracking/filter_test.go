@@ -0,0 +1,160 @@
+package tracking
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/pashagolub/pgxmock/v3"
+)
+
+// metresToLat converts a north-south offset to degrees of latitude.
+func metresToLat(m float64) float64 {
+	return m / 111195
+}
+
+func TestFilterTrackIgnoresJitterAtRest(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	start := time.Date(2026, 8, 17, 18, 0, 0, 0, time.UTC)
+	var points []TrackPoint
+	for i := 0; i < 600; i++ {
+		points = append(points, TrackPoint{
+			Lat:        -7.94 + metresToLat(rng.NormFloat64()*6),
+			Lng:        112.95 + metresToLat(rng.NormFloat64()*6),
+			ElevationM: 2400 + rng.NormFloat64()*2,
+			RecordedAt: start.Add(time.Duration(i) * 5 * time.Second),
+			AccuracyM:  8,
+		})
+	}
+
+	rawDistance, rawGain := pathTotals(points)
+	filtered := filterTrack(points, DefaultFilterConfig)
+	if rawDistance < 1000 || rawGain < 100 {
+		t.Fatalf("expected noisy raw figures, got %.0f m and %.0f m gain", rawDistance, rawGain)
+	}
+	if filtered.DistanceM > 50 {
+		t.Fatalf("expected jitter to be filtered out, got %.0f m", filtered.DistanceM)
+	}
+	if filtered.ElevationGainM > 10 {
+		t.Fatalf("expected elevation noise to be filtered out, got %.0f m", filtered.ElevationGainM)
+	}
+}
+
+func TestFilterTrackKeepsRealMovement(t *testing.T) {
+	rng := rand.New(rand.NewSource(11))
+	start := time.Date(2026, 8, 17, 6, 0, 0, 0, time.UTC)
+	var points []TrackPoint
+	// 2 km north at about 1.1 m/s, climbing 300 m.
+	for i := 0; i <= 360; i++ {
+		along := float64(i) * 2000 / 360
+		points = append(points, TrackPoint{
+			Lat:        -7.94 + metresToLat(along+rng.NormFloat64()*3),
+			Lng:        112.95 + metresToLat(rng.NormFloat64()*3),
+			ElevationM: 2100 + along*0.15 + rng.NormFloat64()*1.5,
+			RecordedAt: start.Add(time.Duration(i) * 5 * time.Second),
+			AccuracyM:  5,
+		})
+	}
+
+	filtered := filterTrack(points, DefaultFilterConfig)
+	if math.Abs(filtered.DistanceM-2000) > 150 {
+		t.Fatalf("expected about 2000 m, got %.0f m", filtered.DistanceM)
+	}
+	if math.Abs(filtered.ElevationGainM-300) > 20 {
+		t.Fatalf("expected about 300 m gain, got %.0f m", filtered.ElevationGainM)
+	}
+}
+
+func TestFilterTrackRejectsInaccurateAndOutlierPoints(t *testing.T) {
+	start := time.Date(2026, 8, 17, 6, 0, 0, 0, time.UTC)
+	points := []TrackPoint{
+		{Lat: -7.94, Lng: 112.95, RecordedAt: start, AccuracyM: 5},
+		{Lat: -7.94 + metresToLat(10), Lng: 112.95, RecordedAt: start.Add(10 * time.Second), AccuracyM: 120},
+		{Lat: -7.94 + metresToLat(2000), Lng: 112.95, RecordedAt: start.Add(20 * time.Second), AccuracyM: 5},
+		{Lat: -7.94 + metresToLat(30), Lng: 112.95, RecordedAt: start.Add(30 * time.Second)},
+	}
+
+	filtered := filterTrack(points, DefaultFilterConfig)
+	if filtered.Rejected != 2 || len(filtered.Points) != 2 {
+		t.Fatalf("expected 2 rejected points, got %d rejected and %d kept", filtered.Rejected, len(filtered.Points))
+	}
+	if filtered.DistanceM > 30 {
+		t.Fatalf("expected the jump to be ignored, got %.0f m", filtered.DistanceM)
+	}
+}
+
+func TestFilterTrackReanchorsAfterOutlierFirstFix(t *testing.T) {
+	start := time.Date(2026, 8, 17, 6, 0, 0, 0, time.UTC)
+	// The first fix is 5 km off; the rest walk north at 1 m/s.
+	points := []TrackPoint{{Lat: -7.94 + metresToLat(5000), Lng: 112.95, RecordedAt: start, AccuracyM: 5}}
+	for i := 1; i <= 20; i++ {
+		points = append(points, TrackPoint{
+			Lat:        -7.94 + metresToLat(float64(i)*10),
+			Lng:        112.95,
+			RecordedAt: start.Add(time.Duration(i) * 10 * time.Second),
+			AccuracyM:  5,
+		})
+	}
+
+	filtered := filterTrack(points, DefaultFilterConfig)
+	if filtered.Rejected != 1 || len(filtered.Points) != 20 {
+		t.Fatalf("expected only the first fix rejected, got %d rejected and %d kept", filtered.Rejected, len(filtered.Points))
+	}
+	if math.Abs(filtered.DistanceM-190) > 30 {
+		t.Fatalf("expected about 190 m, got %.0f m", filtered.DistanceM)
+	}
+}
+
+func TestHysteresisClimb(t *testing.T) {
+	elevations := []float64{100, 102, 99, 103, 106, 104, 111, 109, 100, 98, 104}
+	points := make([]TrackPoint, len(elevations))
+	for i, e := range elevations {
+		points[i].ElevationM = e
+	}
+	gain, loss := hysteresisClimb(points, 5)
+	// Counted: 100 -> 106 -> 111 up, 111 -> 100 down. The rest stays within
+	// 5 m of the last turning point.
+	if gain != 11 || loss != 11 {
+		t.Fatalf("unexpected gain %.0f and loss %.0f", gain, loss)
+	}
+	if gain, _ := hysteresisClimb(points, 0); gain != 22 {
+		t.Fatalf("expected every rise without a band, got %.0f", gain)
+	}
+}
+
+func TestSummaryReportsFilteredFigures(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	start := time.Now().Add(-time.Hour)
+	expectViewer(mock, "session-1", "", "user-1", true)
+	mock.ExpectQuery(`SELECT id, started_at, ended_at`).
+		WithArgs("session-1").
+		WillReturnRows(pgxmock.NewRows([]string{"id", "started_at", "ended_at", "dist", "elev", "status", "paused"}).
+			AddRow("session-1", start, nil, 4100.0, 12.0, StatusActive, 0.0))
+	mock.ExpectQuery(`FROM track_points WHERE session_id=\$1 ORDER BY recorded_at, id`).
+		WithArgs("session-1").
+		WillReturnRows(pgxmock.NewRows(pathCols).
+			AddRow(-7.94, 112.95, 2100.0, start, 5.0, 0, 0, nil, 0.0, nil).
+			AddRow(-7.94+metresToLat(2000), 112.95, 2106.0, start.Add(10*time.Second), 5.0, 0, 0, nil, 0.0, nil).
+			AddRow(-7.94+metresToLat(100), 112.95, 2100.0, start.Add(time.Minute), 5.0, 0, 0, nil, 0.0, nil))
+	expectPauses(mock, "session-1")
+
+	svc := NewService(mock, nil)
+	svc.SetFilterConfig(FilterConfig{MaxSpeedMps: 12})
+	summary, err := svc.Summary(context.Background(), "session-1", "", 0)
+	if err != nil {
+		t.Fatalf("summary: %v", err)
+	}
+	if summary.DistanceM != 4100 || summary.ElevationGainM != 12 {
+		t.Fatalf("expected raw totals, got %+v", summary)
+	}
+	if summary.PointCount != 3 || summary.RejectedPoints != 1 || math.Abs(summary.FilteredDistanceM-100) > 1 || summary.FilteredElevationGainM != 0 {
+		t.Fatalf("unexpected filtered figures %+v", summary)
+	}
+}
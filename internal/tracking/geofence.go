@@ -0,0 +1,453 @@
+package tracking
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"backend-summithub/internal/privacy"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	GeofenceCamp     = "camp"
+	GeofenceDanger   = "danger"
+	GeofenceBoundary = "boundary"
+	GeofenceOther    = "other"
+)
+
+const (
+	CrossingEnter = "enter"
+	CrossingExit  = "exit"
+)
+
+const (
+	EventGeofenceEnter = "geofence_enter"
+	EventGeofenceExit  = "geofence_exit"
+)
+
+var (
+	ErrInvalidGeofence  = errors.New("geofence needs a name, a kind of camp, danger, boundary or other, and either a polygon area or a positive radius")
+	ErrGeofenceNotFound = errors.New("geofence not found")
+)
+
+// Geofence is a zone drawn for one trip or, by a park authority, for every
+// trip on a mountain. It is either a polygon (AreaWKT) or a circle around
+// CenterLat/CenterLng.
+type Geofence struct {
+	ID         string    `json:"id"`
+	TripID     string    `json:"trip_id,omitempty"`
+	MountainID string    `json:"mountain_id,omitempty"`
+	Name       string    `json:"name"`
+	Kind       string    `json:"kind"`
+	AreaWKT    string    `json:"area,omitempty"`
+	CenterLat  float64   `json:"center_lat,omitempty"`
+	CenterLng  float64   `json:"center_lng,omitempty"`
+	RadiusM    float64   `json:"radius_m,omitempty"`
+	CreatedBy  string    `json:"created_by,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// GeofenceCrossing is a session entering or leaving a zone, at the point
+// that first fell on the other side of its edge.
+type GeofenceCrossing struct {
+	ID           string    `json:"id"`
+	Type         string    `json:"type"`
+	SessionID    string    `json:"session_id"`
+	UserID       string    `json:"user_id,omitempty"`
+	GeofenceID   string    `json:"geofence_id"`
+	GeofenceName string    `json:"geofence_name"`
+	Kind         string    `json:"kind"`
+	Lat          float64   `json:"lat"`
+	Lng          float64   `json:"lng"`
+	RecordedAt   time.Time `json:"recorded_at"`
+}
+
+// GeofenceEvent is broadcast on the session's and the trip's channels for
+// each crossing. Entering a danger zone is sent with high priority.
+type GeofenceEvent struct {
+	Type     string           `json:"type"`
+	Priority string           `json:"priority,omitempty"`
+	Crossing GeofenceCrossing `json:"crossing"`
+}
+
+// GeofenceOccupant is an open session currently inside a zone.
+type GeofenceOccupant struct {
+	SessionID string    `json:"session_id"`
+	UserID    string    `json:"user_id"`
+	EnteredAt time.Time `json:"entered_at"`
+}
+
+func validGeofence(g Geofence) bool {
+	switch g.Kind {
+	case GeofenceCamp, GeofenceDanger, GeofenceBoundary, GeofenceOther:
+	default:
+		return false
+	}
+	if strings.TrimSpace(g.Name) == "" || (g.TripID == "") == (g.MountainID == "") {
+		return false
+	}
+	area := strings.ToUpper(strings.TrimSpace(g.AreaWKT))
+	if area != "" {
+		return g.RadiusM == 0 && (strings.HasPrefix(area, "POLYGON") || strings.HasPrefix(area, "MULTIPOLYGON"))
+	}
+	return g.RadiusM > 0
+}
+
+func (s *Service) CreateGeofence(ctx context.Context, input Geofence) (Geofence, error) {
+	if !validGeofence(input) {
+		return Geofence{}, ErrInvalidGeofence
+	}
+	input.ID = uuid.NewString()
+	err := s.db.QueryRow(ctx, `
+		INSERT INTO geofences (id, trip_id, mountain_id, name, kind, area, center, radius_m, created_by)
+		VALUES ($1, NULLIF($2,'')::uuid, NULLIF($3,'')::uuid, $4, $5, ST_GeogFromText(NULLIF($6,'')),
+		        CASE WHEN $9::float8 > 0 THEN ST_SetSRID(ST_MakePoint($7,$8), 4326)::geography END,
+		        NULLIF($9::float8, 0), NULLIF($10,'')::uuid)
+		RETURNING created_at
+	`, input.ID, input.TripID, input.MountainID, input.Name, input.Kind, input.AreaWKT,
+		input.CenterLng, input.CenterLat, input.RadiusM, input.CreatedBy).Scan(&input.CreatedAt)
+	if err != nil {
+		return Geofence{}, err
+	}
+	return input, nil
+}
+
+// Geofences lists the zones that apply to a trip, its own and those of its
+// mountain, for a member of the trip.
+func (s *Service) Geofences(ctx context.Context, tripID, userID string) ([]Geofence, error) {
+	member, err := s.IsTripMember(ctx, tripID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !member {
+		return nil, ErrNotTripMember
+	}
+	rows, err := s.db.Query(ctx, `
+		SELECT g.id, COALESCE(g.trip_id::text,''), COALESCE(g.mountain_id::text,''), g.name, g.kind,
+		       COALESCE(ST_AsText(g.area),''), COALESCE(ST_Y(g.center::geometry),0), COALESCE(ST_X(g.center::geometry),0),
+		       COALESCE(g.radius_m,0), COALESCE(g.created_by::text,''), g.created_at
+		FROM geofences g
+		WHERE g.trip_id = $1 OR g.mountain_id = (SELECT t.mountain_id FROM trips t WHERE t.id = $1)
+		ORDER BY g.created_at
+	`, tripID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	geofences := []Geofence{}
+	for rows.Next() {
+		var g Geofence
+		if err := rows.Scan(&g.ID, &g.TripID, &g.MountainID, &g.Name, &g.Kind,
+			&g.AreaWKT, &g.CenterLat, &g.CenterLng, &g.RadiusM, &g.CreatedBy, &g.CreatedAt); err != nil {
+			return nil, err
+		}
+		geofences = append(geofences, g)
+	}
+	return geofences, rows.Err()
+}
+
+// checkGeofenceMember allows members of a trip zone's trip to read it.
+// Mountain-wide zones are open to any user, but their crossings and
+// occupants are limited to sessions of the user's own trips.
+func (s *Service) checkGeofenceMember(ctx context.Context, geofenceID, userID string) error {
+	var tripID string
+	err := s.db.QueryRow(ctx, `SELECT COALESCE(trip_id::text,'') FROM geofences WHERE id::text=$1`, geofenceID).Scan(&tripID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrGeofenceNotFound
+	}
+	if err != nil || tripID == "" {
+		return err
+	}
+	member, err := s.IsTripMember(ctx, tripID, userID)
+	if err != nil {
+		return err
+	}
+	if !member {
+		return ErrNotTripMember
+	}
+	return nil
+}
+
+// GeofenceCrossings lists crossings in time order, for one session, one
+// zone, or both when both ids are given. userID must belong to the
+// session's trip and the zone's trip, and only sees sessions of trips they
+// belong to; other hikers' crossings inside their privacy zones are left out.
+func (s *Service) GeofenceCrossings(ctx context.Context, sessionID, geofenceID, userID string) ([]GeofenceCrossing, error) {
+	if sessionID != "" {
+		if err := checkSessionMember(ctx, s.db, sessionID, userID); err != nil {
+			return nil, err
+		}
+	}
+	if geofenceID != "" {
+		if err := s.checkGeofenceMember(ctx, geofenceID, userID); err != nil {
+			return nil, err
+		}
+	}
+	rows, err := privacy.QueryPositions(ctx, s.db, userID, func(visible func(location, owner string) string) string {
+		return `
+		SELECT e.id, e.type, e.session_id, COALESCE(ts.user_id::text,''), e.geofence_id, g.name, g.kind,
+		       ST_Y(e.location::geometry), ST_X(e.location::geometry), e.recorded_at
+		FROM geofence_events e
+		JOIN geofences g ON g.id = e.geofence_id
+		JOIN track_sessions ts ON ts.id = e.session_id
+		WHERE ($1 = '' OR e.session_id::text = $1) AND ($2 = '' OR e.geofence_id::text = $2)
+		  AND (ts.user_id::text = $3
+		       OR EXISTS (SELECT 1 FROM trip_members tm WHERE tm.trip_id = ts.trip_id AND tm.user_id::text = $3)
+		       OR EXISTS (SELECT 1 FROM trips t WHERE t.id = ts.trip_id AND t.created_by::text = $3))
+		  AND ` + visible("e.location", "ts.user_id") + `
+		ORDER BY e.recorded_at, e.id
+		LIMIT 1000
+	`
+	}, sessionID, geofenceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	crossings := []GeofenceCrossing{}
+	for rows.Next() {
+		var c GeofenceCrossing
+		if err := rows.Scan(&c.ID, &c.Type, &c.SessionID, &c.UserID, &c.GeofenceID, &c.GeofenceName, &c.Kind,
+			&c.Lat, &c.Lng, &c.RecordedAt); err != nil {
+			return nil, err
+		}
+		crossings = append(crossings, c)
+	}
+	return crossings, rows.Err()
+}
+
+// GeofenceOccupants lists the open sessions currently inside a zone that
+// userID may see, as for GeofenceCrossings.
+func (s *Service) GeofenceOccupants(ctx context.Context, geofenceID, userID string) ([]GeofenceOccupant, error) {
+	if err := s.checkGeofenceMember(ctx, geofenceID, userID); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(ctx, `
+		SELECT sg.session_id, COALESCE(ts.user_id::text,''), sg.entered_at
+		FROM session_geofences sg
+		JOIN track_sessions ts ON ts.id = sg.session_id
+		WHERE sg.geofence_id = $1 AND ts.status IN ('active', 'paused')
+		  AND (ts.user_id::text = $2
+		       OR EXISTS (SELECT 1 FROM trip_members tm WHERE tm.trip_id = ts.trip_id AND tm.user_id::text = $2)
+		       OR EXISTS (SELECT 1 FROM trips t WHERE t.id = ts.trip_id AND t.created_by::text = $2))
+		ORDER BY sg.entered_at
+	`, geofenceID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	occupants := []GeofenceOccupant{}
+	for rows.Next() {
+		var o GeofenceOccupant
+		if err := rows.Scan(&o.SessionID, &o.UserID, &o.EnteredAt); err != nil {
+			return nil, err
+		}
+		occupants = append(occupants, o)
+	}
+	return occupants, rows.Err()
+}
+
+// zoneRef is what a crossing needs to know about its zone.
+type zoneRef struct {
+	name string
+	kind string
+}
+
+// checkGeofences advances the session's zone state with newly stored points.
+// Only points after the last checked one are tested, against the set of
+// zones the session was already inside, so earlier points are never
+// re-scanned. It returns the crossings to broadcast once the transaction
+// commits.
+func (s *Service) checkGeofences(ctx context.Context, tx pgx.Tx, session Session, points []TrackPoint) ([]GeofenceCrossing, error) {
+	if !session.hasGeofences || len(points) == 0 {
+		return nil, nil
+	}
+
+	var checkedAt *time.Time
+	if err := tx.QueryRow(ctx, `SELECT geofence_checked_at FROM track_sessions WHERE id=$1`, session.ID).Scan(&checkedAt); err != nil {
+		return nil, err
+	}
+	ordered := pointsAfter(points, checkedAt)
+	if len(ordered) == 0 {
+		return nil, nil
+	}
+
+	inside, err := insideGeofences(ctx, tx, session.ID)
+	if err != nil {
+		return nil, err
+	}
+	containing, zones, err := containingGeofences(ctx, tx, session.TripID, ordered)
+	if err != nil {
+		return nil, err
+	}
+
+	var crossings []GeofenceCrossing
+	cross := func(kind, id string, zone zoneRef, p TrackPoint) error {
+		c := GeofenceCrossing{
+			ID:           uuid.NewString(),
+			Type:         kind,
+			SessionID:    session.ID,
+			UserID:       session.UserID,
+			GeofenceID:   id,
+			GeofenceName: zone.name,
+			Kind:         zone.kind,
+			Lat:          p.Lat,
+			Lng:          p.Lng,
+			RecordedAt:   p.RecordedAt,
+		}
+		if err := recordCrossing(ctx, tx, c); err != nil {
+			return err
+		}
+		crossings = append(crossings, c)
+		return nil
+	}
+
+	for i, p := range ordered {
+		for _, id := range sortedZoneIDs(inside) {
+			if !containing[i][id] {
+				if err := cross(CrossingExit, id, inside[id], p); err != nil {
+					return nil, err
+				}
+				delete(inside, id)
+			}
+		}
+		for _, id := range sortedZoneIDs(containing[i]) {
+			if _, ok := inside[id]; !ok {
+				if err := cross(CrossingEnter, id, zones[id], p); err != nil {
+					return nil, err
+				}
+				inside[id] = zones[id]
+			}
+		}
+	}
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE track_sessions SET geofence_checked_at=$2 WHERE id=$1
+	`, session.ID, ordered[len(ordered)-1].RecordedAt); err != nil {
+		return nil, err
+	}
+	return crossings, nil
+}
+
+func insideGeofences(ctx context.Context, tx pgx.Tx, sessionID string) (map[string]zoneRef, error) {
+	rows, err := tx.Query(ctx, `
+		SELECT sg.geofence_id::text, g.name, g.kind
+		FROM session_geofences sg JOIN geofences g ON g.id = sg.geofence_id
+		WHERE sg.session_id=$1
+	`, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	inside := map[string]zoneRef{}
+	for rows.Next() {
+		var id string
+		var zone zoneRef
+		if err := rows.Scan(&id, &zone.name, &zone.kind); err != nil {
+			return nil, err
+		}
+		inside[id] = zone
+	}
+	return inside, rows.Err()
+}
+
+// containingGeofences returns, per point in the order given, the ids of the
+// trip's zones containing it, along with the zones seen.
+func containingGeofences(ctx context.Context, tx pgx.Tx, tripID string, points []TrackPoint) ([]map[string]bool, map[string]zoneRef, error) {
+	lats := make([]float64, len(points))
+	lngs := make([]float64, len(points))
+	for i, p := range points {
+		lats[i], lngs[i] = p.Lat, p.Lng
+	}
+	rows, err := tx.Query(ctx, `
+		SELECT p.ord, g.id::text, g.name, g.kind
+		FROM unnest($2::float8[], $3::float8[]) WITH ORDINALITY AS p(lat, lng, ord)
+		JOIN geofences g
+		  ON (g.trip_id = $1 OR g.mountain_id = (SELECT t.mountain_id FROM trips t WHERE t.id = $1))
+		 AND CASE WHEN g.area IS NOT NULL
+		          THEN ST_Covers(g.area, ST_SetSRID(ST_MakePoint(p.lng, p.lat), 4326)::geography)
+		          ELSE ST_DWithin(g.center, ST_SetSRID(ST_MakePoint(p.lng, p.lat), 4326)::geography, g.radius_m)
+		     END
+		ORDER BY p.ord, g.id
+	`, tripID, lats, lngs)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	containing := make([]map[string]bool, len(points))
+	for i := range containing {
+		containing[i] = map[string]bool{}
+	}
+	zones := map[string]zoneRef{}
+	for rows.Next() {
+		var ord int64
+		var id string
+		var zone zoneRef
+		if err := rows.Scan(&ord, &id, &zone.name, &zone.kind); err != nil {
+			return nil, nil, err
+		}
+		containing[ord-1][id] = true
+		zones[id] = zone
+	}
+	return containing, zones, rows.Err()
+}
+
+func recordCrossing(ctx context.Context, tx pgx.Tx, c GeofenceCrossing) error {
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO geofence_events (id, session_id, geofence_id, type, recorded_at, location)
+		VALUES ($1, $2, $3, $4, $5, ST_SetSRID(ST_MakePoint($6,$7), 4326)::geography)
+	`, c.ID, c.SessionID, c.GeofenceID, c.Type, c.RecordedAt, c.Lng, c.Lat); err != nil {
+		return err
+	}
+	var err error
+	if c.Type == CrossingEnter {
+		_, err = tx.Exec(ctx, `
+			INSERT INTO session_geofences (session_id, geofence_id, entered_at) VALUES ($1, $2, $3)
+		`, c.SessionID, c.GeofenceID, c.RecordedAt)
+	} else {
+		_, err = tx.Exec(ctx, `
+			DELETE FROM session_geofences WHERE session_id=$1 AND geofence_id=$2
+		`, c.SessionID, c.GeofenceID)
+	}
+	return err
+}
+
+func sortedZoneIDs[V any](zones map[string]V) []string {
+	ids := make([]string, 0, len(zones))
+	for id := range zones {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (s *Service) broadcastCrossings(session Session, crossings []GeofenceCrossing) {
+	if s.hub == nil {
+		return
+	}
+	for _, c := range crossings {
+		event := GeofenceEvent{Type: EventGeofenceExit, Crossing: c}
+		if c.Type == CrossingEnter {
+			event.Type = EventGeofenceEnter
+		}
+		urgent := c.Type == CrossingEnter && c.Kind == GeofenceDanger
+		if urgent {
+			event.Priority = PriorityHigh
+		}
+		payload, _ := json.Marshal(event)
+		s.broadcastAt(session, session.ID, c.Lat, c.Lng, payload, urgent)
+		if session.TripID != "" {
+			s.broadcastAt(session, TripChannel(session.TripID), c.Lat, c.Lng, payload, urgent)
+		}
+	}
+}
@@ -0,0 +1,299 @@
+package tracking
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"backend-summithub/internal/stream"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pashagolub/pgxmock/v3"
+)
+
+func expectCrossing(mock pgxmock.PgxPoolIface, kind, geofenceID string, p TrackPoint) {
+	mock.ExpectExec(`INSERT INTO geofence_events`).
+		WithArgs(pgxmock.AnyArg(), "session-1", geofenceID, kind, p.RecordedAt, p.Lng, p.Lat).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	if kind == CrossingEnter {
+		mock.ExpectExec(`INSERT INTO session_geofences`).
+			WithArgs("session-1", geofenceID, p.RecordedAt).
+			WillReturnResult(pgxmock.NewResult("INSERT", 1))
+		return
+	}
+	mock.ExpectExec(`DELETE FROM session_geofences`).
+		WithArgs("session-1", geofenceID).
+		WillReturnResult(pgxmock.NewResult("DELETE", 1))
+}
+
+func TestCheckGeofencesIsIncremental(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	t0 := time.Date(2026, 8, 17, 5, 0, 0, 0, time.UTC)
+	late := TrackPoint{Lat: -8.10, Lng: 112.92, RecordedAt: t0.Add(-time.Minute)}
+	p1 := TrackPoint{Lat: -8.107, Lng: 112.922, RecordedAt: t0.Add(10 * time.Second)}
+	p2 := TrackPoint{Lat: -8.108, Lng: 112.922, RecordedAt: t0.Add(20 * time.Second)}
+	p3 := TrackPoint{Lat: -8.100, Lng: 112.922, RecordedAt: t0.Add(30 * time.Second)}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT geofence_checked_at FROM track_sessions WHERE id=\$1`).
+		WithArgs("session-1").
+		WillReturnRows(pgxmock.NewRows([]string{"checked_at"}).AddRow(&t0))
+	// Already inside the camp from earlier points; only new points are tested.
+	mock.ExpectQuery(`FROM session_geofences sg JOIN geofences g`).
+		WithArgs("session-1").
+		WillReturnRows(pgxmock.NewRows([]string{"id", "name", "kind"}).AddRow("camp-1", "Kalimati", GeofenceCamp))
+	mock.ExpectQuery(`WITH ORDINALITY AS p\(lat, lng, ord\)\s+JOIN geofences g`).
+		WithArgs("trip-1", []float64{p1.Lat, p2.Lat, p3.Lat}, []float64{p1.Lng, p2.Lng, p3.Lng}).
+		WillReturnRows(pgxmock.NewRows([]string{"ord", "id", "name", "kind"}).
+			AddRow(int64(1), "camp-1", "Kalimati", GeofenceCamp).
+			AddRow(int64(1), "crater-1", "Jonggring Saloko", GeofenceDanger).
+			AddRow(int64(2), "crater-1", "Jonggring Saloko", GeofenceDanger))
+	expectCrossing(mock, CrossingEnter, "crater-1", p1)
+	expectCrossing(mock, CrossingExit, "camp-1", p2)
+	expectCrossing(mock, CrossingExit, "crater-1", p3)
+	mock.ExpectExec(`UPDATE track_sessions SET geofence_checked_at=\$2 WHERE id=\$1`).
+		WithArgs("session-1", p3.RecordedAt).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+	tx, err := mock.Begin(context.Background())
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	session := Session{ID: "session-1", TripID: "trip-1", UserID: "user-1", hasGeofences: true}
+	crossings, err := NewService(mock, nil).checkGeofences(context.Background(), tx, session, []TrackPoint{p2, late, p3, p1})
+	if err != nil {
+		t.Fatalf("check geofences: %v", err)
+	}
+
+	want := []struct{ kind, id string }{{CrossingEnter, "crater-1"}, {CrossingExit, "camp-1"}, {CrossingExit, "crater-1"}}
+	if len(crossings) != len(want) {
+		t.Fatalf("expected %d crossings, got %+v", len(want), crossings)
+	}
+	for i, w := range want {
+		if crossings[i].Type != w.kind || crossings[i].GeofenceID != w.id || crossings[i].UserID != "user-1" {
+			t.Fatalf("crossing %d: expected %s %s, got %+v", i, w.kind, w.id, crossings[i])
+		}
+	}
+	if crossings[1].GeofenceName != "Kalimati" || crossings[2].Kind != GeofenceDanger {
+		t.Fatalf("expected zone details on crossings, got %+v", crossings)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
+
+func TestCheckGeofencesSkippedWithoutZones(t *testing.T) {
+	crossings, err := NewService(nil, nil).checkGeofences(context.Background(), nil, Session{ID: "session-1"}, []TrackPoint{{Lat: 1}})
+	if err != nil || crossings != nil {
+		t.Fatalf("expected no check, got %v %v", crossings, err)
+	}
+}
+
+func TestAddPointBroadcastsDangerZoneEntry(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	hub := stream.NewHub(nil)
+	client := hub.Register(TripChannel("trip-1"))
+	defer hub.Unregister(client)
+
+	at := time.Date(2026, 8, 17, 5, 0, 0, 0, time.UTC)
+	point := TrackPoint{Lat: -8.107, Lng: 112.922, RecordedAt: at}
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM track_sessions WHERE id=\$1\s+FOR UPDATE`).
+		WithArgs("session-1").
+		WillReturnRows(pgxmock.NewRows([]string{"id", "trip_id", "user_id", "started_at", "status", "has_route", "has_geofences", "tracking_mode", "tracking_auto"}).
+			AddRow("session-1", "trip-1", "user-1", at.Add(-time.Hour), StatusActive, false, true, ProfileNormal, false))
+	mock.ExpectQuery(`recorded_at <= \$2`).WithArgs("session-1", at).WillReturnRows(pgxmock.NewRows([]string{"lat", "lng", "elev"}))
+	mock.ExpectQuery(`recorded_at > \$2`).WithArgs("session-1", at).WillReturnRows(pgxmock.NewRows([]string{"lat", "lng", "elev"}))
+	mock.ExpectQuery(`INSERT INTO track_points`).
+		WithArgs("session-1", point.Lng, point.Lat, 0.0, at, 0.0, "", 0.0, 0, 0, (*float64)(nil), 0.0, (*int)(nil)).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "created_at"}).AddRow(int64(5), time.Now()))
+	mock.ExpectQuery(`SELECT geofence_checked_at`).
+		WithArgs("session-1").
+		WillReturnRows(pgxmock.NewRows([]string{"checked_at"}).AddRow(nil))
+	mock.ExpectQuery(`FROM session_geofences sg`).
+		WithArgs("session-1").
+		WillReturnRows(pgxmock.NewRows([]string{"id", "name", "kind"}))
+	mock.ExpectQuery(`JOIN geofences g`).
+		WithArgs("trip-1", []float64{point.Lat}, []float64{point.Lng}).
+		WillReturnRows(pgxmock.NewRows([]string{"ord", "id", "name", "kind"}).AddRow(int64(1), "crater-1", "Jonggring Saloko", GeofenceDanger))
+	expectCrossing(mock, CrossingEnter, "crater-1", point)
+	mock.ExpectExec(`UPDATE track_sessions SET geofence_checked_at`).
+		WithArgs("session-1", at).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectCommit()
+
+	if _, err := NewService(mock, hub).AddPoint(context.Background(), "session-1", point); err != nil {
+		t.Fatalf("add point: %v", err)
+	}
+
+	<-client.Send // position
+	select {
+	case msg := <-client.Send:
+		var event GeofenceEvent
+		if err := json.Unmarshal(msg, &event); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if event.Type != EventGeofenceEnter || event.Priority != PriorityHigh || event.Crossing.GeofenceName != "Jonggring Saloko" {
+			t.Fatalf("unexpected event %s", msg)
+		}
+	case <-time.After(100 * time.Millisecond):
+		t.Fatalf("expected geofence_enter broadcast")
+	}
+}
+
+func TestValidGeofence(t *testing.T) {
+	cases := []struct {
+		name string
+		g    Geofence
+		ok   bool
+	}{
+		{"polygon", Geofence{TripID: "t", Name: "Camp", Kind: GeofenceCamp, AreaWKT: "POLYGON((0 0,1 0,1 1,0 0))"}, true},
+		{"circle", Geofence{MountainID: "m", Name: "Crater", Kind: GeofenceDanger, CenterLat: -8.1, CenterLng: 112.9, RadiusM: 500}, true},
+		{"both shapes", Geofence{TripID: "t", Name: "x", Kind: GeofenceOther, AreaWKT: "POLYGON((0 0,1 0,1 1,0 0))", RadiusM: 5}, false},
+		{"no shape", Geofence{TripID: "t", Name: "x", Kind: GeofenceOther}, false},
+		{"line", Geofence{TripID: "t", Name: "x", Kind: GeofenceOther, AreaWKT: "LINESTRING(0 0,1 1)"}, false},
+		{"bad kind", Geofence{TripID: "t", Name: "x", Kind: "lava", RadiusM: 5}, false},
+		{"no name", Geofence{TripID: "t", Kind: GeofenceCamp, RadiusM: 5}, false},
+		{"two scopes", Geofence{TripID: "t", MountainID: "m", Name: "x", Kind: GeofenceCamp, RadiusM: 5}, false},
+	}
+	for _, tc := range cases {
+		if got := validGeofence(tc.g); got != tc.ok {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.ok, got)
+		}
+	}
+}
+
+// expectGeofenceTrip answers checkGeofenceMember's zone lookup; tripID is
+// empty for a mountain-wide zone.
+func expectGeofenceTrip(mock pgxmock.PgxPoolIface, geofenceID, tripID string) {
+	mock.ExpectQuery(`SELECT COALESCE\(trip_id::text,''\) FROM geofences WHERE id::text=\$1`).
+		WithArgs(geofenceID).
+		WillReturnRows(pgxmock.NewRows([]string{"trip_id"}).AddRow(tripID))
+}
+
+func TestGeofenceHandlers(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	app := fiber.New()
+	publisher := func(c *fiber.Ctx) error {
+		if c.Get("X-Role") != "park_authority" {
+			return fiber.ErrForbidden
+		}
+		return c.Next()
+	}
+	RegisterGeofenceRoutes(app.Group("/tracking"), NewService(mock, nil), func(c *fiber.Ctx) error {
+		c.Locals("user_id", c.Get("X-User", "user-1"))
+		return c.Next()
+	}, publisher)
+	get := func(path, userID string) *http.Response {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("X-User", userID)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("request: %v", err)
+		}
+		return resp
+	}
+
+	post := func(path, body, role string) *http.Response {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Role", role)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("request: %v", err)
+		}
+		return resp
+	}
+
+	mock.ExpectQuery(`INSERT INTO geofences`).
+		WithArgs(pgxmock.AnyArg(), "", "mountain-1", "Jonggring Saloko", GeofenceDanger, "", 112.922, -8.108, 500.0, "user-1").
+		WillReturnRows(pgxmock.NewRows([]string{"created_at"}).AddRow(time.Now()))
+	crater := `{"name":"Jonggring Saloko","kind":"danger","center_lat":-8.108,"center_lng":112.922,"radius_m":500}`
+	if resp := post("/tracking/mountains/mountain-1/geofences", crater, "hiker"); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403 without publisher role, got %d", resp.StatusCode)
+	}
+	if resp := post("/tracking/mountains/mountain-1/geofences", crater, "park_authority"); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", resp.StatusCode)
+	}
+
+	expectTripMember(mock, "user-1", true)
+	if resp := post("/tracking/trips/trip-1/geofences", `{"name":"Camp","kind":"camp"}`, ""); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 without a shape, got %d", resp.StatusCode)
+	}
+
+	at := time.Now()
+	expectGeofenceTrip(mock, "crater-1", "")
+	mock.ExpectQuery(`FROM session_geofences sg\s+JOIN track_sessions ts .* tm.user_id::text = \$2`).
+		WithArgs("crater-1", "user-1").
+		WillReturnRows(pgxmock.NewRows([]string{"session_id", "user_id", "entered_at"}).AddRow("session-1", "user-1", at))
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/tracking/geofences/crater-1/occupants", nil))
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("occupants status: %v %v", resp.StatusCode, err)
+	}
+	var occupants []GeofenceOccupant
+	if err := json.NewDecoder(resp.Body).Decode(&occupants); err != nil || len(occupants) != 1 || occupants[0].SessionID != "session-1" {
+		t.Fatalf("unexpected occupants %+v %v", occupants, err)
+	}
+
+	expectSessionMember(mock, "user-1", true)
+	mock.ExpectQuery(`FROM geofence_events e .* tm.user_id::text = \$3`).
+		WithArgs("session-1", "", "user-1").
+		WillReturnRows(pgxmock.NewRows([]string{"id", "type", "session_id", "user_id", "geofence_id", "name", "kind", "lat", "lng", "recorded_at"}).
+			AddRow("ev-1", CrossingEnter, "session-1", "user-1", "crater-1", "Jonggring Saloko", GeofenceDanger, -8.107, 112.922, at))
+	resp, err = app.Test(httptest.NewRequest(http.MethodGet, "/tracking/sessions/session-1/geofence-events", nil))
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("events status: %v %v", resp.StatusCode, err)
+	}
+	var crossings []GeofenceCrossing
+	if err := json.NewDecoder(resp.Body).Decode(&crossings); err != nil || len(crossings) != 1 || crossings[0].Type != CrossingEnter {
+		t.Fatalf("unexpected crossings %+v %v", crossings, err)
+	}
+
+	// Outsiders are turned away from the trip's zones and sessions.
+	expectTripMember(mock, "user-9", false)
+	if resp := get("/tracking/trips/trip-1/geofences", "user-9"); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403 listing another trip's zones, got %d", resp.StatusCode)
+	}
+	expectSessionMember(mock, "user-9", false)
+	if resp := get("/tracking/sessions/session-1/geofence-events", "user-9"); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403 for another hiker's crossings, got %d", resp.StatusCode)
+	}
+	expectGeofenceTrip(mock, "camp-1", "trip-1")
+	expectTripMember(mock, "user-9", false)
+	if resp := get("/tracking/geofences/camp-1/events", "user-9"); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403 for another trip's zone events, got %d", resp.StatusCode)
+	}
+	expectGeofenceTrip(mock, "camp-1", "trip-1")
+	expectTripMember(mock, "user-9", false)
+	if resp := get("/tracking/geofences/camp-1/occupants", "user-9"); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403 for another trip's zone occupants, got %d", resp.StatusCode)
+	}
+	mock.ExpectQuery(`FROM geofences WHERE id::text=\$1`).
+		WithArgs("missing").
+		WillReturnRows(pgxmock.NewRows([]string{"trip_id"}))
+	if resp := get("/tracking/geofences/missing/occupants", "user-1"); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown zone, got %d", resp.StatusCode)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
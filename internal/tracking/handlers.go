@@ -1,6 +1,19 @@
 package tracking
 
-import "github.com/gofiber/fiber/v2"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"backend-summithub/internal/notice"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+)
 
 func RegisterRoutes(r fiber.Router, svc *Service, authMiddleware fiber.Handler) {
 	r.Post("/sessions", authMiddleware, func(c *fiber.Ctx) error {
@@ -12,6 +25,12 @@ func RegisterRoutes(r fiber.Router, svc *Service, authMiddleware fiber.Handler)
 			return fiber.NewError(fiber.StatusBadRequest, "trip_id and user_id required")
 		}
 		session, err := svc.StartSession(c.Context(), req)
+		if errors.Is(err, ErrInvalidVisibility) {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		if errors.Is(err, notice.ErrAreaClosed) {
+			return fiber.NewError(fiber.StatusConflict, err.Error())
+		}
 		if err != nil {
 			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
 		}
@@ -24,25 +43,507 @@ func RegisterRoutes(r fiber.Router, svc *Service, authMiddleware fiber.Handler)
 			return fiber.NewError(fiber.StatusBadRequest, err.Error())
 		}
 		point, err := svc.AddPoint(c.Context(), c.Params("id"), req)
+		if errors.Is(err, ErrInvalidPoint) {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		if errors.Is(err, ErrSessionNotFound) {
+			return fiber.NewError(fiber.StatusNotFound, err.Error())
+		}
+		if errors.Is(err, ErrSessionEnded) {
+			return fiber.NewError(fiber.StatusConflict, err.Error())
+		}
 		if err != nil {
 			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
 		}
 		return c.Status(fiber.StatusCreated).JSON(point)
 	})
 
+	r.Post("/sessions/:id/points/batch", authMiddleware, func(c *fiber.Ctx) error {
+		ndjson := strings.Contains(c.Get(fiber.HeaderContentType), "ndjson")
+		points, err := parseBatch(c.Body(), ndjson)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		result, err := svc.AddPoints(c.Context(), c.Params("id"), points)
+		if err != nil {
+			switch {
+			case errors.Is(err, ErrInvalidBatch):
+				return fiber.NewError(fiber.StatusBadRequest, err.Error())
+			case errors.Is(err, ErrSessionNotFound):
+				return fiber.NewError(fiber.StatusNotFound, err.Error())
+			case errors.Is(err, ErrSessionEnded):
+				return fiber.NewError(fiber.StatusConflict, err.Error())
+			}
+			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		}
+		return c.JSON(result)
+	})
+
+	// Imports take the file as multipart field "file" or as the raw body.
+	r.Post("/import", authMiddleware, func(c *fiber.Ctx) error {
+		userID, _ := c.Locals("user_id").(string)
+		if userID == "" {
+			return fiber.NewError(fiber.StatusUnauthorized, "authentication required")
+		}
+		tripID := c.Query("trip_id", c.FormValue("trip_id"))
+		data := c.Body()
+		if header, err := c.FormFile("file"); err == nil {
+			file, err := header.Open()
+			if err != nil {
+				return fiber.NewError(fiber.StatusBadRequest, err.Error())
+			}
+			defer file.Close()
+			if data, err = io.ReadAll(file); err != nil {
+				return fiber.NewError(fiber.StatusBadRequest, err.Error())
+			}
+		}
+		if tripID != "" {
+			ok, err := svc.IsTripMember(c.Context(), tripID, userID)
+			if err != nil {
+				return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+			}
+			if !ok {
+				return fiber.NewError(fiber.StatusForbidden, ErrNotTripMember.Error())
+			}
+		}
+
+		result, err := svc.ImportTrack(c.Context(), userID, tripID, data)
+		switch {
+		case errors.Is(err, ErrDuplicateImport):
+			return c.Status(fiber.StatusConflict).JSON(result)
+		case errors.Is(err, ErrInvalidImport):
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		case err != nil:
+			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		}
+		return c.Status(fiber.StatusCreated).JSON(result)
+	})
+
+	lifecycle := map[string]func(context.Context, string, string) (Session, error){
+		ActionPause:  svc.PauseSession,
+		ActionResume: svc.ResumeSession,
+		ActionEnd:    svc.EndSession,
+	}
+	for action, apply := range lifecycle {
+		apply := apply
+		r.Post("/sessions/:id/"+action, authMiddleware, func(c *fiber.Ctx) error {
+			userID, _ := c.Locals("user_id").(string)
+			session, err := apply(c.Context(), c.Params("id"), userID)
+			switch {
+			case errors.Is(err, ErrSessionNotFound):
+				return fiber.NewError(fiber.StatusNotFound, err.Error())
+			case errors.Is(err, ErrInvalidTransition):
+				return fiber.NewError(fiber.StatusConflict, err.Error())
+			case err != nil:
+				return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+			}
+			return c.JSON(session)
+		})
+	}
+
+	r.Put("/sessions/:id/visibility", authMiddleware, func(c *fiber.Ctx) error {
+		var req struct {
+			Visibility string `json:"visibility"`
+		}
+		if err := c.BodyParser(&req); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		userID, _ := c.Locals("user_id").(string)
+		session, err := svc.SetVisibility(c.Context(), c.Params("id"), userID, req.Visibility)
+		switch {
+		case errors.Is(err, ErrInvalidVisibility):
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		case errors.Is(err, ErrSessionNotFound):
+			return fiber.NewError(fiber.StatusNotFound, err.Error())
+		case err != nil:
+			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		}
+		return c.JSON(session)
+	})
+
+	r.Get("/sessions/:id/profile", authMiddleware, func(c *fiber.Ctx) error {
+		userID, _ := c.Locals("user_id").(string)
+		profile, err := svc.TrackingProfile(c.Context(), c.Params("id"), userID)
+		if errors.Is(err, ErrSessionNotFound) {
+			return fiber.NewError(fiber.StatusNotFound, err.Error())
+		}
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		}
+		return c.JSON(profile)
+	})
+
+	r.Put("/sessions/:id/profile", authMiddleware, func(c *fiber.Ctx) error {
+		var req struct {
+			Mode string `json:"mode"`
+		}
+		if err := c.BodyParser(&req); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		userID, _ := c.Locals("user_id").(string)
+		profile, err := svc.SetTrackingMode(c.Context(), c.Params("id"), userID, req.Mode)
+		switch {
+		case errors.Is(err, ErrInvalidTrackingMode):
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		case errors.Is(err, ErrSessionNotFound):
+			return fiber.NewError(fiber.StatusNotFound, err.Error())
+		case err != nil:
+			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		}
+		return c.JSON(profile)
+	})
+
+	r.Post("/sessions/:id/recompute", authMiddleware, func(c *fiber.Ctx) error {
+		userID, _ := c.Locals("user_id").(string)
+		session, err := svc.RecomputeTotals(c.Context(), c.Params("id"), userID)
+		if errors.Is(err, ErrSessionNotFound) {
+			return fiber.NewError(fiber.StatusNotFound, err.Error())
+		}
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		}
+		return c.JSON(session)
+	})
+
+	// Summaries, points and exports need no token for public sessions; a
+	// caller identified by one may also read followers-only sessions of
+	// hikers they follow, and their own and their trips' sessions.
 	r.Get("/sessions/:id/summary", func(c *fiber.Ctx) error {
-		summary, err := svc.Summary(c.Context(), c.Params("id"))
+		viewerID, _ := c.Locals("user_id").(string)
+		summary, err := svc.Summary(c.Context(), c.Params("id"), viewerID, c.QueryInt("max_hr"))
+		if errors.Is(err, ErrSessionNotFound) {
+			return fiber.NewError(fiber.StatusNotFound, err.Error())
+		}
 		if err != nil {
 			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
 		}
 		return c.JSON(summary)
 	})
 
+	r.Get("/sessions/:id/deviations", authMiddleware, func(c *fiber.Ctx) error {
+		userID, _ := c.Locals("user_id").(string)
+		deviations, err := svc.Deviations(c.Context(), c.Params("id"), userID)
+		if err != nil {
+			return accessError(err)
+		}
+		return c.JSON(deviations)
+	})
+
+	r.Post("/sessions/:id/sos", authMiddleware, func(c *fiber.Ctx) error {
+		var req SOSAlert
+		if len(c.Body()) > 0 {
+			if err := c.BodyParser(&req); err != nil {
+				return fiber.NewError(fiber.StatusBadRequest, err.Error())
+			}
+		}
+		userID, _ := c.Locals("user_id").(string)
+		alert, err := svc.RaiseSOS(c.Context(), c.Params("id"), userID, req)
+		if err != nil {
+			return sosError(err)
+		}
+		return c.Status(fiber.StatusCreated).JSON(alert)
+	})
+
+	r.Get("/sessions/:id/sos", authMiddleware, func(c *fiber.Ctx) error {
+		userID, _ := c.Locals("user_id").(string)
+		alerts, err := svc.SessionSOS(c.Context(), c.Params("id"), userID)
+		if err != nil {
+			return sosError(err)
+		}
+		return c.JSON(alerts)
+	})
+
+	r.Get("/sos/:id", authMiddleware, func(c *fiber.Ctx) error {
+		userID, _ := c.Locals("user_id").(string)
+		alert, err := svc.SOS(c.Context(), c.Params("id"), userID)
+		if err != nil {
+			return sosError(err)
+		}
+		return c.JSON(alert)
+	})
+
+	sosActions := map[string]func(context.Context, string, string, string) (SOSAlert, error){
+		ActionAcknowledge: svc.AcknowledgeSOS,
+		ActionResolve:     svc.ResolveSOS,
+	}
+	for action, apply := range sosActions {
+		apply := apply
+		r.Post("/sos/:id/"+action, authMiddleware, func(c *fiber.Ctx) error {
+			var req struct {
+				Note string `json:"note"`
+			}
+			if len(c.Body()) > 0 {
+				if err := c.BodyParser(&req); err != nil {
+					return fiber.NewError(fiber.StatusBadRequest, err.Error())
+				}
+			}
+			userID, _ := c.Locals("user_id").(string)
+			alert, err := apply(c.Context(), c.Params("id"), userID, req.Note)
+			if err != nil {
+				return sosError(err)
+			}
+			return c.JSON(alert)
+		})
+	}
+
+	// Without query options the points API returns every point as a plain
+	// array, as it always has. A caller identified by a token sees their own
+	// points in privacy zones.
 	r.Get("/sessions/:id/points", func(c *fiber.Ctx) error {
-		points, err := svc.Points(c.Context(), c.Params("id"))
+		viewerID, _ := c.Locals("user_id").(string)
+		if len(c.Request().URI().QueryString()) == 0 {
+			points, err := svc.Points(c.Context(), c.Params("id"), viewerID)
+			if errors.Is(err, ErrSessionNotFound) {
+				return fiber.NewError(fiber.StatusNotFound, err.Error())
+			}
+			if err != nil {
+				return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+			}
+			return c.JSON(points)
+		}
+		q, err := parsePointsQuery(c)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		result, err := svc.QueryPoints(c.Context(), c.Params("id"), viewerID, q)
+		if errors.Is(err, ErrInvalidPointsQuery) {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		if errors.Is(err, ErrSessionNotFound) {
+			return fiber.NewError(fiber.StatusNotFound, err.Error())
+		}
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		}
+		return c.JSON(result)
+	})
+
+	r.Get("/sessions/:id/export", func(c *fiber.Ctx) error {
+		viewerID, _ := c.Locals("user_id").(string)
+		data, contentType, err := svc.Export(c.Context(), c.Params("id"), viewerID, c.Query("format", ExportGPX))
+		if errors.Is(err, ErrUnknownExportFormat) {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		if errors.Is(err, ErrSessionNotFound) {
+			return fiber.NewError(fiber.StatusNotFound, err.Error())
+		}
 		if err != nil {
 			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
 		}
-		return c.JSON(points)
+		c.Set(fiber.HeaderContentType, contentType)
+		c.Set(fiber.HeaderContentDisposition, `attachment; filename="session-`+c.Params("id")+"."+c.Query("format", ExportGPX)+`"`)
+		return c.Send(data)
+	})
+}
+
+// RegisterGeofenceRoutes adds zone management next to the tracking routes.
+// Trip members draw zones for their trip; mountain-wide zones such as a
+// closed crater need publisherMiddleware.
+func RegisterGeofenceRoutes(r fiber.Router, svc *Service, authMiddleware, publisherMiddleware fiber.Handler) {
+	r.Post("/trips/:tripID/geofences", authMiddleware, func(c *fiber.Ctx) error {
+		userID, _ := c.Locals("user_id").(string)
+		member, err := svc.IsTripMember(c.Context(), c.Params("tripID"), userID)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		}
+		if !member {
+			return fiber.NewError(fiber.StatusForbidden, ErrNotTripMember.Error())
+		}
+		return createGeofence(c, svc, Geofence{TripID: c.Params("tripID")})
 	})
+
+	r.Post("/mountains/:mountainID/geofences", authMiddleware, publisherMiddleware, func(c *fiber.Ctx) error {
+		return createGeofence(c, svc, Geofence{MountainID: c.Params("mountainID")})
+	})
+
+	r.Get("/trips/:tripID/geofences", authMiddleware, func(c *fiber.Ctx) error {
+		userID, _ := c.Locals("user_id").(string)
+		geofences, err := svc.Geofences(c.Context(), c.Params("tripID"), userID)
+		if err != nil {
+			return accessError(err)
+		}
+		return c.JSON(geofences)
+	})
+
+	r.Get("/sessions/:id/geofence-events", authMiddleware, func(c *fiber.Ctx) error {
+		userID, _ := c.Locals("user_id").(string)
+		crossings, err := svc.GeofenceCrossings(c.Context(), c.Params("id"), "", userID)
+		if err != nil {
+			return accessError(err)
+		}
+		return c.JSON(crossings)
+	})
+
+	r.Get("/geofences/:id/events", authMiddleware, func(c *fiber.Ctx) error {
+		userID, _ := c.Locals("user_id").(string)
+		crossings, err := svc.GeofenceCrossings(c.Context(), c.Query("session_id"), c.Params("id"), userID)
+		if err != nil {
+			return accessError(err)
+		}
+		return c.JSON(crossings)
+	})
+
+	r.Get("/geofences/:id/occupants", authMiddleware, func(c *fiber.Ctx) error {
+		userID, _ := c.Locals("user_id").(string)
+		occupants, err := svc.GeofenceOccupants(c.Context(), c.Params("id"), userID)
+		if err != nil {
+			return accessError(err)
+		}
+		return c.JSON(occupants)
+	})
+}
+
+// createGeofence reads a zone from the body into the scope set by the route.
+func createGeofence(c *fiber.Ctx, svc *Service, scope Geofence) error {
+	var req Geofence
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	req.TripID, req.MountainID = scope.TripID, scope.MountainID
+	req.CreatedBy, _ = c.Locals("user_id").(string)
+	geofence, err := svc.CreateGeofence(c.Context(), req)
+	if errors.Is(err, ErrInvalidGeofence) {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+	return c.Status(fiber.StatusCreated).JSON(geofence)
+}
+
+// RegisterStreamRoutes adds the trip-level live map stream next to the
+// per-session stream. Members get a snapshot of every open session's last
+// point on connect, then each member's positions as they arrive.
+func RegisterStreamRoutes(r fiber.Router, svc *Service, authMiddleware fiber.Handler) {
+	r.Get("/ws/trips/:tripID", authMiddleware, func(c *fiber.Ctx) error {
+		if !websocket.IsWebSocketUpgrade(c) {
+			return fiber.ErrUpgradeRequired
+		}
+		userID, _ := c.Locals("user_id").(string)
+		member, err := svc.IsTripMember(c.Context(), c.Params("tripID"), userID)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		}
+		if !member {
+			return fiber.NewError(fiber.StatusForbidden, ErrNotTripMember.Error())
+		}
+		return c.Next()
+	}, websocket.New(func(c *websocket.Conn) {
+		tripID := c.Params("tripID")
+		// Subscribe before reading the snapshot so no position falls between
+		// the two; updates queue on the client until the snapshot is written.
+		userID, _ := c.Locals("user_id").(string)
+		client := svc.hub.RegisterViewer(TripChannel(tripID), userID)
+
+		snapshot, err := svc.TripSnapshot(context.Background(), tripID, userID)
+		if err == nil {
+			payload, _ := json.Marshal(snapshot)
+			err = c.WriteMessage(websocket.TextMessage, payload)
+		}
+		if err != nil {
+			svc.hub.Unregister(client)
+			return
+		}
+
+		done := make(chan struct{})
+		go func() {
+			for msg := range client.Send {
+				if err := c.WriteMessage(websocket.TextMessage, msg); err != nil {
+					break
+				}
+			}
+			close(done)
+		}()
+
+		// Clients may raise an SOS over the socket; the alert reaches them
+		// through the trip channel like everyone else's. A hiker may also pin
+		// their own session's tracking mode, as with PUT .../profile; the new
+		// profile is answered here and pushed to the session stream.
+		for {
+			_, raw, err := c.ReadMessage()
+			if err != nil {
+				break
+			}
+			var msg struct {
+				Type string `json:"type"`
+				Mode string `json:"mode"`
+				SOSAlert
+			}
+			if err := json.Unmarshal(raw, &msg); err != nil {
+				reply(client.Send, TripEvent{Type: EventError, Error: "invalid message"})
+				continue
+			}
+			switch msg.Type {
+			case EventSOS:
+				if _, err := svc.RaiseSOS(context.Background(), msg.SessionID, userID, msg.SOSAlert); err != nil {
+					reply(client.Send, TripEvent{Type: EventError, Error: err.Error()})
+				}
+			case EventTrackingProfile:
+				profile, err := svc.SetTrackingMode(context.Background(), msg.SessionID, userID, msg.Mode)
+				if err != nil {
+					reply(client.Send, TripEvent{Type: EventError, Error: err.Error()})
+					continue
+				}
+				reply(client.Send, ProfileEvent{Type: EventTrackingProfile, SessionID: msg.SessionID, Profile: profile})
+			default:
+				reply(client.Send, TripEvent{Type: EventError, Error: "invalid message"})
+			}
+		}
+		svc.hub.Unregister(client)
+		<-done
+	}))
+}
+
+func parsePointsQuery(c *fiber.Ctx) (PointsQuery, error) {
+	q := PointsQuery{
+		Cursor:     c.Query("cursor"),
+		Limit:      c.QueryInt("limit"),
+		IntervalM:  c.QueryFloat("interval_m"),
+		ToleranceM: c.QueryFloat("tolerance_m"),
+		MaxPoints:  c.QueryInt("max_points"),
+		Format:     c.Query("format"),
+	}
+	if interval := c.Query("interval"); interval != "" {
+		d, err := time.ParseDuration(interval)
+		if err != nil {
+			return PointsQuery{}, fmt.Errorf("%w: interval must be a duration such as 30s", ErrInvalidPointsQuery)
+		}
+		q.Interval = d
+	}
+	return q, nil
+}
+
+// reply queues a frame for this connection only, dropping it if the client
+// is not keeping up.
+func reply(send chan<- []byte, event any) {
+	payload, _ := json.Marshal(event)
+	select {
+	case send <- payload:
+	default:
+	}
+}
+
+// accessError maps the errors of reads limited to a session's trip.
+func accessError(err error) error {
+	switch {
+	case errors.Is(err, ErrSessionNotFound), errors.Is(err, ErrGeofenceNotFound):
+		return fiber.NewError(fiber.StatusNotFound, err.Error())
+	case errors.Is(err, ErrNotTripMember):
+		return fiber.NewError(fiber.StatusForbidden, err.Error())
+	}
+	return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+}
+
+func sosError(err error) error {
+	switch {
+	case errors.Is(err, ErrSessionNotFound), errors.Is(err, ErrSOSNotFound):
+		return fiber.NewError(fiber.StatusNotFound, err.Error())
+	case errors.Is(err, ErrNotTripMember):
+		return fiber.NewError(fiber.StatusForbidden, err.Error())
+	case errors.Is(err, ErrInvalidTransition):
+		return fiber.NewError(fiber.StatusConflict, err.Error())
+	case errors.Is(err, ErrInvalidBattery):
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	return fiber.NewError(fiber.StatusInternalServerError, err.Error())
 }
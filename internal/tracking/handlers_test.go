@@ -19,17 +19,20 @@ func TestTrackingHandlers(t *testing.T) {
 	}
 	defer mock.Close()
 
+	mock.ExpectQuery(`FROM trips t JOIN mountains m`).
+		WithArgs("trip-1", pgxmock.AnyArg()).
+		WillReturnRows(pgxmock.NewRows(noticeCols))
+
 	mock.ExpectQuery(`INSERT INTO track_sessions`).
-		WithArgs(pgxmock.AnyArg(), "trip-1", "user-1", pgxmock.AnyArg(), "active").
+		WithArgs(pgxmock.AnyArg(), "trip-1", "user-1", pgxmock.AnyArg(), "active", VisibilityPublic).
 		WillReturnRows(pgxmock.NewRows([]string{"started_at", "status"}).AddRow(time.Now(), "active"))
 
-	mock.ExpectQuery(`SELECT ST_Y\(location::geometry\), ST_X\(location::geometry\), COALESCE\(elevation_m, 0\)`).
-		WithArgs(pgxmock.AnyArg()).
-		WillReturnRows(pgxmock.NewRows([]string{"lat", "lng", "elev"}).AddRow(0, 0, 0))
+	expectPointLookups(mock, "session-1", nil, nil)
 
 	mock.ExpectQuery(`INSERT INTO track_points`).
-		WithArgs(pgxmock.AnyArg(), 106.8, -6.2, 0.0, pgxmock.AnyArg(), 0.0).
+		WithArgs("session-1", 106.8, -6.2, 0.0, pgxmock.AnyArg(), 0.0, "", 0.0, 0, 0, (*float64)(nil), 0.0, (*int)(nil)).
 		WillReturnRows(pgxmock.NewRows([]string{"id", "created_at"}).AddRow(int64(1), time.Now()))
+	mock.ExpectCommit()
 
 	app := fiber.New()
 	RegisterRoutes(app.Group("/tracking"), NewService(mock, nil), func(c *fiber.Ctx) error { return c.Next() })
@@ -82,18 +85,21 @@ func TestTrackingHandlersSummaryPoints(t *testing.T) {
 	}
 	defer mock.Close()
 
+	expectViewer(mock, "session-1", "", "user-1", true)
 	mock.ExpectQuery(`SELECT id, started_at, ended_at, COALESCE\(total_distance_m,0\), COALESCE\(total_elevation_gain_m,0\)`).
 		WithArgs("session-1").
-		WillReturnRows(pgxmock.NewRows([]string{"id", "started_at", "ended_at", "dist", "elev"}).AddRow("session-1", time.Now(), time.Time{}, 100.0, 10.0))
+		WillReturnRows(pgxmock.NewRows([]string{"id", "started_at", "ended_at", "dist", "elev", "status", "paused"}).AddRow("session-1", time.Now(), nil, 100.0, 10.0, StatusActive, 0.0))
 
-	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM track_points`).
+	mock.ExpectQuery(`FROM track_points WHERE session_id=\$1 ORDER BY recorded_at, id`).
 		WithArgs("session-1").
-		WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(2))
+		WillReturnRows(pathRows(2))
+	expectPauses(mock, "session-1")
 
+	expectViewer(mock, "session-1", "", "user-1", true)
 	mock.ExpectQuery(`SELECT id, session_id, ST_Y\(location::geometry\), ST_X\(location::geometry\), COALESCE\(elevation_m,0\), recorded_at, COALESCE\(speed_mps,0\), created_at`).
 		WithArgs("session-1").
-		WillReturnRows(pgxmock.NewRows([]string{"id", "session_id", "lat", "lng", "elevation_m", "recorded_at", "speed_mps", "created_at"}).
-			AddRow(int64(1), "session-1", -6.2, 106.8, 10.0, time.Now(), 1.2, time.Now()))
+		WillReturnRows(pgxmock.NewRows([]string{"id", "session_id", "lat", "lng", "elevation_m", "recorded_at", "speed_mps", "created_at", "accuracy_m", "heart_rate_bpm", "cadence_rpm", "temperature_c", "pressure_hpa", "battery_pct"}).
+			AddRow(int64(1), "session-1", -6.2, 106.8, 10.0, time.Now(), 1.2, time.Now(), 8.0, 142, 0, nil, 0.0, nil))
 
 	app := fiber.New()
 	RegisterRoutes(app.Group("/tracking"), NewService(mock, nil), func(c *fiber.Ctx) error { return c.Next() })
@@ -130,6 +136,7 @@ func TestTrackingHandlersSummaryError(t *testing.T) {
 	}
 	defer mock.Close()
 
+	expectViewer(mock, "session-err", "", "user-1", true)
 	mock.ExpectQuery(`SELECT id, started_at, ended_at, COALESCE\(total_distance_m,0\), COALESCE\(total_elevation_gain_m,0\)`).
 		WithArgs("session-err").
 		WillReturnError(errTrack)
@@ -151,6 +158,7 @@ func TestTrackingHandlersPointsError(t *testing.T) {
 	}
 	defer mock.Close()
 
+	expectViewer(mock, "session-err", "", "user-1", true)
 	mock.ExpectQuery(`SELECT id, session_id, ST_Y\(location::geometry\), ST_X\(location::geometry\), COALESCE\(elevation_m,0\), recorded_at, COALESCE\(speed_mps,0\), created_at`).
 		WithArgs("session-err").
 		WillReturnError(errTrack)
@@ -172,8 +180,12 @@ func TestTrackingHandlersStartSessionError(t *testing.T) {
 	}
 	defer mock.Close()
 
+	mock.ExpectQuery(`FROM trips t JOIN mountains m`).
+		WithArgs("trip-1", pgxmock.AnyArg()).
+		WillReturnRows(pgxmock.NewRows(noticeCols))
+
 	mock.ExpectQuery(`INSERT INTO track_sessions`).
-		WithArgs(pgxmock.AnyArg(), "trip-1", "user-1", pgxmock.AnyArg(), "active").
+		WithArgs(pgxmock.AnyArg(), "trip-1", "user-1", pgxmock.AnyArg(), "active", VisibilityPublic).
 		WillReturnError(errTrack)
 
 	app := fiber.New()
@@ -195,13 +207,12 @@ func TestTrackingHandlersAddPointError(t *testing.T) {
 	}
 	defer mock.Close()
 
-	mock.ExpectQuery(`SELECT ST_Y\(location::geometry\), ST_X\(location::geometry\), COALESCE\(elevation_m, 0\)`).
-		WithArgs("session-err").
-		WillReturnRows(pgxmock.NewRows([]string{"lat", "lng", "elev"}).AddRow(0, 0, 0))
+	expectPointLookups(mock, "session-err", nil, nil)
 
 	mock.ExpectQuery(`INSERT INTO track_points`).
-		WithArgs("session-err", 106.8, -6.2, 0.0, pgxmock.AnyArg(), 0.0).
+		WithArgs("session-err", 106.8, -6.2, 0.0, pgxmock.AnyArg(), 0.0, "", 0.0, 0, 0, (*float64)(nil), 0.0, (*int)(nil)).
 		WillReturnError(errTrack)
+	mock.ExpectRollback()
 
 	app := fiber.New()
 	RegisterRoutes(app.Group("/tracking"), NewService(mock, nil), func(c *fiber.Ctx) error { return c.Next() })
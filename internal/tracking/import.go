@@ -0,0 +1,129 @@
+package tracking
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"backend-summithub/internal/db"
+	"backend-summithub/internal/shared/trackfile"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrInvalidImport   = errors.New("invalid track file")
+	ErrDuplicateImport = errors.New("track file already imported")
+)
+
+// maxImportPoints bounds one imported file; a multi-day trek at 1 Hz stays
+// well below it.
+const maxImportPoints = 100000
+
+// ImportResult describes the session created from an uploaded file. When the
+// same file was imported before, Duplicate is set and Session is the session
+// created the first time.
+type ImportResult struct {
+	Session   Session `json:"session"`
+	Format    string  `json:"format"`
+	Name      string  `json:"name,omitempty"`
+	Points    int64   `json:"points"`
+	Duplicate bool    `json:"duplicate,omitempty"`
+}
+
+// ImportTrack creates an ended session from a GPX, TCX or FIT export, with
+// every point of the file and its sensor readings, and totals computed as
+// for a live session. Files are identified by the SHA-256 of their content
+// per user, so importing the same export twice returns ErrDuplicateImport
+// with the existing session.
+// Imported sessions are historical: nothing is broadcast and no route or
+// zone checks run.
+func (s *Service) ImportTrack(ctx context.Context, userID, tripID string, data []byte) (ImportResult, error) {
+	track, err := trackfile.Parse(data)
+	if err != nil {
+		return ImportResult{}, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+	}
+	if len(track.Points) > maxImportPoints {
+		return ImportResult{}, fmt.Errorf("%w: more than %d points", ErrInvalidImport, maxImportPoints)
+	}
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	points := make([]TrackPoint, len(track.Points))
+	for i, p := range track.Points {
+		points[i] = TrackPoint{
+			Lat:          p.Lat,
+			Lng:          p.Lng,
+			ElevationM:   p.ElevationM,
+			RecordedAt:   p.Time,
+			SpeedMps:     p.SpeedMps,
+			HeartRateBpm: p.HeartRateBpm,
+			CadenceRpm:   p.CadenceRpm,
+			TemperatureC: p.TemperatureC,
+		}
+	}
+	points = dedupeBatch(points)
+	endedAt := points[len(points)-1].RecordedAt
+
+	result := ImportResult{Format: track.Format, Name: track.Name}
+	session := Session{ID: uuid.NewString(), TripID: tripID, UserID: userID, StartedAt: points[0].RecordedAt}
+	err = db.WithTx(ctx, s.db, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, `
+			INSERT INTO track_sessions (id, trip_id, user_id, started_at, status, import_format, import_hash)
+			VALUES ($1, NULLIF($2,'')::uuid, $3, $4, $5, $6, $7)
+			ON CONFLICT (user_id, import_hash) WHERE import_hash IS NOT NULL DO NOTHING
+			RETURNING started_at
+		`, session.ID, tripID, userID, session.StartedAt, StatusActive, track.Format, hash).Scan(&session.StartedAt)
+		if errors.Is(err, pgx.ErrNoRows) {
+			result.Duplicate = true
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		for start := 0; start < len(points); start += batchChunkSize {
+			end := start + batchChunkSize
+			if end > len(points) {
+				end = len(points)
+			}
+			inserted, err := insertChunk(ctx, tx, session.ID, points[start:end])
+			if err != nil {
+				return err
+			}
+			result.Points += inserted
+		}
+		return finishSession(ctx, tx, &session, StatusEnded, &endedAt)
+	})
+	if err != nil {
+		return ImportResult{}, err
+	}
+
+	if result.Duplicate {
+		result.Session, result.Points, err = s.importedSession(ctx, userID, hash)
+		if err != nil {
+			return ImportResult{}, err
+		}
+		return result, ErrDuplicateImport
+	}
+	result.Session = session
+	s.notifyEnded(session)
+	return result, nil
+}
+
+// importedSession loads the session an earlier import of the same file created.
+func (s *Service) importedSession(ctx context.Context, userID, hash string) (Session, int64, error) {
+	var session Session
+	var count int64
+	err := s.db.QueryRow(ctx, `
+		SELECT id, COALESCE(trip_id::text,''), COALESCE(user_id::text,''), started_at, COALESCE(ended_at, started_at),
+		       COALESCE(total_distance_m,0), COALESCE(total_elevation_gain_m,0), status,
+		       (SELECT COUNT(*) FROM track_points tp WHERE tp.session_id = track_sessions.id)
+		FROM track_sessions WHERE user_id::text=$1 AND import_hash=$2
+	`, userID, hash).Scan(&session.ID, &session.TripID, &session.UserID, &session.StartedAt, &session.EndedAt,
+		&session.TotalDistanceM, &session.TotalElevationGainM, &session.Status, &count)
+	return session, count, err
+}
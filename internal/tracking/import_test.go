@@ -0,0 +1,178 @@
+package tracking
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pashagolub/pgxmock/v3"
+)
+
+const importGPX = `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" xmlns="http://www.topografix.com/GPX/1/1" xmlns:gpxtpx="http://www.garmin.com/xmlschemas/TrackPointExtension/v2">
+  <trk><name>Arjuno</name><trkseg>
+    <trkpt lat="-7.76" lon="112.59"><ele>3100</ele><time>2026-08-09T05:00:00Z</time>
+      <extensions><gpxtpx:TrackPointExtension><gpxtpx:hr>121</gpxtpx:hr></gpxtpx:TrackPointExtension></extensions>
+    </trkpt>
+    <trkpt lat="-7.77" lon="112.59"><ele>3150</ele><time>2026-08-09T05:10:00Z</time></trkpt>
+  </trkseg></trk>
+</gpx>`
+
+func TestImportTrackCreatesEndedSession(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	start := time.Date(2026, 8, 9, 5, 0, 0, 0, time.UTC)
+	end := start.Add(10 * time.Minute)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO track_sessions .* ON CONFLICT \(user_id, import_hash\) WHERE import_hash IS NOT NULL DO NOTHING`).
+		WithArgs(pgxmock.AnyArg(), "trip-1", "user-1", start, StatusActive, "gpx", pgxmock.AnyArg()).
+		WillReturnRows(pgxmock.NewRows([]string{"started_at"}).AddRow(start))
+	mock.ExpectExec(`INSERT INTO track_points`).
+		WithArgs(pgxmock.AnyArg(), []float64{-7.76, -7.77}, []float64{112.59, 112.59}, []float64{3100, 3150},
+			[]time.Time{start, end}, []float64{0, 0}, []string{"", ""}, []float64{0, 0},
+			[]int32{121, 0}, []int32{0, 0}, []*float64{nil, nil}, []float64{0, 0}, []*int{nil, nil}).
+		WillReturnResult(pgxmock.NewResult("INSERT", 2))
+	mock.ExpectQuery(`FROM track_points WHERE session_id=\$1 ORDER BY recorded_at, id`).
+		WithArgs(pgxmock.AnyArg()).
+		WillReturnRows(pgxmock.NewRows([]string{"lat", "lng", "elev"}).AddRow(-7.76, 112.59, 3100.0).AddRow(-7.77, 112.59, 3150.0))
+	mock.ExpectExec(`UPDATE track_sessions SET total_distance_m = \$2, total_elevation_gain_m = \$3`).
+		WithArgs(pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg()).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectQuery(`UPDATE track_sessions SET status=\$2, ended_at=COALESCE\(\$3, NOW\(\)\)`).
+		WithArgs(pgxmock.AnyArg(), StatusEnded, &end).
+		WillReturnRows(pgxmock.NewRows([]string{"status", "ended_at"}).AddRow(StatusEnded, end))
+	mock.ExpectCommit()
+
+	result, err := NewService(mock, nil).ImportTrack(context.Background(), "user-1", "trip-1", []byte(importGPX))
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if result.Duplicate || result.Format != "gpx" || result.Name != "Arjuno" || result.Points != 2 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	session := result.Session
+	if session.Status != StatusEnded || !session.EndedAt.Equal(end) || session.TotalElevationGainM != 50 || session.TotalDistanceM < 1000 {
+		t.Fatalf("unexpected session %+v", session)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
+
+func TestImportTrackReturnsExistingSessionForSameFile(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	start := time.Date(2026, 8, 9, 5, 0, 0, 0, time.UTC)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO track_sessions`).
+		WithArgs(pgxmock.AnyArg(), "", "user-1", start, StatusActive, "gpx", pgxmock.AnyArg()).
+		WillReturnRows(pgxmock.NewRows([]string{"started_at"}))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`FROM track_sessions WHERE user_id::text=\$1 AND import_hash=\$2`).
+		WithArgs("user-1", pgxmock.AnyArg()).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "trip_id", "user_id", "started_at", "ended_at", "distance", "gain", "status", "points"}).
+			AddRow("session-first", "", "user-1", start, start.Add(10*time.Minute), 1112.0, 50.0, StatusEnded, int64(2)))
+
+	result, err := NewService(mock, nil).ImportTrack(context.Background(), "user-1", "", []byte(importGPX))
+	if !errors.Is(err, ErrDuplicateImport) {
+		t.Fatalf("expected ErrDuplicateImport, got %v", err)
+	}
+	if !result.Duplicate || result.Session.ID != "session-first" || result.Points != 2 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
+
+func TestImportHandler(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	app := fiber.New()
+	RegisterRoutes(app.Group("/tracking"), NewService(mock, nil), func(c *fiber.Ctx) error {
+		c.Locals("user_id", "user-1")
+		return c.Next()
+	})
+
+	upload := func(tripID string, file []byte) *http.Response {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		if tripID != "" {
+			_ = form.WriteField("trip_id", tripID)
+		}
+		part, _ := form.CreateFormFile("file", "hike.gpx")
+		_, _ = part.Write(file)
+		_ = form.Close()
+		req := httptest.NewRequest(http.MethodPost, "/tracking/import", &body)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("request: %v", err)
+		}
+		return resp
+	}
+
+	mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM trip_members`).
+		WithArgs("trip-9", "user-1").
+		WillReturnRows(pgxmock.NewRows([]string{"exists"}).AddRow(false))
+	if resp := upload("trip-9", []byte(importGPX)); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403 for another trip, got %d", resp.StatusCode)
+	}
+
+	if resp := upload("", []byte("not a track")); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unknown format, got %d", resp.StatusCode)
+	}
+
+	start := time.Date(2026, 8, 9, 5, 0, 0, 0, time.UTC)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO track_sessions`).
+		WithArgs(pgxmock.AnyArg(), "", "user-1", start, StatusActive, "gpx", pgxmock.AnyArg()).
+		WillReturnRows(pgxmock.NewRows([]string{"started_at"}))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`FROM track_sessions WHERE user_id::text=\$1 AND import_hash=\$2`).
+		WithArgs("user-1", pgxmock.AnyArg()).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "trip_id", "user_id", "started_at", "ended_at", "distance", "gain", "status", "points"}).
+			AddRow("session-first", "", "user-1", start, start.Add(10*time.Minute), 1112.0, 50.0, StatusEnded, int64(2)))
+
+	resp := upload("", []byte(importGPX))
+	if resp.StatusCode != http.StatusConflict {
+		t.Fatalf("expected 409 for a repeated import, got %d", resp.StatusCode)
+	}
+	var result ImportResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if result.Session.ID != "session-first" || !result.Duplicate {
+		t.Fatalf("unexpected result %+v", result)
+	}
+
+	// The raw body works as well as a multipart upload.
+	req := httptest.NewRequest(http.MethodPost, "/tracking/import", strings.NewReader("<gpx></gpx>"))
+	req.Header.Set("Content-Type", "application/gpx+xml")
+	if resp, err := app.Test(req); err != nil || resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an empty track, got %v %v", resp.StatusCode, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
@@ -0,0 +1,209 @@
+package tracking
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"backend-summithub/internal/db"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	StatusActive = "active"
+	StatusPaused = "paused"
+	StatusEnded  = "ended"
+	// StatusAutoClosed marks a session the idle sweep ended on the user's behalf.
+	StatusAutoClosed = "auto_closed"
+)
+
+const (
+	ActionPause  = "pause"
+	ActionResume = "resume"
+	ActionEnd    = "end"
+)
+
+var (
+	ErrSessionEnded      = errors.New("tracking session has ended")
+	ErrInvalidTransition = errors.New("invalid session status transition")
+)
+
+// transitions lists, per action, the statuses it may be applied from and the
+// status it leads to.
+var transitions = map[string]struct {
+	from []string
+	to   string
+}{
+	ActionPause:  {from: []string{StatusActive}, to: StatusPaused},
+	ActionResume: {from: []string{StatusPaused}, to: StatusActive},
+	ActionEnd:    {from: []string{StatusActive, StatusPaused}, to: StatusEnded},
+}
+
+// SessionEvent is broadcast on the session's hub channel when its status
+// changes, next to the raw track points.
+type SessionEvent struct {
+	Type    string  `json:"type"`
+	Session Session `json:"session"`
+}
+
+const EventSessionEnded = "session_ended"
+
+// isEnded reports whether a session no longer accepts points.
+func isEnded(status string) bool {
+	return status == StatusEnded || status == StatusAutoClosed
+}
+
+func (s *Service) PauseSession(ctx context.Context, sessionID, userID string) (Session, error) {
+	return s.transition(ctx, sessionID, userID, ActionPause)
+}
+
+func (s *Service) ResumeSession(ctx context.Context, sessionID, userID string) (Session, error) {
+	return s.transition(ctx, sessionID, userID, ActionResume)
+}
+
+// EndSession closes the session, recomputes its totals from the stored points
+// and tells subscribers the session is over.
+func (s *Service) EndSession(ctx context.Context, sessionID, userID string) (Session, error) {
+	session, err := s.transition(ctx, sessionID, userID, ActionEnd)
+	if err != nil {
+		return Session{}, err
+	}
+	s.broadcastEnded(session)
+	s.notifyEnded(session)
+	return session, nil
+}
+
+// transition applies action to one of userID's sessions. Other users'
+// sessions are ErrSessionNotFound, as for SetVisibility.
+func (s *Service) transition(ctx context.Context, sessionID, userID, action string) (Session, error) {
+	rule, ok := transitions[action]
+	if !ok {
+		return Session{}, fmt.Errorf("%w: unknown action %q", ErrInvalidTransition, action)
+	}
+
+	var session Session
+	err := db.WithTx(ctx, s.db, func(tx pgx.Tx) error {
+		var err error
+		session, err = lockSession(ctx, tx, sessionID)
+		if err != nil {
+			return err
+		}
+		if session.UserID != userID {
+			return ErrSessionNotFound
+		}
+		if !allowed(rule.from, session.Status) {
+			return fmt.Errorf("%w: cannot %s a %s session", ErrInvalidTransition, action, session.Status)
+		}
+
+		switch action {
+		case ActionPause:
+			_, err = tx.Exec(ctx, `INSERT INTO track_session_pauses (session_id, paused_at) VALUES ($1, NOW())`, sessionID)
+		case ActionResume, ActionEnd:
+			_, err = tx.Exec(ctx, `
+				UPDATE track_session_pauses SET resumed_at = NOW()
+				WHERE session_id=$1 AND resumed_at IS NULL
+			`, sessionID)
+		}
+		if err != nil {
+			return err
+		}
+
+		if action == ActionEnd {
+			return finishSession(ctx, tx, &session, StatusEnded, nil)
+		}
+		return tx.QueryRow(ctx, `
+			UPDATE track_sessions SET status=$2 WHERE id=$1
+			RETURNING status
+		`, sessionID, rule.to).Scan(&session.Status)
+	})
+	if err != nil {
+		return Session{}, err
+	}
+	return session, nil
+}
+
+// finishSession recomputes the totals and marks the session with a final
+// status. endedAt defaults to now.
+func finishSession(ctx context.Context, tx pgx.Tx, session *Session, status string, endedAt *time.Time) error {
+	var err error
+	session.TotalDistanceM, session.TotalElevationGainM, err = recomputeTotals(ctx, tx, session.ID)
+	if err != nil {
+		return err
+	}
+	return tx.QueryRow(ctx, `
+		UPDATE track_sessions SET status=$2, ended_at=COALESCE($3, NOW())
+		WHERE id=$1
+		RETURNING status, ended_at
+	`, session.ID, status, endedAt).Scan(&session.Status, &session.EndedAt)
+}
+
+// lockSession loads a session and holds its row lock until the transaction ends.
+func lockSession(ctx context.Context, tx pgx.Tx, sessionID string) (Session, error) {
+	var session Session
+	err := tx.QueryRow(ctx, `
+		SELECT id, COALESCE(trip_id::text,''), COALESCE(user_id::text,''), started_at, status,
+		       EXISTS (SELECT 1 FROM gpx_routes r WHERE r.trip_id = track_sessions.trip_id AND r.route IS NOT NULL),
+		       EXISTS (SELECT 1 FROM geofences g
+		               WHERE g.trip_id = track_sessions.trip_id
+		                  OR g.mountain_id = (SELECT t.mountain_id FROM trips t WHERE t.id = track_sessions.trip_id)),
+		       tracking_mode, tracking_auto
+		FROM track_sessions WHERE id=$1
+		FOR UPDATE
+	`, sessionID).Scan(&session.ID, &session.TripID, &session.UserID, &session.StartedAt, &session.Status, &session.hasRoute, &session.hasGeofences,
+		&session.trackingMode, &session.trackingAuto)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Session{}, ErrSessionNotFound
+	}
+	return session, err
+}
+
+// SessionEndListener is told about every session once it has ended, after
+// the change is committed, whether the hiker ended it, the idle sweep
+// closed it or it was imported. Listeners run in the background, one after
+// another, so their work never holds up the request that ended the session.
+type SessionEndListener interface {
+	SessionEnded(ctx context.Context, session Session)
+}
+
+// AddSessionEndListener registers l for every session that ends from now on.
+func (s *Service) AddSessionEndListener(l SessionEndListener) {
+	s.endListeners = append(s.endListeners, l)
+}
+
+// notifyEnded hands the session to the listeners on a background context,
+// as the request's context is done as soon as the response is written.
+func (s *Service) notifyEnded(session Session) {
+	if len(s.endListeners) == 0 {
+		return
+	}
+	listeners := s.endListeners
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		ctx := context.Background()
+		for _, l := range listeners {
+			l.SessionEnded(ctx, session)
+		}
+	}()
+}
+
+func (s *Service) broadcastEnded(session Session) {
+	if s.hub == nil {
+		return
+	}
+	payload, _ := json.Marshal(SessionEvent{Type: EventSessionEnded, Session: session})
+	s.hub.Broadcast(session.ID, payload)
+	s.broadcastTrip(session, EventSessionEnded, nil)
+}
+
+func allowed(statuses []string, status string) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,242 @@
+package tracking
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"backend-summithub/internal/stream"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v3"
+)
+
+func expectLock(mock pgxmock.PgxPoolIface, sessionID, status string) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM track_sessions WHERE id=\$1\s+FOR UPDATE`).
+		WithArgs(sessionID).
+		WillReturnRows(lockedSession(sessionID, status))
+}
+
+func TestPauseAndResumeSession(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	expectLock(mock, "session-1", StatusActive)
+	mock.ExpectExec(`INSERT INTO track_session_pauses \(session_id, paused_at\) VALUES \(\$1, NOW\(\)\)`).
+		WithArgs("session-1").
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectQuery(`UPDATE track_sessions SET status=\$2 WHERE id=\$1`).
+		WithArgs("session-1", StatusPaused).
+		WillReturnRows(pgxmock.NewRows([]string{"status"}).AddRow(StatusPaused))
+	mock.ExpectCommit()
+
+	expectLock(mock, "session-1", StatusPaused)
+	mock.ExpectExec(`UPDATE track_session_pauses SET resumed_at = NOW\(\)`).
+		WithArgs("session-1").
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectQuery(`UPDATE track_sessions SET status=\$2 WHERE id=\$1`).
+		WithArgs("session-1", StatusActive).
+		WillReturnRows(pgxmock.NewRows([]string{"status"}).AddRow(StatusActive))
+	mock.ExpectCommit()
+
+	svc := NewService(mock, nil)
+	session, err := svc.PauseSession(context.Background(), "session-1", "user-1")
+	if err != nil || session.Status != StatusPaused {
+		t.Fatalf("pause: %+v %v", session, err)
+	}
+	session, err = svc.ResumeSession(context.Background(), "session-1", "user-1")
+	if err != nil || session.Status != StatusActive {
+		t.Fatalf("resume: %+v %v", session, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
+
+func TestInvalidTransitions(t *testing.T) {
+	cases := []struct {
+		status string
+		apply  func(*Service) (Session, error)
+	}{
+		{StatusPaused, func(s *Service) (Session, error) { return s.PauseSession(context.Background(), "session-1", "user-1") }},
+		{StatusActive, func(s *Service) (Session, error) { return s.ResumeSession(context.Background(), "session-1", "user-1") }},
+		{StatusEnded, func(s *Service) (Session, error) { return s.EndSession(context.Background(), "session-1", "user-1") }},
+		{StatusEnded, func(s *Service) (Session, error) { return s.ResumeSession(context.Background(), "session-1", "user-1") }},
+	}
+	for _, tc := range cases {
+		mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+		if err != nil {
+			t.Fatalf("mock pool: %v", err)
+		}
+		expectLock(mock, "session-1", tc.status)
+		mock.ExpectRollback()
+
+		if _, err := tc.apply(NewService(mock, nil)); !errors.Is(err, ErrInvalidTransition) {
+			t.Fatalf("from %s: expected ErrInvalidTransition, got %v", tc.status, err)
+		}
+		mock.Close()
+	}
+}
+
+func TestTransitionsLimitedToOwner(t *testing.T) {
+	for _, apply := range []func(*Service) (Session, error){
+		func(s *Service) (Session, error) { return s.PauseSession(context.Background(), "session-1", "user-2") },
+		func(s *Service) (Session, error) { return s.ResumeSession(context.Background(), "session-1", "user-2") },
+		func(s *Service) (Session, error) { return s.EndSession(context.Background(), "session-1", "user-2") },
+	} {
+		mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+		if err != nil {
+			t.Fatalf("mock pool: %v", err)
+		}
+		expectLock(mock, "session-1", StatusPaused)
+		mock.ExpectRollback()
+
+		svc := NewService(mock, nil)
+		listener := &endListener{ended: make(chan Session, 1)}
+		svc.AddSessionEndListener(listener)
+		if _, err := apply(svc); !errors.Is(err, ErrSessionNotFound) {
+			t.Fatalf("expected ErrSessionNotFound for another user, got %v", err)
+		}
+		svc.background.Wait()
+		if len(listener.ended) != 0 {
+			t.Fatalf("another user's request must not end the session")
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Fatalf("expectations: %v", err)
+		}
+		mock.Close()
+	}
+}
+
+type endListener struct {
+	ended chan Session
+}
+
+func (l *endListener) SessionEnded(_ context.Context, session Session) {
+	l.ended <- session
+}
+
+func TestEndSessionFinalisesAndBroadcasts(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	hub := stream.NewHub(nil)
+	client := hub.Register("session-1")
+	defer hub.Unregister(client)
+
+	ended := time.Now()
+	expectLock(mock, "session-1", StatusPaused)
+	mock.ExpectExec(`UPDATE track_session_pauses SET resumed_at = NOW\(\)`).
+		WithArgs("session-1").
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	expectRecompute(mock, "session-1", [][3]float64{{-7.94, 112.95, 2100}, {-7.95, 112.95, 2130}})
+	mock.ExpectQuery(`UPDATE track_sessions SET status=\$2, ended_at=COALESCE\(\$3, NOW\(\)\)`).
+		WithArgs("session-1", StatusEnded, (*time.Time)(nil)).
+		WillReturnRows(pgxmock.NewRows([]string{"status", "ended_at"}).AddRow(StatusEnded, ended))
+	mock.ExpectCommit()
+
+	svc := NewService(mock, hub)
+	listener := &endListener{ended: make(chan Session, 1)}
+	svc.AddSessionEndListener(listener)
+	session, err := svc.EndSession(context.Background(), "session-1", "user-1")
+	if err != nil {
+		t.Fatalf("end: %v", err)
+	}
+	if session.Status != StatusEnded || session.TotalElevationGainM != 30 || session.TotalDistanceM < 1100 {
+		t.Fatalf("unexpected session %+v", session)
+	}
+	select {
+	case got := <-listener.ended:
+		if got.ID != "session-1" || got.Status != StatusEnded {
+			t.Fatalf("expected listeners told about the ended session, got %+v", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected listeners told about the ended session")
+	}
+
+	select {
+	case msg := <-client.Send:
+		var event SessionEvent
+		if err := json.Unmarshal(msg, &event); err != nil || event.Type != EventSessionEnded || event.Session.ID != "session-1" {
+			t.Fatalf("unexpected event %s", msg)
+		}
+	case <-time.After(100 * time.Millisecond):
+		t.Fatalf("expected session_ended broadcast")
+	}
+}
+
+func TestAddPointRefusedOnEndedSession(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	expectLock(mock, "session-1", StatusEnded)
+	mock.ExpectRollback()
+
+	app := fiber.New()
+	RegisterRoutes(app.Group("/tracking"), NewService(mock, nil), func(c *fiber.Ctx) error { return c.Next() })
+
+	body, _ := json.Marshal(TrackPoint{Lat: -6.2, Lng: 106.8})
+	req := httptest.NewRequest(http.MethodPost, "/tracking/sessions/session-1/points", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	if err != nil || resp.StatusCode != http.StatusConflict {
+		t.Fatalf("expected 409, got %v %v", resp.StatusCode, err)
+	}
+}
+
+func TestLifecycleHandlers(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM track_sessions WHERE id=\$1\s+FOR UPDATE`).
+		WithArgs("missing").
+		WillReturnError(pgx.ErrNoRows)
+	mock.ExpectRollback()
+	expectLock(mock, "session-1", StatusActive)
+	mock.ExpectRollback()
+
+	expectLock(mock, "session-1", StatusActive)
+	mock.ExpectRollback()
+
+	app := fiber.New()
+	RegisterRoutes(app.Group("/tracking"), NewService(mock, nil), func(c *fiber.Ctx) error {
+		c.Locals("user_id", c.Get("X-User", "user-1"))
+		return c.Next()
+	})
+
+	for _, tc := range []struct {
+		path, user string
+		want       int
+	}{
+		{"/tracking/sessions/missing/pause", "user-1", http.StatusNotFound},
+		{"/tracking/sessions/session-1/resume", "user-1", http.StatusConflict},
+		{"/tracking/sessions/session-1/end", "user-2", http.StatusNotFound},
+	} {
+		req := httptest.NewRequest(http.MethodPost, tc.path, nil)
+		req.Header.Set("X-User", tc.user)
+		resp, err := app.Test(req)
+		if err != nil || resp.StatusCode != tc.want {
+			t.Fatalf("%s: expected %d, got %v %v", tc.path, tc.want, resp.StatusCode, err)
+		}
+	}
+}
@@ -1,6 +1,10 @@
 package tracking
 
-import "time"
+import (
+	"time"
+
+	"backend-summithub/internal/notice"
+)
 
 type Session struct {
 	ID        string    `json:"id"`
@@ -11,6 +15,25 @@ type Session struct {
 	TotalDistanceM      float64 `json:"total_distance_m"`
 	TotalElevationGainM float64 `json:"total_elevation_gain_m"`
 	Status              string  `json:"status"`
+	// Visibility is public, followers or private; only public sessions feed
+	// the heatmap.
+	Visibility string          `json:"visibility,omitempty"`
+	Notices             []notice.Notice `json:"notices,omitempty"`
+	// Profile is how the device should record, returned when the session
+	// starts; later changes arrive as tracking_profile events.
+	Profile *TrackingProfile `json:"tracking_profile,omitempty"`
+
+	// hasRoute is set by lockSession when the session's trip has a planned route.
+	hasRoute bool
+	// hasGeofences is set by lockSession when zones apply to the session's trip.
+	hasGeofences bool
+	// trackingMode and trackingAuto are set by lockSession from the
+	// session's recording profile.
+	trackingMode string
+	trackingAuto bool
+	// hidden is set by withLiveMask when some positions must only be
+	// broadcast to the owner.
+	hidden func(lat, lng float64) bool
 }
 
 type TrackPoint struct {
@@ -21,13 +44,53 @@ type TrackPoint struct {
 	ElevationM float64   `json:"elevation_m"`
 	RecordedAt time.Time `json:"recorded_at"`
 	SpeedMps   float64   `json:"speed_mps"`
+	AccuracyM  float64   `json:"accuracy_m,omitempty"`
+	HeartRateBpm int     `json:"heart_rate_bpm,omitempty"`
+	CadenceRpm   int     `json:"cadence_rpm,omitempty"`
+	// TemperatureC and BatteryPct are pointers because zero is a reading.
+	TemperatureC *float64 `json:"temperature_c,omitempty"`
+	PressureHPa  float64  `json:"pressure_hpa,omitempty"`
+	BatteryPct   *int     `json:"battery_pct,omitempty"`
+	ClientPointID string `json:"client_point_id,omitempty"`
 	CreatedAt  time.Time `json:"created_at"`
 }
 
+// BatchResult reports what a batch upload stored. Points already stored by
+// an earlier attempt are counted as duplicates.
+type BatchResult struct {
+	SessionID           string  `json:"session_id"`
+	Received            int     `json:"received"`
+	Inserted            int64   `json:"inserted"`
+	Duplicates          int64   `json:"duplicates"`
+	TotalDistanceM      float64 `json:"total_distance_m"`
+	TotalElevationGainM float64 `json:"total_elevation_gain_m"`
+}
+
+// Summary reports raw figures, summed over every stored point, next to
+// filtered ones computed after GPS noise filtering. Moving time, speeds,
+// elevation extremes and splits all come from the filtered track.
 type Summary struct {
-	SessionID     string  `json:"session_id"`
-	PointCount    int     `json:"point_count"`
-	DistanceM     float64 `json:"distance_m"`
-	DurationSec   int64   `json:"duration_sec"`
-	AverageSpeedM float64 `json:"average_speed_mps"`
+	SessionID              string  `json:"session_id"`
+	Status                 string  `json:"status"`
+	PointCount             int     `json:"point_count"`
+	RejectedPoints         int     `json:"rejected_points"`
+	DistanceM              float64 `json:"distance_m"`
+	ElevationGainM         float64 `json:"elevation_gain_m"`
+	FilteredDistanceM      float64 `json:"filtered_distance_m"`
+	FilteredElevationGainM float64 `json:"filtered_elevation_gain_m"`
+	FilteredElevationLossM float64 `json:"filtered_elevation_loss_m"`
+	MinElevationM          float64 `json:"min_elevation_m"`
+	MaxElevationM          float64 `json:"max_elevation_m"`
+	// ElapsedSec runs from start to end; DurationSec excludes pauses and
+	// MovingSec also excludes rests.
+	ElapsedSec          int64   `json:"elapsed_sec"`
+	DurationSec         int64   `json:"duration_sec"`
+	PausedSec           int64   `json:"paused_sec"`
+	MovingSec           int64   `json:"moving_sec"`
+	AverageSpeedM       float64 `json:"average_speed_mps"`
+	MaxSpeedMps         float64 `json:"max_speed_mps"`
+	MovingPaceSecPerKm  float64 `json:"moving_pace_sec_per_km"`
+	ClimbRateMPerHour   float64 `json:"climb_rate_m_per_h"`
+	Splits              []Split `json:"splits"`
+	Sensors             SensorSummary `json:"sensors"`
 }
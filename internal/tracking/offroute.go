@@ -0,0 +1,254 @@
+package tracking
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+
+	"backend-summithub/internal/privacy"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	EventOffRoute    = "off_route"
+	EventBackOnRoute = "back_on_route"
+)
+
+// OffRouteConfig sets when a hiker counts as off the planned route: more
+// than DistanceM from every route of the trip for Points consecutive points.
+type OffRouteConfig struct {
+	DistanceM float64
+	Points    int
+}
+
+var DefaultOffRouteConfig = OffRouteConfig{DistanceM: 100, Points: 3}
+
+// RouteDeviation is one stretch of a session spent off the planned route.
+// StartedAt is the first off-route point, DetectedAt the point that
+// confirmed it, and ClearedAt the point back on the route.
+type RouteDeviation struct {
+	ID         string     `json:"id"`
+	SessionID  string     `json:"session_id"`
+	UserID     string     `json:"user_id,omitempty"`
+	RouteID    string     `json:"route_id"`
+	StartedAt  time.Time  `json:"started_at"`
+	DetectedAt time.Time  `json:"detected_at"`
+	ClearedAt  *time.Time `json:"cleared_at,omitempty"`
+	DistanceM  float64    `json:"distance_m"`
+	Lat        float64    `json:"lat"`
+	Lng        float64    `json:"lng"`
+}
+
+// RouteEvent is broadcast on the session's and the trip's channels when a
+// deviation is detected or cleared.
+type RouteEvent struct {
+	Type      string         `json:"type"`
+	Deviation RouteDeviation `json:"deviation"`
+}
+
+// SetOffRouteConfig replaces the off-route thresholds.
+func (s *Service) SetOffRouteConfig(cfg OffRouteConfig) {
+	s.offRoute = cfg
+}
+
+// routeDistance is a point's distance to the nearest route of the trip.
+type routeDistance struct {
+	point     TrackPoint
+	routeID   string
+	distanceM float64
+}
+
+// checkRoute advances the session's off-route state with newly stored
+// points. Only points after the last checked one count, so late offline
+// points and retries do not move the state. It returns the events to
+// broadcast once the transaction commits.
+func (s *Service) checkRoute(ctx context.Context, tx pgx.Tx, session Session, points []TrackPoint) ([]RouteEvent, error) {
+	if !session.hasRoute || s.offRoute.Points <= 0 || len(points) == 0 {
+		return nil, nil
+	}
+
+	var streak int
+	var since, checkedAt *time.Time
+	if err := tx.QueryRow(ctx, `
+		SELECT off_route_streak, off_route_since, route_checked_at FROM track_sessions WHERE id=$1
+	`, session.ID).Scan(&streak, &since, &checkedAt); err != nil {
+		return nil, err
+	}
+
+	ordered := pointsAfter(points, checkedAt)
+	if len(ordered) == 0 {
+		return nil, nil
+	}
+
+	distances, err := routeDistances(ctx, tx, session.TripID, ordered)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []RouteEvent
+	for _, d := range distances {
+		if d.distanceM <= s.offRoute.DistanceM {
+			if streak >= s.offRoute.Points {
+				deviation, err := clearDeviation(ctx, tx, session, d.point.RecordedAt)
+				if err != nil {
+					return nil, err
+				}
+				if deviation != nil {
+					events = append(events, RouteEvent{Type: EventBackOnRoute, Deviation: *deviation})
+				}
+			}
+			streak, since = 0, nil
+			continue
+		}
+
+		streak++
+		if streak == 1 {
+			at := d.point.RecordedAt
+			since = &at
+		}
+		if streak == s.offRoute.Points {
+			deviation := RouteDeviation{
+				ID:         uuid.NewString(),
+				SessionID:  session.ID,
+				UserID:     session.UserID,
+				RouteID:    d.routeID,
+				StartedAt:  *since,
+				DetectedAt: d.point.RecordedAt,
+				DistanceM:  d.distanceM,
+				Lat:        d.point.Lat,
+				Lng:        d.point.Lng,
+			}
+			if _, err := tx.Exec(ctx, `
+				INSERT INTO route_deviations (id, session_id, route_id, started_at, detected_at, distance_m, location)
+				VALUES ($1, $2, $3, $4, $5, $6, ST_SetSRID(ST_MakePoint($7,$8), 4326)::geography)
+			`, deviation.ID, session.ID, d.routeID, deviation.StartedAt, deviation.DetectedAt, d.distanceM, d.point.Lng, d.point.Lat); err != nil {
+				return nil, err
+			}
+			events = append(events, RouteEvent{Type: EventOffRoute, Deviation: deviation})
+		}
+	}
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE track_sessions SET off_route_streak=$2, off_route_since=$3, route_checked_at=$4 WHERE id=$1
+	`, session.ID, streak, since, ordered[len(ordered)-1].RecordedAt); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// pointsAfter returns the points recorded after checkedAt in time order. The
+// incremental per-session checks use it to skip points they already saw.
+func pointsAfter(points []TrackPoint, checkedAt *time.Time) []TrackPoint {
+	ordered := make([]TrackPoint, 0, len(points))
+	for _, p := range points {
+		if checkedAt == nil || p.RecordedAt.After(*checkedAt) {
+			ordered = append(ordered, p)
+		}
+	}
+	sort.SliceStable(ordered, func(i, j int) bool { return ordered[i].RecordedAt.Before(ordered[j].RecordedAt) })
+	return ordered
+}
+
+// routeDistances measures each point against the nearest route of the trip,
+// in the order given.
+func routeDistances(ctx context.Context, tx pgx.Tx, tripID string, points []TrackPoint) ([]routeDistance, error) {
+	lats := make([]float64, len(points))
+	lngs := make([]float64, len(points))
+	for i, p := range points {
+		lats[i], lngs[i] = p.Lat, p.Lng
+	}
+	rows, err := tx.Query(ctx, `
+		SELECT DISTINCT ON (p.ord) p.ord, r.id::text,
+		       ST_Distance(r.route, ST_SetSRID(ST_MakePoint(p.lng, p.lat), 4326)::geography)
+		FROM unnest($2::float8[], $3::float8[]) WITH ORDINALITY AS p(lat, lng, ord)
+		JOIN gpx_routes r ON r.trip_id = $1 AND r.route IS NOT NULL
+		ORDER BY p.ord, 3
+	`, tripID, lats, lngs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var distances []routeDistance
+	for rows.Next() {
+		var ord int64
+		var d routeDistance
+		if err := rows.Scan(&ord, &d.routeID, &d.distanceM); err != nil {
+			return nil, err
+		}
+		d.point = points[ord-1]
+		distances = append(distances, d)
+	}
+	return distances, rows.Err()
+}
+
+// clearDeviation closes the session's open deviation. It returns nil when
+// there is none to close, as when the deviation row was cleared by hand.
+func clearDeviation(ctx context.Context, tx pgx.Tx, session Session, at time.Time) (*RouteDeviation, error) {
+	d := RouteDeviation{SessionID: session.ID, UserID: session.UserID}
+	err := tx.QueryRow(ctx, `
+		UPDATE route_deviations SET cleared_at=$2
+		WHERE session_id=$1 AND cleared_at IS NULL
+		RETURNING id, COALESCE(route_id::text,''), started_at, detected_at, cleared_at, distance_m,
+		          ST_Y(location::geometry), ST_X(location::geometry)
+	`, session.ID, at).Scan(&d.ID, &d.RouteID, &d.StartedAt, &d.DetectedAt, &d.ClearedAt, &d.DistanceM, &d.Lat, &d.Lng)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// Deviations lists a session's off-route stretches, oldest first, for the
+// hiker and the members of the session's trip. Members do not see the
+// stretches that start inside the hiker's privacy zones.
+func (s *Service) Deviations(ctx context.Context, sessionID, userID string) ([]RouteDeviation, error) {
+	if err := checkSessionMember(ctx, s.db, sessionID, userID); err != nil {
+		return nil, err
+	}
+	rows, err := privacy.QueryPositions(ctx, s.db, userID, func(visible func(location, owner string) string) string {
+		return `
+		SELECT d.id, d.session_id, COALESCE(ts.user_id::text,''), COALESCE(d.route_id::text,''),
+		       d.started_at, d.detected_at, d.cleared_at, d.distance_m,
+		       ST_Y(d.location::geometry), ST_X(d.location::geometry)
+		FROM route_deviations d
+		JOIN track_sessions ts ON ts.id = d.session_id
+		WHERE d.session_id=$1 AND ` + visible("d.location", "ts.user_id") + `
+		ORDER BY d.started_at
+	`
+	}, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deviations := []RouteDeviation{}
+	for rows.Next() {
+		var d RouteDeviation
+		if err := rows.Scan(&d.ID, &d.SessionID, &d.UserID, &d.RouteID, &d.StartedAt, &d.DetectedAt, &d.ClearedAt, &d.DistanceM, &d.Lat, &d.Lng); err != nil {
+			return nil, err
+		}
+		deviations = append(deviations, d)
+	}
+	return deviations, rows.Err()
+}
+
+func (s *Service) broadcastRouteEvents(session Session, events []RouteEvent) {
+	if s.hub == nil {
+		return
+	}
+	for _, event := range events {
+		payload, _ := json.Marshal(event)
+		lat, lng := event.Deviation.Lat, event.Deviation.Lng
+		s.broadcastAt(session, session.ID, lat, lng, payload, false)
+		if session.TripID != "" {
+			s.broadcastAt(session, TripChannel(session.TripID), lat, lng, payload, false)
+		}
+	}
+}
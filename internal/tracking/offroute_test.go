@@ -0,0 +1,231 @@
+package tracking
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"backend-summithub/internal/stream"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v3"
+)
+
+func routeState(streak int, since, checkedAt *time.Time) *pgxmock.Rows {
+	return pgxmock.NewRows([]string{"streak", "since", "checked_at"}).AddRow(streak, since, checkedAt)
+}
+
+func TestCheckRouteDetectsAndClearsDeviation(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	t0 := time.Date(2026, 8, 17, 7, 0, 0, 0, time.UTC)
+	late := TrackPoint{Lat: -1.69, Lng: 101.26, RecordedAt: t0.Add(-time.Minute)}
+	p1 := TrackPoint{Lat: -1.70, Lng: 101.26, RecordedAt: t0.Add(10 * time.Second)}
+	p2 := TrackPoint{Lat: -1.71, Lng: 101.26, RecordedAt: t0.Add(20 * time.Second)}
+	p3 := TrackPoint{Lat: -1.72, Lng: 101.26, RecordedAt: t0.Add(30 * time.Second)}
+
+	mock.ExpectBegin()
+	// One off-route point was already counted by an earlier request.
+	mock.ExpectQuery(`SELECT off_route_streak, off_route_since, route_checked_at FROM track_sessions`).
+		WithArgs("session-1").
+		WillReturnRows(routeState(1, &t0, &t0))
+	mock.ExpectQuery(`FROM unnest\(\$2::float8\[\], \$3::float8\[\]\) WITH ORDINALITY .* JOIN gpx_routes r`).
+		WithArgs("trip-1", []float64{p1.Lat, p2.Lat, p3.Lat}, []float64{p1.Lng, p2.Lng, p3.Lng}).
+		WillReturnRows(pgxmock.NewRows([]string{"ord", "route_id", "distance"}).
+			AddRow(int64(1), "route-1", 150.0).
+			AddRow(int64(2), "route-1", 180.0).
+			AddRow(int64(3), "route-1", 40.0))
+	mock.ExpectExec(`INSERT INTO route_deviations`).
+		WithArgs(pgxmock.AnyArg(), "session-1", "route-1", t0, p2.RecordedAt, 180.0, p2.Lng, p2.Lat).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	cleared := p3.RecordedAt
+	mock.ExpectQuery(`UPDATE route_deviations SET cleared_at=\$2 WHERE session_id=\$1 AND cleared_at IS NULL`).
+		WithArgs("session-1", p3.RecordedAt).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "route_id", "started_at", "detected_at", "cleared_at", "distance", "lat", "lng"}).
+			AddRow("dev-1", "route-1", t0, p2.RecordedAt, &cleared, 180.0, p2.Lat, p2.Lng))
+	mock.ExpectExec(`UPDATE track_sessions SET off_route_streak=\$2, off_route_since=\$3, route_checked_at=\$4`).
+		WithArgs("session-1", 0, (*time.Time)(nil), p3.RecordedAt).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+	tx, err := mock.Begin(context.Background())
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	session := Session{ID: "session-1", TripID: "trip-1", UserID: "user-1", hasRoute: true}
+	events, err := NewService(mock, nil).checkRoute(context.Background(), tx, session, []TrackPoint{p3, late, p1, p2})
+	if err != nil {
+		t.Fatalf("check route: %v", err)
+	}
+	if len(events) != 2 || events[0].Type != EventOffRoute || events[1].Type != EventBackOnRoute {
+		t.Fatalf("unexpected events %+v", events)
+	}
+	if !events[0].Deviation.StartedAt.Equal(t0) || events[0].Deviation.UserID != "user-1" || events[0].Deviation.DistanceM != 180 {
+		t.Fatalf("unexpected deviation %+v", events[0].Deviation)
+	}
+	if events[1].Deviation.ID != "dev-1" || events[1].Deviation.ClearedAt == nil {
+		t.Fatalf("expected cleared deviation, got %+v", events[1].Deviation)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
+
+func TestCheckRouteSkippedWithoutRoute(t *testing.T) {
+	events, err := NewService(nil, nil).checkRoute(context.Background(), nil, Session{ID: "session-1"}, []TrackPoint{{Lat: 1}})
+	if err != nil || events != nil {
+		t.Fatalf("expected no check, got %v %v", events, err)
+	}
+}
+
+func TestAddPointBroadcastsOffRoute(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	hub := stream.NewHub(nil)
+	client := hub.Register(TripChannel("trip-1"))
+	defer hub.Unregister(client)
+
+	at := time.Date(2026, 8, 17, 7, 0, 0, 0, time.UTC)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM track_sessions WHERE id=\$1\s+FOR UPDATE`).
+		WithArgs("session-1").
+		WillReturnRows(pgxmock.NewRows([]string{"id", "trip_id", "user_id", "started_at", "status", "has_route", "has_geofences", "tracking_mode", "tracking_auto"}).
+			AddRow("session-1", "trip-1", "user-1", at.Add(-time.Hour), StatusActive, true, false, ProfileNormal, false))
+	mock.ExpectQuery(`recorded_at <= \$2`).WithArgs("session-1", at).WillReturnRows(pgxmock.NewRows([]string{"lat", "lng", "elev"}))
+	mock.ExpectQuery(`recorded_at > \$2`).WithArgs("session-1", at).WillReturnRows(pgxmock.NewRows([]string{"lat", "lng", "elev"}))
+	mock.ExpectQuery(`INSERT INTO track_points`).
+		WithArgs("session-1", 101.26, -1.7, 0.0, at, 0.0, "", 0.0, 0, 0, (*float64)(nil), 0.0, (*int)(nil)).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "created_at"}).AddRow(int64(9), time.Now()))
+	mock.ExpectQuery(`SELECT off_route_streak`).
+		WithArgs("session-1").
+		WillReturnRows(routeState(0, nil, nil))
+	mock.ExpectQuery(`JOIN gpx_routes r`).
+		WithArgs("trip-1", []float64{-1.7}, []float64{101.26}).
+		WillReturnRows(pgxmock.NewRows([]string{"ord", "route_id", "distance"}).AddRow(int64(1), "route-1", 250.0))
+	mock.ExpectExec(`INSERT INTO route_deviations`).
+		WithArgs(pgxmock.AnyArg(), "session-1", "route-1", at, at, 250.0, 101.26, -1.7).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectExec(`UPDATE track_sessions SET off_route_streak`).
+		WithArgs("session-1", 1, &at, at).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectCommit()
+
+	svc := NewService(mock, hub)
+	svc.SetOffRouteConfig(OffRouteConfig{DistanceM: 100, Points: 1})
+	if _, err := svc.AddPoint(context.Background(), "session-1", TrackPoint{Lat: -1.7, Lng: 101.26, RecordedAt: at}); err != nil {
+		t.Fatalf("add point: %v", err)
+	}
+
+	var types []string
+	for len(types) < 2 {
+		select {
+		case msg := <-client.Send:
+			var event RouteEvent
+			_ = json.Unmarshal(msg, &event)
+			types = append(types, event.Type)
+		case <-time.After(100 * time.Millisecond):
+			t.Fatalf("expected position and off_route events, got %v", types)
+		}
+	}
+	if types[0] != EventPosition || types[1] != EventOffRoute {
+		t.Fatalf("unexpected events %v", types)
+	}
+}
+
+func TestDeviationsHandler(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	at := time.Date(2026, 8, 17, 7, 0, 0, 0, time.UTC)
+	expectSessionMember(mock, "user-1", true)
+	// Another member would not see stretches inside the hiker's privacy zones.
+	mock.ExpectQuery(`FROM route_deviations d JOIN track_sessions ts ON ts.id = d.session_id WHERE d.session_id=\$1 AND \(ts.user_id::text = \$2 OR NOT EXISTS \(SELECT 1 FROM privacy_zones pz WHERE pz.user_id = ts.user_id AND ST_DWithin\(pz.center, d.location, pz.radius_m\)\)\)`).
+		WithArgs("session-1", "user-1").
+		WillReturnRows(pgxmock.NewRows([]string{"id", "session_id", "user_id", "route_id", "started_at", "detected_at", "cleared_at", "distance", "lat", "lng"}).
+			AddRow("dev-1", "session-1", "user-1", "route-1", at, at.Add(time.Minute), nil, 180.0, -1.7, 101.26))
+
+	expectSessionMember(mock, "user-9", false)
+
+	app := fiber.New()
+	RegisterRoutes(app.Group("/tracking"), NewService(mock, nil), func(c *fiber.Ctx) error {
+		c.Locals("user_id", c.Get("X-User", "user-1"))
+		return c.Next()
+	})
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/tracking/sessions/session-1/deviations", nil))
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("deviations status: %v %v", resp.StatusCode, err)
+	}
+	var deviations []RouteDeviation
+	if err := json.NewDecoder(resp.Body).Decode(&deviations); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(deviations) != 1 || deviations[0].ID != "dev-1" || deviations[0].ClearedAt != nil {
+		t.Fatalf("unexpected deviations %+v", deviations)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/tracking/sessions/session-1/deviations", nil)
+	req.Header.Set("X-User", "user-9")
+	resp, err = app.Test(req)
+	if err != nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403 for an outsider, got %v %v", resp.StatusCode, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
+
+func TestCheckRouteBackOnRouteWithoutOpenDeviation(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	t0 := time.Date(2026, 8, 17, 7, 0, 0, 0, time.UTC)
+	p := TrackPoint{Lat: -1.70, Lng: 101.26, RecordedAt: t0.Add(10 * time.Second)}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT off_route_streak, off_route_since, route_checked_at FROM track_sessions`).
+		WithArgs("session-1").
+		WillReturnRows(routeState(3, &t0, &t0))
+	mock.ExpectQuery(`JOIN gpx_routes r`).
+		WithArgs("trip-1", []float64{p.Lat}, []float64{p.Lng}).
+		WillReturnRows(pgxmock.NewRows([]string{"ord", "route_id", "distance"}).AddRow(int64(1), "route-1", 20.0))
+	mock.ExpectQuery(`UPDATE route_deviations SET cleared_at=\$2 WHERE session_id=\$1 AND cleared_at IS NULL`).
+		WithArgs("session-1", p.RecordedAt).
+		WillReturnError(pgx.ErrNoRows)
+	mock.ExpectExec(`UPDATE track_sessions SET off_route_streak=\$2, off_route_since=\$3, route_checked_at=\$4`).
+		WithArgs("session-1", 0, (*time.Time)(nil), p.RecordedAt).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+	tx, err := mock.Begin(context.Background())
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	session := Session{ID: "session-1", TripID: "trip-1", UserID: "user-1", hasRoute: true}
+	events, err := NewService(mock, nil).checkRoute(context.Background(), tx, session, []TrackPoint{p})
+	if err != nil {
+		t.Fatalf("check route: %v", err)
+	}
+	if len(events) != 0 {
+		t.Fatalf("expected no back_on_route without an open deviation, got %+v", events)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
@@ -0,0 +1,335 @@
+package tracking
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"backend-summithub/internal/db"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// partitionLockKey is the Postgres advisory lock held while partitions are
+// created or dropped so replicas do not race on the DDL.
+const partitionLockKey int64 = 0x53485f5041525449
+
+// partitionMonthsAhead is how many months past the current one always have
+// a partition, so live points never fall into the default partition.
+const partitionMonthsAhead = 3
+
+// archiveToleranceM is the Douglas-Peucker tolerance of the geometry kept
+// on a session once its raw points are dropped.
+const archiveToleranceM = 5.0
+
+const partitionPrefix = "track_points_"
+
+// PartitionMaintainer keeps track_points partitioned ahead of time and, with
+// a retention set, archives and drops months older than the retention.
+type PartitionMaintainer struct {
+	svc       *Service
+	retention time.Duration
+	interval  time.Duration
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewPartitionMaintainer returns a maintainer running every interval. A zero
+// retention keeps raw points forever.
+func NewPartitionMaintainer(svc *Service, retention, interval time.Duration) *PartitionMaintainer {
+	return &PartitionMaintainer{svc: svc, retention: retention, interval: interval}
+}
+
+// Start runs maintenance at once and then every interval until Stop is
+// called or ctx ends.
+func (m *PartitionMaintainer) Start(ctx context.Context) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.cancel != nil {
+		return
+	}
+	ctx, m.cancel = context.WithCancel(ctx)
+	done := make(chan struct{})
+	m.done = done
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+		for {
+			m.maintain(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop ends the worker and waits for a running pass to finish.
+func (m *PartitionMaintainer) Stop() {
+	m.mu.Lock()
+	cancel, done := m.cancel, m.done
+	m.cancel, m.done = nil, nil
+	m.mu.Unlock()
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-done
+}
+
+func (m *PartitionMaintainer) maintain(ctx context.Context) {
+	now := time.Now().UTC()
+	if err := m.svc.EnsurePartitions(ctx, now); err != nil && ctx.Err() == nil {
+		log.Printf("track point partitions: %v", err)
+	}
+	if m.retention <= 0 {
+		return
+	}
+	if _, err := m.svc.ApplyRetention(ctx, now.Add(-m.retention)); err != nil && ctx.Err() == nil {
+		log.Printf("track point retention: %v", err)
+	}
+}
+
+// EnsurePartitions creates the monthly partitions from now's month through
+// partitionMonthsAhead, and for every month with points waiting in the
+// default partition, which moves those points into place. The pass is
+// skipped when another replica holds the lock.
+func (s *Service) EnsurePartitions(ctx context.Context, now time.Time) error {
+	return db.WithTx(ctx, s.db, func(tx pgx.Tx) error {
+		var locked bool
+		if err := tx.QueryRow(ctx, `SELECT pg_try_advisory_xact_lock($1)`, partitionLockKey).Scan(&locked); err != nil {
+			return err
+		}
+		if !locked {
+			return nil
+		}
+
+		months := map[time.Time]bool{}
+		current := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		for i := 0; i <= partitionMonthsAhead; i++ {
+			months[current.AddDate(0, i, 0)] = true
+		}
+		rows, err := tx.Query(ctx, `SELECT DISTINCT date_trunc('month', recorded_at) FROM track_points_default`)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var month time.Time
+			if err := rows.Scan(&month); err != nil {
+				rows.Close()
+				return err
+			}
+			months[month.UTC()] = true
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		ordered := make([]time.Time, 0, len(months))
+		for month := range months {
+			ordered = append(ordered, month)
+		}
+		sort.Slice(ordered, func(i, j int) bool { return ordered[i].Before(ordered[j]) })
+		for _, month := range ordered {
+			if _, err := tx.Exec(ctx, `SELECT create_track_point_partition($1)`, month); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ApplyRetention drops monthly partitions that end before cutoff. Every
+// session with points in such a month is archived first: its whole track is
+// simplified onto the session and its remaining raw points are deleted, so
+// a session is never left half raw. A month holding a session that still
+// has points after cutoff is kept until that session ages out. It returns
+// how many sessions were archived.
+func (s *Service) ApplyRetention(ctx context.Context, cutoff time.Time) (int, error) {
+	archived := 0
+	err := db.WithTx(ctx, s.db, func(tx pgx.Tx) error {
+		var locked bool
+		if err := tx.QueryRow(ctx, `SELECT pg_try_advisory_xact_lock($1)`, partitionLockKey).Scan(&locked); err != nil {
+			return err
+		}
+		if !locked {
+			return nil
+		}
+
+		partitions, err := expiredPartitions(ctx, tx, cutoff)
+		if err != nil {
+			return err
+		}
+		for _, name := range partitions {
+			table := pgx.Identifier{name}.Sanitize()
+			sessionIDs, err := queryStrings(ctx, tx, `SELECT DISTINCT session_id FROM `+table+` WHERE session_id IS NOT NULL`)
+			if err != nil {
+				return err
+			}
+			var held bool
+			if err := tx.QueryRow(ctx, `
+				SELECT EXISTS (SELECT 1 FROM track_points WHERE session_id = ANY($1) AND recorded_at >= $2)
+			`, sessionIDs, cutoff).Scan(&held); err != nil {
+				return err
+			}
+			if held {
+				continue
+			}
+			for _, id := range sessionIDs {
+				if err := archiveSession(ctx, tx, id); err != nil {
+					return err
+				}
+				archived++
+			}
+			if _, err := tx.Exec(ctx, `DROP TABLE `+table); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return archived, nil
+}
+
+// expiredPartitions lists the monthly partitions ending at or before cutoff,
+// oldest first.
+func expiredPartitions(ctx context.Context, tx pgx.Tx, cutoff time.Time) ([]string, error) {
+	names, err := queryStrings(ctx, tx, `
+		SELECT c.relname
+		FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		WHERE i.inhparent = 'track_points'::regclass
+	`)
+	if err != nil {
+		return nil, err
+	}
+	var expired []string
+	for _, name := range names {
+		month, ok := partitionMonth(name)
+		if ok && !month.AddDate(0, 1, 0).After(cutoff) {
+			expired = append(expired, name)
+		}
+	}
+	sort.Strings(expired)
+	return expired, nil
+}
+
+// partitionMonth parses the month of a partition named track_points_YYYY_MM.
+func partitionMonth(name string) (time.Time, bool) {
+	suffix, ok := strings.CutPrefix(name, partitionPrefix)
+	if !ok {
+		return time.Time{}, false
+	}
+	month, err := time.Parse("2006_01", suffix)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return month, true
+}
+
+// archiveSession stores the simplified track on the session and deletes its
+// raw points.
+func archiveSession(ctx context.Context, tx pgx.Tx, sessionID string) error {
+	rows, err := tx.Query(ctx, `
+		SELECT `+pointColumns+`
+		FROM track_points WHERE session_id=$1
+		ORDER BY recorded_at, id
+	`, sessionID)
+	if err != nil {
+		return err
+	}
+	points, err := scanPoints(rows)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE track_sessions
+		SET simplified_route = ST_GeomFromText($2, 4326), archived_point_count = $3, points_archived_at = NOW()
+		WHERE id=$1
+	`, sessionID, lineStringZM(simplifyTolerance(points, archiveToleranceM)), len(points)); err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `DELETE FROM track_points WHERE session_id=$1`, sessionID)
+	return err
+}
+
+// lineStringZM writes points as WKT with elevation in Z and the recorded
+// time in Unix seconds in M. Fewer than two points make no line.
+func lineStringZM(points []TrackPoint) *string {
+	if len(points) < 2 {
+		return nil
+	}
+	var b strings.Builder
+	b.WriteString("LINESTRING ZM (")
+	for i, p := range points {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(strconv.FormatFloat(p.Lng, 'f', -1, 64))
+		b.WriteByte(' ')
+		b.WriteString(strconv.FormatFloat(p.Lat, 'f', -1, 64))
+		b.WriteByte(' ')
+		b.WriteString(strconv.FormatFloat(p.ElevationM, 'f', -1, 64))
+		b.WriteByte(' ')
+		b.WriteString(strconv.FormatInt(p.RecordedAt.Unix(), 10))
+	}
+	b.WriteByte(')')
+	wkt := b.String()
+	return &wkt
+}
+
+// archivedPoints reads the simplified track of a session whose raw points
+// were dropped by retention. It is empty for any other session.
+func archivedPoints(ctx context.Context, q db.Querier, sessionID string) ([]TrackPoint, error) {
+	rows, err := q.Query(ctx, `
+		SELECT ST_Y(d.geom), ST_X(d.geom), ST_Z(d.geom), to_timestamp(ST_M(d.geom)) AT TIME ZONE 'UTC'
+		FROM track_sessions ts, ST_DumpPoints(ts.simplified_route) d
+		WHERE ts.id=$1
+		ORDER BY d.path
+	`, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var points []TrackPoint
+	for rows.Next() {
+		p := TrackPoint{SessionID: sessionID}
+		if err := rows.Scan(&p.Lat, &p.Lng, &p.ElevationM, &p.RecordedAt); err != nil {
+			return nil, err
+		}
+		points = append(points, p)
+	}
+	return points, rows.Err()
+}
+
+func queryStrings(ctx context.Context, tx pgx.Tx, query string) ([]string, error) {
+	rows, err := tx.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, rows.Err()
+}
@@ -0,0 +1,192 @@
+package tracking
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pashagolub/pgxmock/v3"
+)
+
+func TestEnsurePartitionsCoversAheadAndDefaultMonths(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	now := time.Date(2026, 11, 20, 8, 0, 0, 0, time.UTC)
+	imported := time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT pg_try_advisory_xact_lock\(\$1\)`).
+		WithArgs(partitionLockKey).
+		WillReturnRows(pgxmock.NewRows([]string{"locked"}).AddRow(true))
+	mock.ExpectQuery(`SELECT DISTINCT date_trunc\('month', recorded_at\) FROM track_points_default`).
+		WillReturnRows(pgxmock.NewRows([]string{"month"}).AddRow(imported))
+	// The old month is created first, then the current one and three ahead,
+	// crossing the year.
+	for _, month := range []time.Time{
+		imported,
+		time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2026, 12, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2027, 2, 1, 0, 0, 0, 0, time.UTC),
+	} {
+		mock.ExpectExec(`SELECT create_track_point_partition\(\$1\)`).
+			WithArgs(month).
+			WillReturnResult(pgxmock.NewResult("SELECT", 1))
+	}
+	mock.ExpectCommit()
+
+	if err := NewService(mock, nil).EnsurePartitions(context.Background(), now); err != nil {
+		t.Fatalf("ensure partitions: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
+
+func TestEnsurePartitionsSkippedWithoutLock(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT pg_try_advisory_xact_lock\(\$1\)`).
+		WithArgs(partitionLockKey).
+		WillReturnRows(pgxmock.NewRows([]string{"locked"}).AddRow(false))
+	mock.ExpectCommit()
+
+	if err := NewService(mock, nil).EnsurePartitions(context.Background(), time.Now()); err != nil {
+		t.Fatalf("ensure partitions: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
+
+func TestApplyRetentionArchivesSessionsAndDropsMonths(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	cutoff := time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC)
+	points := lShape()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT pg_try_advisory_xact_lock\(\$1\)`).
+		WithArgs(partitionLockKey).
+		WillReturnRows(pgxmock.NewRows([]string{"locked"}).AddRow(true))
+	// March ends after the cutoff and the default partition has no month.
+	mock.ExpectQuery(`FROM pg_inherits i JOIN pg_class c`).
+		WillReturnRows(pgxmock.NewRows([]string{"relname"}).
+			AddRow("track_points_2026_03").AddRow("track_points_default").
+			AddRow("track_points_2026_02").AddRow("track_points_2026_01"))
+
+	// January holds a session still recording after the cutoff.
+	mock.ExpectQuery(`SELECT DISTINCT session_id FROM "track_points_2026_01"`).
+		WillReturnRows(pgxmock.NewRows([]string{"session_id"}).AddRow("session-long"))
+	mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM track_points WHERE session_id = ANY\(\$1\) AND recorded_at >= \$2\)`).
+		WithArgs([]string{"session-long"}, cutoff).
+		WillReturnRows(pgxmock.NewRows([]string{"held"}).AddRow(true))
+
+	mock.ExpectQuery(`SELECT DISTINCT session_id FROM "track_points_2026_02"`).
+		WillReturnRows(pgxmock.NewRows([]string{"session_id"}).AddRow("session-1"))
+	mock.ExpectQuery(`SELECT EXISTS`).
+		WithArgs([]string{"session-1"}, cutoff).
+		WillReturnRows(pgxmock.NewRows([]string{"held"}).AddRow(false))
+	mock.ExpectQuery(`FROM track_points WHERE session_id=\$1 ORDER BY recorded_at, id`).
+		WithArgs("session-1").
+		WillReturnRows(pointRows(points))
+	wkt := lineStringZM(simplifyTolerance(points, archiveToleranceM))
+	mock.ExpectExec(`UPDATE track_sessions SET simplified_route = ST_GeomFromText\(\$2, 4326\), archived_point_count = \$3`).
+		WithArgs("session-1", wkt, len(points)).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectExec(`DELETE FROM track_points WHERE session_id=\$1`).
+		WithArgs("session-1").
+		WillReturnResult(pgxmock.NewResult("DELETE", int64(len(points))))
+	mock.ExpectExec(`DROP TABLE "track_points_2026_02"`).
+		WillReturnResult(pgxmock.NewResult("DROP TABLE", 0))
+	mock.ExpectCommit()
+
+	archived, err := NewService(mock, nil).ApplyRetention(context.Background(), cutoff)
+	if err != nil || archived != 1 {
+		t.Fatalf("expected one session archived, got %d %v", archived, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
+
+func TestLineStringZM(t *testing.T) {
+	at := time.Date(2026, 8, 20, 5, 0, 0, 0, time.UTC)
+	wkt := lineStringZM([]TrackPoint{
+		{Lat: -7.94, Lng: 112.95, ElevationM: 2100.5, RecordedAt: at},
+		{Lat: -7.95, Lng: 112.96, ElevationM: 2130, RecordedAt: at.Add(time.Minute)},
+	})
+	want := "LINESTRING ZM (112.95 -7.94 2100.5 1787202000, 112.96 -7.95 2130 1787202060)"
+	if wkt == nil || *wkt != want {
+		t.Fatalf("unexpected wkt %v", wkt)
+	}
+	if lineStringZM([]TrackPoint{{Lat: 1, Lng: 2}}) != nil {
+		t.Fatalf("expected no line from a single point")
+	}
+}
+
+func TestPointsFallBackToArchivedTrack(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	at := time.Date(2025, 6, 1, 4, 0, 0, 0, time.UTC)
+	expectViewer(mock, "session-1", "", "user-1", true)
+	mock.ExpectQuery(`FROM track_points WHERE session_id=\$1 ORDER BY recorded_at`).
+		WithArgs("session-1").
+		WillReturnRows(pgxmock.NewRows(pointCols))
+	mock.ExpectQuery(`FROM track_sessions ts, ST_DumpPoints\(ts.simplified_route\) d WHERE ts.id=\$1 ORDER BY d.path`).
+		WithArgs("session-1").
+		WillReturnRows(pgxmock.NewRows([]string{"lat", "lng", "elev", "recorded_at"}).
+			AddRow(-7.94, 112.95, 2100.0, at).
+			AddRow(-7.95, 112.96, 2130.0, at.Add(time.Hour)))
+
+	points, err := NewService(mock, nil).Points(context.Background(), "session-1", "")
+	if err != nil || len(points) != 2 || points[1].ElevationM != 2130 || points[0].SessionID != "session-1" {
+		t.Fatalf("expected the archived track, got %+v %v", points, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
+
+func TestRecomputeKeepsArchivedTotals(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	mock.ExpectQuery(`FROM track_points WHERE session_id=\$1 ORDER BY recorded_at, id`).
+		WithArgs("session-1").
+		WillReturnRows(pgxmock.NewRows([]string{"lat", "lng", "elev"}))
+	mock.ExpectExec(`UPDATE track_sessions SET total_distance_m = \$2, total_elevation_gain_m = \$3 WHERE id=\$1 AND points_archived_at IS NULL`).
+		WithArgs("session-1", 0.0, 0.0).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+	mock.ExpectQuery(`SELECT COALESCE\(total_distance_m,0\), COALESCE\(total_elevation_gain_m,0\) FROM track_sessions`).
+		WithArgs("session-1").
+		WillReturnRows(pgxmock.NewRows([]string{"distance", "gain"}).AddRow(12400.0, 1650.0))
+
+	distanceM, gainM, err := recomputeTotals(context.Background(), mock, "session-1")
+	if err != nil || distanceM != 12400 || gainM != 1650 {
+		t.Fatalf("expected stored totals, got %v %v %v", distanceM, gainM, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
@@ -0,0 +1,216 @@
+package tracking
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend-summithub/internal/shared/geo"
+)
+
+const (
+	PointsJSON     = "json"
+	PointsPolyline = "polyline"
+	PointsColumns  = "columns"
+)
+
+const (
+	defaultPageSize = 1000
+	maxPageSize     = 10000
+)
+
+var ErrInvalidPointsQuery = errors.New("invalid points query")
+
+// PointsQuery selects and thins the points of a session. With Cursor or
+// Limit set, one page of stored points is read in recorded order; otherwise
+// the whole session is. The page or session is then reduced in turn by
+// time or distance buckets, Douglas-Peucker with ToleranceM, and MaxPoints.
+type PointsQuery struct {
+	Cursor     string
+	Limit      int
+	Interval   time.Duration
+	IntervalM  float64
+	ToleranceM float64
+	MaxPoints  int
+	Format     string
+}
+
+// PointColumns holds points as parallel arrays, which is far smaller than an
+// object per point. RecordedAt is in Unix seconds. Sensor columns are only
+// present when some point carries the reading.
+type PointColumns struct {
+	RecordedAt   []int64   `json:"recorded_at"`
+	Lat          []float64 `json:"lat,omitempty"`
+	Lng          []float64 `json:"lng,omitempty"`
+	ElevationM   []float64 `json:"elevation_m"`
+	SpeedMps     []float64 `json:"speed_mps,omitempty"`
+	HeartRateBpm []int     `json:"heart_rate_bpm,omitempty"`
+}
+
+// PointsResult is one response of the points API. Polyline output carries
+// positions in Polyline and the remaining channels in Columns.
+type PointsResult struct {
+	Format     string        `json:"format"`
+	Count      int           `json:"count"`
+	Points     []TrackPoint  `json:"points,omitempty"`
+	Polyline   string        `json:"polyline,omitempty"`
+	Columns    *PointColumns `json:"columns,omitempty"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
+
+// QueryPoints reads and thins the session's points viewerID may see as q
+// describes. Hidden points are dropped after paging, so a page can hold
+// fewer than Limit points and still have a next cursor.
+func (s *Service) QueryPoints(ctx context.Context, sessionID, viewerID string, q PointsQuery) (PointsResult, error) {
+	if q.Format == "" {
+		q.Format = PointsJSON
+	}
+	if q.Format != PointsJSON && q.Format != PointsPolyline && q.Format != PointsColumns {
+		return PointsResult{}, fmt.Errorf("%w: format must be json, polyline or columns", ErrInvalidPointsQuery)
+	}
+	if q.Limit < 0 || q.Limit > maxPageSize || q.MaxPoints < 0 || q.Interval < 0 || q.IntervalM < 0 || q.ToleranceM < 0 {
+		return PointsResult{}, fmt.Errorf("%w: options must be positive and limit at most %d", ErrInvalidPointsQuery, maxPageSize)
+	}
+
+	result := PointsResult{Format: q.Format}
+	points, next, err := s.readPoints(ctx, sessionID, viewerID, q.Cursor, q.Limit)
+	if err != nil {
+		return PointsResult{}, err
+	}
+	result.NextCursor = next
+
+	if q.Interval > 0 {
+		points = bucketByTime(points, q.Interval)
+	}
+	if q.IntervalM > 0 {
+		points = bucketByDistance(points, q.IntervalM)
+	}
+	if q.ToleranceM > 0 {
+		points = simplifyTolerance(points, q.ToleranceM)
+	}
+	points = simplifyCount(points, q.MaxPoints)
+
+	result.Count = len(points)
+	switch q.Format {
+	case PointsJSON:
+		result.Points = points
+		if result.Points == nil {
+			result.Points = []TrackPoint{}
+		}
+	case PointsColumns:
+		result.Columns = toColumns(points, true)
+	case PointsPolyline:
+		coords := make([][2]float64, len(points))
+		for i, p := range points {
+			coords[i] = [2]float64{p.Lat, p.Lng}
+		}
+		result.Polyline = geo.EncodePolyline(coords)
+		result.Columns = toColumns(points, false)
+	}
+	return result, nil
+}
+
+// pointsPage reads up to limit points after the cursor, ordered by
+// recorded_at and id so pages neither skip nor repeat points that share a
+// timestamp.
+func (s *Service) pointsPage(ctx context.Context, sessionID, cursor string, limit int) ([]TrackPoint, string, error) {
+	if limit == 0 {
+		limit = defaultPageSize
+	}
+	after, afterID := time.Time{}, int64(0)
+	if cursor != "" {
+		var err error
+		if after, afterID, err = decodeCursor(cursor); err != nil {
+			return nil, "", err
+		}
+	}
+
+	rows, err := s.db.Query(ctx, `
+		SELECT `+pointColumns+`
+		FROM track_points
+		WHERE session_id=$1 AND (recorded_at, id) > ($2, $3)
+		ORDER BY recorded_at, id
+		LIMIT $4
+	`, sessionID, after, afterID, limit+1)
+	if err != nil {
+		return nil, "", err
+	}
+	points, err := scanPoints(rows)
+	if err != nil {
+		return nil, "", err
+	}
+	if cursor == "" && len(points) == 0 {
+		// An archived session keeps only its simplified track, which is
+		// returned whole as a single page.
+		points, err = archivedPoints(ctx, s.db, sessionID)
+		return points, "", err
+	}
+
+	next := ""
+	if len(points) > limit {
+		points = points[:limit]
+		last := points[limit-1]
+		next = encodeCursor(last.RecordedAt, last.ID)
+	}
+	return points, next, nil
+}
+
+func encodeCursor(at time.Time, id int64) string {
+	raw := strconv.FormatInt(at.UnixNano(), 10) + ":" + strconv.FormatInt(id, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(cursor string) (time.Time, int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, 0, fmt.Errorf("%w: bad cursor", ErrInvalidPointsQuery)
+	}
+	at, id, ok := strings.Cut(string(raw), ":")
+	nanos, err1 := strconv.ParseInt(at, 10, 64)
+	pointID, err2 := strconv.ParseInt(id, 10, 64)
+	if !ok || err1 != nil || err2 != nil {
+		return time.Time{}, 0, fmt.Errorf("%w: bad cursor", ErrInvalidPointsQuery)
+	}
+	return time.Unix(0, nanos).UTC(), pointID, nil
+}
+
+func toColumns(points []TrackPoint, positions bool) *PointColumns {
+	cols := &PointColumns{
+		RecordedAt: make([]int64, len(points)),
+		ElevationM: make([]float64, len(points)),
+	}
+	if positions {
+		cols.Lat = make([]float64, len(points))
+		cols.Lng = make([]float64, len(points))
+	}
+	var hasSpeed, hasHR bool
+	for _, p := range points {
+		hasSpeed = hasSpeed || p.SpeedMps > 0
+		hasHR = hasHR || p.HeartRateBpm > 0
+	}
+	if hasSpeed {
+		cols.SpeedMps = make([]float64, len(points))
+	}
+	if hasHR {
+		cols.HeartRateBpm = make([]int, len(points))
+	}
+	for i, p := range points {
+		cols.RecordedAt[i] = p.RecordedAt.Unix()
+		cols.ElevationM[i] = math.Round(p.ElevationM*10) / 10
+		if positions {
+			cols.Lat[i], cols.Lng[i] = p.Lat, p.Lng
+		}
+		if hasSpeed {
+			cols.SpeedMps[i] = math.Round(p.SpeedMps*100) / 100
+		}
+		if hasHR {
+			cols.HeartRateBpm[i] = p.HeartRateBpm
+		}
+	}
+	return cols
+}
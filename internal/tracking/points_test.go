@@ -0,0 +1,132 @@
+package tracking
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"backend-summithub/internal/shared/geo"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pashagolub/pgxmock/v3"
+)
+
+var pointCols = []string{"id", "session_id", "lat", "lng", "elevation_m", "recorded_at", "speed_mps", "created_at", "accuracy_m",
+	"heart_rate_bpm", "cadence_rpm", "temperature_c", "pressure_hpa", "battery_pct"}
+
+func pointRows(points []TrackPoint) *pgxmock.Rows {
+	rows := pgxmock.NewRows(pointCols)
+	for _, p := range points {
+		rows.AddRow(p.ID, "session-1", p.Lat, p.Lng, p.ElevationM, p.RecordedAt, p.SpeedMps, p.RecordedAt, 0.0, p.HeartRateBpm, 0, nil, 0.0, nil)
+	}
+	return rows
+}
+
+func getPoints(t *testing.T, app *fiber.App, query string) (int, PointsResult) {
+	t.Helper()
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/tracking/sessions/session-1/points"+query, nil))
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	var result PointsResult
+	if resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+	}
+	return resp.StatusCode, result
+}
+
+func TestPointsCursorPagination(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	points := lShape()
+	app := fiber.New()
+	RegisterRoutes(app.Group("/tracking"), NewService(mock, nil), func(c *fiber.Ctx) error { return c.Next() })
+
+	// The first page asks for one point more than the limit to learn whether
+	// another page follows.
+	expectViewer(mock, "session-1", "", "user-1", true)
+	mock.ExpectQuery(`WHERE session_id=\$1 AND \(recorded_at, id\) > \(\$2, \$3\) ORDER BY recorded_at, id LIMIT \$4`).
+		WithArgs("session-1", time.Time{}, int64(0), 11).
+		WillReturnRows(pointRows(points[:11]))
+	status, first := getPoints(t, app, "?limit=10")
+	if status != http.StatusOK || first.Count != 10 || first.NextCursor == "" || first.Points[9].ID != 10 {
+		t.Fatalf("unexpected first page %d %+v", status, first)
+	}
+
+	last := points[9]
+	expectViewer(mock, "session-1", "", "user-1", true)
+	mock.ExpectQuery(`\(recorded_at, id\) > \(\$2, \$3\)`).
+		WithArgs("session-1", last.RecordedAt, last.ID, 11).
+		WillReturnRows(pointRows(points[10:]))
+	status, second := getPoints(t, app, "?limit=10&cursor="+first.NextCursor)
+	if status != http.StatusOK || second.Count != 6 || second.NextCursor != "" || second.Points[0].ID != 11 {
+		t.Fatalf("unexpected second page %d %+v", status, second)
+	}
+
+	expectViewer(mock, "session-1", "", "user-1", true)
+	if status, _ := getPoints(t, app, "?cursor=not-a-cursor"); status != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a bad cursor, got %d", status)
+	}
+	if status, _ := getPoints(t, app, "?limit=50000"); status != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an oversized page, got %d", status)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
+
+func TestPointsSimplifiedFormats(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	points := lShape()
+	points[0].HeartRateBpm = 120
+	app := fiber.New()
+	RegisterRoutes(app.Group("/tracking"), NewService(mock, nil), func(c *fiber.Ctx) error { return c.Next() })
+
+	expectViewer(mock, "session-1", "", "user-1", true)
+	mock.ExpectQuery(`FROM track_points WHERE session_id=\$1 ORDER BY recorded_at`).WithArgs("session-1").WillReturnRows(pointRows(points))
+	status, result := getPoints(t, app, "?tolerance_m=10&format=polyline")
+	if status != http.StatusOK || result.Count != 3 || result.Points != nil {
+		t.Fatalf("unexpected polyline result %d %+v", status, result)
+	}
+	coords, err := geo.DecodePolyline(result.Polyline)
+	if err != nil || len(coords) != 3 || math.Abs(coords[1][0]-points[10].Lat) > 1e-5 {
+		t.Fatalf("unexpected polyline %q %v %v", result.Polyline, coords, err)
+	}
+	if result.Columns == nil || result.Columns.Lat != nil || len(result.Columns.RecordedAt) != 3 || result.Columns.HeartRateBpm[0] != 120 {
+		t.Fatalf("expected times and sensors next to the polyline, got %+v", result.Columns)
+	}
+
+	expectViewer(mock, "session-1", "", "user-1", true)
+	mock.ExpectQuery(`FROM track_points WHERE session_id=\$1 ORDER BY recorded_at`).WithArgs("session-1").WillReturnRows(pointRows(points))
+	status, result = getPoints(t, app, "?interval=5m&max_points=3&format=columns")
+	if status != http.StatusOK || result.Count != 3 || len(result.Columns.Lat) != 3 || result.Columns.SpeedMps != nil {
+		t.Fatalf("unexpected columns result %d %+v", status, result)
+	}
+	if result.Columns.RecordedAt[0] != points[0].RecordedAt.Unix() || result.Columns.RecordedAt[2] != points[15].RecordedAt.Unix() {
+		t.Fatalf("expected endpoints kept, got %v", result.Columns.RecordedAt)
+	}
+
+	if status, _ := getPoints(t, app, "?format=xml"); status != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unknown format, got %d", status)
+	}
+	if status, _ := getPoints(t, app, "?interval=often"); status != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a bad interval, got %d", status)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
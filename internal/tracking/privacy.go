@@ -0,0 +1,94 @@
+package tracking
+
+import (
+	"context"
+	"log"
+
+	"backend-summithub/internal/privacy"
+)
+
+// SetPrivacy hides positions inside each hiker's privacy zones from
+// everyone but the hiker, on point reads and broadcasts, which are masked
+// after loading. Without it those hide nothing. Queries that read other
+// positions, such as geofence crossings, deviations and the trip snapshot,
+// run through privacy.QueryPositions and need no setup.
+//
+// SOS alerts are never hidden: a hiker in trouble at home still needs
+// their trip to know where they are.
+func (s *Service) SetPrivacy(p *privacy.Service) {
+	s.privacy = p
+}
+
+// readPoints is how every read of a session's stored points for a viewer
+// goes: it returns ErrSessionNotFound when the session's visibility keeps
+// viewerID from it and drops the points viewerID may not see. With a cursor
+// or limit it reads that page, otherwise every point.
+func (s *Service) readPoints(ctx context.Context, sessionID, viewerID, cursor string, limit int) ([]TrackPoint, string, error) {
+	ownerID, err := checkViewer(ctx, s.db, sessionID, viewerID)
+	if err != nil {
+		return nil, "", err
+	}
+	var mask privacy.Mask
+	if s.privacy != nil {
+		if mask, err = s.privacy.Mask(ctx, ownerID, viewerID); err != nil {
+			return nil, "", err
+		}
+	}
+	var points []TrackPoint
+	var next string
+	if cursor != "" || limit > 0 {
+		points, next, err = s.pointsPage(ctx, sessionID, cursor, limit)
+	} else {
+		points, err = s.storedPoints(ctx, sessionID)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return visiblePoints(mask, points), next, nil
+}
+
+// visiblePoints drops the points mask hides.
+func visiblePoints(mask privacy.Mask, points []TrackPoint) []TrackPoint {
+	if mask.Empty() {
+		return points
+	}
+	visible := make([]TrackPoint, 0, len(points))
+	for _, p := range points {
+		if !mask.Hides(p.Lat, p.Lng) {
+			visible = append(visible, p)
+		}
+	}
+	return visible
+}
+
+// withLiveMask sets what anonymous subscribers may not see on the session
+// before its broadcasts. Zones that cannot be loaded hide every position:
+// a live position sent too widely cannot be taken back.
+func (s *Service) withLiveMask(ctx context.Context, session Session) Session {
+	if s.privacy == nil || s.hub == nil {
+		return session
+	}
+	mask, err := s.privacy.Mask(ctx, session.UserID, "")
+	if err != nil {
+		log.Printf("privacy zones for session %s: %v", session.ID, err)
+		session.hidden = func(float64, float64) bool { return true }
+		return session
+	}
+	if !mask.Empty() {
+		session.hidden = mask.Hides
+	}
+	return session
+}
+
+// broadcastAt sends payload on channel, or only to the session's owner when
+// lat, lng lies in one of their privacy zones.
+func (s *Service) broadcastAt(session Session, channel string, lat, lng float64, payload []byte, urgent bool) {
+	switch {
+	case session.hidden != nil && session.hidden(lat, lng):
+		s.hub.BroadcastPrivate(channel, session.UserID, payload)
+	case urgent:
+		s.hub.BroadcastUrgent(channel, payload)
+	default:
+		s.hub.Broadcast(channel, payload)
+	}
+}
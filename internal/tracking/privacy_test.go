@@ -0,0 +1,192 @@
+package tracking
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"backend-summithub/internal/privacy"
+	"backend-summithub/internal/stream"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pashagolub/pgxmock/v3"
+)
+
+var zoneCols = []string{"id", "user_id", "name", "lat", "lng", "radius_m", "created_at"}
+
+// expectHomeZone expects user-1's zones to be loaded: a 500 m circle around
+// the first point of privateTrack.
+func expectHomeZone(mock pgxmock.PgxPoolIface) {
+	mock.ExpectQuery(`FROM privacy_zones WHERE user_id::text=\$1`).
+		WithArgs("user-1").
+		WillReturnRows(pgxmock.NewRows(zoneCols).AddRow("zone-1", "user-1", "home", -7.94, 112.95, 500.0, time.Now()))
+}
+
+var privateTrack = []TrackPoint{
+	{ID: 1, Lat: -7.9405, Lng: 112.9505, RecordedAt: time.Date(2026, 9, 1, 5, 0, 0, 0, time.UTC)},
+	{ID: 2, Lat: -7.99, Lng: 112.99, RecordedAt: time.Date(2026, 9, 1, 6, 0, 0, 0, time.UTC)},
+}
+
+func TestPointsHidePrivacyZonesFromOthers(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+	svc := NewService(mock, nil)
+	svc.SetPrivacy(privacy.NewService(mock))
+
+	expectPoints := func() {
+		mock.ExpectQuery(`FROM track_points WHERE session_id=\$1 ORDER BY recorded_at`).
+			WithArgs("session-1").
+			WillReturnRows(pointRows(privateTrack))
+	}
+
+	expectViewer(mock, "session-1", "user-2", "user-1", true)
+	expectHomeZone(mock)
+	expectPoints()
+	points, err := svc.Points(context.Background(), "session-1", "user-2")
+	if err != nil || len(points) != 1 || points[0].ID != 2 {
+		t.Fatalf("expected the point at home to be hidden, got %+v %v", points, err)
+	}
+
+	// the owner sees everything without their zones being loaded
+	expectViewer(mock, "session-1", "user-1", "user-1", true)
+	expectPoints()
+	points, err = svc.Points(context.Background(), "session-1", "user-1")
+	if err != nil || len(points) != 2 {
+		t.Fatalf("expected the owner to see every point, got %+v %v", points, err)
+	}
+
+	expectViewer(mock, "session-1", "", "user-1", true)
+	expectHomeZone(mock)
+	expectPoints()
+	result, err := svc.QueryPoints(context.Background(), "session-1", "", PointsQuery{Format: PointsJSON})
+	if err != nil || result.Count != 1 || result.Points[0].ID != 2 {
+		t.Fatalf("expected the query to hide the point at home, got %+v %v", result, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
+
+func TestBroadcastsKeepPrivacyZonesToOwner(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+	hub := stream.NewHub(nil)
+	svc := NewService(mock, hub)
+	svc.SetPrivacy(privacy.NewService(mock))
+
+	owner := hub.RegisterViewer("session-1", "user-1")
+	anonymous := hub.Register("session-1")
+	member := hub.RegisterViewer(TripChannel("trip-1"), "user-2")
+
+	expectHomeZone(mock)
+	session := svc.withLiveMask(context.Background(), Session{ID: "session-1", TripID: "trip-1", UserID: "user-1", Status: StatusActive})
+	svc.broadcastPoint(session, privateTrack[0])
+	svc.broadcastRouteEvents(session, []RouteEvent{{Type: EventOffRoute, Deviation: RouteDeviation{Lat: privateTrack[0].Lat, Lng: privateTrack[0].Lng}}})
+	if len(owner.Send) != 2 || len(anonymous.Send) != 0 || len(member.Send) != 0 {
+		t.Fatalf("expected only the owner to hear about home, got %d %d %d", len(owner.Send), len(anonymous.Send), len(member.Send))
+	}
+
+	svc.broadcastPoint(session, privateTrack[1])
+	if len(owner.Send) != 3 || len(anonymous.Send) != 1 || len(member.Send) != 1 {
+		t.Fatalf("expected a point outside the zones to reach everyone, got %d %d %d", len(owner.Send), len(anonymous.Send), len(member.Send))
+	}
+
+	// zones that cannot be loaded hide every position
+	mock.ExpectQuery(`FROM privacy_zones WHERE user_id::text=\$1`).
+		WithArgs("user-1").
+		WillReturnError(errors.New("connection refused"))
+	session = svc.withLiveMask(context.Background(), session)
+	svc.broadcastPoint(session, privateTrack[1])
+	if len(anonymous.Send) != 1 || len(owner.Send) != 4 {
+		t.Fatalf("expected a failed zone lookup to keep the point to the owner, got %d %d", len(anonymous.Send), len(owner.Send))
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
+
+func TestTripSnapshotHidesPrivatePositions(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+	svc := NewService(mock, nil)
+
+	// The last point at home is joined only for its owner, so user-2 gets
+	// the member without a position.
+	mock.ExpectQuery(`FROM track_sessions ts LEFT JOIN users u .*`+regexp.QuoteMeta(`) lp ON (ts.user_id::text = $2 OR NOT EXISTS (SELECT 1 FROM privacy_zones pz WHERE pz.user_id = ts.user_id AND ST_DWithin(pz.center, lp.location, pz.radius_m)))`)).
+		WithArgs("trip-1", "user-2").
+		WillReturnRows(pgxmock.NewRows(snapshotCols).
+			AddRow("session-1", "user-1", "ayu", StatusActive, nil, 0.0, 0.0, 0.0, time.Now(), 0.0, 0.0, nil))
+
+	snapshot, err := svc.TripSnapshot(context.Background(), "trip-1", "user-2")
+	if err != nil || len(snapshot.Members) != 1 || snapshot.Members[0].Point != nil {
+		t.Fatalf("expected the member without their position, got %+v %v", snapshot, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
+
+func TestCrossingAndDeviationReadsHidePrivacyZones(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	svc := NewService(mock, nil)
+	auth := func(c *fiber.Ctx) error {
+		c.Locals("user_id", "user-2")
+		return c.Next()
+	}
+	app := fiber.New()
+	RegisterRoutes(app.Group("/tracking"), svc, auth)
+	RegisterGeofenceRoutes(app.Group("/tracking"), svc, auth, auth)
+
+	// A trip member reading user-1's session gets the rows the database
+	// keeps outside user-1's zones, filtered in the query itself.
+	at := time.Date(2026, 9, 1, 6, 0, 0, 0, time.UTC)
+	expectGeofenceTrip(mock, "camp-1", "trip-1")
+	expectTripMember(mock, "user-2", true)
+	mock.ExpectQuery(`FROM geofence_events e .*`+regexp.QuoteMeta(`AND (ts.user_id::text = $3 OR NOT EXISTS (SELECT 1 FROM privacy_zones pz WHERE pz.user_id = ts.user_id AND ST_DWithin(pz.center, e.location, pz.radius_m)))`)).
+		WithArgs("", "camp-1", "user-2").
+		WillReturnRows(pgxmock.NewRows([]string{"id", "type", "session_id", "user_id", "geofence_id", "name", "kind", "lat", "lng", "recorded_at"}).
+			AddRow("ev-2", CrossingExit, "session-1", "user-1", "camp-1", "Pos 4", GeofenceCamp, -7.99, 112.99, at))
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/tracking/geofences/camp-1/events", nil))
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("events status: %v %v", resp.StatusCode, err)
+	}
+	var crossings []GeofenceCrossing
+	if err := json.NewDecoder(resp.Body).Decode(&crossings); err != nil || len(crossings) != 1 || crossings[0].ID != "ev-2" {
+		t.Fatalf("unexpected crossings %+v %v", crossings, err)
+	}
+
+	expectSessionMember(mock, "user-2", true)
+	mock.ExpectQuery(`FROM route_deviations d .*`+regexp.QuoteMeta(`AND (ts.user_id::text = $2 OR NOT EXISTS (SELECT 1 FROM privacy_zones pz WHERE pz.user_id = ts.user_id AND ST_DWithin(pz.center, d.location, pz.radius_m)))`)).
+		WithArgs("session-1", "user-2").
+		WillReturnRows(pgxmock.NewRows([]string{"id", "session_id", "user_id", "route_id", "started_at", "detected_at", "cleared_at", "distance", "lat", "lng"}))
+	resp, err = app.Test(httptest.NewRequest(http.MethodGet, "/tracking/sessions/session-1/deviations", nil))
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("deviations status: %v %v", resp.StatusCode, err)
+	}
+	var deviations []RouteDeviation
+	if err := json.NewDecoder(resp.Body).Decode(&deviations); err != nil || len(deviations) != 0 {
+		t.Fatalf("expected the stretch at home to be left out, got %+v %v", deviations, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
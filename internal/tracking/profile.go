@@ -0,0 +1,230 @@
+package tracking
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"backend-summithub/internal/shared/geo"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Recording modes of a session's tracking profile. ProfileAuto is not a mode
+// of its own: setting it hands the choice back to the server.
+const (
+	ProfileNormal        = "normal"
+	ProfileLowPower      = "low_power"
+	ProfileHighFrequency = "high_frequency"
+	ProfileAuto          = "auto"
+)
+
+// Location accuracy the device should request from its GPS.
+const (
+	AccuracyHigh     = "high"
+	AccuracyBalanced = "balanced"
+	AccuracyLow      = "low"
+)
+
+// Why a profile changed, sent with each tracking_profile event.
+const (
+	ProfileReasonStationary  = "stationary"
+	ProfileReasonMoving      = "moving"
+	ProfileReasonOffRoute    = "off_route"
+	ProfileReasonBackOnRoute = "back_on_route"
+	ProfileReasonManual      = "manual"
+)
+
+const EventTrackingProfile = "tracking_profile"
+
+var ErrInvalidTrackingMode = errors.New("mode must be normal, low_power, high_frequency or auto")
+
+// TrackingProfile tells the hiker's device how to record: a point every
+// IntervalSec, or sooner once it has moved DistanceFilterM, at Accuracy.
+// While Auto is set the server switches Mode as points arrive.
+type TrackingProfile struct {
+	Mode            string  `json:"mode"`
+	IntervalSec     int     `json:"interval_sec"`
+	DistanceFilterM float64 `json:"distance_filter_m"`
+	Accuracy        string  `json:"accuracy"`
+	Auto            bool    `json:"auto"`
+	Reason          string  `json:"reason,omitempty"`
+}
+
+// ProfileEvent is broadcast on the session's channel when its profile
+// changes, for the recording device to apply.
+type ProfileEvent struct {
+	Type      string          `json:"type"`
+	SessionID string          `json:"session_id"`
+	Profile   TrackingProfile `json:"profile"`
+}
+
+// trackingModes are the recording settings of each mode. Low power keeps a
+// stationary phone alive through a night at camp; high frequency gives
+// searchers a dense track while the hiker is off route.
+var trackingModes = map[string]TrackingProfile{
+	ProfileNormal:        {Mode: ProfileNormal, IntervalSec: 15, DistanceFilterM: 10, Accuracy: AccuracyBalanced},
+	ProfileLowPower:      {Mode: ProfileLowPower, IntervalSec: 300, DistanceFilterM: 50, Accuracy: AccuracyLow},
+	ProfileHighFrequency: {Mode: ProfileHighFrequency, IntervalSec: 3, DistanceFilterM: 5, Accuracy: AccuracyHigh},
+}
+
+func newProfile(mode string, auto bool, reason string) TrackingProfile {
+	p := trackingModes[mode]
+	if p.Mode == "" {
+		p = trackingModes[ProfileNormal]
+	}
+	p.Auto, p.Reason = auto, reason
+	return p
+}
+
+// ProfileConfig sets when a hiker counts as stationary: every point of the
+// last StationaryWindow within StationaryRadiusM of the latest one. A zero
+// window never switches to low power.
+type ProfileConfig struct {
+	StationaryWindow  time.Duration
+	StationaryRadiusM float64
+}
+
+var DefaultProfileConfig = ProfileConfig{StationaryWindow: 20 * time.Minute, StationaryRadiusM: 50}
+
+// SetProfileConfig replaces the stationary thresholds.
+func (s *Service) SetProfileConfig(cfg ProfileConfig) {
+	s.profile = cfg
+}
+
+// adaptProfile picks the session's recording mode after new points: high
+// frequency from an off-route event until the hiker is back on the route,
+// otherwise low power while stationary and normal when moving. It returns
+// the new profile to broadcast once the transaction commits, or nil when
+// the mode stays or the hiker has pinned one.
+func (s *Service) adaptProfile(ctx context.Context, tx pgx.Tx, session Session, routeEvents []RouteEvent) (*TrackingProfile, error) {
+	if !session.trackingAuto {
+		return nil, nil
+	}
+	lastRoute := ""
+	if len(routeEvents) > 0 {
+		lastRoute = routeEvents[len(routeEvents)-1].Type
+	}
+
+	mode, reason := ProfileHighFrequency, ProfileReasonOffRoute
+	if lastRoute != EventOffRoute {
+		if session.trackingMode == ProfileHighFrequency && lastRoute != EventBackOnRoute {
+			return nil, nil
+		}
+		stationary, err := s.stationary(ctx, tx, session.ID)
+		if err != nil {
+			return nil, err
+		}
+		mode, reason = ProfileNormal, ProfileReasonMoving
+		if stationary {
+			mode, reason = ProfileLowPower, ProfileReasonStationary
+		} else if lastRoute == EventBackOnRoute {
+			reason = ProfileReasonBackOnRoute
+		}
+	}
+	if mode == session.trackingMode {
+		return nil, nil
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE track_sessions SET tracking_mode=$2 WHERE id=$1`, session.ID, mode); err != nil {
+		return nil, err
+	}
+	profile := newProfile(mode, true, reason)
+	return &profile, nil
+}
+
+// stationary reports whether the session's points since the last one at or
+// before the stationary window all lie within the radius of the latest.
+// Without a point that old the hiker has not been still long enough.
+func (s *Service) stationary(ctx context.Context, tx pgx.Tx, sessionID string) (bool, error) {
+	if s.profile.StationaryWindow <= 0 {
+		return false, nil
+	}
+	rows, err := tx.Query(ctx, `
+		SELECT ST_Y(location::geometry), ST_X(location::geometry)
+		FROM track_points
+		WHERE session_id=$1 AND recorded_at >= (
+		    SELECT MAX(recorded_at) FROM track_points
+		    WHERE session_id=$1
+		      AND recorded_at <= (SELECT MAX(recorded_at) FROM track_points WHERE session_id=$1) - make_interval(secs => $2)
+		)
+		ORDER BY recorded_at DESC, id DESC
+	`, sessionID, s.profile.StationaryWindow.Seconds())
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	var latest [2]float64
+	n := 0
+	for rows.Next() {
+		var lat, lng float64
+		if err := rows.Scan(&lat, &lng); err != nil {
+			return false, err
+		}
+		if n == 0 {
+			latest = [2]float64{lat, lng}
+		} else if geo.HaversineKm(latest[0], latest[1], lat, lng)*1000 > s.profile.StationaryRadiusM {
+			return false, nil
+		}
+		n++
+	}
+	return n >= 2, rows.Err()
+}
+
+// TrackingProfile returns the recording profile of one of the user's
+// sessions.
+func (s *Service) TrackingProfile(ctx context.Context, sessionID, userID string) (TrackingProfile, error) {
+	var mode string
+	var auto bool
+	err := s.db.QueryRow(ctx, `
+		SELECT tracking_mode, tracking_auto FROM track_sessions WHERE id=$1 AND user_id::text=$2
+	`, sessionID, userID).Scan(&mode, &auto)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return TrackingProfile{}, ErrSessionNotFound
+	}
+	if err != nil {
+		return TrackingProfile{}, err
+	}
+	return newProfile(mode, auto, ""), nil
+}
+
+// SetTrackingMode pins one of the user's open sessions to mode, or with
+// ProfileAuto lets the server choose again, starting from high frequency
+// when the hiker is still off route. The new profile is pushed to the
+// session's stream.
+func (s *Service) SetTrackingMode(ctx context.Context, sessionID, userID, mode string) (TrackingProfile, error) {
+	if _, ok := trackingModes[mode]; !ok && mode != ProfileAuto {
+		return TrackingProfile{}, ErrInvalidTrackingMode
+	}
+	var auto bool
+	err := s.db.QueryRow(ctx, `
+		UPDATE track_sessions
+		SET tracking_auto = ($3 = 'auto'),
+		    tracking_mode = CASE
+		        WHEN $3 <> 'auto' THEN $3
+		        WHEN $4 > 0 AND off_route_streak >= $4 THEN 'high_frequency'
+		        ELSE 'normal'
+		    END
+		WHERE id=$1 AND user_id::text=$2 AND status IN ('active', 'paused')
+		RETURNING tracking_mode, tracking_auto
+	`, sessionID, userID, mode, s.offRoute.Points).Scan(&mode, &auto)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return TrackingProfile{}, ErrSessionNotFound
+	}
+	if err != nil {
+		return TrackingProfile{}, err
+	}
+	profile := newProfile(mode, auto, ProfileReasonManual)
+	s.broadcastProfile(sessionID, profile)
+	return profile, nil
+}
+
+func (s *Service) broadcastProfile(sessionID string, profile TrackingProfile) {
+	if s.hub == nil {
+		return
+	}
+	payload, _ := json.Marshal(ProfileEvent{Type: EventTrackingProfile, SessionID: sessionID, Profile: profile})
+	s.hub.Broadcast(sessionID, payload)
+}
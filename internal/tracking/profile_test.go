@@ -0,0 +1,312 @@
+package tracking
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"backend-summithub/internal/stream"
+
+	"github.com/gofiber/fiber/v2"
+	gws "github.com/gorilla/websocket"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v3"
+)
+
+// campRows are recent points of a session, latest first, each offset the
+// given metres north of a tent.
+func campRows(offsetsM ...float64) *pgxmock.Rows {
+	rows := pgxmock.NewRows([]string{"lat", "lng"})
+	for _, m := range offsetsM {
+		rows.AddRow(-7.5+m/111320, 110.44)
+	}
+	return rows
+}
+
+func expectStationary(mock pgxmock.PgxPoolIface, rows *pgxmock.Rows) {
+	mock.ExpectQuery(`FROM track_points WHERE session_id=\$1 AND recorded_at >= \(\s*SELECT MAX\(recorded_at\)`).
+		WithArgs("session-1", DefaultProfileConfig.StationaryWindow.Seconds()).
+		WillReturnRows(rows)
+}
+
+func TestAdaptProfile(t *testing.T) {
+	offRoute := []RouteEvent{{Type: EventOffRoute}}
+	backOnRoute := []RouteEvent{{Type: EventOffRoute}, {Type: EventBackOnRoute}}
+	tests := []struct {
+		name       string
+		mode       string
+		auto       bool
+		events     []RouteEvent
+		stationary *pgxmock.Rows
+		want       string
+		reason     string
+	}{
+		{name: "pinned", mode: ProfileNormal, events: offRoute},
+		{name: "off route", mode: ProfileNormal, auto: true, events: offRoute, want: ProfileHighFrequency, reason: ProfileReasonOffRoute},
+		{name: "still off route", mode: ProfileHighFrequency, auto: true},
+		{name: "at camp", mode: ProfileNormal, auto: true, stationary: campRows(0, 20, 35, 10), want: ProfileLowPower, reason: ProfileReasonStationary},
+		{name: "still at camp", mode: ProfileLowPower, auto: true, stationary: campRows(5, 0)},
+		{name: "leaving camp", mode: ProfileLowPower, auto: true, stationary: campRows(400, 0, 10), want: ProfileNormal, reason: ProfileReasonMoving},
+		{name: "not still for long enough", mode: ProfileNormal, auto: true, stationary: campRows()},
+		{name: "back on route", mode: ProfileHighFrequency, auto: true, events: backOnRoute, stationary: campRows(0, 300), want: ProfileNormal, reason: ProfileReasonBackOnRoute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+			if err != nil {
+				t.Fatalf("mock pool: %v", err)
+			}
+			defer mock.Close()
+
+			mock.ExpectBegin()
+			if tt.stationary != nil {
+				expectStationary(mock, tt.stationary)
+			}
+			if tt.want != "" {
+				mock.ExpectExec(`UPDATE track_sessions SET tracking_mode=\$2 WHERE id=\$1`).
+					WithArgs("session-1", tt.want).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+			}
+			tx, err := mock.Begin(context.Background())
+			if err != nil {
+				t.Fatalf("begin: %v", err)
+			}
+
+			session := Session{ID: "session-1", trackingMode: tt.mode, trackingAuto: tt.auto}
+			profile, err := NewService(mock, nil).adaptProfile(context.Background(), tx, session, tt.events)
+			if err != nil {
+				t.Fatalf("adapt: %v", err)
+			}
+			switch {
+			case tt.want == "" && profile != nil:
+				t.Fatalf("expected the mode to stay, got %+v", profile)
+			case tt.want != "" && (profile == nil || profile.Mode != tt.want || profile.Reason != tt.reason || !profile.Auto):
+				t.Fatalf("expected %s because %s, got %+v", tt.want, tt.reason, profile)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatalf("expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestAddPointPushesLowPowerAtCamp(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	hub := stream.NewHub(nil)
+	client := hub.Register("session-1")
+	defer hub.Unregister(client)
+
+	at := time.Date(2026, 8, 17, 19, 0, 0, 0, time.UTC)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM track_sessions WHERE id=\$1\s+FOR UPDATE`).
+		WithArgs("session-1").
+		WillReturnRows(pgxmock.NewRows([]string{"id", "trip_id", "user_id", "started_at", "status", "has_route", "has_geofences", "tracking_mode", "tracking_auto"}).
+			AddRow("session-1", "", "user-1", at.Add(-10*time.Hour), StatusActive, false, false, ProfileNormal, true))
+	mock.ExpectQuery(`recorded_at <= \$2`).WithArgs("session-1", at).WillReturnRows(pgxmock.NewRows([]string{"lat", "lng", "elev"}))
+	mock.ExpectQuery(`recorded_at > \$2`).WithArgs("session-1", at).WillReturnRows(pgxmock.NewRows([]string{"lat", "lng", "elev"}))
+	mock.ExpectQuery(`INSERT INTO track_points`).
+		WithArgs("session-1", 110.44, -7.5, 0.0, at, 0.0, "", 0.0, 0, 0, (*float64)(nil), 0.0, (*int)(nil)).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "created_at"}).AddRow(int64(9), time.Now()))
+	expectStationary(mock, campRows(0, 15, 8))
+	mock.ExpectExec(`UPDATE track_sessions SET tracking_mode=\$2`).
+		WithArgs("session-1", ProfileLowPower).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectCommit()
+
+	if _, err := NewService(mock, hub).AddPoint(context.Background(), "session-1", TrackPoint{Lat: -7.5, Lng: 110.44, RecordedAt: at}); err != nil {
+		t.Fatalf("add point: %v", err)
+	}
+
+	<-client.Send // the position
+	var event ProfileEvent
+	select {
+	case msg := <-client.Send:
+		_ = json.Unmarshal(msg, &event)
+	case <-time.After(100 * time.Millisecond):
+		t.Fatalf("expected a tracking_profile event")
+	}
+	if event.Type != EventTrackingProfile || event.Profile.Mode != ProfileLowPower || event.Profile.IntervalSec != 300 || event.Profile.Accuracy != AccuracyLow {
+		t.Fatalf("unexpected event %+v", event)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
+
+func TestTrackingProfileHandlers(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	mock.ExpectQuery(`SELECT tracking_mode, tracking_auto FROM track_sessions WHERE id=\$1 AND user_id::text=\$2`).
+		WithArgs("session-1", "user-1").
+		WillReturnRows(pgxmock.NewRows([]string{"tracking_mode", "tracking_auto"}).AddRow(ProfileLowPower, true))
+	mock.ExpectQuery(`SELECT tracking_mode, tracking_auto FROM track_sessions`).
+		WithArgs("session-2", "user-1").
+		WillReturnError(pgx.ErrNoRows)
+	mock.ExpectQuery(`UPDATE track_sessions SET tracking_auto = \(\$3 = 'auto'\)`).
+		WithArgs("session-1", "user-1", ProfileHighFrequency, DefaultOffRouteConfig.Points).
+		WillReturnRows(pgxmock.NewRows([]string{"tracking_mode", "tracking_auto"}).AddRow(ProfileHighFrequency, false))
+	mock.ExpectQuery(`UPDATE track_sessions SET tracking_auto`).
+		WithArgs("session-1", "user-1", ProfileAuto, DefaultOffRouteConfig.Points).
+		WillReturnRows(pgxmock.NewRows([]string{"tracking_mode", "tracking_auto"}).AddRow(ProfileNormal, true))
+	mock.ExpectQuery(`UPDATE track_sessions SET tracking_auto`).
+		WithArgs("session-ended", "user-1", ProfileNormal, DefaultOffRouteConfig.Points).
+		WillReturnError(pgx.ErrNoRows)
+
+	hub := stream.NewHub(nil)
+	device := hub.Register("session-1")
+	defer hub.Unregister(device)
+
+	app := fiber.New()
+	RegisterRoutes(app.Group("/tracking"), NewService(mock, hub), func(c *fiber.Ctx) error {
+		c.Locals("user_id", "user-1")
+		return c.Next()
+	})
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/tracking/sessions/session-1/profile", nil))
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("get profile: %v %v", resp, err)
+	}
+	var profile TrackingProfile
+	if err := json.NewDecoder(resp.Body).Decode(&profile); err != nil || profile.Mode != ProfileLowPower || !profile.Auto || profile.IntervalSec != 300 {
+		t.Fatalf("unexpected profile %+v %v", profile, err)
+	}
+	resp, _ = app.Test(httptest.NewRequest(http.MethodGet, "/tracking/sessions/session-2/profile", nil))
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected not found, got %d", resp.StatusCode)
+	}
+
+	put := func(sessionID, body string) (int, TrackingProfile) {
+		req := httptest.NewRequest(http.MethodPut, "/tracking/sessions/"+sessionID+"/profile", bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("put profile: %v", err)
+		}
+		var profile TrackingProfile
+		_ = json.NewDecoder(resp.Body).Decode(&profile)
+		return resp.StatusCode, profile
+	}
+	if code, _ := put("session-1", `{"mode":"turbo"}`); code != http.StatusBadRequest {
+		t.Fatalf("expected bad request, got %d", code)
+	}
+	if code, p := put("session-1", `{"mode":"high_frequency"}`); code != http.StatusOK || p.Mode != ProfileHighFrequency || p.Auto || p.Reason != ProfileReasonManual {
+		t.Fatalf("expected a pinned high frequency profile, got %d %+v", code, p)
+	}
+	if code, p := put("session-1", `{"mode":"auto"}`); code != http.StatusOK || p.Mode != ProfileNormal || !p.Auto {
+		t.Fatalf("expected the automatic profile back, got %d %+v", code, p)
+	}
+	if code, _ := put("session-ended", `{"mode":"normal"}`); code != http.StatusNotFound {
+		t.Fatalf("expected not found for an ended session, got %d", code)
+	}
+
+	// each change is pushed to the recording device
+	for _, want := range []string{ProfileHighFrequency, ProfileNormal} {
+		var event ProfileEvent
+		_ = json.Unmarshal(<-device.Send, &event)
+		if event.Type != EventTrackingProfile || event.SessionID != "session-1" || event.Profile.Mode != want {
+			t.Fatalf("expected a %s profile event, got %+v", want, event)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
+
+func TestTripStreamSetsTrackingProfile(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	expectTripMember(mock, "user-1", true)
+	mock.ExpectQuery(`WHERE ts.trip_id=\$1`).
+		WithArgs("trip-1", "user-1").
+		WillReturnRows(pgxmock.NewRows(snapshotCols))
+	mock.ExpectQuery(`UPDATE track_sessions SET tracking_auto`).
+		WithArgs("session-1", "user-1", ProfileLowPower, DefaultOffRouteConfig.Points).
+		WillReturnRows(pgxmock.NewRows([]string{"tracking_mode", "tracking_auto"}).AddRow(ProfileLowPower, false))
+	// Another hiker's session is not found for user-1.
+	mock.ExpectQuery(`UPDATE track_sessions SET tracking_auto`).
+		WithArgs("session-2", "user-1", ProfileHighFrequency, DefaultOffRouteConfig.Points).
+		WillReturnError(pgx.ErrNoRows)
+
+	hub := stream.NewHub(nil)
+	device := hub.Register("session-1")
+	defer hub.Unregister(device)
+	svc := NewService(mock, hub)
+	app := fiber.New()
+	RegisterStreamRoutes(app.Group("/stream"), svc, func(c *fiber.Ctx) error {
+		c.Locals("user_id", "user-1")
+		return c.Next()
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen error: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		_ = app.Listener(ln)
+	}()
+	defer func() { _ = app.Shutdown() }()
+
+	conn, _, err := gws.DefaultDialer.Dial("ws://"+ln.Addr().String()+"/stream/ws/trips/trip-1", nil)
+	if err != nil {
+		t.Fatalf("dial error: %v", err)
+	}
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+
+	var snapshot TripEvent
+	if err := conn.ReadJSON(&snapshot); err != nil {
+		t.Fatalf("read snapshot: %v", err)
+	}
+
+	for _, mode := range []string{"turbo", ProfileLowPower} {
+		if err := conn.WriteJSON(map[string]any{"type": "tracking_profile", "session_id": "session-1", "mode": mode}); err != nil {
+			t.Fatalf("write profile: %v", err)
+		}
+	}
+	var failure TripEvent
+	if err := conn.ReadJSON(&failure); err != nil || failure.Type != EventError || failure.Error != ErrInvalidTrackingMode.Error() {
+		t.Fatalf("expected an invalid mode error, got %+v %v", failure, err)
+	}
+	var event ProfileEvent
+	if err := conn.ReadJSON(&event); err != nil || event.Type != EventTrackingProfile || event.SessionID != "session-1" || event.Profile.Mode != ProfileLowPower || event.Profile.Reason != ProfileReasonManual {
+		t.Fatalf("unexpected profile reply %+v %v", event, err)
+	}
+	select {
+	case msg := <-device.Send:
+		var pushed ProfileEvent
+		if err := json.Unmarshal(msg, &pushed); err != nil || pushed.Profile.Mode != ProfileLowPower {
+			t.Fatalf("unexpected session stream push %s %v", msg, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected the profile on the session stream")
+	}
+
+	if err := conn.WriteJSON(map[string]any{"type": "tracking_profile", "session_id": "session-2", "mode": ProfileHighFrequency}); err != nil {
+		t.Fatalf("write profile: %v", err)
+	}
+	if err := conn.ReadJSON(&failure); err != nil || failure.Type != EventError || failure.Error != ErrSessionNotFound.Error() {
+		t.Fatalf("expected another hiker's session to be refused, got %+v %v", failure, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
@@ -0,0 +1,40 @@
+package tracking
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"backend-summithub/internal/stream"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrSessionNotEnded = errors.New("tracking session has not ended")
+
+// ReplayFrames returns a finished session's points viewerID may see as the
+// payloads live clients received, for replay on the session stream.
+func (s *Service) ReplayFrames(ctx context.Context, sessionID, viewerID string) ([]stream.Frame, error) {
+	var status string
+	err := s.db.QueryRow(ctx, `SELECT status FROM track_sessions WHERE id=$1`, sessionID).Scan(&status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !isEnded(status) {
+		return nil, ErrSessionNotEnded
+	}
+
+	points, err := s.Points(ctx, sessionID, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	frames := make([]stream.Frame, len(points))
+	for i, p := range points {
+		payload, _ := json.Marshal(p)
+		frames[i] = stream.Frame{At: p.RecordedAt, Payload: payload}
+	}
+	return frames, nil
+}
@@ -0,0 +1,56 @@
+package tracking
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v3"
+)
+
+func TestReplayFrames(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	svc := NewService(mock, nil)
+	points := lShape()
+
+	mock.ExpectQuery(`SELECT status FROM track_sessions WHERE id=\$1`).
+		WithArgs("session-missing").
+		WillReturnError(pgx.ErrNoRows)
+	if _, err := svc.ReplayFrames(context.Background(), "session-missing", ""); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+
+	mock.ExpectQuery(`SELECT status FROM track_sessions WHERE id=\$1`).
+		WithArgs("session-1").
+		WillReturnRows(pgxmock.NewRows([]string{"status"}).AddRow(StatusPaused))
+	if _, err := svc.ReplayFrames(context.Background(), "session-1", ""); !errors.Is(err, ErrSessionNotEnded) {
+		t.Fatalf("expected open sessions to be refused, got %v", err)
+	}
+
+	mock.ExpectQuery(`SELECT status FROM track_sessions WHERE id=\$1`).
+		WithArgs("session-1").
+		WillReturnRows(pgxmock.NewRows([]string{"status"}).AddRow(StatusAutoClosed))
+	expectViewer(mock, "session-1", "", "user-1", true)
+	mock.ExpectQuery(`FROM track_points WHERE session_id=\$1 ORDER BY recorded_at`).
+		WithArgs("session-1").
+		WillReturnRows(pointRows(points))
+	frames, err := svc.ReplayFrames(context.Background(), "session-1", "")
+	if err != nil || len(frames) != len(points) {
+		t.Fatalf("expected a frame per point, got %d %v", len(frames), err)
+	}
+	// Frames carry the same payload as the live broadcast of the point.
+	var point TrackPoint
+	if err := json.Unmarshal(frames[3].Payload, &point); err != nil || point.ID != 4 || !frames[3].At.Equal(points[3].RecordedAt) {
+		t.Fatalf("unexpected frame %s %v", frames[3].Payload, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
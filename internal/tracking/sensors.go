@@ -0,0 +1,186 @@
+package tracking
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+var ErrInvalidPoint = errors.New("invalid track point")
+
+const (
+	// LowBatteryPct is the battery level at or below which a member is
+	// flagged on the trip's live map.
+	LowBatteryPct = 20
+	// DefaultMaxHeartRateBpm is used for heart rate zones when the client
+	// does not send the hiker's own maximum.
+	DefaultMaxHeartRateBpm = 190
+	// maxSensorGap is the longest a reading is assumed to hold until the next
+	// one; longer gaps (pauses, signal loss) are not counted in zone time.
+	maxSensorGap = 2 * time.Minute
+)
+
+// heartRateZones are the lower bounds of zones 1 to 5 as fractions of the
+// maximum heart rate.
+var heartRateZones = []float64{0.5, 0.6, 0.7, 0.8, 0.9}
+
+// HeartRateStats summarises a session's heart rate. The average is weighted
+// by how long each reading held.
+type HeartRateStats struct {
+	AvgBpm    float64         `json:"avg_bpm"`
+	MaxBpm    int             `json:"max_bpm"`
+	MinBpm    int             `json:"min_bpm"`
+	ZoneMaxHR int             `json:"zone_max_hr"`
+	Zones     []HeartRateZone `json:"zones"`
+}
+
+// HeartRateZone is the time spent between MinBpm and MaxBpm; the top zone
+// has no upper bound.
+type HeartRateZone struct {
+	Zone   int   `json:"zone"`
+	MinBpm int   `json:"min_bpm"`
+	MaxBpm int   `json:"max_bpm,omitempty"`
+	Sec    int64 `json:"sec"`
+}
+
+// SensorSummary holds the figures from optional sensor channels. Each part
+// is omitted when no point carried the reading.
+type SensorSummary struct {
+	HeartRate       *HeartRateStats `json:"heart_rate,omitempty"`
+	AvgCadenceRpm   float64         `json:"avg_cadence_rpm,omitempty"`
+	MaxCadenceRpm   int             `json:"max_cadence_rpm,omitempty"`
+	MinTemperatureC *float64        `json:"min_temperature_c,omitempty"`
+	MaxTemperatureC *float64        `json:"max_temperature_c,omitempty"`
+	MinPressureHPa  float64         `json:"min_pressure_hpa,omitempty"`
+	MaxPressureHPa  float64         `json:"max_pressure_hpa,omitempty"`
+	BatteryStartPct *int            `json:"battery_start_pct,omitempty"`
+	BatteryEndPct   *int            `json:"battery_end_pct,omitempty"`
+}
+
+// validateSensors rejects readings no device produces, which would
+// otherwise skew the summary.
+func validateSensors(p TrackPoint) error {
+	switch {
+	case p.HeartRateBpm < 0 || p.HeartRateBpm > 250:
+		return fmt.Errorf("%w: heart_rate_bpm must be between 0 and 250", ErrInvalidPoint)
+	case p.CadenceRpm < 0 || p.CadenceRpm > 300:
+		return fmt.Errorf("%w: cadence_rpm must be between 0 and 300", ErrInvalidPoint)
+	case p.TemperatureC != nil && (*p.TemperatureC < -80 || *p.TemperatureC > 70):
+		return fmt.Errorf("%w: temperature_c must be between -80 and 70", ErrInvalidPoint)
+	case p.PressureHPa != 0 && (p.PressureHPa < 100 || p.PressureHPa > 1100):
+		return fmt.Errorf("%w: pressure_hpa must be between 100 and 1100", ErrInvalidPoint)
+	case p.BatteryPct != nil && (*p.BatteryPct < 0 || *p.BatteryPct > 100):
+		return fmt.Errorf("%w: battery_pct must be between 0 and 100", ErrInvalidPoint)
+	}
+	return nil
+}
+
+// lowBattery reports whether the point's device battery is running out.
+func lowBattery(p *TrackPoint) bool {
+	return p != nil && p.BatteryPct != nil && *p.BatteryPct <= LowBatteryPct
+}
+
+// summariseSensors reads the sensor channels of the raw points, in recorded
+// order. maxHR sets the zone boundaries; zero uses DefaultMaxHeartRateBpm.
+func summariseSensors(points []TrackPoint, maxHR int) SensorSummary {
+	var out SensorSummary
+	var cadenceSum, cadenceCount int
+	for _, p := range points {
+		if p.CadenceRpm > 0 {
+			cadenceSum += p.CadenceRpm
+			cadenceCount++
+			if p.CadenceRpm > out.MaxCadenceRpm {
+				out.MaxCadenceRpm = p.CadenceRpm
+			}
+		}
+		if t := p.TemperatureC; t != nil {
+			if out.MinTemperatureC == nil || *t < *out.MinTemperatureC {
+				out.MinTemperatureC = t
+			}
+			if out.MaxTemperatureC == nil || *t > *out.MaxTemperatureC {
+				out.MaxTemperatureC = t
+			}
+		}
+		if p.PressureHPa > 0 {
+			if out.MinPressureHPa == 0 || p.PressureHPa < out.MinPressureHPa {
+				out.MinPressureHPa = p.PressureHPa
+			}
+			out.MaxPressureHPa = math.Max(out.MaxPressureHPa, p.PressureHPa)
+		}
+		if p.BatteryPct != nil {
+			if out.BatteryStartPct == nil {
+				out.BatteryStartPct = p.BatteryPct
+			}
+			out.BatteryEndPct = p.BatteryPct
+		}
+	}
+	if cadenceCount > 0 {
+		out.AvgCadenceRpm = float64(cadenceSum) / float64(cadenceCount)
+	}
+	out.HeartRate = heartRateStats(points, maxHR)
+	return out
+}
+
+// heartRateStats holds each heart rate reading until the next one, up to
+// maxSensorGap, and adds that time to the reading's zone.
+func heartRateStats(points []TrackPoint, maxHR int) *HeartRateStats {
+	var samples []TrackPoint
+	for _, p := range points {
+		if p.HeartRateBpm > 0 {
+			samples = append(samples, p)
+		}
+	}
+	if len(samples) == 0 {
+		return nil
+	}
+
+	if maxHR <= 0 {
+		maxHR = DefaultMaxHeartRateBpm
+	}
+	stats := &HeartRateStats{ZoneMaxHR: maxHR}
+	for i, lower := range heartRateZones {
+		zone := HeartRateZone{Zone: i + 1, MinBpm: int(math.Round(lower * float64(maxHR)))}
+		if i+1 < len(heartRateZones) {
+			zone.MaxBpm = int(math.Round(heartRateZones[i+1]*float64(maxHR))) - 1
+		}
+		stats.Zones = append(stats.Zones, zone)
+	}
+
+	zoneSec := make([]float64, len(stats.Zones))
+	var weighted, heldSec, sum float64
+	for i, p := range samples {
+		if i == 0 || p.HeartRateBpm > stats.MaxBpm {
+			stats.MaxBpm = p.HeartRateBpm
+		}
+		if i == 0 || p.HeartRateBpm < stats.MinBpm {
+			stats.MinBpm = p.HeartRateBpm
+		}
+		sum += float64(p.HeartRateBpm)
+		if i+1 == len(samples) {
+			break
+		}
+		held := samples[i+1].RecordedAt.Sub(p.RecordedAt)
+		if held <= 0 || held > maxSensorGap {
+			continue
+		}
+		seconds := held.Seconds()
+		weighted += float64(p.HeartRateBpm) * seconds
+		heldSec += seconds
+		for z := len(stats.Zones) - 1; z >= 0; z-- {
+			if p.HeartRateBpm >= stats.Zones[z].MinBpm {
+				zoneSec[z] += seconds
+				break
+			}
+		}
+	}
+	if heldSec > 0 {
+		stats.AvgBpm = weighted / heldSec
+	} else {
+		stats.AvgBpm = sum / float64(len(samples))
+	}
+	for z := range stats.Zones {
+		stats.Zones[z].Sec = int64(math.Round(zoneSec[z]))
+	}
+	return stats
+}
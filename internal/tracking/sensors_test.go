@@ -0,0 +1,236 @@
+package tracking
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"backend-summithub/internal/shared/trackfile"
+	"backend-summithub/internal/stream"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pashagolub/pgxmock/v3"
+)
+
+func TestHeartRateStatsHoldsReadingsAndSkipsGaps(t *testing.T) {
+	start := time.Date(2026, 8, 20, 5, 0, 0, 0, time.UTC)
+	points := []TrackPoint{
+		{RecordedAt: start, HeartRateBpm: 100},
+		{RecordedAt: start.Add(60 * time.Second)},
+		{RecordedAt: start.Add(90 * time.Second), HeartRateBpm: 160},
+		{RecordedAt: start.Add(120 * time.Second), HeartRateBpm: 176},
+		// A ten minute pause is not counted as time at 176 bpm.
+		{RecordedAt: start.Add(12 * time.Minute), HeartRateBpm: 120},
+	}
+
+	stats := heartRateStats(points, 200)
+	if stats == nil || stats.MaxBpm != 176 || stats.MinBpm != 100 || stats.ZoneMaxHR != 200 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	// 90 s at 100 and 30 s at 160.
+	if want := (100.0*90 + 160*30) / 120; math.Abs(stats.AvgBpm-want) > 0.01 {
+		t.Fatalf("expected time-weighted average %.2f, got %.2f", want, stats.AvgBpm)
+	}
+	if len(stats.Zones) != 5 || stats.Zones[0].MinBpm != 100 || stats.Zones[0].MaxBpm != 119 || stats.Zones[4].MaxBpm != 0 {
+		t.Fatalf("unexpected zone bounds %+v", stats.Zones)
+	}
+	if stats.Zones[0].Sec != 90 || stats.Zones[3].Sec != 30 || stats.Zones[4].Sec != 0 {
+		t.Fatalf("unexpected zone times %+v", stats.Zones)
+	}
+
+	if heartRateStats([]TrackPoint{{RecordedAt: start}}, 0) != nil {
+		t.Fatalf("expected no heart rate stats without readings")
+	}
+	if stats := heartRateStats(points[:1], 0); stats.AvgBpm != 100 || stats.ZoneMaxHR != DefaultMaxHeartRateBpm {
+		t.Fatalf("single reading should be its own average, got %+v", stats)
+	}
+}
+
+func TestSummariseSensors(t *testing.T) {
+	freezing, mild := -1.5, 12.0
+	full, low := 96, 18
+	start := time.Now()
+	summary := summariseSensors([]TrackPoint{
+		{RecordedAt: start, CadenceRpm: 50, TemperatureC: &mild, PressureHPa: 700, BatteryPct: &full},
+		{RecordedAt: start.Add(time.Minute), CadenceRpm: 60, TemperatureC: &freezing, PressureHPa: 640},
+		{RecordedAt: start.Add(2 * time.Minute), BatteryPct: &low},
+	}, 0)
+	if summary.AvgCadenceRpm != 55 || summary.MaxCadenceRpm != 60 {
+		t.Fatalf("unexpected cadence %+v", summary)
+	}
+	if *summary.MinTemperatureC != freezing || *summary.MaxTemperatureC != mild {
+		t.Fatalf("unexpected temperature %v %v", *summary.MinTemperatureC, *summary.MaxTemperatureC)
+	}
+	if summary.MinPressureHPa != 640 || summary.MaxPressureHPa != 700 {
+		t.Fatalf("unexpected pressure %+v", summary)
+	}
+	if *summary.BatteryStartPct != 96 || *summary.BatteryEndPct != 18 || summary.HeartRate != nil {
+		t.Fatalf("unexpected battery or heart rate %+v", summary)
+	}
+}
+
+func TestValidateSensors(t *testing.T) {
+	over, hot := 101, 95.0
+	for _, p := range []TrackPoint{
+		{HeartRateBpm: 300},
+		{CadenceRpm: -1},
+		{TemperatureC: &hot},
+		{PressureHPa: 20},
+		{BatteryPct: &over},
+	} {
+		if err := validateSensors(p); !errors.Is(err, ErrInvalidPoint) {
+			t.Fatalf("expected %+v to be rejected, got %v", p, err)
+		}
+	}
+	empty := 0
+	if err := validateSensors(TrackPoint{HeartRateBpm: 150, BatteryPct: &empty, PressureHPa: 650}); err != nil {
+		t.Fatalf("expected valid readings, got %v", err)
+	}
+
+	_, err := NewService(nil, nil).AddPoints(context.Background(), "session-1", []TrackPoint{{RecordedAt: time.Now(), BatteryPct: &over}})
+	if !errors.Is(err, ErrInvalidBatch) {
+		t.Fatalf("expected batch to be rejected, got %v", err)
+	}
+
+	app := fiber.New()
+	RegisterRoutes(app.Group("/tracking"), NewService(nil, nil), func(c *fiber.Ctx) error { return c.Next() })
+	req := httptest.NewRequest(http.MethodPost, "/tracking/sessions/session-1/points", strings.NewReader(`{"lat":-7.9,"lng":112.9,"heart_rate_bpm":400}`))
+	req.Header.Set("Content-Type", "application/json")
+	if resp, err := app.Test(req); err != nil || resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %v %v", resp.StatusCode, err)
+	}
+}
+
+func TestAddPointStoresSensorsAndFlagsLowBattery(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	hub := stream.NewHub(nil)
+	client := hub.Register(TripChannel("trip-1"))
+	defer hub.Unregister(client)
+
+	temperature, battery := 4.5, 12
+	point := TrackPoint{Lat: -7.94, Lng: 112.95, HeartRateBpm: 148, CadenceRpm: 52, TemperatureC: &temperature, PressureHPa: 690.5, BatteryPct: &battery}
+	expectPointLookups(mock, "session-1", nil, nil)
+	mock.ExpectQuery(`INSERT INTO track_points`).
+		WithArgs("session-1", 112.95, -7.94, 0.0, pgxmock.AnyArg(), 0.0, "", 0.0, 148, 52, &temperature, 690.5, &battery).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "created_at"}).AddRow(int64(7), time.Now()))
+	mock.ExpectCommit()
+
+	if _, err := NewService(mock, hub).AddPoint(context.Background(), "session-1", point); err != nil {
+		t.Fatalf("add point: %v", err)
+	}
+
+	select {
+	case msg := <-client.Send:
+		var event TripEvent
+		if err := json.Unmarshal(msg, &event); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if event.Member == nil || !event.Member.LowBattery || *event.Member.Point.BatteryPct != 12 {
+			t.Fatalf("expected low battery flag, got %s", msg)
+		}
+	case <-time.After(100 * time.Millisecond):
+		t.Fatalf("expected trip broadcast")
+	}
+}
+
+func TestSummaryIncludesSensors(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	start := time.Now().Add(-time.Hour)
+	expectViewer(mock, "session-1", "", "user-1", true)
+	mock.ExpectQuery(`SELECT id, started_at, ended_at`).
+		WithArgs("session-1").
+		WillReturnRows(pgxmock.NewRows([]string{"id", "started_at", "ended_at", "dist", "elev", "status", "paused"}).
+			AddRow("session-1", start, nil, 200.0, 0.0, StatusActive, 0.0))
+	mock.ExpectQuery(`heart_rate_bpm.* FROM track_points WHERE session_id=\$1 ORDER BY recorded_at, id`).
+		WithArgs("session-1").
+		WillReturnRows(pgxmock.NewRows(pathCols).
+			AddRow(-7.94, 112.95, 2100.0, start, 5.0, 150, 0, nil, 0.0, nil).
+			AddRow(-7.941, 112.95, 2100.0, start.Add(time.Minute), 5.0, 170, 0, nil, 0.0, nil))
+	expectPauses(mock, "session-1")
+
+	app := fiber.New()
+	RegisterRoutes(app.Group("/tracking"), NewService(mock, nil), func(c *fiber.Ctx) error { return c.Next() })
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/tracking/sessions/session-1/summary?max_hr=200", nil))
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("summary status: %v %v", resp.StatusCode, err)
+	}
+	var summary Summary
+	if err := json.NewDecoder(resp.Body).Decode(&summary); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	hr := summary.Sensors.HeartRate
+	if hr == nil || hr.MaxBpm != 170 || hr.AvgBpm != 150 || hr.ZoneMaxHR != 200 || hr.Zones[2].Sec != 60 {
+		t.Fatalf("unexpected heart rate summary %+v", hr)
+	}
+}
+
+func TestExportHandler(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	recorded := time.Date(2026, 8, 20, 5, 0, 0, 0, time.UTC)
+	temperature, battery := -3.0, 40
+	pointRows := func() *pgxmock.Rows {
+		return pgxmock.NewRows([]string{"id", "session_id", "lat", "lng", "elevation_m", "recorded_at", "speed_mps", "created_at", "accuracy_m", "heart_rate_bpm", "cadence_rpm", "temperature_c", "pressure_hpa", "battery_pct"}).
+			AddRow(int64(1), "session-1", -8.41, 116.46, 3726.0, recorded, 0.9, recorded, 4.0, 138, 50, &temperature, 640.0, &battery).
+			AddRow(int64(2), "session-1", -8.412, 116.461, 3710.0, recorded.Add(time.Minute), 0.0, recorded, 0.0, 0, 0, nil, 0.0, nil)
+	}
+	for range 2 {
+		expectViewer(mock, "session-1", "", "user-1", true)
+		mock.ExpectQuery(`FROM track_points WHERE session_id=\$1`).WithArgs("session-1").WillReturnRows(pointRows())
+	}
+
+	app := fiber.New()
+	RegisterRoutes(app.Group("/tracking"), NewService(mock, nil), func(c *fiber.Ctx) error { return c.Next() })
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/tracking/sessions/session-1/export", nil))
+	if err != nil || resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/gpx+xml" {
+		t.Fatalf("gpx export: %v %v %q", resp.StatusCode, err, resp.Header.Get("Content-Type"))
+	}
+	body, _ := io.ReadAll(resp.Body)
+	track, err := trackfile.Parse(body)
+	if err != nil || len(track.Points) != 2 || track.Points[0].HeartRateBpm != 138 || *track.Points[0].TemperatureC != -3 {
+		t.Fatalf("unexpected exported track %+v %v", track, err)
+	}
+
+	resp, err = app.Test(httptest.NewRequest(http.MethodGet, "/tracking/sessions/session-1/export?format=csv", nil))
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("csv export: %v %v", resp.StatusCode, err)
+	}
+	records, err := csv.NewReader(resp.Body).ReadAll()
+	if err != nil || len(records) != 3 {
+		t.Fatalf("unexpected csv %v %v", records, err)
+	}
+	if got := strings.Join(records[1], ","); got != "2026-08-20T05:00:00Z,-8.41,116.46,3726,0.9,4,138,50,-3,640,40" {
+		t.Fatalf("unexpected first row %s", got)
+	}
+	if got := strings.Join(records[2][4:], ","); got != ",,,,,," {
+		t.Fatalf("expected empty sensor cells, got %s", got)
+	}
+
+	resp, _ = app.Test(httptest.NewRequest(http.MethodGet, "/tracking/sessions/session-1/export?format=kml", nil))
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unknown format, got %d", resp.StatusCode)
+	}
+}
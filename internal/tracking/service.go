@@ -2,109 +2,263 @@ package tracking
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
+	"sync"
 	"time"
 
 	"backend-summithub/internal/db"
-	"backend-summithub/internal/shared/geo"
+	"backend-summithub/internal/notice"
+	"backend-summithub/internal/privacy"
 	"backend-summithub/internal/stream"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 )
 
 type Service struct {
-	db  db.Querier
-	hub *stream.Hub
+	db        db.TxBeginner
+	hub       *stream.Hub
+	notices   *notice.Service
+	filter    FilterConfig
+	offRoute  OffRouteConfig
+	profile   ProfileConfig
+	escalator Escalator
+	privacy   *privacy.Service
+
+	endListeners        []SessionEndListener
+	visibilityListeners []VisibilityListener
+
+	// background tracks work finished after the response, such as SOS
+	// escalation and end listeners.
+	background sync.WaitGroup
+}
+
+func NewService(db db.TxBeginner, hub *stream.Hub) *Service {
+	return &Service{db: db, hub: hub, notices: notice.NewService(db), filter: DefaultFilterConfig, offRoute: DefaultOffRouteConfig, profile: DefaultProfileConfig, escalator: LogEscalator{}}
+}
+
+// Wait blocks until the background work started so far, such as SOS
+// escalation and end listeners, has finished. Call it on shutdown once no
+// new requests or sweeps can start more, before closing the database.
+func (s *Service) Wait() {
+	s.background.Wait()
 }
 
-func NewService(db db.Querier, hub *stream.Hub) *Service {
-	return &Service{db: db, hub: hub}
+// SetFilterConfig replaces the GPS filter used for the filtered summary figures.
+func (s *Service) SetFilterConfig(cfg FilterConfig) {
+	s.filter = cfg
 }
 
+// StartSession opens a session. Sessions always start active; later states
+// are reached only through the lifecycle transitions.
 func (s *Service) StartSession(ctx context.Context, input Session) (Session, error) {
 	input.ID = uuid.NewString()
 	if input.StartedAt.IsZero() {
 		input.StartedAt = time.Now()
 	}
-	if input.Status == "" {
-		input.Status = "active"
+	input.Status = StatusActive
+	if input.Visibility == "" {
+		input.Visibility = VisibilityPublic
+	}
+	if !validVisibility(input.Visibility) {
+		return Session{}, ErrInvalidVisibility
+	}
+
+	notices, err := s.notices.ForTrip(ctx, input.TripID, input.StartedAt)
+	if err != nil {
+		return Session{}, err
+	}
+	if err := notice.Check(notices); err != nil {
+		return Session{}, err
 	}
+	input.Notices = notices
 
 	row := s.db.QueryRow(ctx, `
-		INSERT INTO track_sessions (id, trip_id, user_id, started_at, status)
-		VALUES ($1,$2,$3,$4,$5)
+		INSERT INTO track_sessions (id, trip_id, user_id, started_at, status, visibility)
+		VALUES ($1,$2,$3,$4,$5,$6)
 		RETURNING started_at, status
-	`, input.ID, input.TripID, input.UserID, input.StartedAt, input.Status)
+	`, input.ID, input.TripID, input.UserID, input.StartedAt, input.Status, input.Visibility)
 	if err := row.Scan(&input.StartedAt, &input.Status); err != nil {
 		return Session{}, err
 	}
+	profile := newProfile(ProfileNormal, true, "")
+	input.Profile = &profile
 	return input, nil
 }
 
+// AddPoint stores one point and updates the session totals. Points may
+// arrive out of order after offline sync, so the point is spliced between
+// its true neighbours by recorded_at: the segment between them is replaced
+// by the two segments through the new point. The session row is locked for
+// the duration so concurrent points for the same session apply in turn.
 func (s *Service) AddPoint(ctx context.Context, sessionID string, input TrackPoint) (TrackPoint, error) {
 	if input.RecordedAt.IsZero() {
 		input.RecordedAt = time.Now()
 	}
+	if err := validateSensors(input); err != nil {
+		return TrackPoint{}, err
+	}
 
-	var lastLat, lastLng, lastElevation float64
-	_ = s.db.QueryRow(ctx, `
-		SELECT ST_Y(location::geometry), ST_X(location::geometry), COALESCE(elevation_m, 0)
-		FROM track_points
-		WHERE session_id=$1
-		ORDER BY recorded_at DESC
-		LIMIT 1
-	`, sessionID).Scan(&lastLat, &lastLng, &lastElevation)
+	var session Session
+	var routeEvents []RouteEvent
+	var crossings []GeofenceCrossing
+	var profile *TrackingProfile
+	err := db.WithTx(ctx, s.db, func(tx pgx.Tx) error {
+		var err error
+		session, err = lockSession(ctx, tx, sessionID)
+		if err != nil {
+			return err
+		}
+		if isEnded(session.Status) {
+			return ErrSessionEnded
+		}
 
-	row := s.db.QueryRow(ctx, `
-		INSERT INTO track_points (session_id, location, elevation_m, recorded_at, speed_mps)
-		VALUES ($1, ST_SetSRID(ST_MakePoint($2,$3), 4326)::geography, $4, $5, $6)
-		RETURNING id, created_at
-	`, sessionID, input.Lng, input.Lat, input.ElevationM, input.RecordedAt, input.SpeedMps)
-	if err := row.Scan(&input.ID, &input.CreatedAt); err != nil {
+		prev, err := neighbourPoint(ctx, tx, `
+			SELECT ST_Y(location::geometry), ST_X(location::geometry), COALESCE(elevation_m, 0)
+			FROM track_points
+			WHERE session_id=$1 AND recorded_at <= $2
+			ORDER BY recorded_at DESC, id DESC
+			LIMIT 1
+		`, sessionID, input.RecordedAt)
+		if err != nil {
+			return err
+		}
+		next, err := neighbourPoint(ctx, tx, `
+			SELECT ST_Y(location::geometry), ST_X(location::geometry), COALESCE(elevation_m, 0)
+			FROM track_points
+			WHERE session_id=$1 AND recorded_at > $2
+			ORDER BY recorded_at, id
+			LIMIT 1
+		`, sessionID, input.RecordedAt)
+		if err != nil {
+			return err
+		}
+
+		row := tx.QueryRow(ctx, `
+			INSERT INTO track_points (session_id, location, elevation_m, recorded_at, speed_mps, client_point_id, accuracy_m,
+			                          heart_rate_bpm, cadence_rpm, temperature_c, pressure_hpa, battery_pct)
+			VALUES ($1, ST_SetSRID(ST_MakePoint($2,$3), 4326)::geography, $4, $5, $6, NULLIF($7,''), NULLIF($8,0),
+			        NULLIF($9,0), NULLIF($10,0), $11, NULLIF($12,0), $13)
+			RETURNING id, created_at
+		`, sessionID, input.Lng, input.Lat, input.ElevationM, input.RecordedAt, input.SpeedMps, input.ClientPointID, input.AccuracyM,
+			input.HeartRateBpm, input.CadenceRpm, input.TemperatureC, input.PressureHPa, input.BatteryPct)
+		if err := row.Scan(&input.ID, &input.CreatedAt); err != nil {
+			return err
+		}
+		input.SessionID = sessionID
+
+		if prev != nil || next != nil {
+			deltaM, deltaGain := spliceDelta(prev, input, next)
+			if _, err := tx.Exec(ctx, `
+				UPDATE track_sessions
+				SET total_distance_m = COALESCE(total_distance_m,0) + $2,
+				    total_elevation_gain_m = COALESCE(total_elevation_gain_m,0) + $3
+				WHERE id=$1
+			`, sessionID, deltaM, deltaGain); err != nil {
+				return err
+			}
+		}
+
+		routeEvents, err = s.checkRoute(ctx, tx, session, []TrackPoint{input})
+		if err != nil {
+			return err
+		}
+		crossings, err = s.checkGeofences(ctx, tx, session, []TrackPoint{input})
+		if err != nil {
+			return err
+		}
+		profile, err = s.adaptProfile(ctx, tx, session, routeEvents)
+		return err
+	})
+	if err != nil {
 		return TrackPoint{}, err
 	}
-	input.SessionID = sessionID
 
-	if lastLat != 0 || lastLng != 0 {
-		deltaM := geo.HaversineKm(lastLat, lastLng, input.Lat, input.Lng) * 1000
-		deltaElev := 0.0
-		if input.ElevationM > lastElevation {
-			deltaElev = input.ElevationM - lastElevation
-		}
-		_, _ = s.db.Exec(ctx, `
-			UPDATE track_sessions
-			SET total_distance_m = COALESCE(total_distance_m,0) + $2,
-			    total_elevation_gain_m = COALESCE(total_elevation_gain_m,0) + $3
-			WHERE id=$1
-		`, sessionID, deltaM, deltaElev)
+	session = s.withLiveMask(ctx, session)
+	s.broadcastPoint(session, input)
+	s.broadcastRouteEvents(session, routeEvents)
+	s.broadcastCrossings(session, crossings)
+	if profile != nil {
+		s.broadcastProfile(sessionID, *profile)
 	}
+	return input, nil
+}
 
-	if s.hub != nil {
-		payload, _ := json.Marshal(input)
-		s.hub.Broadcast(sessionID, payload)
+// RecomputeTotals rebuilds a session's distance and elevation gain from its
+// stored points, repairing totals written before points were spliced in order.
+// Only the session's owner may recompute it; other users get
+// ErrSessionNotFound.
+func (s *Service) RecomputeTotals(ctx context.Context, sessionID, userID string) (Session, error) {
+	var session Session
+	err := db.WithTx(ctx, s.db, func(tx pgx.Tx) error {
+		var err error
+		session, err = lockSession(ctx, tx, sessionID)
+		if err != nil {
+			return err
+		}
+		if session.UserID != userID {
+			return ErrSessionNotFound
+		}
+		session.TotalDistanceM, session.TotalElevationGainM, err = recomputeTotals(ctx, tx, sessionID)
+		return err
+	})
+	if err != nil {
+		return Session{}, err
 	}
+	return session, nil
+}
 
-	return input, nil
+func neighbourPoint(ctx context.Context, q db.Querier, query, sessionID string, at time.Time) (*TrackPoint, error) {
+	var p TrackPoint
+	if err := q.QueryRow(ctx, query, sessionID, at).Scan(&p.Lat, &p.Lng, &p.ElevationM); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &p, nil
 }
 
-func (s *Service) Summary(ctx context.Context, sessionID string) (Summary, error) {
+// Summary reports the session's figures so far. Elapsed time runs until the
+// session ended, or until now while it is still open; duration excludes time
+// spent paused. maxHeartRateBpm sets the heart rate zones; zero uses
+// DefaultMaxHeartRateBpm. Sessions viewerID may not see are ErrSessionNotFound.
+func (s *Service) Summary(ctx context.Context, sessionID, viewerID string, maxHeartRateBpm int) (Summary, error) {
+	if _, err := checkViewer(ctx, s.db, sessionID, viewerID); err != nil {
+		return Summary{}, err
+	}
 	var session Session
+	var endedAt *time.Time
+	var pausedSec float64
 	row := s.db.QueryRow(ctx, `
-		SELECT id, started_at, ended_at, COALESCE(total_distance_m,0), COALESCE(total_elevation_gain_m,0)
+		SELECT id, started_at, ended_at, COALESCE(total_distance_m,0), COALESCE(total_elevation_gain_m,0), status,
+		       (SELECT COALESCE(SUM(EXTRACT(EPOCH FROM COALESCE(p.resumed_at, NOW()) - p.paused_at)), 0)::float8
+		        FROM track_session_pauses p WHERE p.session_id = track_sessions.id)
 		FROM track_sessions WHERE id=$1
 	`, sessionID)
-	if err := row.Scan(&session.ID, &session.StartedAt, &session.EndedAt, &session.TotalDistanceM, &session.TotalElevationGainM); err != nil {
+	if err := row.Scan(&session.ID, &session.StartedAt, &endedAt, &session.TotalDistanceM, &session.TotalElevationGainM, &session.Status, &pausedSec); err != nil {
 		return Summary{}, err
 	}
 
-	var pointCount int
-	if err := s.db.QueryRow(ctx, `SELECT COUNT(*) FROM track_points WHERE session_id=$1`, sessionID).Scan(&pointCount); err != nil {
+	path, err := sessionPath(ctx, s.db, sessionID)
+	if err != nil {
+		return Summary{}, err
+	}
+	pauses, err := sessionPauses(ctx, s.db, sessionID)
+	if err != nil {
 		return Summary{}, err
 	}
+	filtered := filterTrack(path, s.filter)
+	stats := computeStats(filtered, pauses)
 
-	duration := time.Since(session.StartedAt)
-	if !session.EndedAt.IsZero() {
-		duration = session.EndedAt.Sub(session.StartedAt)
+	elapsed := time.Since(session.StartedAt)
+	if endedAt != nil && !endedAt.IsZero() {
+		elapsed = endedAt.Sub(session.StartedAt)
+	}
+	paused := time.Duration(pausedSec * float64(time.Second))
+	duration := elapsed - paused
+	if duration < 0 {
+		duration = 0
 	}
 	avgSpeed := 0.0
 	if duration.Seconds() > 0 {
@@ -112,32 +266,122 @@ func (s *Service) Summary(ctx context.Context, sessionID string) (Summary, error
 	}
 
 	return Summary{
-		SessionID:     session.ID,
-		PointCount:    pointCount,
-		DistanceM:     session.TotalDistanceM,
-		DurationSec:   int64(duration.Seconds()),
-		AverageSpeedM: avgSpeed,
+		SessionID:              session.ID,
+		Status:                 session.Status,
+		PointCount:             len(path),
+		RejectedPoints:         filtered.Rejected,
+		DistanceM:              session.TotalDistanceM,
+		ElevationGainM:         session.TotalElevationGainM,
+		FilteredDistanceM:      filtered.DistanceM,
+		FilteredElevationGainM: filtered.ElevationGainM,
+		FilteredElevationLossM: filtered.ElevationLossM,
+		MinElevationM:          stats.MinElevationM,
+		MaxElevationM:          stats.MaxElevationM,
+		ElapsedSec:             int64(elapsed.Seconds()),
+		DurationSec:            int64(duration.Seconds()),
+		PausedSec:              int64(paused.Seconds()),
+		MovingSec:              int64(stats.MovingSec),
+		AverageSpeedM:          avgSpeed,
+		MaxSpeedMps:            stats.MaxSpeedMps,
+		MovingPaceSecPerKm:     stats.MovingPaceSecKm,
+		ClimbRateMPerHour:      stats.ClimbRateMPerH,
+		Splits:                 stats.Splits,
+		Sensors:                summariseSensors(path, maxHeartRateBpm),
 	}, nil
 }
 
-func (s *Service) Points(ctx context.Context, sessionID string) ([]TrackPoint, error) {
+// sessionPauses lists the session's pauses in order; one still open ends now.
+func sessionPauses(ctx context.Context, q db.Querier, sessionID string) ([]pauseInterval, error) {
+	rows, err := q.Query(ctx, `
+		SELECT paused_at, COALESCE(resumed_at, NOW())
+		FROM track_session_pauses WHERE session_id=$1
+		ORDER BY paused_at
+	`, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pauses []pauseInterval
+	for rows.Next() {
+		var p pauseInterval
+		if err := rows.Scan(&p.from, &p.to); err != nil {
+			return nil, err
+		}
+		pauses = append(pauses, p)
+	}
+	return pauses, rows.Err()
+}
+
+// sessionPath loads the points the summary statistics are computed from, in
+// recorded order, with their sensor readings. Archived sessions fall back to
+// their simplified track.
+func sessionPath(ctx context.Context, q db.Querier, sessionID string) ([]TrackPoint, error) {
+	rows, err := q.Query(ctx, `
+		SELECT ST_Y(location::geometry), ST_X(location::geometry), COALESCE(elevation_m,0), recorded_at, COALESCE(accuracy_m,0),
+		       COALESCE(heart_rate_bpm,0), COALESCE(cadence_rpm,0), temperature_c, COALESCE(pressure_hpa,0), battery_pct
+		FROM track_points WHERE session_id=$1
+		ORDER BY recorded_at, id
+	`, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var points []TrackPoint
+	for rows.Next() {
+		var p TrackPoint
+		if err := rows.Scan(&p.Lat, &p.Lng, &p.ElevationM, &p.RecordedAt, &p.AccuracyM,
+			&p.HeartRateBpm, &p.CadenceRpm, &p.TemperatureC, &p.PressureHPa, &p.BatteryPct); err != nil {
+			return nil, err
+		}
+		points = append(points, p)
+	}
+	if err := rows.Err(); err != nil || len(points) > 0 {
+		return points, err
+	}
+	rows.Close()
+	return archivedPoints(ctx, q, sessionID)
+}
+
+// pointColumns are the track_points columns scanPoints reads.
+const pointColumns = `id, session_id, ST_Y(location::geometry), ST_X(location::geometry), COALESCE(elevation_m,0), recorded_at, COALESCE(speed_mps,0), created_at, COALESCE(accuracy_m,0),
+		       COALESCE(heart_rate_bpm,0), COALESCE(cadence_rpm,0), temperature_c, COALESCE(pressure_hpa,0), battery_pct`
+
+// Points returns the session's points viewerID may see in recorded order,
+// or the simplified track once retention has archived the session.
+func (s *Service) Points(ctx context.Context, sessionID, viewerID string) ([]TrackPoint, error) {
+	points, _, err := s.readPoints(ctx, sessionID, viewerID, "", 0)
+	return points, err
+}
+
+// storedPoints returns every stored point of a session, hidden or not.
+func (s *Service) storedPoints(ctx context.Context, sessionID string) ([]TrackPoint, error) {
 	rows, err := s.db.Query(ctx, `
-		SELECT id, session_id, ST_Y(location::geometry), ST_X(location::geometry), COALESCE(elevation_m,0), recorded_at, COALESCE(speed_mps,0), created_at
+		SELECT `+pointColumns+`
 		FROM track_points WHERE session_id=$1
 		ORDER BY recorded_at
 	`, sessionID)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	points, err := scanPoints(rows)
+	if err != nil || len(points) > 0 {
+		return points, err
+	}
+	return archivedPoints(ctx, s.db, sessionID)
+}
 
+func scanPoints(rows pgx.Rows) ([]TrackPoint, error) {
+	defer rows.Close()
 	var points []TrackPoint
 	for rows.Next() {
 		var p TrackPoint
-		if err := rows.Scan(&p.ID, &p.SessionID, &p.Lat, &p.Lng, &p.ElevationM, &p.RecordedAt, &p.SpeedMps, &p.CreatedAt); err != nil {
+		if err := rows.Scan(&p.ID, &p.SessionID, &p.Lat, &p.Lng, &p.ElevationM, &p.RecordedAt, &p.SpeedMps, &p.CreatedAt, &p.AccuracyM,
+			&p.HeartRateBpm, &p.CadenceRpm, &p.TemperatureC, &p.PressureHPa, &p.BatteryPct); err != nil {
 			return nil, err
 		}
 		points = append(points, p)
 	}
-	return points, nil
+	return points, rows.Err()
 }
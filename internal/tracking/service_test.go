@@ -6,8 +6,10 @@ import (
 	"testing"
 	"time"
 
+	"backend-summithub/internal/notice"
 	"backend-summithub/internal/stream"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/pashagolub/pgxmock/v3"
 )
 
@@ -20,22 +22,28 @@ func TestStartSessionAddPointSummary(t *testing.T) {
 
 	svc := NewService(mock, nil)
 
+	mock.ExpectQuery(`FROM trips t JOIN mountains m`).
+		WithArgs("trip-1", pgxmock.AnyArg()).
+		WillReturnRows(pgxmock.NewRows(noticeCols))
+
 	mock.ExpectQuery(`INSERT INTO track_sessions`).
-		WithArgs(pgxmock.AnyArg(), "trip-1", "user-1", pgxmock.AnyArg(), "active").
+		WithArgs(pgxmock.AnyArg(), "trip-1", "user-1", pgxmock.AnyArg(), "active", VisibilityPublic).
 		WillReturnRows(pgxmock.NewRows([]string{"started_at", "status"}).AddRow(time.Now(), "active"))
 
-	session, err := svc.StartSession(context.Background(), Session{TripID: "trip-1", UserID: "user-1"})
+	session, err := svc.StartSession(context.Background(), Session{TripID: "trip-1", UserID: "user-1", Status: StatusEnded})
 	if err != nil {
 		t.Fatalf("start session: %v", err)
 	}
+	if session.Profile == nil || session.Profile.Mode != ProfileNormal || !session.Profile.Auto || session.Profile.IntervalSec == 0 {
+		t.Fatalf("expected the normal automatic profile, got %+v", session.Profile)
+	}
 
-	mock.ExpectQuery(`SELECT ST_Y\(location::geometry\), ST_X\(location::geometry\), COALESCE\(elevation_m, 0\)`).
-		WithArgs(session.ID).
-		WillReturnRows(pgxmock.NewRows([]string{"lat", "lng", "elev"}).AddRow(0, 0, 0))
+	expectPointLookups(mock, session.ID, nil, nil)
 
 	mock.ExpectQuery(`INSERT INTO track_points`).
-		WithArgs(session.ID, 106.8, -6.2, 10.0, pgxmock.AnyArg(), 1.2).
+		WithArgs(session.ID, 106.8, -6.2, 10.0, pgxmock.AnyArg(), 1.2, "", 0.0, 0, 0, (*float64)(nil), 0.0, (*int)(nil)).
 		WillReturnRows(pgxmock.NewRows([]string{"id", "created_at"}).AddRow(int64(1), time.Now()))
+	mock.ExpectCommit()
 
 	point, err := svc.AddPoint(context.Background(), session.ID, TrackPoint{Lat: -6.2, Lng: 106.8, ElevationM: 10, SpeedMps: 1.2})
 	if err != nil {
@@ -45,15 +53,17 @@ func TestStartSessionAddPointSummary(t *testing.T) {
 		t.Fatalf("expected point id")
 	}
 
+	expectViewer(mock, session.ID, "", "user-1", true)
 	mock.ExpectQuery(`SELECT id, started_at, ended_at, COALESCE\(total_distance_m,0\), COALESCE\(total_elevation_gain_m,0\)`).
 		WithArgs(session.ID).
-		WillReturnRows(pgxmock.NewRows([]string{"id", "started_at", "ended_at", "dist", "elev"}).AddRow(session.ID, time.Now().Add(-time.Minute), time.Time{}, 100.0, 10.0))
+		WillReturnRows(pgxmock.NewRows([]string{"id", "started_at", "ended_at", "dist", "elev", "status", "paused"}).AddRow(session.ID, time.Now().Add(-time.Minute), nil, 100.0, 10.0, StatusActive, 0.0))
 
-	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM track_points`).
+	mock.ExpectQuery(`FROM track_points WHERE session_id=\$1 ORDER BY recorded_at, id`).
 		WithArgs(session.ID).
-		WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(1))
+		WillReturnRows(pathRows(1))
+	expectPauses(mock, session.ID)
 
-	summary, err := svc.Summary(context.Background(), session.ID)
+	summary, err := svc.Summary(context.Background(), session.ID, "", 0)
 	if err != nil {
 		t.Fatalf("summary: %v", err)
 	}
@@ -61,13 +71,14 @@ func TestStartSessionAddPointSummary(t *testing.T) {
 		t.Fatalf("unexpected summary")
 	}
 
+	expectViewer(mock, session.ID, "", "user-1", true)
 	mock.ExpectQuery(`SELECT id, session_id, ST_Y\(location::geometry\), ST_X\(location::geometry\), COALESCE\(elevation_m,0\), recorded_at, COALESCE\(speed_mps,0\), created_at`).
 		WithArgs(session.ID).
-		WillReturnRows(pgxmock.NewRows([]string{"id", "session_id", "lat", "lng", "elevation_m", "recorded_at", "speed_mps", "created_at"}).
-			AddRow(int64(1), session.ID, -6.2, 106.8, 10.0, time.Now(), 1.2, time.Now()))
+		WillReturnRows(pgxmock.NewRows([]string{"id", "session_id", "lat", "lng", "elevation_m", "recorded_at", "speed_mps", "created_at", "accuracy_m", "heart_rate_bpm", "cadence_rpm", "temperature_c", "pressure_hpa", "battery_pct"}).
+			AddRow(int64(1), session.ID, -6.2, 106.8, 10.0, time.Now(), 1.2, time.Now(), 8.0, 142, 0, nil, 0.0, nil))
 
-	points, err := svc.Points(context.Background(), session.ID)
-	if err != nil || len(points) != 1 {
+	points, err := svc.Points(context.Background(), session.ID, "")
+	if err != nil || len(points) != 1 || points[0].HeartRateBpm != 142 {
 		t.Fatalf("points: %v", err)
 	}
 
@@ -85,17 +96,16 @@ func TestAddPointUpdatesTotals(t *testing.T) {
 
 	svc := NewService(mock, nil)
 
-	mock.ExpectQuery(`SELECT ST_Y\(location::geometry\), ST_X\(location::geometry\), COALESCE\(elevation_m, 0\)`).
-		WithArgs("session-1").
-		WillReturnRows(pgxmock.NewRows([]string{"lat", "lng", "elev"}).AddRow(-6.2, 106.8, 10.0))
+	expectPointLookups(mock, "session-1", &[3]float64{-6.2, 106.8, 10.0}, nil)
 
 	mock.ExpectQuery(`INSERT INTO track_points`).
-		WithArgs("session-1", 106.9, -6.1, 20.0, pgxmock.AnyArg(), 1.2).
+		WithArgs("session-1", 106.9, -6.1, 20.0, pgxmock.AnyArg(), 1.2, "", 0.0, 0, 0, (*float64)(nil), 0.0, (*int)(nil)).
 		WillReturnRows(pgxmock.NewRows([]string{"id", "created_at"}).AddRow(int64(2), time.Now()))
 
 	mock.ExpectExec(`UPDATE track_sessions`).
 		WithArgs("session-1", pgxmock.AnyArg(), 10.0).
 		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectCommit()
 
 	_, err = svc.AddPoint(context.Background(), "session-1", TrackPoint{Lat: -6.1, Lng: 106.9, ElevationM: 20, SpeedMps: 1.2})
 	if err != nil {
@@ -110,8 +120,12 @@ func TestStartSessionError(t *testing.T) {
 	}
 	defer mock.Close()
 
+	mock.ExpectQuery(`FROM trips t JOIN mountains m`).
+		WithArgs("trip-1", pgxmock.AnyArg()).
+		WillReturnRows(pgxmock.NewRows(noticeCols))
+
 	mock.ExpectQuery(`INSERT INTO track_sessions`).
-		WithArgs(pgxmock.AnyArg(), "trip-1", "user-1", pgxmock.AnyArg(), "active").
+		WithArgs(pgxmock.AnyArg(), "trip-1", "user-1", pgxmock.AnyArg(), "active", VisibilityPublic).
 		WillReturnError(errTrack)
 
 	svc := NewService(mock, nil)
@@ -128,13 +142,12 @@ func TestAddPointInsertError(t *testing.T) {
 	}
 	defer mock.Close()
 
-	mock.ExpectQuery(`SELECT ST_Y\(location::geometry\), ST_X\(location::geometry\), COALESCE\(elevation_m, 0\)`).
-		WithArgs("session-2").
-		WillReturnRows(pgxmock.NewRows([]string{"lat", "lng", "elev"}).AddRow(0, 0, 0))
+	expectPointLookups(mock, "session-2", nil, nil)
 
 	mock.ExpectQuery(`INSERT INTO track_points`).
-		WithArgs("session-2", 106.8, -6.2, 0.0, pgxmock.AnyArg(), 0.0).
+		WithArgs("session-2", 106.8, -6.2, 0.0, pgxmock.AnyArg(), 0.0, "", 0.0, 0, 0, (*float64)(nil), 0.0, (*int)(nil)).
 		WillReturnError(errTrack)
+	mock.ExpectRollback()
 
 	svc := NewService(mock, nil)
 	_, err = svc.AddPoint(context.Background(), "session-2", TrackPoint{Lat: -6.2, Lng: 106.8})
@@ -150,12 +163,13 @@ func TestSummaryQueryError(t *testing.T) {
 	}
 	defer mock.Close()
 
+	expectViewer(mock, "session-3", "", "user-1", true)
 	mock.ExpectQuery(`SELECT id, started_at, ended_at, COALESCE\(total_distance_m,0\), COALESCE\(total_elevation_gain_m,0\)`).
 		WithArgs("session-3").
 		WillReturnError(errTrack)
 
 	svc := NewService(mock, nil)
-	_, err = svc.Summary(context.Background(), "session-3")
+	_, err = svc.Summary(context.Background(), "session-3", "", 0)
 	if err == nil {
 		t.Fatalf("expected error")
 	}
@@ -168,12 +182,13 @@ func TestPointsQueryError(t *testing.T) {
 	}
 	defer mock.Close()
 
+	expectViewer(mock, "session-4", "", "user-1", true)
 	mock.ExpectQuery(`SELECT id, session_id, ST_Y\(location::geometry\), ST_X\(location::geometry\), COALESCE\(elevation_m,0\), recorded_at, COALESCE\(speed_mps,0\), created_at`).
 		WithArgs("session-4").
 		WillReturnError(errTrack)
 
 	svc := NewService(mock, nil)
-	_, err = svc.Points(context.Background(), "session-4")
+	_, err = svc.Points(context.Background(), "session-4", "")
 	if err == nil {
 		t.Fatalf("expected error")
 	}
@@ -186,16 +201,17 @@ func TestSummaryCountError(t *testing.T) {
 	}
 	defer mock.Close()
 
+	expectViewer(mock, "session-5", "", "user-1", true)
 	mock.ExpectQuery(`SELECT id, started_at, ended_at, COALESCE\(total_distance_m,0\), COALESCE\(total_elevation_gain_m,0\)`).
 		WithArgs("session-5").
-		WillReturnRows(pgxmock.NewRows([]string{"id", "started_at", "ended_at", "dist", "elev"}).AddRow("session-5", time.Now(), time.Time{}, 0.0, 0.0))
+		WillReturnRows(pgxmock.NewRows([]string{"id", "started_at", "ended_at", "dist", "elev", "status", "paused"}).AddRow("session-5", time.Now(), nil, 0.0, 0.0, StatusActive, 0.0))
 
-	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM track_points`).
+	mock.ExpectQuery(`FROM track_points WHERE session_id=\$1 ORDER BY recorded_at, id`).
 		WithArgs("session-5").
 		WillReturnError(errTrack)
 
 	svc := NewService(mock, nil)
-	_, err = svc.Summary(context.Background(), "session-5")
+	_, err = svc.Summary(context.Background(), "session-5", "", 0)
 	if err == nil {
 		t.Fatalf("expected error")
 	}
@@ -212,13 +228,12 @@ func TestAddPointBroadcastsToHub(t *testing.T) {
 	client := hub.Register("session-hub")
 	defer hub.Unregister(client)
 
-	mock.ExpectQuery(`SELECT ST_Y\(location::geometry\), ST_X\(location::geometry\), COALESCE\(elevation_m, 0\)`).
-		WithArgs("session-hub").
-		WillReturnRows(pgxmock.NewRows([]string{"lat", "lng", "elev"}).AddRow(0, 0, 0))
+	expectPointLookups(mock, "session-hub", nil, nil)
 
 	mock.ExpectQuery(`INSERT INTO track_points`).
-		WithArgs("session-hub", 106.8, -6.2, 0.0, pgxmock.AnyArg(), 0.0).
+		WithArgs("session-hub", 106.8, -6.2, 0.0, pgxmock.AnyArg(), 0.0, "", 0.0, 0, 0, (*float64)(nil), 0.0, (*int)(nil)).
 		WillReturnRows(pgxmock.NewRows([]string{"id", "created_at"}).AddRow(int64(1), time.Now()))
+	mock.ExpectCommit()
 
 	svc := NewService(mock, hub)
 	_, err = svc.AddPoint(context.Background(), "session-hub", TrackPoint{Lat: -6.2, Lng: 106.8})
@@ -243,16 +258,18 @@ func TestSummaryWithEndedAt(t *testing.T) {
 	started := time.Now().Add(-2 * time.Hour)
 	ended := started.Add(30 * time.Minute)
 
+	expectViewer(mock, "session-ended", "", "user-1", true)
 	mock.ExpectQuery(`SELECT id, started_at, ended_at, COALESCE\(total_distance_m,0\), COALESCE\(total_elevation_gain_m,0\)`).
 		WithArgs("session-ended").
-		WillReturnRows(pgxmock.NewRows([]string{"id", "started_at", "ended_at", "dist", "elev"}).AddRow("session-ended", started, ended, 120.0, 5.0))
+		WillReturnRows(pgxmock.NewRows([]string{"id", "started_at", "ended_at", "dist", "elev", "status", "paused"}).AddRow("session-ended", started, &ended, 120.0, 5.0, StatusEnded, 0.0))
 
-	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM track_points`).
+	mock.ExpectQuery(`FROM track_points WHERE session_id=\$1 ORDER BY recorded_at, id`).
 		WithArgs("session-ended").
-		WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(3))
+		WillReturnRows(pathRows(3))
+	expectPauses(mock, "session-ended")
 
 	svc := NewService(mock, nil)
-	summary, err := svc.Summary(context.Background(), "session-ended")
+	summary, err := svc.Summary(context.Background(), "session-ended", "", 0)
 	if err != nil {
 		t.Fatalf("summary: %v", err)
 	}
@@ -268,15 +285,115 @@ func TestPointsScanError(t *testing.T) {
 	}
 	defer mock.Close()
 
+	expectViewer(mock, "session-scan", "", "user-1", true)
 	mock.ExpectQuery(`SELECT id, session_id, ST_Y\(location::geometry\), ST_X\(location::geometry\), COALESCE\(elevation_m,0\), recorded_at, COALESCE\(speed_mps,0\), created_at`).
 		WithArgs("session-scan").
 		WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(int64(1)))
 
 	svc := NewService(mock, nil)
-	_, err = svc.Points(context.Background(), "session-scan")
+	_, err = svc.Points(context.Background(), "session-scan", "")
 	if err == nil {
 		t.Fatalf("expected error")
 	}
 }
 
 var errTrack = errors.New("track error")
+
+// expectPointLookups expects AddPoint's transaction start: the session lock
+// and the neighbour lookups before and after the new point.
+func expectPointLookups(mock pgxmock.PgxPoolIface, sessionID string, prev, next *[3]float64) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM track_sessions WHERE id=\$1\s+FOR UPDATE`).
+		WithArgs(sessionID).
+		WillReturnRows(lockedSession(sessionID, StatusActive))
+	for _, n := range []struct {
+		query string
+		point *[3]float64
+	}{
+		{`recorded_at <= \$2 ORDER BY recorded_at DESC, id DESC`, prev},
+		{`recorded_at > \$2 ORDER BY recorded_at, id`, next},
+	} {
+		expectation := mock.ExpectQuery(n.query).WithArgs(sessionID, pgxmock.AnyArg())
+		if n.point == nil {
+			expectation.WillReturnError(pgx.ErrNoRows)
+			continue
+		}
+		expectation.WillReturnRows(pgxmock.NewRows([]string{"lat", "lng", "elev"}).AddRow(n.point[0], n.point[1], n.point[2]))
+	}
+}
+
+var noticeCols = []string{"id", "mountain_id", "area", "status", "reason", "starts_at", "ends_at", "created_by", "created_at"}
+
+func TestStartSessionRefusedInClosedArea(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	mock.ExpectQuery(`FROM trips t JOIN mountains m`).
+		WithArgs("trip-semeru", pgxmock.AnyArg()).
+		WillReturnRows(pgxmock.NewRows(noticeCols).
+			AddRow("notice-1", "mountain-1", "", "closed", "eruption", time.Now(), nil, "ranger", time.Now()))
+
+	svc := NewService(mock, nil)
+	_, err = svc.StartSession(context.Background(), Session{TripID: "trip-semeru", UserID: "user-1"})
+	if !errors.Is(err, notice.ErrAreaClosed) {
+		t.Fatalf("expected area closed error, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+// lockedSession is the row lockSession reads for a session in status, with
+// no route, no zones and a pinned recording profile.
+func lockedSession(sessionID, status string) *pgxmock.Rows {
+	return pgxmock.NewRows([]string{"id", "trip_id", "user_id", "started_at", "status", "has_route", "has_geofences", "tracking_mode", "tracking_auto"}).
+		AddRow(sessionID, "trip-1", "user-1", time.Now().Add(-time.Hour), status, false, false, ProfileNormal, false)
+}
+
+// pathCols are the columns sessionPath reads, sensors last.
+var pathCols = []string{"lat", "lng", "elev", "recorded_at", "accuracy", "hr", "cadence", "temperature", "pressure", "battery"}
+
+// pathRows is n points the summary loads, one minute and about 110 m apart.
+func pathRows(n int) *pgxmock.Rows {
+	rows := pgxmock.NewRows(pathCols)
+	start := time.Now().Add(-time.Hour)
+	for i := 0; i < n; i++ {
+		rows.AddRow(-7.94-float64(i)*0.001, 112.95, 2100.0+float64(i)*10, start.Add(time.Duration(i)*time.Minute), 5.0, 0, 0, nil, 0.0, nil)
+	}
+	return rows
+}
+
+// expectPauses answers the summary's pause lookup; pauses alternate from, to.
+func expectPauses(mock pgxmock.PgxPoolIface, sessionID string, pauses ...time.Time) {
+	rows := pgxmock.NewRows([]string{"paused_at", "resumed_at"})
+	for i := 0; i+1 < len(pauses); i += 2 {
+		rows.AddRow(pauses[i], pauses[i+1])
+	}
+	mock.ExpectQuery(`FROM track_session_pauses WHERE session_id=\$1 ORDER BY paused_at`).
+		WithArgs(sessionID).
+		WillReturnRows(rows)
+}
+
+type slowEndListener struct {
+	done bool
+}
+
+func (l *slowEndListener) SessionEnded(context.Context, Session) {
+	time.Sleep(20 * time.Millisecond)
+	l.done = true
+}
+
+func TestWaitBlocksUntilBackgroundWorkFinishes(t *testing.T) {
+	svc := NewService(nil, nil)
+	listener := &slowEndListener{}
+	svc.AddSessionEndListener(listener)
+
+	svc.notifyEnded(Session{ID: "session-1"})
+	svc.Wait()
+	if !listener.done {
+		t.Fatalf("expected Wait to return only after the end listener ran")
+	}
+}
@@ -0,0 +1,125 @@
+package tracking
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// metresPerDegree is the length of one degree of latitude.
+const metresPerDegree = 111320.0
+
+// offsetDistanceM is how far p lies from the segment a-b, measured on a
+// local flat projection around a. Over the few kilometres between kept
+// points of a hiking track the error is negligible.
+func offsetDistanceM(p, a, b TrackPoint) float64 {
+	scale := math.Cos(a.Lat * math.Pi / 180)
+	px, py := (p.Lng-a.Lng)*scale*metresPerDegree, (p.Lat-a.Lat)*metresPerDegree
+	bx, by := (b.Lng-a.Lng)*scale*metresPerDegree, (b.Lat-a.Lat)*metresPerDegree
+	length := bx*bx + by*by
+	if length == 0 {
+		return math.Hypot(px, py)
+	}
+	t := math.Max(0, math.Min(1, (px*bx+py*by)/length))
+	return math.Hypot(px-t*bx, py-t*by)
+}
+
+// significance ranks points for Douglas-Peucker: each interior point gets
+// the offset at which the algorithm would keep it, capped by its parent's so
+// that keeping every point above a threshold gives the same result as
+// running the algorithm with that tolerance. Endpoints are always kept.
+func significance(points []TrackPoint) []float64 {
+	ranks := make([]float64, len(points))
+	if len(points) == 0 {
+		return ranks
+	}
+	ranks[0], ranks[len(points)-1] = math.Inf(1), math.Inf(1)
+
+	type span struct {
+		first, last int
+		cap         float64
+	}
+	stack := []span{{0, len(points) - 1, math.Inf(1)}}
+	for len(stack) > 0 {
+		s := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if s.last-s.first < 2 {
+			continue
+		}
+		split, maxM := -1, -1.0
+		for i := s.first + 1; i < s.last; i++ {
+			if d := offsetDistanceM(points[i], points[s.first], points[s.last]); d > maxM {
+				split, maxM = i, d
+			}
+		}
+		rank := math.Min(maxM, s.cap)
+		ranks[split] = rank
+		stack = append(stack, span{s.first, split, rank}, span{split, s.last, rank})
+	}
+	return ranks
+}
+
+// simplifyTolerance keeps the points Douglas-Peucker keeps with the given
+// tolerance in metres.
+func simplifyTolerance(points []TrackPoint, toleranceM float64) []TrackPoint {
+	ranks := significance(points)
+	kept := make([]TrackPoint, 0, len(points))
+	for i, p := range points {
+		if ranks[i] > toleranceM {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
+
+// simplifyCount keeps the max most significant points, in order.
+func simplifyCount(points []TrackPoint, max int) []TrackPoint {
+	if max <= 0 || len(points) <= max {
+		return points
+	}
+	if max == 1 {
+		return points[:1]
+	}
+	ranks := significance(points)
+	order := make([]int, len(points))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return ranks[order[i]] > ranks[order[j]] })
+	keep := order[:max]
+	sort.Ints(keep)
+
+	kept := make([]TrackPoint, len(keep))
+	for i, idx := range keep {
+		kept[i] = points[idx]
+	}
+	return kept
+}
+
+// bucketByTime keeps the first point of every interval and the last point.
+func bucketByTime(points []TrackPoint, interval time.Duration) []TrackPoint {
+	return bucket(points, func(last, p TrackPoint) bool {
+		return p.RecordedAt.Sub(last.RecordedAt) >= interval
+	})
+}
+
+// bucketByDistance keeps a point each time the track has moved intervalM
+// from the last kept point, and the last point.
+func bucketByDistance(points []TrackPoint, intervalM float64) []TrackPoint {
+	return bucket(points, func(last, p TrackPoint) bool {
+		return segmentDistanceM(last, p) >= intervalM
+	})
+}
+
+func bucket(points []TrackPoint, next func(last, p TrackPoint) bool) []TrackPoint {
+	if len(points) < 3 {
+		return points
+	}
+	kept := []TrackPoint{points[0]}
+	for _, p := range points[1 : len(points)-1] {
+		if next(kept[len(kept)-1], p) {
+			kept = append(kept, p)
+		}
+	}
+	return append(kept, points[len(points)-1])
+}
@@ -0,0 +1,102 @@
+package tracking
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// lShape is a straight 1 km walk north with 2 m of jitter, then 500 m east.
+func lShape() []TrackPoint {
+	start := time.Date(2026, 8, 20, 5, 0, 0, 0, time.UTC)
+	var points []TrackPoint
+	for i := 0; i <= 10; i++ {
+		jitter := 0.0
+		if i%2 == 1 {
+			jitter = 2
+		}
+		points = append(points, TrackPoint{
+			ID:         int64(len(points) + 1),
+			Lat:        -7.94 + metresToLat(float64(i)*100),
+			Lng:        112.95 + metresToLat(jitter),
+			RecordedAt: start.Add(time.Duration(len(points)) * time.Minute),
+		})
+	}
+	for i := 1; i <= 5; i++ {
+		points = append(points, TrackPoint{
+			ID:         int64(len(points) + 1),
+			Lat:        points[10].Lat,
+			Lng:        112.95 + metresToLat(float64(i)*100),
+			RecordedAt: start.Add(time.Duration(len(points)) * time.Minute),
+		})
+	}
+	return points
+}
+
+func TestSimplifyToleranceKeepsCorners(t *testing.T) {
+	points := lShape()
+	kept := simplifyTolerance(points, 10)
+	if len(kept) != 3 || kept[0].ID != 1 || kept[1].ID != 11 || kept[2].ID != 16 {
+		t.Fatalf("expected start, corner and end, got %v", ids(kept))
+	}
+	// Below the jitter the zigzag is kept, but the straight east leg is not.
+	fine := simplifyTolerance(points, 1)
+	if len(fine) < 10 || fine[len(fine)-2].ID != 11 {
+		t.Fatalf("unexpected fine simplification %v", ids(fine))
+	}
+}
+
+func TestSimplifyCountMatchesTolerance(t *testing.T) {
+	points := lShape()
+	if kept := simplifyCount(points, 3); len(kept) != 3 || kept[1].ID != 11 {
+		t.Fatalf("expected corner to be the most significant point, got %v", ids(kept))
+	}
+	if kept := simplifyCount(points, 100); len(kept) != len(points) {
+		t.Fatalf("expected no change under the limit, got %d", len(kept))
+	}
+	kept := simplifyCount(points, 7)
+	if len(kept) != 7 || kept[0].ID != 1 || kept[6].ID != 16 {
+		t.Fatalf("expected endpoints kept, got %v", ids(kept))
+	}
+	for i := 1; i < len(kept); i++ {
+		if !kept[i].RecordedAt.After(kept[i-1].RecordedAt) {
+			t.Fatalf("expected recorded order, got %v", ids(kept))
+		}
+	}
+}
+
+func TestSignificanceIsCappedByParent(t *testing.T) {
+	points := lShape()
+	ranks := significance(points)
+	if !math.IsInf(ranks[0], 1) || !math.IsInf(ranks[len(ranks)-1], 1) {
+		t.Fatalf("endpoints must always be kept")
+	}
+	for i, r := range ranks {
+		if r > ranks[10] && i != 0 && i != len(ranks)-1 && i != 10 {
+			t.Fatalf("point %d ranks above the corner: %v", i, ranks)
+		}
+	}
+}
+
+func TestBucketByTimeAndDistance(t *testing.T) {
+	points := lShape()
+	// Minutes 0, 5 and 10, then the last point at minute 15.
+	if got := ids(bucketByTime(points, 5*time.Minute)); len(got) != 4 || got[1] != 6 || got[2] != 11 || got[3] != 16 {
+		t.Fatalf("unexpected time buckets %v", got)
+	}
+	byDistance := bucketByDistance(points, 250)
+	if got := ids(byDistance); len(got) != 6 || got[1] != 4 || got[2] != 7 || got[5] != 16 {
+		t.Fatalf("unexpected distance buckets %v", got)
+	}
+	if short := bucketByTime(points[:2], time.Hour); len(short) != 2 {
+		t.Fatalf("expected short tracks unchanged")
+	}
+}
+
+func ids(points []TrackPoint) []int64 {
+	out := make([]int64, len(points))
+	for i, p := range points {
+		out[i] = p.ID
+	}
+	return out
+}
@@ -0,0 +1,413 @@
+package tracking
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"backend-summithub/internal/db"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	SOSRaised       = "raised"
+	SOSAcknowledged = "acknowledged"
+	SOSResolved     = "resolved"
+)
+
+const (
+	ActionAcknowledge = "acknowledge"
+	ActionResolve     = "resolve"
+)
+
+const (
+	EventSOS             = "sos"
+	EventSOSAcknowledged = "sos_acknowledged"
+	EventSOSResolved     = "sos_resolved"
+	// PriorityHigh marks events clients should surface above everything else.
+	PriorityHigh = "high"
+)
+
+// Audit trail actions besides the status changes themselves.
+const (
+	sosLogEscalated        = "escalated"
+	sosLogEscalationFailed = "escalation_failed"
+)
+
+var (
+	ErrSOSNotFound    = errors.New("sos alert not found")
+	ErrInvalidBattery = errors.New("battery_pct must be between 0 and 100")
+)
+
+// sosTransitions lists, per action, the alert statuses it may be applied
+// from, the status it leads to and the event broadcast for it.
+var sosTransitions = map[string]struct {
+	from  []string
+	to    string
+	event string
+}{
+	ActionAcknowledge: {from: []string{SOSRaised}, to: SOSAcknowledged, event: EventSOSAcknowledged},
+	ActionResolve:     {from: []string{SOSRaised, SOSAcknowledged}, to: SOSResolved, event: EventSOSResolved},
+}
+
+// SOSAlert is an emergency raised from a tracking session. UserID is the
+// session's hiker; RaisedBy is who pressed the button, which may be a
+// companion on the same trip.
+type SOSAlert struct {
+	ID             string        `json:"id"`
+	SessionID      string        `json:"session_id"`
+	TripID         string        `json:"trip_id,omitempty"`
+	UserID         string        `json:"user_id"`
+	RaisedBy       string        `json:"raised_by"`
+	Status         string        `json:"status"`
+	Lat            float64       `json:"lat"`
+	Lng            float64       `json:"lng"`
+	BatteryPct     *int          `json:"battery_pct,omitempty"`
+	Message        string        `json:"message"`
+	Escalated      bool          `json:"escalated"`
+	CreatedAt      time.Time     `json:"created_at"`
+	AcknowledgedAt *time.Time    `json:"acknowledged_at,omitempty"`
+	AcknowledgedBy string        `json:"acknowledged_by,omitempty"`
+	ResolvedAt     *time.Time    `json:"resolved_at,omitempty"`
+	ResolvedBy     string        `json:"resolved_by,omitempty"`
+	Log            []SOSLogEntry `json:"log,omitempty"`
+}
+
+// SOSLogEntry is one step of an alert's audit trail.
+type SOSLogEntry struct {
+	Action    string    `json:"action"`
+	ActorID   string    `json:"actor_id,omitempty"`
+	Note      string    `json:"note,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SOSEvent is sent to the trip and to every open session of its members.
+type SOSEvent struct {
+	Type     string   `json:"type"`
+	Priority string   `json:"priority"`
+	Alert    SOSAlert `json:"alert"`
+}
+
+// SetEscalator replaces where alerts are escalated outside the app.
+func (s *Service) SetEscalator(e Escalator) {
+	s.escalator = e
+}
+
+// RaiseSOS records an emergency for the session, alerts the trip and its
+// members, then escalates it. raisedBy must be the hiker or a member of the
+// trip. Without a position the session's last point is used.
+func (s *Service) RaiseSOS(ctx context.Context, sessionID, raisedBy string, input SOSAlert) (SOSAlert, error) {
+	if input.BatteryPct != nil && (*input.BatteryPct < 0 || *input.BatteryPct > 100) {
+		return SOSAlert{}, ErrInvalidBattery
+	}
+	alert := SOSAlert{
+		ID:         uuid.NewString(),
+		SessionID:  sessionID,
+		RaisedBy:   raisedBy,
+		Status:     SOSRaised,
+		Lat:        input.Lat,
+		Lng:        input.Lng,
+		BatteryPct: input.BatteryPct,
+		Message:    input.Message,
+	}
+
+	var channels []string
+	err := db.WithTx(ctx, s.db, func(tx pgx.Tx) error {
+		var member bool
+		err := tx.QueryRow(ctx, `
+			SELECT COALESCE(ts.trip_id::text,''), COALESCE(ts.user_id::text,''),
+			       COALESCE(ts.user_id::text = $2, false)
+			       OR EXISTS (SELECT 1 FROM trip_members tm WHERE tm.trip_id = ts.trip_id AND tm.user_id::text = $2)
+			       OR EXISTS (SELECT 1 FROM trips t WHERE t.id = ts.trip_id AND t.created_by::text = $2)
+			FROM track_sessions ts WHERE ts.id=$1
+		`, sessionID, raisedBy).Scan(&alert.TripID, &alert.UserID, &member)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrSessionNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if !member {
+			return ErrNotTripMember
+		}
+
+		if alert.Lat == 0 && alert.Lng == 0 {
+			err := tx.QueryRow(ctx, `
+				SELECT ST_Y(location::geometry), ST_X(location::geometry) FROM track_points
+				WHERE session_id=$1 ORDER BY recorded_at DESC, id DESC LIMIT 1
+			`, sessionID).Scan(&alert.Lat, &alert.Lng)
+			if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+				return err
+			}
+		}
+
+		if err := tx.QueryRow(ctx, `
+			INSERT INTO sos_alerts (id, session_id, trip_id, user_id, raised_by, status, location, battery_pct, message)
+			VALUES ($1, $2, NULLIF($3,'')::uuid, NULLIF($4,'')::uuid, NULLIF($5,'')::uuid, $6,
+			        CASE WHEN $7::float8 = 0 AND $8::float8 = 0 THEN NULL
+			             ELSE ST_SetSRID(ST_MakePoint($7,$8), 4326)::geography END,
+			        $9, $10)
+			RETURNING created_at
+		`, alert.ID, sessionID, alert.TripID, alert.UserID, raisedBy, SOSRaised,
+			alert.Lng, alert.Lat, alert.BatteryPct, alert.Message).Scan(&alert.CreatedAt); err != nil {
+			return err
+		}
+		if err := logSOS(ctx, tx, alert.ID, SOSRaised, raisedBy, alert.Message); err != nil {
+			return err
+		}
+
+		payload, _ := json.Marshal(alert)
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO notifications (id, user_id, kind, payload)
+			SELECT gen_random_uuid(), m.user_id, 'sos', $3::jsonb
+			FROM (
+			    SELECT tm.user_id FROM trip_members tm WHERE tm.trip_id::text = $1
+			    UNION
+			    SELECT t.created_by FROM trips t WHERE t.id::text = $1
+			) m
+			WHERE m.user_id IS NOT NULL AND m.user_id::text <> $2
+		`, alert.TripID, raisedBy, payload); err != nil {
+			return err
+		}
+
+		channels, err = sosChannels(ctx, tx, alert)
+		return err
+	})
+	if err != nil {
+		return SOSAlert{}, err
+	}
+
+	s.broadcastSOS(EventSOS, alert, channels)
+	s.escalateSOS(alert)
+	return alert, nil
+}
+
+func (s *Service) AcknowledgeSOS(ctx context.Context, alertID, userID, note string) (SOSAlert, error) {
+	return s.updateSOS(ctx, alertID, userID, ActionAcknowledge, note)
+}
+
+func (s *Service) ResolveSOS(ctx context.Context, alertID, userID, note string) (SOSAlert, error) {
+	return s.updateSOS(ctx, alertID, userID, ActionResolve, note)
+}
+
+// updateSOS moves an alert along its workflow on behalf of a trip member and
+// records the step in the audit trail.
+func (s *Service) updateSOS(ctx context.Context, alertID, userID, action, note string) (SOSAlert, error) {
+	rule, ok := sosTransitions[action]
+	if !ok {
+		return SOSAlert{}, fmt.Errorf("%w: unknown action %q", ErrInvalidTransition, action)
+	}
+
+	var alert SOSAlert
+	var channels []string
+	err := db.WithTx(ctx, s.db, func(tx pgx.Tx) error {
+		var status string
+		var member bool
+		err := tx.QueryRow(ctx, `
+			SELECT a.status,
+			       COALESCE(a.user_id::text = $2, false)
+			       OR EXISTS (SELECT 1 FROM trip_members tm WHERE tm.trip_id = a.trip_id AND tm.user_id::text = $2)
+			       OR EXISTS (SELECT 1 FROM trips t WHERE t.id = a.trip_id AND t.created_by::text = $2)
+			FROM sos_alerts a WHERE a.id=$1
+			FOR UPDATE
+		`, alertID, userID).Scan(&status, &member)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrSOSNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if !member {
+			return ErrNotTripMember
+		}
+		if !allowed(rule.from, status) {
+			return fmt.Errorf("%w: cannot %s a %s alert", ErrInvalidTransition, action, status)
+		}
+
+		if _, err := tx.Exec(ctx, `
+			UPDATE sos_alerts SET status=$2,
+			       acknowledged_at = CASE WHEN $2 = 'acknowledged' THEN NOW() ELSE acknowledged_at END,
+			       acknowledged_by = CASE WHEN $2 = 'acknowledged' THEN NULLIF($3,'')::uuid ELSE acknowledged_by END,
+			       resolved_at = CASE WHEN $2 = 'resolved' THEN NOW() ELSE resolved_at END,
+			       resolved_by = CASE WHEN $2 = 'resolved' THEN NULLIF($3,'')::uuid ELSE resolved_by END
+			WHERE id=$1
+		`, alertID, rule.to, userID); err != nil {
+			return err
+		}
+		if err := logSOS(ctx, tx, alertID, rule.to, userID, note); err != nil {
+			return err
+		}
+
+		alert, err = getSOS(ctx, tx, alertID)
+		if err != nil {
+			return err
+		}
+		channels, err = sosChannels(ctx, tx, alert)
+		return err
+	})
+	if err != nil {
+		return SOSAlert{}, err
+	}
+
+	s.broadcastSOS(rule.event, alert, channels)
+	return alert, nil
+}
+
+// SOS returns an alert with its audit trail to its hiker or a member of its
+// trip.
+func (s *Service) SOS(ctx context.Context, alertID, userID string) (SOSAlert, error) {
+	alert, err := getSOS(ctx, s.db, alertID)
+	if err != nil {
+		return SOSAlert{}, err
+	}
+	if alert.UserID != userID {
+		member := false
+		if alert.TripID != "" {
+			if member, err = s.IsTripMember(ctx, alert.TripID, userID); err != nil {
+				return SOSAlert{}, err
+			}
+		}
+		if !member {
+			return SOSAlert{}, ErrNotTripMember
+		}
+	}
+
+	rows, err := s.db.Query(ctx, `
+		SELECT action, COALESCE(actor_id::text,''), note, created_at
+		FROM sos_alert_log WHERE alert_id=$1
+		ORDER BY id
+	`, alertID)
+	if err != nil {
+		return SOSAlert{}, err
+	}
+	defer rows.Close()
+
+	alert.Log = []SOSLogEntry{}
+	for rows.Next() {
+		var entry SOSLogEntry
+		if err := rows.Scan(&entry.Action, &entry.ActorID, &entry.Note, &entry.CreatedAt); err != nil {
+			return SOSAlert{}, err
+		}
+		alert.Log = append(alert.Log, entry)
+	}
+	return alert, rows.Err()
+}
+
+// SessionSOS lists a session's alerts, newest first, for the hiker and the
+// members of the session's trip.
+func (s *Service) SessionSOS(ctx context.Context, sessionID, userID string) ([]SOSAlert, error) {
+	if err := checkSessionMember(ctx, s.db, sessionID, userID); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(ctx, `SELECT `+sosColumns+` FROM sos_alerts a WHERE a.session_id=$1 ORDER BY a.created_at DESC`, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	alerts := []SOSAlert{}
+	for rows.Next() {
+		alert, err := scanSOS(rows)
+		if err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, alert)
+	}
+	return alerts, rows.Err()
+}
+
+const sosColumns = `
+	a.id, a.session_id, COALESCE(a.trip_id::text,''), COALESCE(a.user_id::text,''), COALESCE(a.raised_by::text,''),
+	a.status, COALESCE(ST_Y(a.location::geometry),0), COALESCE(ST_X(a.location::geometry),0), a.battery_pct, a.message,
+	EXISTS (SELECT 1 FROM sos_alert_log l WHERE l.alert_id = a.id AND l.action = 'escalated'),
+	a.created_at, a.acknowledged_at, COALESCE(a.acknowledged_by::text,''), a.resolved_at, COALESCE(a.resolved_by::text,'')`
+
+func scanSOS(row pgx.Row) (SOSAlert, error) {
+	var a SOSAlert
+	err := row.Scan(&a.ID, &a.SessionID, &a.TripID, &a.UserID, &a.RaisedBy,
+		&a.Status, &a.Lat, &a.Lng, &a.BatteryPct, &a.Message,
+		&a.Escalated, &a.CreatedAt, &a.AcknowledgedAt, &a.AcknowledgedBy, &a.ResolvedAt, &a.ResolvedBy)
+	return a, err
+}
+
+func getSOS(ctx context.Context, q db.Querier, alertID string) (SOSAlert, error) {
+	alert, err := scanSOS(q.QueryRow(ctx, `SELECT `+sosColumns+` FROM sos_alerts a WHERE a.id=$1`, alertID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return SOSAlert{}, ErrSOSNotFound
+	}
+	return alert, err
+}
+
+func logSOS(ctx context.Context, q db.Querier, alertID, action, actorID, note string) error {
+	_, err := q.Exec(ctx, `
+		INSERT INTO sos_alert_log (alert_id, action, actor_id, note)
+		VALUES ($1, $2, NULLIF($3,'')::uuid, $4)
+	`, alertID, action, actorID, note)
+	return err
+}
+
+// sosChannels lists the hub channels an alert goes to: the alert's session,
+// the trip stream and every other open session of the trip, so members see
+// it on whichever stream their app is connected to.
+func sosChannels(ctx context.Context, q db.Querier, alert SOSAlert) ([]string, error) {
+	channels := []string{alert.SessionID}
+	if alert.TripID == "" {
+		return channels, nil
+	}
+	channels = append(channels, TripChannel(alert.TripID))
+
+	rows, err := q.Query(ctx, `
+		SELECT id FROM track_sessions
+		WHERE trip_id::text=$1 AND id::text<>$2 AND status IN ('active', 'paused')
+	`, alert.TripID, alert.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		channels = append(channels, id)
+	}
+	return channels, rows.Err()
+}
+
+func (s *Service) broadcastSOS(eventType string, alert SOSAlert, channels []string) {
+	if s.hub == nil {
+		return
+	}
+	payload, _ := json.Marshal(SOSEvent{Type: eventType, Priority: PriorityHigh, Alert: alert})
+	for _, channel := range channels {
+		s.hub.BroadcastUrgent(channel, payload)
+	}
+}
+
+// escalateSOS hands a stored alert to the escalator in the background, so
+// a slow webhook or gateway never delays the response, and records the
+// outcome in the audit trail, where SOS reads it back as Escalated. A failed
+// escalation does not fail the alert: members have already been told.
+func (s *Service) escalateSOS(alert SOSAlert) {
+	if s.escalator == nil {
+		return
+	}
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		ctx := context.Background()
+		action, note := sosLogEscalated, ""
+		if err := s.escalator.Escalate(ctx, alert); err != nil {
+			log.Printf("sos %s escalation failed: %v", alert.ID, err)
+			action, note = sosLogEscalationFailed, err.Error()
+		}
+		if err := logSOS(ctx, s.db, alert.ID, action, "", note); err != nil {
+			log.Printf("sos %s audit error: %v", alert.ID, err)
+		}
+	}()
+}
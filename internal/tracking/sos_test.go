@@ -0,0 +1,461 @@
+package tracking
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"backend-summithub/internal/stream"
+
+	"github.com/gofiber/fiber/v2"
+	gws "github.com/gorilla/websocket"
+	"github.com/pashagolub/pgxmock/v3"
+)
+
+type recordingEscalator struct {
+	alerts  []SOSAlert
+	err     error
+	release chan struct{}
+}
+
+func (r *recordingEscalator) Escalate(_ context.Context, alert SOSAlert) error {
+	if r.release != nil {
+		<-r.release
+	}
+	r.alerts = append(r.alerts, alert)
+	return r.err
+}
+
+var sosCols = []string{"id", "session_id", "trip_id", "user_id", "raised_by", "status", "lat", "lng", "battery_pct", "message",
+	"escalated", "created_at", "acknowledged_at", "acknowledged_by", "resolved_at", "resolved_by"}
+
+func expectRaiseSOS(mock pgxmock.PgxPoolIface, raisedBy string, member bool) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM track_sessions ts WHERE ts.id=\$1`).
+		WithArgs("session-1", raisedBy).
+		WillReturnRows(pgxmock.NewRows([]string{"trip_id", "user_id", "member"}).AddRow("trip-1", "user-1", member))
+}
+
+func expectSOSStored(mock pgxmock.PgxPoolIface, lng, lat float64, battery *int, message string) {
+	mock.ExpectQuery(`INSERT INTO sos_alerts`).
+		WithArgs(pgxmock.AnyArg(), "session-1", "trip-1", "user-1", "user-2", SOSRaised, lng, lat, battery, message).
+		WillReturnRows(pgxmock.NewRows([]string{"created_at"}).AddRow(time.Now()))
+	mock.ExpectExec(`INSERT INTO sos_alert_log`).
+		WithArgs(pgxmock.AnyArg(), SOSRaised, "user-2", message).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectExec(`INSERT INTO notifications .* 'sos'`).
+		WithArgs("trip-1", "user-2", pgxmock.AnyArg()).
+		WillReturnResult(pgxmock.NewResult("INSERT", 3))
+	mock.ExpectQuery(`SELECT id FROM track_sessions\s+WHERE trip_id::text=\$1 AND id::text<>\$2`).
+		WithArgs("trip-1", "session-1").
+		WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow("session-2"))
+	mock.ExpectCommit()
+}
+
+func TestRaiseSOSBroadcastsAndEscalates(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	hub := stream.NewHub(nil)
+	trip := hub.Register(TripChannel("trip-1"))
+	defer hub.Unregister(trip)
+	other := hub.Register("session-2")
+	defer hub.Unregister(other)
+
+	battery := 12
+	// A companion raises it without a fix, so the last stored point is used.
+	expectRaiseSOS(mock, "user-2", true)
+	mock.ExpectQuery(`FROM track_points\s+WHERE session_id=\$1 ORDER BY recorded_at DESC, id DESC LIMIT 1`).
+		WithArgs("session-1").
+		WillReturnRows(pgxmock.NewRows([]string{"lat", "lng"}).AddRow(-7.94, 112.95))
+	expectSOSStored(mock, 112.95, -7.94, &battery, "fell, ankle broken")
+	mock.ExpectExec(`INSERT INTO sos_alert_log`).
+		WithArgs(pgxmock.AnyArg(), "escalated", "", "").
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+
+	escalator := &recordingEscalator{}
+	svc := NewService(mock, hub)
+	svc.SetEscalator(escalator)
+	alert, err := svc.RaiseSOS(context.Background(), "session-1", "user-2", SOSAlert{BatteryPct: &battery, Message: "fell, ankle broken"})
+	if err != nil {
+		t.Fatalf("raise sos: %v", err)
+	}
+	if alert.UserID != "user-1" || alert.RaisedBy != "user-2" || alert.Lat != -7.94 {
+		t.Fatalf("unexpected alert %+v", alert)
+	}
+	svc.background.Wait()
+	if len(escalator.alerts) != 1 || escalator.alerts[0].ID != alert.ID {
+		t.Fatalf("expected one escalation, got %+v", escalator.alerts)
+	}
+
+	for name, client := range map[string]*stream.Client{"trip": trip, "other session": other} {
+		select {
+		case msg := <-client.Send:
+			var event SOSEvent
+			if err := json.Unmarshal(msg, &event); err != nil {
+				t.Fatalf("%s: decode: %v", name, err)
+			}
+			if event.Type != EventSOS || event.Priority != PriorityHigh || event.Alert.ID != alert.ID {
+				t.Fatalf("%s: unexpected event %s", name, msg)
+			}
+		case <-time.After(100 * time.Millisecond):
+			t.Fatalf("%s: expected sos broadcast", name)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
+
+func TestRaiseSOSRejectsOutsiders(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	expectRaiseSOS(mock, "user-9", false)
+	mock.ExpectRollback()
+
+	_, err = NewService(mock, nil).RaiseSOS(context.Background(), "session-1", "user-9", SOSAlert{Lat: 1, Lng: 2})
+	if !errors.Is(err, ErrNotTripMember) {
+		t.Fatalf("expected ErrNotTripMember, got %v", err)
+	}
+
+	low := -5
+	if _, err := NewService(mock, nil).RaiseSOS(context.Background(), "session-1", "user-1", SOSAlert{BatteryPct: &low}); !errors.Is(err, ErrInvalidBattery) {
+		t.Fatalf("expected ErrInvalidBattery, got %v", err)
+	}
+}
+
+func TestRaiseSOSHandlerRecordsFailedEscalation(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	expectRaiseSOS(mock, "user-2", true)
+	expectSOSStored(mock, 112.95, -7.94, nil, "lost")
+	mock.ExpectExec(`INSERT INTO sos_alert_log`).
+		WithArgs(pgxmock.AnyArg(), "escalation_failed", "", "gateway down").
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+
+	svc := NewService(mock, nil)
+	svc.SetEscalator(&recordingEscalator{err: errors.New("gateway down")})
+	app := fiber.New()
+	RegisterRoutes(app.Group("/tracking"), svc, func(c *fiber.Ctx) error {
+		c.Locals("user_id", "user-2")
+		return c.Next()
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/tracking/sessions/session-1/sos",
+		strings.NewReader(`{"lat":-7.94,"lng":112.95,"message":"lost"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	if err != nil || resp.StatusCode != http.StatusCreated {
+		t.Fatalf("sos status: %v %v", resp.StatusCode, err)
+	}
+	var alert SOSAlert
+	if err := json.NewDecoder(resp.Body).Decode(&alert); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if alert.Status != SOSRaised || alert.Escalated {
+		t.Fatalf("unexpected alert %+v", alert)
+	}
+	svc.background.Wait()
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
+
+func expectLockSOS(mock pgxmock.PgxPoolIface, status string) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM sos_alerts a WHERE a.id=\$1\s+FOR UPDATE`).
+		WithArgs("sos-1", "user-2").
+		WillReturnRows(pgxmock.NewRows([]string{"status", "member"}).AddRow(status, true))
+}
+
+func TestAcknowledgeAndResolveSOS(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	hub := stream.NewHub(nil)
+	client := hub.Register(TripChannel("trip-1"))
+	defer hub.Unregister(client)
+
+	at := time.Now()
+	expectLockSOS(mock, SOSRaised)
+	mock.ExpectExec(`UPDATE sos_alerts SET status=\$2`).
+		WithArgs("sos-1", SOSAcknowledged, "user-2").
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectExec(`INSERT INTO sos_alert_log`).
+		WithArgs("sos-1", SOSAcknowledged, "user-2", "on my way").
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectQuery(`FROM sos_alerts a WHERE a.id=\$1`).
+		WithArgs("sos-1").
+		WillReturnRows(pgxmock.NewRows(sosCols).
+			AddRow("sos-1", "session-1", "trip-1", "user-1", "user-1", SOSAcknowledged, -7.94, 112.95, nil, "help", true, at, &at, "user-2", nil, ""))
+	mock.ExpectQuery(`SELECT id FROM track_sessions`).
+		WithArgs("trip-1", "session-1").
+		WillReturnRows(pgxmock.NewRows([]string{"id"}))
+	mock.ExpectCommit()
+
+	svc := NewService(mock, hub)
+	alert, err := svc.AcknowledgeSOS(context.Background(), "sos-1", "user-2", "on my way")
+	if err != nil {
+		t.Fatalf("acknowledge: %v", err)
+	}
+	if alert.Status != SOSAcknowledged || alert.AcknowledgedBy != "user-2" {
+		t.Fatalf("unexpected alert %+v", alert)
+	}
+	select {
+	case msg := <-client.Send:
+		var event SOSEvent
+		_ = json.Unmarshal(msg, &event)
+		if event.Type != EventSOSAcknowledged || event.Priority != PriorityHigh {
+			t.Fatalf("unexpected event %s", msg)
+		}
+	case <-time.After(100 * time.Millisecond):
+		t.Fatalf("expected acknowledge broadcast")
+	}
+
+	expectLockSOS(mock, SOSResolved)
+	mock.ExpectRollback()
+	app := fiber.New()
+	RegisterRoutes(app.Group("/tracking"), svc, func(c *fiber.Ctx) error {
+		c.Locals("user_id", "user-2")
+		return c.Next()
+	})
+	resp, err := app.Test(httptest.NewRequest(http.MethodPost, "/tracking/sos/sos-1/acknowledge", nil))
+	if err != nil || resp.StatusCode != http.StatusConflict {
+		t.Fatalf("expected 409 for resolved alert, got %v %v", resp.StatusCode, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
+
+func TestSOSHandlerIncludesAuditTrail(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	at := time.Now()
+	mock.ExpectQuery(`FROM sos_alerts a WHERE a.id=\$1`).
+		WithArgs("sos-1").
+		WillReturnRows(pgxmock.NewRows(sosCols).
+			AddRow("sos-1", "session-1", "trip-1", "user-1", "user-1", SOSResolved, -7.94, 112.95, nil, "help", true, at, &at, "user-2", &at, "user-2"))
+	mock.ExpectQuery(`FROM sos_alert_log WHERE alert_id=\$1`).
+		WithArgs("sos-1").
+		WillReturnRows(pgxmock.NewRows([]string{"action", "actor_id", "note", "created_at"}).
+			AddRow(SOSRaised, "user-1", "help", at).
+			AddRow("escalated", "", "", at).
+			AddRow(SOSAcknowledged, "user-2", "", at).
+			AddRow(SOSResolved, "user-2", "carried down", at))
+	mock.ExpectQuery(`FROM sos_alerts a WHERE a.id=\$1`).
+		WithArgs("missing").
+		WillReturnRows(pgxmock.NewRows(sosCols))
+	mock.ExpectQuery(`FROM sos_alerts a WHERE a.id=\$1`).
+		WithArgs("sos-1").
+		WillReturnRows(pgxmock.NewRows(sosCols).
+			AddRow("sos-1", "session-1", "trip-1", "user-1", "user-1", SOSRaised, -7.94, 112.95, nil, "help", false, at, nil, "", nil, ""))
+	expectTripMember(mock, "user-9", false)
+
+	app := fiber.New()
+	RegisterRoutes(app.Group("/tracking"), NewService(mock, nil), func(c *fiber.Ctx) error {
+		c.Locals("user_id", c.Get("X-User", "user-1"))
+		return c.Next()
+	})
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/tracking/sos/sos-1", nil))
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("sos status: %v %v", resp.StatusCode, err)
+	}
+	var alert SOSAlert
+	if err := json.NewDecoder(resp.Body).Decode(&alert); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(alert.Log) != 4 || alert.Log[3].Note != "carried down" || alert.ResolvedBy != "user-2" {
+		t.Fatalf("unexpected alert %+v", alert)
+	}
+
+	resp, err = app.Test(httptest.NewRequest(http.MethodGet, "/tracking/sos/missing", nil))
+	if err != nil || resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404, got %v %v", resp.StatusCode, err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/tracking/sos/sos-1", nil)
+	req.Header.Set("X-User", "user-9")
+	resp, err = app.Test(req)
+	if err != nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403 for an outsider, got %v %v", resp.StatusCode, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
+
+func TestSessionSOSHandlerLimitedToTripMembers(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	at := time.Now()
+	expectSessionMember(mock, "user-2", true)
+	mock.ExpectQuery(`FROM sos_alerts a WHERE a.session_id=\$1 ORDER BY a.created_at DESC`).
+		WithArgs("session-1").
+		WillReturnRows(pgxmock.NewRows(sosCols).
+			AddRow("sos-1", "session-1", "trip-1", "user-1", "user-1", SOSRaised, -7.94, 112.95, nil, "help", false, at, nil, "", nil, ""))
+	expectSessionMember(mock, "user-9", false)
+
+	app := fiber.New()
+	RegisterRoutes(app.Group("/tracking"), NewService(mock, nil), func(c *fiber.Ctx) error {
+		c.Locals("user_id", c.Get("X-User", "user-2"))
+		return c.Next()
+	})
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/tracking/sessions/session-1/sos", nil))
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("session sos status: %v %v", resp.StatusCode, err)
+	}
+	var alerts []SOSAlert
+	if err := json.NewDecoder(resp.Body).Decode(&alerts); err != nil || len(alerts) != 1 {
+		t.Fatalf("unexpected alerts %+v %v", alerts, err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/tracking/sessions/session-1/sos", nil)
+	req.Header.Set("X-User", "user-9")
+	resp, err = app.Test(req)
+	if err != nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403 for an outsider, got %v %v", resp.StatusCode, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
+
+func TestRaiseSOSDoesNotWaitForEscalation(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	expectRaiseSOS(mock, "user-2", true)
+	expectSOSStored(mock, 112.95, -7.94, nil, "")
+	mock.ExpectExec(`INSERT INTO sos_alert_log`).
+		WithArgs(pgxmock.AnyArg(), "escalated", "", "").
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+
+	escalator := &recordingEscalator{release: make(chan struct{})}
+	svc := NewService(mock, nil)
+	svc.SetEscalator(escalator)
+
+	raised := make(chan error, 1)
+	go func() {
+		_, err := svc.RaiseSOS(context.Background(), "session-1", "user-2", SOSAlert{Lat: -7.94, Lng: 112.95})
+		raised <- err
+	}()
+	select {
+	case err := <-raised:
+		if err != nil {
+			t.Fatalf("raise sos: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected RaiseSOS to return before the escalation finished")
+	}
+
+	close(escalator.release)
+	svc.background.Wait()
+	if len(escalator.alerts) != 1 {
+		t.Fatalf("expected one escalation, got %+v", escalator.alerts)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
+
+func TestTripStreamRaisesSOS(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	expectTripMember(mock, "user-2", true)
+	mock.ExpectQuery(`WHERE ts.trip_id=\$1`).
+		WithArgs("trip-1", "user-2").
+		WillReturnRows(pgxmock.NewRows(snapshotCols))
+	expectRaiseSOS(mock, "user-2", true)
+	expectSOSStored(mock, 112.95, -7.94, nil, "")
+	mock.ExpectExec(`INSERT INTO sos_alert_log`).
+		WithArgs(pgxmock.AnyArg(), "escalated", "", "").
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+
+	svc := NewService(mock, stream.NewHub(nil))
+	svc.SetEscalator(&recordingEscalator{})
+	app := fiber.New()
+	RegisterStreamRoutes(app.Group("/stream"), svc, func(c *fiber.Ctx) error {
+		c.Locals("user_id", "user-2")
+		return c.Next()
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen error: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		_ = app.Listener(ln)
+	}()
+	defer func() { _ = app.Shutdown() }()
+
+	conn, _, err := gws.DefaultDialer.Dial("ws://"+ln.Addr().String()+"/stream/ws/trips/trip-1", nil)
+	if err != nil {
+		t.Fatalf("dial error: %v", err)
+	}
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+
+	var snapshot TripEvent
+	if err := conn.ReadJSON(&snapshot); err != nil {
+		t.Fatalf("read snapshot: %v", err)
+	}
+
+	if err := conn.WriteMessage(gws.TextMessage, []byte("not json")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	var failure TripEvent
+	if err := conn.ReadJSON(&failure); err != nil || failure.Type != EventError {
+		t.Fatalf("expected error reply, got %+v %v", failure, err)
+	}
+
+	if err := conn.WriteJSON(map[string]any{"type": "sos", "session_id": "session-1", "lat": -7.94, "lng": 112.95}); err != nil {
+		t.Fatalf("write sos: %v", err)
+	}
+	var event SOSEvent
+	if err := conn.ReadJSON(&event); err != nil {
+		t.Fatalf("read sos: %v", err)
+	}
+	if event.Type != EventSOS || event.Alert.SessionID != "session-1" || event.Alert.RaisedBy != "user-2" {
+		t.Fatalf("unexpected sos event %+v", event)
+	}
+	svc.background.Wait()
+}
@@ -0,0 +1,163 @@
+package tracking
+
+import (
+	"math"
+	"time"
+)
+
+// movingSpeedMps is the slowest pace between counted moves that is still
+// treated as moving rather than resting.
+const movingSpeedMps = 0.2
+
+// splitLengthM is the length of one summary split.
+const splitLengthM = 1000
+
+// Split covers one kilometre of the filtered track; the last split may be
+// shorter.
+type Split struct {
+	Km               int     `json:"km"`
+	DistanceM        float64 `json:"distance_m"`
+	DurationSec      int64   `json:"duration_sec"`
+	MovingSec        int64   `json:"moving_sec"`
+	ElevationChangeM float64 `json:"elevation_change_m"`
+}
+
+// trackStats are the movement figures derived from a filtered track.
+type trackStats struct {
+	MovingSec       float64
+	MinElevationM   float64
+	MaxElevationM   float64
+	MaxSpeedMps     float64
+	ClimbRateMPerH  float64
+	MovingPaceSecKm float64
+	Splits          []Split
+}
+
+// pauseInterval is one pause of a session; to is now for an open pause.
+type pauseInterval struct {
+	from, to time.Time
+}
+
+// computeStats measures the filtered track. Moving time and speeds come from
+// the counted moves, so jitter at rest does not register as movement;
+// elevation extremes come from the smoothed points. A move that overlaps a
+// pause is dropped whole from moving time and climb rate, so the gap between
+// pausing and resuming is not mistaken for a walk.
+func computeStats(track filteredTrack, pauses []pauseInterval) trackStats {
+	var stats trackStats
+	for i, p := range track.Points {
+		if i == 0 || p.ElevationM < stats.MinElevationM {
+			stats.MinElevationM = p.ElevationM
+		}
+		if i == 0 || p.ElevationM > stats.MaxElevationM {
+			stats.MaxElevationM = p.ElevationM
+		}
+	}
+
+	var climbM, climbSec, movingM float64
+	var splits splitter
+	for i := 1; i < len(track.Moves); i++ {
+		a, b := track.Moves[i-1], track.Moves[i]
+		distanceM := segmentDistanceM(a, b)
+		seconds := b.RecordedAt.Sub(a.RecordedAt).Seconds()
+		moving := seconds > 0 && distanceM/seconds >= movingSpeedMps && !overlapsPause(a, b, pauses)
+		if moving {
+			stats.MovingSec += seconds
+			movingM += distanceM
+			stats.MaxSpeedMps = math.Max(stats.MaxSpeedMps, distanceM/seconds)
+			if b.ElevationM > a.ElevationM {
+				climbM += b.ElevationM - a.ElevationM
+				climbSec += seconds
+			}
+		}
+		splits.add(a, b, distanceM, moving)
+	}
+	stats.Splits = splits.finish()
+
+	if climbSec > 0 {
+		stats.ClimbRateMPerH = climbM / climbSec * 3600
+	}
+	if movingM > 0 {
+		stats.MovingPaceSecKm = stats.MovingSec / (movingM / 1000)
+	}
+	return stats
+}
+
+// overlapsPause reports whether the move from a to b overlaps any pause.
+func overlapsPause(a, b TrackPoint, pauses []pauseInterval) bool {
+	for _, p := range pauses {
+		if p.from.Before(b.RecordedAt) && p.to.After(a.RecordedAt) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitter cuts the counted moves into kilometre splits, interpolating the
+// time and elevation where a move crosses a boundary.
+type splitter struct {
+	splits    []Split
+	start     TrackPoint
+	last      TrackPoint
+	distanceM float64
+	movingSec float64
+	started   bool
+}
+
+func (s *splitter) add(a, b TrackPoint, distanceM float64, moving bool) {
+	if !s.started {
+		s.start, s.started = a, true
+	}
+	seconds := b.RecordedAt.Sub(a.RecordedAt).Seconds()
+	for distanceM > 0 && s.distanceM+distanceM >= splitLengthM {
+		needM := splitLengthM - s.distanceM
+		fraction := needM / distanceM
+		boundary := interpolate(a, b, fraction)
+		s.distanceM = splitLengthM
+		if moving {
+			s.movingSec += seconds * fraction
+		}
+		s.close(boundary)
+
+		a = boundary
+		distanceM -= needM
+		seconds -= seconds * fraction
+	}
+	s.distanceM += distanceM
+	if moving {
+		s.movingSec += seconds
+	}
+	s.last = b
+}
+
+func (s *splitter) close(end TrackPoint) {
+	s.splits = append(s.splits, Split{
+		Km:               len(s.splits) + 1,
+		DistanceM:        s.distanceM,
+		DurationSec:      int64(math.Round(end.RecordedAt.Sub(s.start.RecordedAt).Seconds())),
+		MovingSec:        int64(math.Round(s.movingSec)),
+		ElevationChangeM: end.ElevationM - s.start.ElevationM,
+	})
+	s.start = end
+	s.distanceM, s.movingSec = 0, 0
+}
+
+func (s *splitter) finish() []Split {
+	if s.distanceM > 0 {
+		s.close(s.last)
+	}
+	if s.splits == nil {
+		return []Split{}
+	}
+	return s.splits
+}
+
+// interpolate returns the point a fraction of the way from a to b.
+func interpolate(a, b TrackPoint, fraction float64) TrackPoint {
+	return TrackPoint{
+		Lat:        a.Lat + (b.Lat-a.Lat)*fraction,
+		Lng:        a.Lng + (b.Lng-a.Lng)*fraction,
+		ElevationM: a.ElevationM + (b.ElevationM-a.ElevationM)*fraction,
+		RecordedAt: a.RecordedAt.Add(time.Duration(float64(b.RecordedAt.Sub(a.RecordedAt)) * fraction)),
+	}
+}
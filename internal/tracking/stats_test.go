@@ -0,0 +1,138 @@
+package tracking
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestComputeStatsSplitsAndMovingTime(t *testing.T) {
+	start := time.Date(2026, 8, 17, 6, 0, 0, 0, time.UTC)
+	moves := []TrackPoint{{Lat: -7.94, Lng: 112.95, ElevationM: 2000, RecordedAt: start}}
+	// 24 moves of 100 m climbing 10 m each, at 1 m/s except the 13th, which
+	// takes 1000 s and counts as resting.
+	for i := 1; i <= 24; i++ {
+		prev := moves[i-1]
+		seconds := 100
+		if i == 13 {
+			seconds = 1000
+		}
+		moves = append(moves, TrackPoint{
+			Lat:        prev.Lat + metresToLat(100),
+			Lng:        112.95,
+			ElevationM: prev.ElevationM + 10,
+			RecordedAt: prev.RecordedAt.Add(time.Duration(seconds) * time.Second),
+		})
+	}
+	distanceM, _ := pathTotals(moves)
+
+	stats := computeStats(filteredTrack{Points: moves, Moves: moves, DistanceM: distanceM}, nil)
+	if stats.MovingSec != 2300 {
+		t.Fatalf("expected 2300 s moving, got %.0f", stats.MovingSec)
+	}
+	if stats.MinElevationM != 2000 || stats.MaxElevationM != 2240 {
+		t.Fatalf("unexpected elevation range %.0f-%.0f", stats.MinElevationM, stats.MaxElevationM)
+	}
+	if math.Abs(stats.MaxSpeedMps-1) > 0.01 || math.Abs(stats.ClimbRateMPerH-360) > 0.5 {
+		t.Fatalf("unexpected max speed %.2f or climb rate %.1f", stats.MaxSpeedMps, stats.ClimbRateMPerH)
+	}
+	// The resting move is left out of both time and distance: 2300 s over 2.3 km.
+	if math.Abs(stats.MovingPaceSecKm-1000) > 1 {
+		t.Fatalf("unexpected moving pace %.1f", stats.MovingPaceSecKm)
+	}
+
+	want := []Split{
+		{Km: 1, DistanceM: 1000, DurationSec: 1000, MovingSec: 1000, ElevationChangeM: 100},
+		{Km: 2, DistanceM: 1000, DurationSec: 1900, MovingSec: 900, ElevationChangeM: 100},
+		{Km: 3, DistanceM: 400, DurationSec: 400, MovingSec: 400, ElevationChangeM: 40},
+	}
+	if len(stats.Splits) != len(want) {
+		t.Fatalf("expected %d splits, got %+v", len(want), stats.Splits)
+	}
+	for i, got := range stats.Splits {
+		w := want[i]
+		if got.Km != w.Km || math.Abs(got.DistanceM-w.DistanceM) > 0.1 || got.DurationSec != w.DurationSec ||
+			got.MovingSec != w.MovingSec || math.Abs(got.ElevationChangeM-w.ElevationChangeM) > 0.1 {
+			t.Fatalf("split %d: expected %+v, got %+v", i+1, w, got)
+		}
+	}
+}
+
+func TestComputeStatsSkipsMovesAcrossPauses(t *testing.T) {
+	start := time.Date(2026, 8, 17, 6, 0, 0, 0, time.UTC)
+	moves := []TrackPoint{
+		{Lat: -7.94, Lng: 112.95, ElevationM: 2000, RecordedAt: start},
+		{Lat: -7.94 + metresToLat(100), Lng: 112.95, ElevationM: 2000, RecordedAt: start.Add(100 * time.Second)},
+		// Paused for ten minutes, then resumed 300 m further on.
+		{Lat: -7.94 + metresToLat(400), Lng: 112.95, ElevationM: 2000, RecordedAt: start.Add(800 * time.Second)},
+		{Lat: -7.94 + metresToLat(500), Lng: 112.95, ElevationM: 2000, RecordedAt: start.Add(900 * time.Second)},
+	}
+	distanceM, _ := pathTotals(moves)
+	pauses := []pauseInterval{{from: start.Add(150 * time.Second), to: start.Add(750 * time.Second)}}
+
+	stats := computeStats(filteredTrack{Points: moves, Moves: moves, DistanceM: distanceM}, pauses)
+	if stats.MovingSec != 200 {
+		t.Fatalf("expected 200 s moving outside the pause, got %.0f", stats.MovingSec)
+	}
+	if math.Abs(stats.MovingPaceSecKm-1000) > 1 {
+		t.Fatalf("expected the pace over the 200 m moved outside the pause, got %.1f", stats.MovingPaceSecKm)
+	}
+	if without := computeStats(filteredTrack{Points: moves, Moves: moves, DistanceM: distanceM}, nil); without.MovingSec != 900 {
+		t.Fatalf("expected the gap to count as moving without pauses, got %.0f", without.MovingSec)
+	}
+}
+
+func TestComputeStatsEmptyTrack(t *testing.T) {
+	stats := computeStats(filterTrack(nil, DefaultFilterConfig), nil)
+	if stats.MovingSec != 0 || stats.MaxSpeedMps != 0 || stats.Splits == nil || len(stats.Splits) != 0 {
+		t.Fatalf("unexpected stats for empty track %+v", stats)
+	}
+}
+
+func TestComputeStatsOnNoisyHike(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	start := time.Date(2026, 8, 17, 6, 0, 0, 0, time.UTC)
+	var points []TrackPoint
+	at, along, elevation := start, 0.0, 2100.0
+	add := func() {
+		points = append(points, TrackPoint{
+			Lat:        -7.94 + metresToLat(along+rng.NormFloat64()*3),
+			Lng:        112.95 + metresToLat(rng.NormFloat64()*3),
+			ElevationM: elevation + rng.NormFloat64()*1.5,
+			RecordedAt: at,
+			AccuracyM:  5,
+		})
+		at = at.Add(5 * time.Second)
+	}
+	// 1.5 km up at 1 m/s gaining 150 m, 20 minutes at rest, 1 km down losing 100 m.
+	for i := 0; i < 300; i++ {
+		along, elevation = along+5, elevation+0.5
+		add()
+	}
+	for i := 0; i < 240; i++ {
+		add()
+	}
+	for i := 0; i < 200; i++ {
+		along, elevation = along+5, elevation-0.5
+		add()
+	}
+
+	filtered := filterTrack(points, DefaultFilterConfig)
+	stats := computeStats(filtered, nil)
+	if math.Abs(stats.MovingSec-2500) > 250 {
+		t.Fatalf("expected about 2500 s moving, got %.0f", stats.MovingSec)
+	}
+	if math.Abs(filtered.ElevationLossM-100) > 15 || math.Abs(stats.MaxElevationM-2250) > 5 {
+		t.Fatalf("unexpected descent %.0f or max elevation %.0f", filtered.ElevationLossM, stats.MaxElevationM)
+	}
+	if stats.MaxSpeedMps > 2 || math.Abs(stats.ClimbRateMPerH-360) > 60 {
+		t.Fatalf("unexpected max speed %.2f or climb rate %.0f", stats.MaxSpeedMps, stats.ClimbRateMPerH)
+	}
+	if len(stats.Splits) != 3 {
+		t.Fatalf("expected 3 splits, got %+v", stats.Splits)
+	}
+	if stats.Splits[1].DurationSec-stats.Splits[1].MovingSec < 1000 {
+		t.Fatalf("expected the rest inside the second split, got %+v", stats.Splits[1])
+	}
+}
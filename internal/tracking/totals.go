@@ -0,0 +1,94 @@
+package tracking
+
+import (
+	"context"
+
+	"backend-summithub/internal/db"
+	"backend-summithub/internal/shared/geo"
+)
+
+// recomputeTotals rebuilds a session's distance and elevation gain from all
+// of its stored points in recorded order and saves them on the session.
+func recomputeTotals(ctx context.Context, q db.Querier, sessionID string) (float64, float64, error) {
+	rows, err := q.Query(ctx, `
+		SELECT ST_Y(location::geometry), ST_X(location::geometry), COALESCE(elevation_m, 0)
+		FROM track_points
+		WHERE session_id=$1
+		ORDER BY recorded_at, id
+	`, sessionID)
+	if err != nil {
+		return 0, 0, err
+	}
+	var points []TrackPoint
+	for rows.Next() {
+		var p TrackPoint
+		if err := rows.Scan(&p.Lat, &p.Lng, &p.ElevationM); err != nil {
+			rows.Close()
+			return 0, 0, err
+		}
+		points = append(points, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	distanceM, gainM := pathTotals(points)
+	tag, err := q.Exec(ctx, `
+		UPDATE track_sessions
+		SET total_distance_m = $2, total_elevation_gain_m = $3
+		WHERE id=$1 AND points_archived_at IS NULL
+	`, sessionID, distanceM, gainM)
+	if err != nil {
+		return 0, 0, err
+	}
+	if tag.RowsAffected() == 0 {
+		// Archived sessions have lost their raw points; the stored totals,
+		// computed from the full track, stay authoritative.
+		err = q.QueryRow(ctx, `
+			SELECT COALESCE(total_distance_m,0), COALESCE(total_elevation_gain_m,0) FROM track_sessions WHERE id=$1
+		`, sessionID).Scan(&distanceM, &gainM)
+	}
+	return distanceM, gainM, err
+}
+
+// pathTotals sums the distance and positive elevation change along points,
+// which must already be in recorded order.
+func pathTotals(points []TrackPoint) (float64, float64) {
+	var distanceM, gainM float64
+	for i := 1; i < len(points); i++ {
+		distanceM += segmentDistanceM(points[i-1], points[i])
+		gainM += segmentGainM(points[i-1], points[i])
+	}
+	return distanceM, gainM
+}
+
+func segmentDistanceM(a, b TrackPoint) float64 {
+	return geo.HaversineKm(a.Lat, a.Lng, b.Lat, b.Lng) * 1000
+}
+
+func segmentGainM(a, b TrackPoint) float64 {
+	if b.ElevationM > a.ElevationM {
+		return b.ElevationM - a.ElevationM
+	}
+	return 0
+}
+
+// spliceDelta is the change in totals from inserting p between prev and next,
+// either of which may be missing when p becomes the first or last point.
+func spliceDelta(prev *TrackPoint, p TrackPoint, next *TrackPoint) (float64, float64) {
+	var deltaM, deltaGain float64
+	if prev != nil {
+		deltaM += segmentDistanceM(*prev, p)
+		deltaGain += segmentGainM(*prev, p)
+	}
+	if next != nil {
+		deltaM += segmentDistanceM(p, *next)
+		deltaGain += segmentGainM(p, *next)
+	}
+	if prev != nil && next != nil {
+		deltaM -= segmentDistanceM(*prev, *next)
+		deltaGain -= segmentGainM(*prev, *next)
+	}
+	return deltaM, deltaGain
+}
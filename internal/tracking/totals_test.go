@@ -0,0 +1,171 @@
+package tracking
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/pashagolub/pgxmock/v3"
+)
+
+func TestSpliceDeltaMatchesInOrderTotalsForAnyArrivalOrder(t *testing.T) {
+	start := time.Date(2026, 8, 17, 4, 0, 0, 0, time.UTC)
+	var track []TrackPoint
+	for i := 0; i < 40; i++ {
+		track = append(track, TrackPoint{
+			Lat:        -7.94 - float64(i)*0.0005,
+			Lng:        112.95 + math.Sin(float64(i))*0.0003,
+			ElevationM: 2100 + float64(i*7%23),
+			RecordedAt: start.Add(time.Duration(i) * time.Minute),
+		})
+	}
+	wantDistance, wantGain := pathTotals(track)
+
+	rng := rand.New(rand.NewSource(1))
+	arrival := append([]TrackPoint(nil), track...)
+	rng.Shuffle(len(arrival), func(i, j int) { arrival[i], arrival[j] = arrival[j], arrival[i] })
+
+	var stored []TrackPoint
+	var distance, gain float64
+	for _, p := range arrival {
+		idx := sort.Search(len(stored), func(i int) bool { return stored[i].RecordedAt.After(p.RecordedAt) })
+		var prev, next *TrackPoint
+		if idx > 0 {
+			prev = &stored[idx-1]
+		}
+		if idx < len(stored) {
+			next = &stored[idx]
+		}
+		dDistance, dGain := spliceDelta(prev, p, next)
+		distance += dDistance
+		gain += dGain
+		stored = append(stored[:idx], append([]TrackPoint{p}, stored[idx:]...)...)
+	}
+
+	if math.Abs(distance-wantDistance) > 1e-6 || math.Abs(gain-wantGain) > 1e-6 {
+		t.Fatalf("spliced totals %.3f/%.3f, want %.3f/%.3f", distance, gain, wantDistance, wantGain)
+	}
+}
+
+func TestAddPointSplicesBetweenNeighbours(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	prev := TrackPoint{Lat: -7.940, Lng: 112.950, ElevationM: 2100}
+	next := TrackPoint{Lat: -7.960, Lng: 112.950, ElevationM: 2120}
+	late := TrackPoint{Lat: -7.950, Lng: 112.951, ElevationM: 2150, RecordedAt: time.Now().Add(-time.Hour)}
+	wantDistance, wantGain := spliceDelta(&prev, late, &next)
+
+	expectPointLookups(mock, "session-1", &[3]float64{prev.Lat, prev.Lng, prev.ElevationM}, &[3]float64{next.Lat, next.Lng, next.ElevationM})
+	mock.ExpectQuery(`INSERT INTO track_points`).
+		WithArgs("session-1", late.Lng, late.Lat, late.ElevationM, pgxmock.AnyArg(), 0.0, "", 0.0, 0, 0, (*float64)(nil), 0.0, (*int)(nil)).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "created_at"}).AddRow(int64(5), time.Now()))
+	mock.ExpectExec(`UPDATE track_sessions`).
+		WithArgs("session-1", wantDistance, wantGain).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectCommit()
+
+	svc := NewService(mock, nil)
+	if _, err := svc.AddPoint(context.Background(), "session-1", late); err != nil {
+		t.Fatalf("add point: %v", err)
+	}
+	if wantGain != 30 {
+		t.Fatalf("expected the climb to the late point to replace the direct climb, got gain delta %.1f", wantGain)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestAddPointReturnsTotalsUpdateError(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	expectPointLookups(mock, "session-1", &[3]float64{-7.94, 112.95, 2100}, nil)
+	mock.ExpectQuery(`INSERT INTO track_points`).
+		WithArgs("session-1", 112.95, -7.95, 2110.0, pgxmock.AnyArg(), 0.0, "", 0.0, 0, 0, (*float64)(nil), 0.0, (*int)(nil)).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "created_at"}).AddRow(int64(2), time.Now()))
+	mock.ExpectExec(`UPDATE track_sessions`).
+		WithArgs("session-1", pgxmock.AnyArg(), 10.0).
+		WillReturnError(errTrack)
+	mock.ExpectRollback()
+
+	svc := NewService(mock, nil)
+	if _, err := svc.AddPoint(context.Background(), "session-1", TrackPoint{Lat: -7.95, Lng: 112.95, ElevationM: 2110}); !errors.Is(err, errTrack) {
+		t.Fatalf("expected update error, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestAddPointReturnsLookupError(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM track_sessions WHERE id=\$1\s+FOR UPDATE`).
+		WithArgs("session-1").
+		WillReturnRows(lockedSession("session-1", StatusActive))
+	mock.ExpectQuery(`recorded_at <= \$2`).
+		WithArgs("session-1", pgxmock.AnyArg()).
+		WillReturnError(errTrack)
+	mock.ExpectRollback()
+
+	svc := NewService(mock, nil)
+	if _, err := svc.AddPoint(context.Background(), "session-1", TrackPoint{Lat: -7.95, Lng: 112.95}); !errors.Is(err, errTrack) {
+		t.Fatalf("expected lookup error, got %v", err)
+	}
+}
+
+func TestRecomputeTotals(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM track_sessions WHERE id=\$1\s+FOR UPDATE`).
+		WithArgs("session-1").
+		WillReturnRows(lockedSession("session-1", StatusActive))
+	expectRecompute(mock, "session-1", [][3]float64{{-7.94, 112.95, 2100}, {-7.95, 112.95, 2090}, {-7.96, 112.95, 2130}})
+	mock.ExpectCommit()
+	// Another user cannot rewrite the hiker's totals.
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM track_sessions WHERE id=\$1\s+FOR UPDATE`).
+		WithArgs("session-1").
+		WillReturnRows(lockedSession("session-1", StatusActive))
+	mock.ExpectRollback()
+
+	svc := NewService(mock, nil)
+	session, err := svc.RecomputeTotals(context.Background(), "session-1", "user-1")
+	if err != nil {
+		t.Fatalf("recompute: %v", err)
+	}
+	if session.TotalElevationGainM != 40 || session.TotalDistanceM < 2200 || session.TotalDistanceM > 2250 {
+		t.Fatalf("unexpected totals: %+v", session)
+	}
+	if _, err := svc.RecomputeTotals(context.Background(), "session-1", "user-2"); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("expected ErrSessionNotFound for another user, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
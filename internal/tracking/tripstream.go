@@ -0,0 +1,157 @@
+package tracking
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"backend-summithub/internal/db"
+	"backend-summithub/internal/privacy"
+	"backend-summithub/internal/stream"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrNotTripMember = errors.New("user is not a member of this trip")
+
+const (
+	EventSnapshot = "snapshot"
+	EventPosition = "position"
+	EventError    = "error"
+)
+
+// MemberPosition is one member's session on the trip stream. Point is the
+// latest point, or nil before the first one arrives. LowBattery is set when
+// that point reports LowBatteryPct or less, so the leader can see who may
+// soon go silent.
+type MemberPosition struct {
+	SessionID  string      `json:"session_id"`
+	UserID     string      `json:"user_id"`
+	Username   string      `json:"username,omitempty"`
+	Status     string      `json:"status"`
+	Point      *TrackPoint `json:"point"`
+	LowBattery bool        `json:"low_battery,omitempty"`
+}
+
+// TripEvent is sent on a trip's stream: one snapshot on connect, then a
+// position or session_ended event per member update. Error events answer
+// only the client whose message failed.
+type TripEvent struct {
+	Type    string           `json:"type"`
+	Members []MemberPosition `json:"members,omitempty"`
+	Member  *MemberPosition  `json:"member,omitempty"`
+	Error   string           `json:"error,omitempty"`
+}
+
+// TripChannel is the hub channel carrying every session of a trip.
+func TripChannel(tripID string) string {
+	return stream.InternalChannel("trip-sessions", tripID)
+}
+
+// IsTripMember reports whether the user belongs to the trip or created it.
+func (s *Service) IsTripMember(ctx context.Context, tripID, userID string) (bool, error) {
+	var ok bool
+	err := s.db.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM trip_members WHERE trip_id=$1 AND user_id::text=$2)
+		    OR EXISTS (SELECT 1 FROM trips WHERE id=$1 AND created_by::text=$2)
+	`, tripID, userID).Scan(&ok)
+	return ok, err
+}
+
+// checkSessionMember allows the session's hiker and the members of its trip.
+func checkSessionMember(ctx context.Context, q db.Querier, sessionID, userID string) error {
+	var member bool
+	err := q.QueryRow(ctx, `
+		SELECT COALESCE(ts.user_id::text = $2, false)
+		       OR EXISTS (SELECT 1 FROM trip_members tm WHERE tm.trip_id = ts.trip_id AND tm.user_id::text = $2)
+		       OR EXISTS (SELECT 1 FROM trips t WHERE t.id = ts.trip_id AND t.created_by::text = $2)
+		FROM track_sessions ts WHERE ts.id=$1
+	`, sessionID, userID).Scan(&member)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrSessionNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if !member {
+		return ErrNotTripMember
+	}
+	return nil
+}
+
+// TripSnapshot returns every open session of the trip with its member and
+// last point. A last point viewerID may not see is left out.
+func (s *Service) TripSnapshot(ctx context.Context, tripID, viewerID string) (TripEvent, error) {
+	rows, err := privacy.QueryPositions(ctx, s.db, viewerID, func(visible func(location, owner string) string) string {
+		return `
+		SELECT ts.id, COALESCE(ts.user_id::text,''), COALESCE(u.username,''), ts.status,
+		       lp.id, COALESCE(lp.lat,0), COALESCE(lp.lng,0), COALESCE(lp.elevation_m,0),
+		       COALESCE(lp.recorded_at, ts.started_at), COALESCE(lp.speed_mps,0), COALESCE(lp.accuracy_m,0),
+		       lp.battery_pct
+		FROM track_sessions ts
+		LEFT JOIN users u ON u.id = ts.user_id
+		LEFT JOIN LATERAL (
+		    SELECT id, location, ST_Y(location::geometry) AS lat, ST_X(location::geometry) AS lng,
+		           COALESCE(elevation_m,0) AS elevation_m, recorded_at,
+		           COALESCE(speed_mps,0) AS speed_mps, COALESCE(accuracy_m,0) AS accuracy_m,
+		           battery_pct
+		    FROM track_points WHERE session_id = ts.id
+		    ORDER BY recorded_at DESC, id DESC
+		    LIMIT 1
+		) lp ON ` + visible("lp.location", "ts.user_id") + `
+		WHERE ts.trip_id=$1 AND ts.status IN ('active', 'paused')
+		ORDER BY ts.started_at
+	`
+	}, tripID)
+	if err != nil {
+		return TripEvent{}, err
+	}
+	defer rows.Close()
+
+	snapshot := TripEvent{Type: EventSnapshot, Members: []MemberPosition{}}
+	for rows.Next() {
+		var m MemberPosition
+		var p TrackPoint
+		var pointID *int64
+		if err := rows.Scan(&m.SessionID, &m.UserID, &m.Username, &m.Status,
+			&pointID, &p.Lat, &p.Lng, &p.ElevationM, &p.RecordedAt, &p.SpeedMps, &p.AccuracyM, &p.BatteryPct); err != nil {
+			return TripEvent{}, err
+		}
+		if pointID != nil {
+			p.ID, p.SessionID = *pointID, m.SessionID
+			m.Point = &p
+			m.LowBattery = lowBattery(m.Point)
+		}
+		snapshot.Members = append(snapshot.Members, m)
+	}
+	return snapshot, rows.Err()
+}
+
+// broadcastPoint sends a new point to the session's subscribers and, with
+// the member's identity, to the trip's.
+func (s *Service) broadcastPoint(session Session, point TrackPoint) {
+	if s.hub == nil {
+		return
+	}
+	payload, _ := json.Marshal(point)
+	s.broadcastAt(session, session.ID, point.Lat, point.Lng, payload, false)
+	s.broadcastTrip(session, EventPosition, &point)
+}
+
+func (s *Service) broadcastTrip(session Session, eventType string, point *TrackPoint) {
+	if s.hub == nil || session.TripID == "" {
+		return
+	}
+	payload, _ := json.Marshal(TripEvent{Type: eventType, Member: &MemberPosition{
+		SessionID:  session.ID,
+		UserID:     session.UserID,
+		Status:     session.Status,
+		Point:      point,
+		LowBattery: lowBattery(point),
+	}})
+	if point != nil {
+		s.broadcastAt(session, TripChannel(session.TripID), point.Lat, point.Lng, payload, false)
+		return
+	}
+	s.hub.Broadcast(TripChannel(session.TripID), payload)
+}
@@ -0,0 +1,226 @@
+package tracking
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"backend-summithub/internal/stream"
+
+	"github.com/gofiber/fiber/v2"
+	gws "github.com/gorilla/websocket"
+	"github.com/pashagolub/pgxmock/v3"
+)
+
+var snapshotCols = []string{"id", "user_id", "username", "status", "point_id", "lat", "lng", "elevation_m", "recorded_at", "speed_mps", "accuracy_m", "battery_pct"}
+
+func expectTripMember(mock pgxmock.PgxPoolIface, userID string, member bool) {
+	mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM trip_members WHERE trip_id=\$1 AND user_id::text=\$2\)`).
+		WithArgs("trip-1", userID).
+		WillReturnRows(pgxmock.NewRows([]string{"exists"}).AddRow(member))
+}
+
+func TestTripSnapshot(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	pointID := int64(42)
+	battery := 15
+	mock.ExpectQuery(`FROM track_sessions ts LEFT JOIN users u .* LEFT JOIN LATERAL .* WHERE ts.trip_id=\$1 AND ts.status IN \('active', 'paused'\)`).
+		WithArgs("trip-1", "").
+		WillReturnRows(pgxmock.NewRows(snapshotCols).
+			AddRow("session-1", "user-1", "ayu", StatusActive, &pointID, -7.94, 112.95, 2900.0, time.Now(), 0.8, 6.0, &battery).
+			AddRow("session-2", "user-2", "bima", StatusPaused, nil, 0.0, 0.0, 0.0, time.Now(), 0.0, 0.0, nil))
+
+	snapshot, err := NewService(mock, nil).TripSnapshot(context.Background(), "trip-1", "")
+	if err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	if snapshot.Type != EventSnapshot || len(snapshot.Members) != 2 {
+		t.Fatalf("unexpected snapshot %+v", snapshot)
+	}
+	first, second := snapshot.Members[0], snapshot.Members[1]
+	if first.Username != "ayu" || first.Point == nil || first.Point.ID != 42 || first.Point.SessionID != "session-1" || first.Point.Lat != -7.94 || !first.LowBattery {
+		t.Fatalf("unexpected first member %+v", first)
+	}
+	if second.UserID != "user-2" || second.Status != StatusPaused || second.Point != nil || second.LowBattery {
+		t.Fatalf("expected second member without a point, got %+v", second)
+	}
+}
+
+func TestAddPointBroadcastsToTrip(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	hub := stream.NewHub(nil)
+	client := hub.Register(TripChannel("trip-1"))
+	defer hub.Unregister(client)
+
+	expectPointLookups(mock, "session-1", nil, nil)
+	mock.ExpectQuery(`INSERT INTO track_points`).
+		WithArgs("session-1", 112.95, -7.94, 0.0, pgxmock.AnyArg(), 0.0, "", 0.0, 0, 0, (*float64)(nil), 0.0, (*int)(nil)).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "created_at"}).AddRow(int64(7), time.Now()))
+	mock.ExpectCommit()
+
+	if _, err := NewService(mock, hub).AddPoint(context.Background(), "session-1", TrackPoint{Lat: -7.94, Lng: 112.95}); err != nil {
+		t.Fatalf("add point: %v", err)
+	}
+
+	select {
+	case msg := <-client.Send:
+		var event TripEvent
+		if err := json.Unmarshal(msg, &event); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if event.Type != EventPosition || event.Member == nil || event.Member.UserID != "user-1" ||
+			event.Member.SessionID != "session-1" || event.Member.Point == nil || event.Member.Point.ID != 7 {
+			t.Fatalf("unexpected trip event %s", msg)
+		}
+	case <-time.After(100 * time.Millisecond):
+		t.Fatalf("expected trip broadcast")
+	}
+}
+
+// expectSessionMember answers checkSessionMember for session-1.
+func expectSessionMember(mock pgxmock.PgxPoolIface, userID string, member bool) {
+	mock.ExpectQuery(`FROM track_sessions ts WHERE ts.id=\$1`).
+		WithArgs("session-1", userID).
+		WillReturnRows(pgxmock.NewRows([]string{"member"}).AddRow(member))
+}
+
+func TestTripStreamRejectsNonMembers(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	expectTripMember(mock, "user-9", false)
+
+	app := fiber.New()
+	RegisterStreamRoutes(app.Group("/stream"), NewService(mock, stream.NewHub(nil)), func(c *fiber.Ctx) error {
+		c.Locals("user_id", "user-9")
+		return c.Next()
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/stream/ws/trips/trip-1", nil)
+	resp, err := app.Test(req)
+	if err != nil || resp.StatusCode != http.StatusUpgradeRequired {
+		t.Fatalf("expected 426 without upgrade, got %v %v", resp.StatusCode, err)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/stream/ws/trips/trip-1", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	resp, err = app.Test(req)
+	if err != nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403, got %v %v", resp.StatusCode, err)
+	}
+}
+
+func TestTripStreamSnapshotThenPositions(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	expectTripMember(mock, "user-1", true)
+	mock.ExpectQuery(`WHERE ts.trip_id=\$1`).
+		WithArgs("trip-1", "user-1").
+		WillReturnRows(pgxmock.NewRows(snapshotCols).
+			AddRow("session-1", "user-1", "ayu", StatusActive, nil, 0.0, 0.0, 0.0, time.Now(), 0.0, 0.0, nil))
+
+	hub := stream.NewHub(nil)
+	svc := NewService(mock, hub)
+	app := fiber.New()
+	RegisterStreamRoutes(app.Group("/stream"), svc, func(c *fiber.Ctx) error {
+		c.Locals("user_id", "user-1")
+		return c.Next()
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen error: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		_ = app.Listener(ln)
+	}()
+	defer func() { _ = app.Shutdown() }()
+
+	conn, _, err := gws.DefaultDialer.Dial("ws://"+ln.Addr().String()+"/stream/ws/trips/trip-1", nil)
+	if err != nil {
+		t.Fatalf("dial error: %v", err)
+	}
+	defer conn.Close()
+
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	var snapshot TripEvent
+	if err := conn.ReadJSON(&snapshot); err != nil {
+		t.Fatalf("read snapshot: %v", err)
+	}
+	if snapshot.Type != EventSnapshot || len(snapshot.Members) != 1 || snapshot.Members[0].Username != "ayu" {
+		t.Fatalf("unexpected snapshot %+v", snapshot)
+	}
+
+	svc.broadcastPoint(Session{ID: "session-1", TripID: "trip-1", UserID: "user-1", Status: StatusActive}, TrackPoint{ID: 8, Lat: -7.9})
+	var event TripEvent
+	if err := conn.ReadJSON(&event); err != nil {
+		t.Fatalf("read position: %v", err)
+	}
+	if event.Type != EventPosition || event.Member.UserID != "user-1" || event.Member.Point.ID != 8 {
+		t.Fatalf("unexpected position %+v", event)
+	}
+}
+
+func TestTripChannelNotReachableThroughPublicStream(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	hub := stream.NewHub(nil)
+	svc := NewService(mock, hub)
+	app := fiber.New()
+	stream.RegisterRoutes(app.Group("/stream"), hub)
+	RegisterStreamRoutes(app.Group("/stream"), svc, func(c *fiber.Ctx) error { return c.Next() })
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen error: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		_ = app.Listener(ln)
+	}()
+	defer func() { _ = app.Shutdown() }()
+
+	conn, resp, err := gws.DefaultDialer.Dial("ws://"+ln.Addr().String()+"/stream/ws/"+TripChannel("trip-1"), nil)
+	if err == nil {
+		defer conn.Close()
+		svc.broadcastPoint(Session{ID: "session-1", TripID: "trip-1", UserID: "user-1", Status: StatusActive}, TrackPoint{ID: 8, Lat: -7.9})
+		_ = conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		if _, msg, err := conn.ReadMessage(); err == nil {
+			t.Fatalf("public stream delivered trip position %s", msg)
+		}
+		t.Fatalf("expected the public stream to refuse the trip channel")
+	}
+	if resp == nil || resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 for trip channel, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
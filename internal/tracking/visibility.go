@@ -0,0 +1,100 @@
+package tracking
+
+import (
+	"context"
+	"errors"
+
+	"backend-summithub/internal/db"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	VisibilityPublic    = "public"
+	VisibilityFollowers = "followers"
+	VisibilityPrivate   = "private"
+)
+
+var ErrInvalidVisibility = errors.New("visibility must be public, followers or private")
+
+func validVisibility(v string) bool {
+	return v == VisibilityPublic || v == VisibilityFollowers || v == VisibilityPrivate
+}
+
+// ViewableSQL is an SQL condition that holds when viewer, a text expression
+// such as a query parameter, may read session, an alias of track_sessions:
+// anyone when it is public, the hiker's followers when it is for followers,
+// and always the hiker and the members of their trip, who watch over them.
+// Queries returning other users' sessions, or figures derived from them,
+// filter with it.
+func ViewableSQL(session, viewer string) string {
+	return `(` + session + `.visibility = 'public'
+		OR COALESCE(` + session + `.user_id::text = ` + viewer + `, false)
+		OR (` + session + `.visibility = 'followers' AND EXISTS (
+		    SELECT 1 FROM user_follows f WHERE f.following_id = ` + session + `.user_id AND f.follower_id::text = ` + viewer + `))
+		OR EXISTS (SELECT 1 FROM trip_members tm WHERE tm.trip_id = ` + session + `.trip_id AND tm.user_id::text = ` + viewer + `)
+		OR EXISTS (SELECT 1 FROM trips t WHERE t.id = ` + session + `.trip_id AND t.created_by::text = ` + viewer + `))`
+}
+
+// checkViewer allows viewerID to read the session's track under ViewableSQL
+// and returns the hiker. A session viewerID may not read is reported as not
+// found, so private sessions cannot be told from missing ones.
+func checkViewer(ctx context.Context, q db.Querier, sessionID, viewerID string) (string, error) {
+	var ownerID string
+	var allowed bool
+	err := q.QueryRow(ctx, `
+		SELECT COALESCE(ts.user_id::text,''), `+ViewableSQL("ts", "$2")+`
+		FROM track_sessions ts WHERE ts.id=$1
+	`, sessionID, viewerID).Scan(&ownerID, &allowed)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && !allowed) {
+		return "", ErrSessionNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return ownerID, nil
+}
+
+// CanView reports whether viewerID may watch the session live or replay it.
+func (s *Service) CanView(ctx context.Context, sessionID, viewerID string) (bool, error) {
+	_, err := checkViewer(ctx, s.db, sessionID, viewerID)
+	if errors.Is(err, ErrSessionNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// VisibilityListener is told when a session's visibility changes, after the
+// change is committed.
+type VisibilityListener interface {
+	VisibilityChanged(ctx context.Context, session Session)
+}
+
+// AddVisibilityListener registers l for every visibility change from now on.
+func (s *Service) AddVisibilityListener(l VisibilityListener) {
+	s.visibilityListeners = append(s.visibilityListeners, l)
+}
+
+// SetVisibility changes who may see a session. Only the session's owner may
+// change it; other users get ErrSessionNotFound.
+func (s *Service) SetVisibility(ctx context.Context, sessionID, userID, visibility string) (Session, error) {
+	if !validVisibility(visibility) {
+		return Session{}, ErrInvalidVisibility
+	}
+	session := Session{ID: sessionID, UserID: userID}
+	err := s.db.QueryRow(ctx, `
+		UPDATE track_sessions SET visibility=$3
+		WHERE id=$1 AND user_id::text=$2
+		RETURNING COALESCE(trip_id::text,''), started_at, COALESCE(ended_at, started_at), status, visibility
+	`, sessionID, userID, visibility).Scan(&session.TripID, &session.StartedAt, &session.EndedAt, &session.Status, &session.Visibility)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Session{}, ErrSessionNotFound
+	}
+	if err != nil {
+		return Session{}, err
+	}
+	for _, l := range s.visibilityListeners {
+		l.VisibilityChanged(ctx, session)
+	}
+	return session, nil
+}
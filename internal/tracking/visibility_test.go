@@ -0,0 +1,160 @@
+package tracking
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v3"
+)
+
+type visibilityListener struct {
+	changed []Session
+}
+
+func (l *visibilityListener) VisibilityChanged(_ context.Context, session Session) {
+	l.changed = append(l.changed, session)
+}
+
+func TestSetVisibility(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	now := time.Now()
+	mock.ExpectQuery(`UPDATE track_sessions SET visibility=\$3\s+WHERE id=\$1 AND user_id::text=\$2`).
+		WithArgs("session-1", "user-1", VisibilityPrivate).
+		WillReturnRows(pgxmock.NewRows([]string{"trip_id", "started_at", "ended_at", "status", "visibility"}).
+			AddRow("trip-1", now, now, StatusEnded, VisibilityPrivate))
+	mock.ExpectQuery(`UPDATE track_sessions SET visibility`).
+		WithArgs("session-1", "user-2", VisibilityPublic).
+		WillReturnError(pgx.ErrNoRows)
+
+	svc := NewService(mock, nil)
+	listener := &visibilityListener{}
+	svc.AddVisibilityListener(listener)
+
+	session, err := svc.SetVisibility(context.Background(), "session-1", "user-1", VisibilityPrivate)
+	if err != nil || session.Visibility != VisibilityPrivate || session.TripID != "trip-1" {
+		t.Fatalf("unexpected session %+v %v", session, err)
+	}
+	if len(listener.changed) != 1 || listener.changed[0].ID != "session-1" {
+		t.Fatalf("expected one visibility change, got %+v", listener.changed)
+	}
+	if _, err := svc.SetVisibility(context.Background(), "session-1", "user-2", VisibilityPublic); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("expected ErrSessionNotFound for another user, got %v", err)
+	}
+	if _, err := svc.SetVisibility(context.Background(), "session-1", "user-1", "friends"); !errors.Is(err, ErrInvalidVisibility) {
+		t.Fatalf("expected ErrInvalidVisibility, got %v", err)
+	}
+	if _, err := svc.StartSession(context.Background(), Session{TripID: "trip-1", UserID: "user-1", Visibility: "friends"}); !errors.Is(err, ErrInvalidVisibility) {
+		t.Fatalf("expected StartSession to reject the visibility, got %v", err)
+	}
+	if len(listener.changed) != 1 {
+		t.Fatalf("failed changes must not notify, got %+v", listener.changed)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
+
+func TestVisibilityHandler(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	now := time.Now()
+	mock.ExpectQuery(`UPDATE track_sessions SET visibility`).
+		WithArgs("session-1", "user-1", VisibilityFollowers).
+		WillReturnRows(pgxmock.NewRows([]string{"trip_id", "started_at", "ended_at", "status", "visibility"}).
+			AddRow("trip-1", now, now, StatusActive, VisibilityFollowers))
+	mock.ExpectQuery(`UPDATE track_sessions SET visibility`).
+		WithArgs("session-9", "user-1", VisibilityPublic).
+		WillReturnError(pgx.ErrNoRows)
+
+	app := fiber.New()
+	RegisterRoutes(app.Group("/tracking"), NewService(mock, nil), func(c *fiber.Ctx) error {
+		c.Locals("user_id", "user-1")
+		return c.Next()
+	})
+
+	for _, tc := range []struct {
+		session, body string
+		status        int
+	}{
+		{"session-1", `{"visibility":"followers"}`, http.StatusOK},
+		{"session-9", `{"visibility":"public"}`, http.StatusNotFound},
+		{"session-1", `{"visibility":"everyone"}`, http.StatusBadRequest},
+	} {
+		req := httptest.NewRequest(http.MethodPut, "/tracking/sessions/"+tc.session+"/visibility", bytes.NewReader([]byte(tc.body)))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil || resp.StatusCode != tc.status {
+			t.Fatalf("%s %s: expected %d, got %v %v", tc.session, tc.body, tc.status, resp.StatusCode, err)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
+
+// expectViewer expects the visibility check of sessionID for viewerID,
+// reading the session as ownerID's.
+func expectViewer(mock pgxmock.PgxPoolIface, sessionID, viewerID, ownerID string, allowed bool) {
+	mock.ExpectQuery(`ts.visibility = 'public'`).
+		WithArgs(sessionID, viewerID).
+		WillReturnRows(pgxmock.NewRows([]string{"user_id", "allowed"}).AddRow(ownerID, allowed))
+}
+
+func TestSessionReadsEnforceVisibility(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	svc := NewService(mock, nil)
+	app := fiber.New()
+	RegisterRoutes(app.Group("/tracking"), svc, func(c *fiber.Ctx) error { return c.Next() })
+
+	// An anonymous caller is turned away from a private session on every
+	// read, as if it did not exist.
+	for _, path := range []string{"/points", "/points?format=polyline", "/export", "/summary"} {
+		expectViewer(mock, "session-1", "", "user-1", false)
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/tracking/sessions/session-1"+path, nil))
+		if err != nil || resp.StatusCode != http.StatusNotFound {
+			t.Fatalf("%s: expected 404, got %v %v", path, resp.StatusCode, err)
+		}
+	}
+	mock.ExpectQuery(`ts.visibility = 'public'`).
+		WithArgs("session-missing", "").
+		WillReturnError(pgx.ErrNoRows)
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/tracking/sessions/session-missing/points", nil))
+	if err != nil || resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("missing session: expected 404, got %v %v", resp.StatusCode, err)
+	}
+
+	for _, viewer := range []string{"", "user-2"} {
+		expectViewer(mock, "session-1", viewer, "user-1", false)
+		if ok, err := svc.CanView(context.Background(), "session-1", viewer); ok || err != nil {
+			t.Fatalf("%q: expected the stream refused, got %v %v", viewer, ok, err)
+		}
+	}
+	expectViewer(mock, "session-1", "user-3", "user-1", true)
+	if ok, err := svc.CanView(context.Background(), "session-1", "user-3"); !ok || err != nil {
+		t.Fatalf("expected an allowed viewer to watch, got %v %v", ok, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
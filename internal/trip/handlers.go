@@ -1,6 +1,12 @@
 package trip
 
-import "github.com/gofiber/fiber/v2"
+import (
+	"errors"
+
+	"backend-summithub/internal/notice"
+
+	"github.com/gofiber/fiber/v2"
+)
 
 func RegisterRoutes(r fiber.Router, svc *Service, authMiddleware fiber.Handler) {
 	r.Post("/", authMiddleware, func(c *fiber.Ctx) error {
@@ -12,6 +18,9 @@ func RegisterRoutes(r fiber.Router, svc *Service, authMiddleware fiber.Handler)
 			return fiber.NewError(fiber.StatusBadRequest, "name and created_by required")
 		}
 		trip, err := svc.CreateTrip(c.Context(), req)
+		if errors.Is(err, notice.ErrAreaClosed) {
+			return fiber.NewError(fiber.StatusConflict, err.Error())
+		}
 		if err != nil {
 			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
 		}
@@ -32,6 +41,9 @@ func RegisterRoutes(r fiber.Router, svc *Service, authMiddleware fiber.Handler)
 			return fiber.NewError(fiber.StatusBadRequest, err.Error())
 		}
 		trip, err := svc.UpdateTrip(c.Context(), c.Params("id"), req)
+		if errors.Is(err, notice.ErrAreaClosed) {
+			return fiber.NewError(fiber.StatusConflict, err.Error())
+		}
 		if err != nil {
 			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
 		}
@@ -102,4 +114,16 @@ func RegisterRoutes(r fiber.Router, svc *Service, authMiddleware fiber.Handler)
 		}
 		return c.JSON(routes)
 	})
+
+	r.Get("/:id/timeline", func(c *fiber.Ctx) error {
+		viewerID, _ := c.Locals("user_id").(string)
+		timeline, err := svc.Timeline(c.Context(), c.Params("id"), viewerID, c.Query("cursor"), c.QueryInt("limit"))
+		if errors.Is(err, ErrInvalidCursor) {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		}
+		return c.JSON(timeline)
+	})
 }
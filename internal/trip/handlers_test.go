@@ -20,14 +20,18 @@ func TestTripHandlersCreateGetMember(t *testing.T) {
 	defer mock.Close()
 
 	createdAt := time.Now()
+	mock.ExpectQuery(`FROM area_notices`).
+		WithArgs("", "Mt", pgxmock.AnyArg(), pgxmock.AnyArg()).
+		WillReturnRows(pgxmock.NewRows(noticeCols))
+
 	mock.ExpectQuery(`INSERT INTO trips`).
-		WithArgs(pgxmock.AnyArg(), "Trip A", "Mt", pgxmock.AnyArg(), pgxmock.AnyArg(), "desc", "user-1").
-		WillReturnRows(pgxmock.NewRows([]string{"created_at"}).AddRow(createdAt))
+		WithArgs(pgxmock.AnyArg(), "Trip A", "Mt", pgxmock.AnyArg(), pgxmock.AnyArg(), "desc", "user-1", "").
+		WillReturnRows(pgxmock.NewRows([]string{"mountain_name", "mountain_id", "created_at"}).AddRow("Mt", "", createdAt))
 
 	mock.ExpectQuery(`SELECT id, name, mountain_name, start_date, end_date, description, created_by, created_at`).
 		WithArgs(pgxmock.AnyArg()).
-		WillReturnRows(pgxmock.NewRows([]string{"id", "name", "mountain_name", "start_date", "end_date", "description", "created_by", "created_at"}).
-			AddRow("trip-1", "Trip A", "Mt", time.Now(), time.Now(), "desc", "user-1", createdAt))
+		WillReturnRows(pgxmock.NewRows([]string{"id", "name", "mountain_name", "start_date", "end_date", "description", "created_by", "created_at", "mountain_id"}).
+			AddRow("trip-1", "Trip A", "Mt", time.Now(), time.Now(), "desc", "user-1", createdAt, ""))
 
 	mock.ExpectQuery(`INSERT INTO trip_members`).
 		WithArgs("trip-1", "user-2", "member").
@@ -98,12 +102,12 @@ func TestTripHandlersUpdateDeleteMembersRoutes(t *testing.T) {
 
 	mock.ExpectQuery(`SELECT id, name, mountain_name, start_date, end_date, description, created_by, created_at`).
 		WithArgs("trip-1").
-		WillReturnRows(pgxmock.NewRows([]string{"id", "name", "mountain_name", "start_date", "end_date", "description", "created_by", "created_at"}).
-			AddRow("trip-1", "Trip", "Mt", start, end, "desc", "user-1", time.Now()))
+		WillReturnRows(pgxmock.NewRows([]string{"id", "name", "mountain_name", "start_date", "end_date", "description", "created_by", "created_at", "mountain_id"}).
+			AddRow("trip-1", "Trip", "Mt", start, end, "desc", "user-1", time.Now(), ""))
 
-	mock.ExpectExec(`UPDATE trips`).
-		WithArgs("trip-1", "Trip Updated", "Mt", pgxmock.AnyArg(), pgxmock.AnyArg(), "desc").
-		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectQuery(`UPDATE trips`).
+		WithArgs("trip-1", "Trip Updated", "Mt", pgxmock.AnyArg(), pgxmock.AnyArg(), "desc", "").
+		WillReturnRows(pgxmock.NewRows([]string{"mountain_name", "mountain_id"}).AddRow("Mt", ""))
 
 	updateBody, _ := json.Marshal(Trip{Name: "Trip Updated"})
 	req := httptest.NewRequest(http.MethodPut, "/trips/trip-1", bytes.NewReader(updateBody))
@@ -188,8 +192,12 @@ func TestTripHandlersCreateError(t *testing.T) {
 	}
 	defer mock.Close()
 
+	mock.ExpectQuery(`FROM area_notices`).
+		WithArgs("", "Mt", pgxmock.AnyArg(), pgxmock.AnyArg()).
+		WillReturnRows(pgxmock.NewRows(noticeCols))
+
 	mock.ExpectQuery(`INSERT INTO trips`).
-		WithArgs(pgxmock.AnyArg(), "Trip A", "Mt", pgxmock.AnyArg(), pgxmock.AnyArg(), "desc", "user-1").
+		WithArgs(pgxmock.AnyArg(), "Trip A", "Mt", pgxmock.AnyArg(), pgxmock.AnyArg(), "desc", "user-1", "").
 		WillReturnError(errQuery)
 
 	app := fiber.New()
@@ -369,3 +377,27 @@ func TestTripHandlersRouteCreateError(t *testing.T) {
 		t.Fatalf("expected route error")
 	}
 }
+
+func TestTripHandlersCreateClosedArea(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	mock.ExpectQuery(`FROM area_notices`).
+		WithArgs("", "Semeru", pgxmock.AnyArg(), pgxmock.AnyArg()).
+		WillReturnRows(pgxmock.NewRows(noticeCols).
+			AddRow("notice-1", "mountain-1", "", "closed", "eruption", time.Now(), nil, "ranger", time.Now()))
+
+	app := fiber.New()
+	RegisterRoutes(app.Group("/trips"), NewService(mock), func(c *fiber.Ctx) error { return c.Next() })
+
+	body, _ := json.Marshal(Trip{Name: "Trip", Mountain: "Semeru", CreatedBy: "user-1"})
+	req := httptest.NewRequest(http.MethodPost, "/trips/", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	if err != nil || resp.StatusCode != http.StatusConflict {
+		t.Fatalf("expected conflict for closed area")
+	}
+}
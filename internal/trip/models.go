@@ -1,16 +1,23 @@
 package trip
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+
+	"backend-summithub/internal/notice"
+)
 
 type Trip struct {
 	ID        string    `json:"id"`
 	Name      string    `json:"name"`
 	Mountain  string    `json:"mountain_name"`
+	MountainID string   `json:"mountain_id"`
 	StartDate time.Time `json:"start_date"`
 	EndDate   time.Time `json:"end_date"`
 	Description string  `json:"description"`
 	CreatedBy string    `json:"created_by"`
 	CreatedAt time.Time `json:"created_at"`
+	Notices   []notice.Notice `json:"notices,omitempty"`
 }
 
 type TripMember struct {
@@ -31,3 +38,28 @@ type GPXRoute struct {
 	UploadedBy string    `json:"uploaded_by"`
 	CreatedAt  time.Time `json:"created_at"`
 }
+
+// TimelineEntry is one typed event on a trip's timeline. Data carries the
+// fields specific to the entry type.
+type TimelineEntry struct {
+	Type       string          `json:"type"`
+	RefID      string          `json:"ref_id"`
+	UserID     string          `json:"user_id,omitempty"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Data       json.RawMessage `json:"data"`
+}
+
+type Timeline struct {
+	Entries    []TimelineEntry `json:"entries"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+const (
+	TimelineSessionStarted  = "session_started"
+	TimelineSessionEnded    = "session_ended"
+	TimelineMemberJoined    = "member_joined"
+	TimelineRouteUploaded   = "route_uploaded"
+	TimelinePhotoTaken      = "photo_taken"
+	TimelinePostCreated     = "post_created"
+	TimelineWaypointVisited = "waypoint_visited"
+)
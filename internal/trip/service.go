@@ -5,28 +5,39 @@ import (
 	"time"
 
 	"backend-summithub/internal/db"
+	"backend-summithub/internal/notice"
 
 	"github.com/google/uuid"
 )
 
 type Service struct {
-	db db.Querier
+	db      db.Querier
+	notices *notice.Service
 }
 
 func NewService(db db.Querier) *Service {
-	return &Service{db: db}
+	return &Service{db: db, notices: notice.NewService(db)}
 }
 
 func (s *Service) CreateTrip(ctx context.Context, input Trip) (Trip, error) {
+	notices, err := s.checkArea(ctx, input)
+	if err != nil {
+		return Trip{}, err
+	}
+
 	input.ID = uuid.NewString()
 	row := s.db.QueryRow(ctx, `
-		INSERT INTO trips (id, name, mountain_name, start_date, end_date, description, created_by)
-		VALUES ($1,$2,$3,$4,$5,$6,$7)
-		RETURNING created_at
-	`, input.ID, input.Name, input.Mountain, timePtr(input.StartDate), timePtr(input.EndDate), input.Description, input.CreatedBy)
-	if err := row.Scan(&input.CreatedAt); err != nil {
+		INSERT INTO trips (id, name, mountain_name, start_date, end_date, description, created_by, mountain_id)
+		VALUES ($1,$2,
+		        COALESCE(NULLIF($3,''), (SELECT name FROM mountains WHERE id = NULLIF($8,'')::uuid)),
+		        $4,$5,$6,$7,
+		        COALESCE(NULLIF($8,'')::uuid, resolve_mountain_id($3)))
+		RETURNING COALESCE(mountain_name,''), COALESCE(mountain_id::text,''), created_at
+	`, input.ID, input.Name, input.Mountain, timePtr(input.StartDate), timePtr(input.EndDate), input.Description, input.CreatedBy, input.MountainID)
+	if err := row.Scan(&input.Mountain, &input.MountainID, &input.CreatedAt); err != nil {
 		return Trip{}, err
 	}
+	input.Notices = notices
 	return input, nil
 }
 
@@ -38,8 +49,13 @@ func (s *Service) UpdateTrip(ctx context.Context, id string, patch Trip) (Trip,
 	if patch.Name != "" {
 		trip.Name = patch.Name
 	}
-	if patch.Mountain != "" {
+	if patch.MountainID != "" {
+		trip.MountainID = patch.MountainID
+		trip.Mountain = patch.Mountain
+	} else if patch.Mountain != "" {
+		// A new free-text name is re-resolved against the mountain catalog.
 		trip.Mountain = patch.Mountain
+		trip.MountainID = ""
 	}
 	if !patch.StartDate.IsZero() {
 		trip.StartDate = patch.StartDate
@@ -51,12 +67,22 @@ func (s *Service) UpdateTrip(ctx context.Context, id string, patch Trip) (Trip,
 		trip.Description = patch.Description
 	}
 
-	_, err = s.db.Exec(ctx, `
+	if patch.MountainID != "" || patch.Mountain != "" || !patch.StartDate.IsZero() || !patch.EndDate.IsZero() {
+		if trip.Notices, err = s.checkArea(ctx, trip); err != nil {
+			return Trip{}, err
+		}
+	}
+
+	row := s.db.QueryRow(ctx, `
 		UPDATE trips
-		SET name=$2, mountain_name=$3, start_date=$4, end_date=$5, description=$6
+		SET name=$2,
+		    mountain_name=COALESCE(NULLIF($3,''), (SELECT name FROM mountains WHERE id = NULLIF($7,'')::uuid)),
+		    start_date=$4, end_date=$5, description=$6,
+		    mountain_id=COALESCE(NULLIF($7,'')::uuid, resolve_mountain_id($3))
 		WHERE id=$1
-	`, trip.ID, trip.Name, trip.Mountain, timePtr(trip.StartDate), timePtr(trip.EndDate), trip.Description)
-	if err != nil {
+		RETURNING COALESCE(mountain_name,''), COALESCE(mountain_id::text,'')
+	`, trip.ID, trip.Name, trip.Mountain, timePtr(trip.StartDate), timePtr(trip.EndDate), trip.Description, trip.MountainID)
+	if err := row.Scan(&trip.Mountain, &trip.MountainID); err != nil {
 		return Trip{}, err
 	}
 	return trip, nil
@@ -64,11 +90,11 @@ func (s *Service) UpdateTrip(ctx context.Context, id string, patch Trip) (Trip,
 
 func (s *Service) GetTrip(ctx context.Context, id string) (Trip, error) {
 	row := s.db.QueryRow(ctx, `
-		SELECT id, name, mountain_name, start_date, end_date, description, created_by, created_at
+		SELECT id, name, mountain_name, start_date, end_date, description, created_by, created_at, COALESCE(mountain_id::text,'')
 		FROM trips WHERE id=$1
 	`, id)
 	var trip Trip
-	if err := row.Scan(&trip.ID, &trip.Name, &trip.Mountain, &trip.StartDate, &trip.EndDate, &trip.Description, &trip.CreatedBy, &trip.CreatedAt); err != nil {
+	if err := row.Scan(&trip.ID, &trip.Name, &trip.Mountain, &trip.StartDate, &trip.EndDate, &trip.Description, &trip.CreatedBy, &trip.CreatedAt, &trip.MountainID); err != nil {
 		return Trip{}, err
 	}
 	return trip, nil
@@ -155,6 +181,35 @@ func (s *Service) Routes(ctx context.Context, tripID string) ([]GPXRoute, error)
 	return routes, nil
 }
 
+// checkArea loads the status notices covering the trip's mountain and dates,
+// refusing trips into a closed area.
+func (s *Service) checkArea(ctx context.Context, trip Trip) ([]notice.Notice, error) {
+	if trip.MountainID == "" && trip.Mountain == "" {
+		return nil, nil
+	}
+	from, to := tripWindow(trip.StartDate, trip.EndDate)
+	notices, err := s.notices.ForMountain(ctx, trip.MountainID, trip.Mountain, from, to)
+	if err != nil {
+		return nil, err
+	}
+	if err := notice.Check(notices); err != nil {
+		return nil, err
+	}
+	return notices, nil
+}
+
+// tripWindow returns the period a trip spends on the mountain. Trips without
+// dates are treated as starting now; the end date is inclusive.
+func tripWindow(start, end time.Time) (time.Time, time.Time) {
+	if start.IsZero() {
+		start = time.Now()
+	}
+	if end.Before(start) {
+		end = start
+	}
+	return start, end.Add(24 * time.Hour)
+}
+
 func timePtr(t time.Time) *time.Time {
 	if t.IsZero() {
 		return nil
@@ -6,6 +6,8 @@ import (
 	"testing"
 	"time"
 
+	"backend-summithub/internal/notice"
+
 	"github.com/pashagolub/pgxmock/v3"
 )
 
@@ -18,9 +20,13 @@ func TestCreateAndGetTrip(t *testing.T) {
 
 	createdAt := time.Now()
 
+	mock.ExpectQuery(`FROM area_notices`).
+		WithArgs("", "Mountain", pgxmock.AnyArg(), pgxmock.AnyArg()).
+		WillReturnRows(pgxmock.NewRows(noticeCols))
+
 	mock.ExpectQuery(`INSERT INTO trips`).
-		WithArgs(pgxmock.AnyArg(), "Trip A", "Mountain", pgxmock.AnyArg(), pgxmock.AnyArg(), "desc", "user-1").
-		WillReturnRows(pgxmock.NewRows([]string{"created_at"}).AddRow(createdAt))
+		WithArgs(pgxmock.AnyArg(), "Trip A", "Mountain", pgxmock.AnyArg(), pgxmock.AnyArg(), "desc", "user-1", "").
+		WillReturnRows(pgxmock.NewRows([]string{"mountain_name", "mountain_id", "created_at"}).AddRow("Mountain", "", createdAt))
 
 	svc := NewService(mock)
 	trip, err := svc.CreateTrip(context.Background(), Trip{
@@ -37,8 +43,8 @@ func TestCreateAndGetTrip(t *testing.T) {
 
 	mock.ExpectQuery(`SELECT id, name, mountain_name, start_date, end_date, description, created_by, created_at`).
 		WithArgs(trip.ID).
-		WillReturnRows(pgxmock.NewRows([]string{"id", "name", "mountain_name", "start_date", "end_date", "description", "created_by", "created_at"}).
-			AddRow(trip.ID, trip.Name, trip.Mountain, trip.StartDate, trip.EndDate, trip.Description, trip.CreatedBy, trip.CreatedAt))
+		WillReturnRows(pgxmock.NewRows([]string{"id", "name", "mountain_name", "start_date", "end_date", "description", "created_by", "created_at", "mountain_id"}).
+			AddRow(trip.ID, trip.Name, trip.Mountain, trip.StartDate, trip.EndDate, trip.Description, trip.CreatedBy, trip.CreatedAt, ""))
 
 	loaded, err := svc.GetTrip(context.Background(), trip.ID)
 	if err != nil {
@@ -64,12 +70,12 @@ func TestUpdateDeleteMembersRoutes(t *testing.T) {
 
 	mock.ExpectQuery(`SELECT id, name, mountain_name, start_date, end_date, description, created_by, created_at`).
 		WithArgs("trip-1").
-		WillReturnRows(pgxmock.NewRows([]string{"id", "name", "mountain_name", "start_date", "end_date", "description", "created_by", "created_at"}).
-			AddRow("trip-1", "Trip", "Mt", time.Now(), time.Now(), "desc", "user-1", time.Now()))
+		WillReturnRows(pgxmock.NewRows([]string{"id", "name", "mountain_name", "start_date", "end_date", "description", "created_by", "created_at", "mountain_id"}).
+			AddRow("trip-1", "Trip", "Mt", time.Now(), time.Now(), "desc", "user-1", time.Now(), ""))
 
-	mock.ExpectExec(`UPDATE trips`).
-		WithArgs("trip-1", "Trip2", "Mt", pgxmock.AnyArg(), pgxmock.AnyArg(), "desc").
-		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectQuery(`UPDATE trips`).
+		WithArgs("trip-1", "Trip2", "Mt", pgxmock.AnyArg(), pgxmock.AnyArg(), "desc", "").
+		WillReturnRows(pgxmock.NewRows([]string{"mountain_name", "mountain_id"}).AddRow("Mt", ""))
 
 	updated, err := svc.UpdateTrip(context.Background(), "trip-1", Trip{Name: "Trip2"})
 	if err != nil {
@@ -163,11 +169,11 @@ func TestUpdateTripExecError(t *testing.T) {
 
 	mock.ExpectQuery(`SELECT id, name, mountain_name, start_date, end_date, description, created_by, created_at`).
 		WithArgs("trip-err").
-		WillReturnRows(pgxmock.NewRows([]string{"id", "name", "mountain_name", "start_date", "end_date", "description", "created_by", "created_at"}).
-			AddRow("trip-err", "Trip", "Mt", start, end, "desc", "user-1", time.Now()))
+		WillReturnRows(pgxmock.NewRows([]string{"id", "name", "mountain_name", "start_date", "end_date", "description", "created_by", "created_at", "mountain_id"}).
+			AddRow("trip-err", "Trip", "Mt", start, end, "desc", "user-1", time.Now(), ""))
 
-	mock.ExpectExec(`UPDATE trips`).
-		WithArgs("trip-err", "Trip", "Mt", pgxmock.AnyArg(), pgxmock.AnyArg(), "desc").
+	mock.ExpectQuery(`UPDATE trips`).
+		WithArgs("trip-err", "Trip", "Mt", pgxmock.AnyArg(), pgxmock.AnyArg(), "desc", "").
 		WillReturnError(errQuery)
 
 	svc := NewService(mock)
@@ -191,12 +197,16 @@ func TestUpdateTripPatchFields(t *testing.T) {
 
 	mock.ExpectQuery(`SELECT id, name, mountain_name, start_date, end_date, description, created_by, created_at`).
 		WithArgs("trip-2").
-		WillReturnRows(pgxmock.NewRows([]string{"id", "name", "mountain_name", "start_date", "end_date", "description", "created_by", "created_at"}).
-			AddRow("trip-2", "Trip", "Mt", start, end, "desc", "user-1", time.Now()))
+		WillReturnRows(pgxmock.NewRows([]string{"id", "name", "mountain_name", "start_date", "end_date", "description", "created_by", "created_at", "mountain_id"}).
+			AddRow("trip-2", "Trip", "Mt", start, end, "desc", "user-1", time.Now(), ""))
 
-	mock.ExpectExec(`UPDATE trips`).
-		WithArgs("trip-2", "Trip2", "Mt2", pgxmock.AnyArg(), pgxmock.AnyArg(), "desc2").
-		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectQuery(`FROM area_notices`).
+		WithArgs("", "Mt2", pgxmock.AnyArg(), pgxmock.AnyArg()).
+		WillReturnRows(pgxmock.NewRows(noticeCols))
+
+	mock.ExpectQuery(`UPDATE trips`).
+		WithArgs("trip-2", "Trip2", "Mt2", pgxmock.AnyArg(), pgxmock.AnyArg(), "desc2", "").
+		WillReturnRows(pgxmock.NewRows([]string{"mountain_name", "mountain_id"}).AddRow("Mt2", ""))
 
 	svc := NewService(mock)
 	updated, err := svc.UpdateTrip(context.Background(), "trip-2", Trip{
@@ -309,7 +319,7 @@ func TestCreateTripError(t *testing.T) {
 	defer mock.Close()
 
 	mock.ExpectQuery(`INSERT INTO trips`).
-		WithArgs(pgxmock.AnyArg(), "Trip", "", pgxmock.AnyArg(), pgxmock.AnyArg(), "", "user-1").
+		WithArgs(pgxmock.AnyArg(), "Trip", "", pgxmock.AnyArg(), pgxmock.AnyArg(), "", "user-1", "").
 		WillReturnError(errQuery)
 
 	svc := NewService(mock)
@@ -319,6 +329,31 @@ func TestCreateTripError(t *testing.T) {
 	}
 }
 
+func TestCreateTripByMountainID(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	mock.ExpectQuery(`FROM area_notices`).
+		WithArgs("mountain-1", "", pgxmock.AnyArg(), pgxmock.AnyArg()).
+		WillReturnRows(pgxmock.NewRows(noticeCols))
+
+	mock.ExpectQuery(`INSERT INTO trips .*resolve_mountain_id`).
+		WithArgs(pgxmock.AnyArg(), "Trip", "", pgxmock.AnyArg(), pgxmock.AnyArg(), "", "user-1", "mountain-1").
+		WillReturnRows(pgxmock.NewRows([]string{"mountain_name", "mountain_id", "created_at"}).AddRow("Semeru", "mountain-1", time.Now()))
+
+	svc := NewService(mock)
+	trip, err := svc.CreateTrip(context.Background(), Trip{Name: "Trip", CreatedBy: "user-1", MountainID: "mountain-1"})
+	if err != nil {
+		t.Fatalf("create trip: %v", err)
+	}
+	if trip.Mountain != "Semeru" || trip.MountainID != "mountain-1" {
+		t.Fatalf("expected mountain resolved from catalog")
+	}
+}
+
 func TestAddRouteError(t *testing.T) {
 	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
 	if err != nil {
@@ -356,3 +391,53 @@ func TestAddMemberError(t *testing.T) {
 }
 
 var errQuery = errors.New("query error")
+
+var noticeCols = []string{"id", "mountain_id", "area", "status", "reason", "starts_at", "ends_at", "created_by", "created_at"}
+
+func TestCreateTripRefusedInClosedArea(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	mock.ExpectQuery(`FROM area_notices`).
+		WithArgs("", "Semeru", pgxmock.AnyArg(), pgxmock.AnyArg()).
+		WillReturnRows(pgxmock.NewRows(noticeCols).
+			AddRow("notice-1", "mountain-1", "", "closed", "eruption", time.Now(), nil, "ranger", time.Now()))
+
+	svc := NewService(mock)
+	_, err = svc.CreateTrip(context.Background(), Trip{Name: "Trip", Mountain: "Semeru", CreatedBy: "user-1"})
+	if !errors.Is(err, notice.ErrAreaClosed) {
+		t.Fatalf("expected area closed error, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestCreateTripWarnsOnRestrictedArea(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	mock.ExpectQuery(`FROM area_notices`).
+		WithArgs("", "Semeru", pgxmock.AnyArg(), pgxmock.AnyArg()).
+		WillReturnRows(pgxmock.NewRows(noticeCols).
+			AddRow("notice-1", "mountain-1", "", "restricted", "Kalimati only", time.Now(), nil, "ranger", time.Now()))
+
+	mock.ExpectQuery(`INSERT INTO trips`).
+		WithArgs(pgxmock.AnyArg(), "Trip", "Semeru", pgxmock.AnyArg(), pgxmock.AnyArg(), "", "user-1", "").
+		WillReturnRows(pgxmock.NewRows([]string{"mountain_name", "mountain_id", "created_at"}).AddRow("Semeru", "mountain-1", time.Now()))
+
+	svc := NewService(mock)
+	trip, err := svc.CreateTrip(context.Background(), Trip{Name: "Trip", Mountain: "Semeru", CreatedBy: "user-1"})
+	if err != nil {
+		t.Fatalf("create trip: %v", err)
+	}
+	if len(trip.Notices) != 1 || trip.Notices[0].Status != notice.StatusRestricted {
+		t.Fatalf("expected restricted notice attached")
+	}
+}
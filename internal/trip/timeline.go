@@ -0,0 +1,163 @@
+package trip
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"backend-summithub/internal/privacy"
+)
+
+// ErrInvalidCursor is returned for timeline cursors that were not issued by Timeline.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+const (
+	defaultTimelinePageSize = 50
+	maxTimelinePageSize     = 200
+)
+
+// timelineQuery merges everything that happened on a trip into one stream.
+// Posts and photos have no trip reference, so they are matched by author
+// (trip members), place (the mountain's area) and time (the trip's dates);
+// only public posts are listed, as the timeline needs no login. Waypoint
+// visits come from trip_waypoint_visits, recorded as points arrive.
+// Photos, posts and visits place a member, so those inside the member's
+// privacy zones are left out for every viewer ($6) but that member, with
+// the condition privacy.QueryPositions passes as visible.
+// Entries are ordered by (occurred_at, type, ref_id), which is also the
+// keyset the cursor resumes from.
+func timelineQuery(visible func(location, owner string) string) string {
+	return `
+	WITH t AS (
+	    SELECT tr.id,
+	           COALESCE(tr.start_date::timestamp, tr.created_at) AS window_start,
+	           (COALESCE(tr.end_date, tr.start_date, CURRENT_DATE) + 1)::timestamp AS window_end,
+	           COALESCE(m.boundary, ST_Buffer(m.summit, 8000)) AS area
+	    FROM trips tr
+	    LEFT JOIN mountains m ON m.id = COALESCE(tr.mountain_id, resolve_mountain_id(tr.mountain_name))
+	    WHERE tr.id = $1
+	),
+	members AS (
+	    SELECT user_id FROM trip_members WHERE trip_id = $1
+	    UNION
+	    SELECT created_by FROM trips WHERE id = $1 AND created_by IS NOT NULL
+	),
+	events AS (
+	    SELECT 'session_started' AS type, ts.id::text AS ref_id, ts.user_id::text AS user_id, ts.started_at AS occurred_at,
+	           jsonb_build_object('session_id', ts.id) AS data
+	    FROM track_sessions ts WHERE ts.trip_id = $1
+	    UNION ALL
+	    SELECT 'session_ended', ts.id::text, ts.user_id::text, ts.ended_at,
+	           jsonb_build_object('session_id', ts.id, 'status', ts.status,
+	                              'distance_m', COALESCE(ts.total_distance_m, 0),
+	                              'elevation_gain_m', COALESCE(ts.total_elevation_gain_m, 0))
+	    FROM track_sessions ts WHERE ts.trip_id = $1 AND ts.ended_at IS NOT NULL
+	    UNION ALL
+	    SELECT 'member_joined', tm.user_id::text, tm.user_id::text, tm.joined_at,
+	           jsonb_build_object('role', tm.role)
+	    FROM trip_members tm WHERE tm.trip_id = $1
+	    UNION ALL
+	    SELECT 'route_uploaded', r.id::text, r.uploaded_by::text, r.created_at,
+	           jsonb_build_object('route_id', r.id, 'name', r.name, 'distance_m', r.total_distance_m)
+	    FROM gpx_routes r WHERE r.trip_id = $1
+	    UNION ALL
+	    SELECT 'photo_taken', p.id::text, p.user_id::text, COALESCE(p.taken_at, p.created_at),
+	           jsonb_build_object('photo_id', p.id, 'waypoint_id', p.waypoint_id, 'photo_url', p.photo_url, 'caption', p.caption)
+	    FROM waypoint_photos p
+	    JOIN members mb ON mb.user_id = p.user_id
+	    JOIN waypoints w ON w.id = p.waypoint_id
+	    CROSS JOIN t
+	    WHERE ST_Covers(t.area, COALESCE(p.location, w.location))
+	      AND ` + visible("COALESCE(p.location, w.location)", "p.user_id") + `
+	      AND COALESCE(p.taken_at, p.created_at) >= t.window_start
+	      AND COALESCE(p.taken_at, p.created_at) < t.window_end
+	    UNION ALL
+	    SELECT 'post_created', po.id::text, po.user_id::text, po.created_at,
+	           jsonb_build_object('post_id', po.id, 'content', po.content)
+	    FROM posts po
+	    JOIN members mb ON mb.user_id = po.user_id
+	    CROSS JOIN t
+	    WHERE po.visibility = 'public'
+	      AND ST_Covers(t.area, po.location)
+	      AND ` + visible("po.location", "po.user_id") + `
+	      AND po.created_at >= t.window_start
+	      AND po.created_at < t.window_end
+	    UNION ALL
+	    SELECT 'waypoint_visited', v.waypoint_id::text || ':' || v.user_id::text, v.user_id::text, v.visited_at,
+	           jsonb_build_object('waypoint_id', v.waypoint_id, 'name', w.name, 'session_id', v.session_id)
+	    FROM trip_waypoint_visits v
+	    JOIN waypoints w ON w.id = v.waypoint_id
+	    WHERE v.trip_id = $1
+	      AND ($2::timestamp IS NULL OR v.visited_at >= $2::timestamp)
+	      AND ` + visible("w.location", "v.user_id") + `
+	)
+	SELECT type, ref_id, COALESCE(user_id, ''), occurred_at, data
+	FROM events
+	WHERE $2::timestamp IS NULL OR (occurred_at, type, ref_id) > ($2::timestamp, $3::text, $4::text)
+	ORDER BY occurred_at, type, ref_id
+	LIMIT $5
+`
+}
+
+// Timeline returns a page of the trip's activity in chronological order, as
+// viewerID, empty when anonymous, may see it.
+func (s *Service) Timeline(ctx context.Context, tripID, viewerID, cursor string, limit int) (Timeline, error) {
+	if limit <= 0 {
+		limit = defaultTimelinePageSize
+	}
+	if limit > maxTimelinePageSize {
+		limit = maxTimelinePageSize
+	}
+	after, afterType, afterRef, err := decodeTimelineCursor(cursor)
+	if err != nil {
+		return Timeline{}, err
+	}
+
+	rows, err := privacy.QueryPositions(ctx, s.db, viewerID, timelineQuery, tripID, after, afterType, afterRef, limit)
+	if err != nil {
+		return Timeline{}, err
+	}
+	defer rows.Close()
+
+	timeline := Timeline{Entries: []TimelineEntry{}}
+	for rows.Next() {
+		var e TimelineEntry
+		if err := rows.Scan(&e.Type, &e.RefID, &e.UserID, &e.OccurredAt, &e.Data); err != nil {
+			return Timeline{}, err
+		}
+		timeline.Entries = append(timeline.Entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return Timeline{}, err
+	}
+	if len(timeline.Entries) == limit {
+		timeline.NextCursor = encodeTimelineCursor(timeline.Entries[limit-1])
+	}
+	return timeline, nil
+}
+
+func encodeTimelineCursor(e TimelineEntry) string {
+	raw := e.OccurredAt.UTC().Format(time.RFC3339Nano) + "|" + e.Type + "|" + e.RefID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeTimelineCursor(cursor string) (*time.Time, string, string, error) {
+	if cursor == "" {
+		return nil, "", "", nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, "", "", ErrInvalidCursor
+	}
+	parts := strings.SplitN(string(raw), "|", 3)
+	if len(parts) != 3 {
+		return nil, "", "", ErrInvalidCursor
+	}
+	at, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return nil, "", "", ErrInvalidCursor
+	}
+	return &at, parts[1], parts[2], nil
+}
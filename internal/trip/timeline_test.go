@@ -0,0 +1,100 @@
+package trip
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pashagolub/pgxmock/v3"
+)
+
+var timelineCols = []string{"type", "ref_id", "user_id", "occurred_at", "data"}
+
+func TestTimelinePagination(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	start := time.Date(2026, 8, 17, 4, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`WITH t AS .* WHERE po.visibility = 'public' .* ORDER BY occurred_at, type, ref_id LIMIT \$5`).
+		WithArgs("trip-1", (*time.Time)(nil), "", "", 2, "user-1").
+		WillReturnRows(pgxmock.NewRows(timelineCols).
+			AddRow(TimelineMemberJoined, "user-1", "user-1", start.Add(-48*time.Hour), json.RawMessage(`{"role":"admin"}`)).
+			AddRow(TimelineSessionStarted, "session-1", "user-1", start, json.RawMessage(`{"session_id":"session-1"}`)))
+
+	svc := NewService(mock)
+	page, err := svc.Timeline(context.Background(), "trip-1", "user-1", "", 2)
+	if err != nil {
+		t.Fatalf("timeline: %v", err)
+	}
+	if len(page.Entries) != 2 || page.NextCursor == "" {
+		t.Fatalf("unexpected first page: %+v", page)
+	}
+
+	after, afterType, afterRef, err := decodeTimelineCursor(page.NextCursor)
+	if err != nil || !after.Equal(start) || afterType != TimelineSessionStarted || afterRef != "session-1" {
+		t.Fatalf("unexpected cursor: %v %s %s %v", after, afterType, afterRef, err)
+	}
+
+	// Visits inside the visitor's privacy zones are left out for others.
+	mock.ExpectQuery(`WITH t AS .* FROM trip_waypoint_visits v .* v.visited_at >= \$2::timestamp\) AND \(v.user_id::text = \$6 OR NOT EXISTS \(SELECT 1 FROM privacy_zones pz WHERE pz.user_id = v.user_id AND ST_DWithin\(pz.center, w.location, pz.radius_m\)\)\)`).
+		WithArgs("trip-1", pgxmock.AnyArg(), TimelineSessionStarted, "session-1", 2, "user-1").
+		WillReturnRows(pgxmock.NewRows(timelineCols).
+			AddRow(TimelineWaypointVisited, "wp-1:user-1", "user-1", start.Add(3*time.Hour), json.RawMessage(`{"waypoint_id":"wp-1"}`)))
+	page, err = svc.Timeline(context.Background(), "trip-1", "user-1", page.NextCursor, 2)
+	if err != nil {
+		t.Fatalf("timeline: %v", err)
+	}
+	if len(page.Entries) != 1 || page.NextCursor != "" {
+		t.Fatalf("unexpected last page: %+v", page)
+	}
+
+	if _, err := svc.Timeline(context.Background(), "trip-1", "", "not-a-cursor", 0); !errors.Is(err, ErrInvalidCursor) {
+		t.Fatalf("expected ErrInvalidCursor, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestTripHandlersTimeline(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	mock.ExpectQuery(`WITH t AS .* \(po.user_id::text = \$6 OR NOT EXISTS`).
+		WithArgs("trip-1", (*time.Time)(nil), "", "", 50, "").
+		WillReturnRows(pgxmock.NewRows(timelineCols).
+			AddRow(TimelinePostCreated, "post-1", "user-2", time.Now(), json.RawMessage(`{"post_id":"post-1"}`)))
+
+	app := fiber.New()
+	RegisterRoutes(app.Group("/trips"), NewService(mock), func(c *fiber.Ctx) error { return c.Next() })
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/trips/trip-1/timeline", nil))
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("timeline status: %v", err)
+	}
+	var timeline Timeline
+	if err := json.NewDecoder(resp.Body).Decode(&timeline); err != nil || len(timeline.Entries) != 1 || timeline.Entries[0].Type != TimelinePostCreated {
+		t.Fatalf("unexpected timeline: %+v %v", timeline, err)
+	}
+
+	resp, err = app.Test(httptest.NewRequest(http.MethodGet, "/trips/trip-1/timeline?cursor=%25%25", nil))
+	if err != nil || resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for bad cursor: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
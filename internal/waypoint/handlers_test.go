@@ -209,8 +209,8 @@ func TestWaypointHandlersPhotosSearch(t *testing.T) {
 
 	mock.ExpectQuery(`SELECT id, name, description, type, ST_Y\(location::geometry\), ST_X\(location::geometry\),`).
 		WithArgs(106.8, -6.2, 5000.0).
-		WillReturnRows(pgxmock.NewRows([]string{"id", "name", "description", "type", "lat", "lng", "elevation_m", "created_by", "is_verified", "created_at"}).
-			AddRow("wp-1", "WP", "desc", "peak", -6.2, 106.8, 100.0, "user-1", false, time.Now()))
+		WillReturnRows(pgxmock.NewRows([]string{"id", "name", "description", "type", "lat", "lng", "elevation_m", "created_by", "is_verified", "created_at", "area_status", "area_reason"}).
+			AddRow("wp-1", "WP", "desc", "peak", -6.2, 106.8, 100.0, "user-1", false, time.Now(), "", ""))
 
 	app := fiber.New()
 	RegisterRoutes(app.Group("/waypoints"), NewService(mock), func(c *fiber.Ctx) error { return c.Next() })
@@ -387,8 +387,8 @@ func TestWaypointHandlersSearchDefaultRadius(t *testing.T) {
 
 	mock.ExpectQuery(`SELECT id, name, description, type, ST_Y\(location::geometry\), ST_X\(location::geometry\),`).
 		WithArgs(106.8, -6.2, 5000.0).
-		WillReturnRows(pgxmock.NewRows([]string{"id", "name", "description", "type", "lat", "lng", "elevation_m", "created_by", "is_verified", "created_at"}).
-			AddRow("wp-1", "WP", "desc", "peak", -6.2, 106.8, 100.0, "user-1", false, time.Now()))
+		WillReturnRows(pgxmock.NewRows([]string{"id", "name", "description", "type", "lat", "lng", "elevation_m", "created_by", "is_verified", "created_at", "area_status", "area_reason"}).
+			AddRow("wp-1", "WP", "desc", "peak", -6.2, 106.8, 100.0, "user-1", false, time.Now(), "", ""))
 
 	app := fiber.New()
 	RegisterRoutes(app.Group("/waypoints"), NewService(mock), func(c *fiber.Ctx) error { return c.Next() })
@@ -13,6 +13,8 @@ type Waypoint struct {
 	CreatedBy string    `json:"created_by"`
 	IsVerified bool     `json:"is_verified"`
 	CreatedAt time.Time `json:"created_at"`
+	AreaStatus string   `json:"area_status,omitempty"`
+	AreaReason string   `json:"area_reason,omitempty"`
 }
 
 type Review struct {
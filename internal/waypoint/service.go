@@ -198,11 +198,22 @@ func (s *Service) Photos(ctx context.Context, waypointID string) ([]Photo, error
 	return photos, nil
 }
 
+// Search returns waypoints within radiusKm, each annotated with the most
+// severe area status notice currently covering it.
 func (s *Service) Search(ctx context.Context, lat, lng, radiusKm float64) ([]Waypoint, error) {
 	rows, err := s.db.Query(ctx, `
 		SELECT id, name, description, type, ST_Y(location::geometry), ST_X(location::geometry),
-		       COALESCE(elevation_m,0), created_by, is_verified, created_at
+		       COALESCE(elevation_m,0), created_by, is_verified, created_at,
+		       COALESCE(ns.status,''), COALESCE(ns.reason,'')
 		FROM waypoints
+		LEFT JOIN LATERAL (
+		    SELECT n.status, n.reason
+		    FROM area_notices n
+		    WHERE n.starts_at <= NOW() AND (n.ends_at IS NULL OR n.ends_at > NOW())
+		      AND ST_Covers(n.effective_area, waypoints.location)
+		    ORDER BY n.severity DESC, n.starts_at DESC
+		    LIMIT 1
+		) ns ON TRUE
 		WHERE ST_DWithin(location, ST_SetSRID(ST_MakePoint($1,$2), 4326)::geography, $3)
 		ORDER BY created_at DESC
 	`, lng, lat, radiusKm*1000)
@@ -214,7 +225,7 @@ func (s *Service) Search(ctx context.Context, lat, lng, radiusKm float64) ([]Way
 	var results []Waypoint
 	for rows.Next() {
 		var wp Waypoint
-		if err := rows.Scan(&wp.ID, &wp.Name, &wp.Description, &wp.Type, &wp.Lat, &wp.Lng, &wp.ElevationM, &wp.CreatedBy, &wp.IsVerified, &wp.CreatedAt); err != nil {
+		if err := rows.Scan(&wp.ID, &wp.Name, &wp.Description, &wp.Type, &wp.Lat, &wp.Lng, &wp.ElevationM, &wp.CreatedBy, &wp.IsVerified, &wp.CreatedAt, &wp.AreaStatus, &wp.AreaReason); err != nil {
 			return nil, err
 		}
 		results = append(results, wp)
@@ -127,13 +127,16 @@ func TestWaypointReviewsPhotosSearch(t *testing.T) {
 
 	mock.ExpectQuery(`SELECT id, name, description, type, ST_Y\(location::geometry\), ST_X\(location::geometry\),`).
 		WithArgs(106.8, -6.2, 5000.0).
-		WillReturnRows(pgxmock.NewRows([]string{"id", "name", "description", "type", "lat", "lng", "elevation_m", "created_by", "is_verified", "created_at"}).
-			AddRow("wp-1", "WP", "desc", "peak", -6.2, 106.8, 100.0, "user-1", false, time.Now()))
+		WillReturnRows(pgxmock.NewRows([]string{"id", "name", "description", "type", "lat", "lng", "elevation_m", "created_by", "is_verified", "created_at", "area_status", "area_reason"}).
+			AddRow("wp-1", "WP", "desc", "peak", -6.2, 106.8, 100.0, "user-1", false, time.Now(), "closed", "eruption"))
 
 	results, err := svc.Search(context.Background(), -6.2, 106.8, 5)
 	if err != nil || len(results) != 1 {
 		t.Fatalf("search: %v", err)
 	}
+	if results[0].AreaStatus != "closed" {
+		t.Fatalf("expected area status on search result")
+	}
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Fatalf("unmet expectations: %v", err)
@@ -0,0 +1,57 @@
+CREATE TABLE mountains (
+    id UUID PRIMARY KEY,
+    name VARCHAR(200) UNIQUE NOT NULL,
+    aliases TEXT[] NOT NULL DEFAULT '{}',
+    summit GEOGRAPHY(POINT, 4326),
+    elevation_m DOUBLE PRECISION,
+    region VARCHAR(200),
+    status VARCHAR(50) NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'closed', 'restricted')),
+    boundary GEOGRAPHY(POLYGON, 4326),
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX idx_mountains_summit ON mountains USING GIST(summit);
+CREATE INDEX idx_mountains_boundary ON mountains USING GIST(boundary);
+CREATE INDEX idx_mountains_name_lower ON mountains (lower(name));
+
+-- Resolves a free-text mountain name (e.g. legacy trips.mountain_name) to a mountain id.
+-- Exact name matches win over alias matches.
+CREATE OR REPLACE FUNCTION resolve_mountain_id(p_name TEXT) RETURNS UUID AS $$
+    SELECT id
+    FROM mountains
+    WHERE lower(name) = lower(trim(p_name))
+       OR lower(trim(p_name)) IN (SELECT lower(a) FROM unnest(aliases) AS a)
+    ORDER BY (lower(name) = lower(trim(p_name))) DESC
+    LIMIT 1
+$$ LANGUAGE sql STABLE;
+
+ALTER TABLE trips ADD COLUMN mountain_id UUID REFERENCES mountains(id);
+CREATE INDEX idx_trips_mountain ON trips(mountain_id);
+
+-- Seed the mountains previously hard-coded in the dev data
+INSERT INTO mountains (id, name, aliases, summit, elevation_m, region, status, boundary)
+SELECT
+    gen_random_uuid(),
+    m.name,
+    m.aliases,
+    ST_SetSRID(ST_MakePoint(m.lon, m.lat), 4326)::geography,
+    m.elevation_m,
+    m.region,
+    'open',
+    ST_Buffer(ST_SetSRID(ST_MakePoint(m.lon, m.lat), 4326)::geography, 8000)
+FROM (VALUES
+    ('Semeru', ARRAY['Mahameru','Gunung Semeru','Mount Semeru'], 112.922, -8.108, 3676.0, 'East Java'),
+    ('Rinjani', ARRAY['Gunung Rinjani','Mount Rinjani'], 116.457, -8.411, 3726.0, 'West Nusa Tenggara'),
+    ('Kerinci', ARRAY['Gunung Kerinci','Mount Kerinci','Gunung Gadang'], 101.264, -1.697, 3805.0, 'Jambi'),
+    ('Merbabu', ARRAY['Gunung Merbabu','Mount Merbabu'], 110.440, -7.454, 3145.0, 'Central Java'),
+    ('Gede', ARRAY['Gunung Gede','Mount Gede'], 106.984, -6.783, 2958.0, 'West Java'),
+    ('Pangrango', ARRAY['Gunung Pangrango','Mount Pangrango'], 106.993, -6.772, 3019.0, 'West Java'),
+    ('Sindoro', ARRAY['Sundoro','Gunung Sindoro','Mount Sindoro'], 109.992, -7.300, 3136.0, 'Central Java'),
+    ('Sumbing', ARRAY['Gunung Sumbing','Mount Sumbing'], 110.071, -7.384, 3371.0, 'Central Java')
+) AS m(name, aliases, lon, lat, elevation_m, region)
+ON CONFLICT (name) DO NOTHING;
+
+-- Link existing trips by their free-text mountain name
+UPDATE trips
+SET mountain_id = resolve_mountain_id(mountain_name)
+WHERE mountain_id IS NULL AND mountain_name IS NOT NULL;
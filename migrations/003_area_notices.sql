@@ -0,0 +1,46 @@
+ALTER TABLE users ADD COLUMN role VARCHAR(50) NOT NULL DEFAULT 'hiker'
+    CHECK (role IN ('hiker', 'admin', 'park_authority'));
+
+CREATE TABLE area_status_notices (
+    id UUID PRIMARY KEY,
+    mountain_id UUID REFERENCES mountains(id) ON DELETE CASCADE,
+    area GEOGRAPHY(POLYGON, 4326),
+    status VARCHAR(50) NOT NULL CHECK (status IN ('open', 'closed', 'restricted', 'quota_reached')),
+    reason TEXT,
+    starts_at TIMESTAMP NOT NULL,
+    ends_at TIMESTAMP,
+    created_by UUID REFERENCES users(id),
+    created_at TIMESTAMP DEFAULT NOW(),
+    CHECK (mountain_id IS NOT NULL OR area IS NOT NULL),
+    CHECK (ends_at IS NULL OR ends_at > starts_at)
+);
+
+CREATE INDEX idx_area_status_notices_mountain ON area_status_notices(mountain_id);
+CREATE INDEX idx_area_status_notices_area ON area_status_notices USING GIST(area);
+CREATE INDEX idx_area_status_notices_window ON area_status_notices(starts_at, ends_at);
+
+-- Notices with the area they apply to resolved: an explicit polygon wins,
+-- otherwise the mountain's park boundary (or a radius around its summit).
+CREATE VIEW area_notices AS
+SELECT
+    n.*,
+    COALESCE(n.area, m.boundary, ST_Buffer(m.summit, 8000)) AS effective_area,
+    CASE n.status
+        WHEN 'closed' THEN 3
+        WHEN 'quota_reached' THEN 2
+        WHEN 'restricted' THEN 1
+        ELSE 0
+    END AS severity
+FROM area_status_notices n
+LEFT JOIN mountains m ON m.id = n.mountain_id;
+
+CREATE TABLE notifications (
+    id UUID PRIMARY KEY,
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    kind VARCHAR(100) NOT NULL,
+    payload JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP DEFAULT NOW(),
+    read_at TIMESTAMP
+);
+
+CREATE INDEX idx_notifications_user ON notifications(user_id, created_at DESC);
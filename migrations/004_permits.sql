@@ -0,0 +1,46 @@
+CREATE TABLE trailheads (
+    id UUID PRIMARY KEY,
+    mountain_id UUID REFERENCES mountains(id) ON DELETE CASCADE,
+    name VARCHAR(200) NOT NULL,
+    location GEOGRAPHY(POINT, 4326),
+    daily_quota INTEGER NOT NULL CHECK (daily_quota >= 0),
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX idx_trailheads_mountain ON trailheads(mountain_id);
+
+-- One row per trailhead and day, created lazily on the first booking. The
+-- conditional UPDATE on this row is what serialises competing bookings.
+CREATE TABLE trailhead_quota_days (
+    trailhead_id UUID REFERENCES trailheads(id) ON DELETE CASCADE,
+    day DATE NOT NULL,
+    capacity INTEGER NOT NULL,
+    booked INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (trailhead_id, day),
+    CHECK (booked >= 0 AND booked <= capacity)
+);
+
+CREATE TABLE permit_bookings (
+    id UUID PRIMARY KEY,
+    seq BIGSERIAL,
+    trip_id UUID REFERENCES trips(id) ON DELETE CASCADE,
+    trailhead_id UUID REFERENCES trailheads(id) ON DELETE CASCADE,
+    climb_date DATE NOT NULL,
+    party_size INTEGER NOT NULL CHECK (party_size > 0),
+    status VARCHAR(50) NOT NULL CHECK (status IN ('confirmed', 'waitlisted', 'cancelled')),
+    booking_code VARCHAR(20) UNIQUE NOT NULL,
+    created_by UUID REFERENCES users(id),
+    created_at TIMESTAMP DEFAULT NOW(),
+    cancelled_at TIMESTAMP
+);
+
+CREATE INDEX idx_permit_bookings_day ON permit_bookings(trailhead_id, climb_date, status, seq);
+CREATE INDEX idx_permit_bookings_trip ON permit_bookings(trip_id);
+CREATE UNIQUE INDEX idx_permit_bookings_active ON permit_bookings(trip_id, trailhead_id, climb_date)
+    WHERE status <> 'cancelled';
+
+CREATE TABLE permit_booking_members (
+    booking_id UUID REFERENCES permit_bookings(id) ON DELETE CASCADE,
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    PRIMARY KEY (booking_id, user_id)
+);
@@ -0,0 +1,15 @@
+CREATE TABLE trip_messages (
+    id UUID PRIMARY KEY,
+    seq BIGSERIAL UNIQUE,
+    trip_id UUID NOT NULL REFERENCES trips(id) ON DELETE CASCADE,
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    body TEXT NOT NULL CHECK (char_length(body) BETWEEN 1 AND 4000),
+    client_id VARCHAR(100),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_trip_messages_trip_seq ON trip_messages(trip_id, seq DESC);
+-- Clients resend with the same client_id after a dropped connection; the
+-- retry returns the stored message instead of posting it twice.
+CREATE UNIQUE INDEX idx_trip_messages_client ON trip_messages(trip_id, user_id, client_id)
+    WHERE client_id IS NOT NULL;
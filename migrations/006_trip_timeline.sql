@@ -0,0 +1,8 @@
+-- Lookups used by the trip timeline, which pulls from several tables per trip.
+CREATE INDEX idx_track_sessions_trip ON track_sessions(trip_id, started_at);
+CREATE INDEX idx_gpx_routes_trip ON gpx_routes(trip_id);
+CREATE INDEX idx_waypoints_location ON waypoints USING GIST(location);
+CREATE INDEX idx_waypoint_photos_location ON waypoint_photos USING GIST(location);
+CREATE INDEX idx_waypoint_photos_user ON waypoint_photos(user_id, taken_at);
+CREATE INDEX idx_posts_location ON posts USING GIST(location);
+CREATE INDEX idx_posts_user ON posts(user_id, created_at);
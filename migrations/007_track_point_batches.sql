@@ -0,0 +1,7 @@
+-- Client-assigned point ids let offline batches be retried without
+-- duplicating points; points without one are matched on recorded_at.
+ALTER TABLE track_points ADD COLUMN client_point_id VARCHAR(100);
+
+CREATE INDEX idx_track_points_session_time ON track_points(session_id, recorded_at);
+CREATE INDEX idx_track_points_client_id ON track_points(session_id, client_point_id)
+    WHERE client_point_id IS NOT NULL;
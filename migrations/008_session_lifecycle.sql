@@ -0,0 +1,16 @@
+-- Sessions seeded or recorded before statuses were fixed, such as the
+-- 'completed' rows of 001, are finished hikes.
+UPDATE track_sessions SET status = 'ended', ended_at = COALESCE(ended_at, started_at)
+WHERE status IS NULL OR status NOT IN ('active', 'paused', 'ended');
+
+ALTER TABLE track_sessions ADD CONSTRAINT track_sessions_status_check
+    CHECK (status IN ('active', 'paused', 'ended'));
+
+-- One row per pause; resumed_at stays NULL while the session is paused.
+CREATE TABLE track_session_pauses (
+    session_id UUID NOT NULL REFERENCES track_sessions(id) ON DELETE CASCADE,
+    paused_at TIMESTAMP NOT NULL,
+    resumed_at TIMESTAMP,
+    PRIMARY KEY (session_id, paused_at),
+    CHECK (resumed_at IS NULL OR resumed_at >= paused_at)
+);
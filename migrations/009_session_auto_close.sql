@@ -0,0 +1,11 @@
+-- As in 008, any status outside the new set is a finished hike.
+UPDATE track_sessions SET status = 'ended', ended_at = COALESCE(ended_at, started_at)
+WHERE status IS NULL OR status NOT IN ('active', 'paused', 'ended', 'auto_closed');
+
+ALTER TABLE track_sessions DROP CONSTRAINT track_sessions_status_check;
+ALTER TABLE track_sessions ADD CONSTRAINT track_sessions_status_check
+    CHECK (status IN ('active', 'paused', 'ended', 'auto_closed'));
+
+-- The auto-close sweep only looks at open sessions.
+CREATE INDEX idx_track_sessions_active ON track_sessions (started_at) WHERE status = 'active';
+CREATE INDEX idx_track_points_session_created ON track_points (session_id, created_at);
@@ -0,0 +1,2 @@
+-- Horizontal accuracy reported by the device, used by the GPS filter.
+ALTER TABLE track_points ADD COLUMN accuracy_m DOUBLE PRECISION;
@@ -0,0 +1,20 @@
+-- Off-route detection state per session: consecutive points beyond the
+-- threshold and when that run began, and the latest recorded_at already
+-- checked so late or retried points are not counted twice.
+ALTER TABLE track_sessions ADD COLUMN off_route_streak INT NOT NULL DEFAULT 0;
+ALTER TABLE track_sessions ADD COLUMN off_route_since TIMESTAMP;
+ALTER TABLE track_sessions ADD COLUMN route_checked_at TIMESTAMP;
+
+CREATE TABLE route_deviations (
+    id UUID PRIMARY KEY,
+    session_id UUID NOT NULL REFERENCES track_sessions(id) ON DELETE CASCADE,
+    route_id UUID REFERENCES gpx_routes(id) ON DELETE SET NULL,
+    started_at TIMESTAMP NOT NULL,
+    detected_at TIMESTAMP NOT NULL,
+    cleared_at TIMESTAMP,
+    distance_m DOUBLE PRECISION NOT NULL,
+    location GEOGRAPHY(POINT, 4326) NOT NULL
+);
+
+CREATE INDEX idx_route_deviations_session ON route_deviations (session_id, started_at);
+CREATE UNIQUE INDEX idx_route_deviations_open ON route_deviations (session_id) WHERE cleared_at IS NULL;
@@ -0,0 +1,33 @@
+-- Emergency alerts raised from a tracking session, and the audit trail of
+-- everything done about them.
+CREATE TABLE sos_alerts (
+    id UUID PRIMARY KEY,
+    session_id UUID NOT NULL REFERENCES track_sessions(id) ON DELETE CASCADE,
+    trip_id UUID REFERENCES trips(id) ON DELETE SET NULL,
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    raised_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'raised'
+        CONSTRAINT sos_alerts_status_check CHECK (status IN ('raised', 'acknowledged', 'resolved')),
+    location GEOGRAPHY(POINT, 4326),
+    battery_pct SMALLINT CHECK (battery_pct BETWEEN 0 AND 100),
+    message TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    acknowledged_at TIMESTAMP,
+    acknowledged_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    resolved_at TIMESTAMP,
+    resolved_by UUID REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX idx_sos_alerts_session ON sos_alerts (session_id, created_at);
+CREATE INDEX idx_sos_alerts_open ON sos_alerts (trip_id) WHERE status <> 'resolved';
+
+CREATE TABLE sos_alert_log (
+    id BIGSERIAL PRIMARY KEY,
+    alert_id UUID NOT NULL REFERENCES sos_alerts(id) ON DELETE CASCADE,
+    action VARCHAR(30) NOT NULL,
+    actor_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    note TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_sos_alert_log_alert ON sos_alert_log (alert_id, id);
@@ -0,0 +1,45 @@
+-- Zones a trip or a park authority draws on the map: a polygon, or a circle
+-- kept as centre and radius so containment is exact.
+CREATE TABLE geofences (
+    id UUID PRIMARY KEY,
+    trip_id UUID REFERENCES trips(id) ON DELETE CASCADE,
+    mountain_id UUID REFERENCES mountains(id) ON DELETE CASCADE,
+    name VARCHAR(200) NOT NULL,
+    kind VARCHAR(20) NOT NULL
+        CONSTRAINT geofences_kind_check CHECK (kind IN ('camp', 'danger', 'boundary', 'other')),
+    area GEOGRAPHY(GEOMETRY, 4326),
+    center GEOGRAPHY(POINT, 4326),
+    radius_m DOUBLE PRECISION CHECK (radius_m > 0),
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    CONSTRAINT geofences_scope_check CHECK ((trip_id IS NULL) <> (mountain_id IS NULL)),
+    CONSTRAINT geofences_shape_check CHECK ((area IS NULL) <> (center IS NULL AND radius_m IS NULL))
+);
+
+CREATE INDEX idx_geofences_trip ON geofences (trip_id);
+CREATE INDEX idx_geofences_mountain ON geofences (mountain_id);
+
+-- Incremental detection state: the latest recorded_at already checked, and
+-- the zones the session is currently inside.
+ALTER TABLE track_sessions ADD COLUMN geofence_checked_at TIMESTAMP;
+
+CREATE TABLE session_geofences (
+    session_id UUID NOT NULL REFERENCES track_sessions(id) ON DELETE CASCADE,
+    geofence_id UUID NOT NULL REFERENCES geofences(id) ON DELETE CASCADE,
+    entered_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (session_id, geofence_id)
+);
+
+CREATE INDEX idx_session_geofences_geofence ON session_geofences (geofence_id);
+
+CREATE TABLE geofence_events (
+    id UUID PRIMARY KEY,
+    session_id UUID NOT NULL REFERENCES track_sessions(id) ON DELETE CASCADE,
+    geofence_id UUID NOT NULL REFERENCES geofences(id) ON DELETE CASCADE,
+    type VARCHAR(10) NOT NULL CHECK (type IN ('enter', 'exit')),
+    recorded_at TIMESTAMP NOT NULL,
+    location GEOGRAPHY(POINT, 4326) NOT NULL
+);
+
+CREATE INDEX idx_geofence_events_session ON geofence_events (session_id, recorded_at);
+CREATE INDEX idx_geofence_events_geofence ON geofence_events (geofence_id, recorded_at);
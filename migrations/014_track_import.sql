@@ -0,0 +1,10 @@
+-- Heart rate recorded by watches, kept when tracks are imported.
+ALTER TABLE track_points ADD COLUMN heart_rate_bpm SMALLINT;
+
+-- SHA-256 of an imported file, so uploading the same export twice returns
+-- the session created the first time.
+ALTER TABLE track_sessions ADD COLUMN import_format VARCHAR(10);
+ALTER TABLE track_sessions ADD COLUMN import_hash CHAR(64);
+
+CREATE UNIQUE INDEX idx_track_sessions_import_hash ON track_sessions (user_id, import_hash)
+    WHERE import_hash IS NOT NULL;
@@ -0,0 +1,6 @@
+-- Optional sensor channels sent with points. Each is NULL when the device
+-- did not report it, so a point without sensors costs only the null bitmap.
+ALTER TABLE track_points ADD COLUMN cadence_rpm SMALLINT;
+ALTER TABLE track_points ADD COLUMN temperature_c REAL;
+ALTER TABLE track_points ADD COLUMN pressure_hpa REAL;
+ALTER TABLE track_points ADD COLUMN battery_pct SMALLINT;
@@ -0,0 +1,78 @@
+-- track_points is range-partitioned by month of recorded_at so old months
+-- can be dropped whole. Points outside every monthly partition (imports of
+-- old tracks, devices with a wrong clock) land in track_points_default until
+-- create_track_point_partition moves them into their month.
+ALTER TABLE track_points RENAME TO track_points_unpartitioned;
+ALTER SEQUENCE track_points_id_seq OWNED BY NONE;
+
+CREATE TABLE track_points (
+    id BIGINT NOT NULL DEFAULT nextval('track_points_id_seq'),
+    session_id UUID REFERENCES track_sessions(id) ON DELETE CASCADE,
+    location GEOGRAPHY(POINT, 4326),
+    elevation_m DOUBLE PRECISION,
+    recorded_at TIMESTAMP NOT NULL,
+    speed_mps DOUBLE PRECISION,
+    created_at TIMESTAMP DEFAULT NOW(),
+    client_point_id VARCHAR(100),
+    accuracy_m DOUBLE PRECISION,
+    heart_rate_bpm SMALLINT,
+    cadence_rpm SMALLINT,
+    temperature_c REAL,
+    pressure_hpa REAL,
+    battery_pct SMALLINT,
+    PRIMARY KEY (id, recorded_at)
+) PARTITION BY RANGE (recorded_at);
+
+ALTER SEQUENCE track_points_id_seq OWNED BY track_points.id;
+
+CREATE TABLE track_points_default PARTITION OF track_points DEFAULT;
+
+-- create_track_point_partition creates the partition for the month holding
+-- day, moving any of its rows out of the default partition first, and
+-- returns its name. It is a no-op when the partition exists.
+CREATE FUNCTION create_track_point_partition(day DATE) RETURNS TEXT
+LANGUAGE plpgsql AS $$
+DECLARE
+    from_day DATE := date_trunc('month', day)::date;
+    to_day DATE := (date_trunc('month', day) + INTERVAL '1 month')::date;
+    name TEXT := 'track_points_' || to_char(day, 'YYYY_MM');
+BEGIN
+    IF to_regclass(name) IS NOT NULL THEN
+        RETURN name;
+    END IF;
+    EXECUTE format('CREATE TABLE %I (LIKE track_points INCLUDING DEFAULTS INCLUDING CONSTRAINTS)', name);
+    EXECUTE format(
+        'WITH moved AS (DELETE FROM track_points_default WHERE recorded_at >= %L AND recorded_at < %L RETURNING *)
+         INSERT INTO %I SELECT * FROM moved', from_day, to_day, name);
+    EXECUTE format('ALTER TABLE track_points ATTACH PARTITION %I FOR VALUES FROM (%L) TO (%L)', name, from_day, to_day);
+    RETURN name;
+END
+$$;
+
+SELECT create_track_point_partition(month::date)
+FROM generate_series(
+    date_trunc('month', LEAST((SELECT MIN(recorded_at) FROM track_points_unpartitioned), NOW())),
+    date_trunc('month', NOW()) + INTERVAL '3 months',
+    INTERVAL '1 month'
+) AS month;
+
+INSERT INTO track_points (id, session_id, location, elevation_m, recorded_at, speed_mps, created_at, client_point_id,
+                          accuracy_m, heart_rate_bpm, cadence_rpm, temperature_c, pressure_hpa, battery_pct)
+SELECT id, session_id, location, elevation_m, recorded_at, speed_mps, created_at, client_point_id,
+       accuracy_m, heart_rate_bpm, cadence_rpm, temperature_c, pressure_hpa, battery_pct
+FROM track_points_unpartitioned;
+
+DROP TABLE track_points_unpartitioned;
+
+CREATE INDEX idx_track_points_session ON track_points (session_id);
+CREATE INDEX idx_track_points_location ON track_points USING GIST (location);
+CREATE INDEX idx_track_points_session_time ON track_points (session_id, recorded_at);
+CREATE INDEX idx_track_points_client_id ON track_points (session_id, client_point_id)
+    WHERE client_point_id IS NOT NULL;
+CREATE INDEX idx_track_points_session_created ON track_points (session_id, created_at);
+
+-- Rollup kept once a session's raw points age out: the track simplified to
+-- a line with elevation in Z and the recorded time (Unix seconds) in M.
+ALTER TABLE track_sessions ADD COLUMN simplified_route GEOMETRY(LINESTRINGZM, 4326);
+ALTER TABLE track_sessions ADD COLUMN archived_point_count INTEGER;
+ALTER TABLE track_sessions ADD COLUMN points_archived_at TIMESTAMP;
@@ -0,0 +1,69 @@
+-- Personal records, summits and badges, updated once per session when it
+-- ends. achievements_evaluated_at marks sessions already counted so a
+-- session is never counted twice and older history can be caught up.
+ALTER TABLE track_sessions ADD COLUMN achievements_evaluated_at TIMESTAMP;
+
+CREATE INDEX idx_track_sessions_unevaluated ON track_sessions (user_id, ended_at)
+    WHERE achievements_evaluated_at IS NULL AND status IN ('ended', 'auto_closed');
+
+-- Elevation gained per calendar day of each session; a user's daily ascent
+-- sums their sessions of that day.
+CREATE TABLE session_day_ascents (
+    session_id UUID NOT NULL REFERENCES track_sessions(id) ON DELETE CASCADE,
+    day DATE NOT NULL,
+    ascent_m DOUBLE PRECISION NOT NULL,
+    PRIMARY KEY (session_id, day)
+);
+
+-- The best value per record kind. scope is the gpx_routes id for
+-- per-route records and empty otherwise.
+CREATE TABLE user_records (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind VARCHAR(40) NOT NULL,
+    scope VARCHAR(64) NOT NULL DEFAULT '',
+    value DOUBLE PRECISION NOT NULL,
+    session_id UUID REFERENCES track_sessions(id) ON DELETE SET NULL,
+    achieved_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, kind, scope)
+);
+
+-- Peak waypoints a user has reached, with the mountain the peak lies on.
+CREATE TABLE user_summits (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    waypoint_id UUID NOT NULL REFERENCES waypoints(id) ON DELETE CASCADE,
+    mountain_id UUID REFERENCES mountains(id) ON DELETE SET NULL,
+    session_id UUID REFERENCES track_sessions(id) ON DELETE SET NULL,
+    reached_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, waypoint_id)
+);
+
+CREATE TABLE user_achievements (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    achievement_id VARCHAR(64) NOT NULL,
+    session_id UUID REFERENCES track_sessions(id) ON DELETE SET NULL,
+    earned_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, achievement_id)
+);
+
+CREATE INDEX idx_waypoints_peaks ON waypoints USING GIST (location) WHERE type = 'peak';
+
+-- The rest of Java's seven highest volcanoes, so the Seven Summits of Java
+-- badge can be earned.
+INSERT INTO mountains (id, name, aliases, summit, elevation_m, region, status, boundary)
+SELECT
+    gen_random_uuid(),
+    m.name,
+    m.aliases,
+    ST_SetSRID(ST_MakePoint(m.lon, m.lat), 4326)::geography,
+    m.elevation_m,
+    m.region,
+    'open',
+    ST_Buffer(ST_SetSRID(ST_MakePoint(m.lon, m.lat), 4326)::geography, 8000)
+FROM (VALUES
+    ('Slamet', ARRAY['Gunung Slamet','Mount Slamet'], 109.208, -7.242, 3428.0, 'Central Java'),
+    ('Raung', ARRAY['Gunung Raung','Mount Raung'], 114.042, -8.125, 3344.0, 'East Java'),
+    ('Arjuno', ARRAY['Arjuna','Gunung Arjuno','Mount Arjuno'], 112.589, -7.764, 3339.0, 'East Java'),
+    ('Lawu', ARRAY['Gunung Lawu','Mount Lawu'], 111.192, -7.627, 3265.0, 'Central Java'),
+    ('Welirang', ARRAY['Gunung Welirang','Mount Welirang'], 112.580, -7.725, 3156.0, 'East Java')
+) AS m(name, aliases, lon, lat, elevation_m, region)
+ON CONFLICT (name) DO NOTHING;
@@ -0,0 +1,35 @@
+-- User-defined stretches of trail, such as "Pos 2 to Puncak Merbabu". A
+-- session passing within tolerance_m of the start and then of the end records
+-- an effort. The start and end indexes let session matching consider only
+-- segments near the track, however many segments exist.
+CREATE TABLE segments (
+    id UUID PRIMARY KEY,
+    name VARCHAR(200) NOT NULL,
+    start_point GEOGRAPHY(POINT, 4326) NOT NULL,
+    end_point GEOGRAPHY(POINT, 4326) NOT NULL,
+    path GEOGRAPHY(LINESTRING, 4326) NOT NULL,
+    distance_m DOUBLE PRECISION NOT NULL,
+    tolerance_m DOUBLE PRECISION NOT NULL CHECK (tolerance_m > 0 AND tolerance_m <= 100),
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_segments_start ON segments USING GIST (start_point);
+CREATE INDEX idx_segments_end ON segments USING GIST (end_point);
+CREATE INDEX idx_segments_path ON segments USING GIST (path);
+
+CREATE TABLE segment_efforts (
+    id UUID PRIMARY KEY,
+    segment_id UUID NOT NULL REFERENCES segments(id) ON DELETE CASCADE,
+    session_id UUID NOT NULL REFERENCES track_sessions(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    started_at TIMESTAMP NOT NULL,
+    ended_at TIMESTAMP NOT NULL,
+    elapsed_sec DOUBLE PRECISION NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (segment_id, session_id, started_at)
+);
+
+CREATE INDEX idx_segment_efforts_board ON segment_efforts (segment_id, elapsed_sec);
+CREATE INDEX idx_segment_efforts_user ON segment_efforts (segment_id, user_id, elapsed_sec);
+CREATE INDEX idx_segment_efforts_session ON segment_efforts (session_id);
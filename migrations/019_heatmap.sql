@@ -0,0 +1,19 @@
+-- Who may see a session's track. Only public sessions feed the heatmap.
+ALTER TABLE track_sessions ADD COLUMN visibility VARCHAR(20) NOT NULL DEFAULT 'public'
+    CONSTRAINT track_sessions_visibility_check CHECK (visibility IN ('public', 'followers', 'private'));
+
+CREATE INDEX idx_track_sessions_public ON track_sessions (id) WHERE visibility = 'public';
+
+-- Circles around places such as a hiker's home. Points of the user's
+-- sessions inside one are left out of what other users see.
+CREATE TABLE privacy_zones (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(200) NOT NULL DEFAULT '',
+    center GEOGRAPHY(POINT, 4326) NOT NULL,
+    radius_m DOUBLE PRECISION NOT NULL CHECK (radius_m > 0),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_privacy_zones_user ON privacy_zones (user_id);
+CREATE INDEX idx_privacy_zones_center ON privacy_zones USING GIST (center);
@@ -0,0 +1,6 @@
+-- The recording mode the server has asked the hiker's device to use. While
+-- tracking_auto is set the server switches it from incoming points; the
+-- hiker can pin a mode, which clears it.
+ALTER TABLE track_sessions ADD COLUMN tracking_mode VARCHAR(20) NOT NULL DEFAULT 'normal'
+    CONSTRAINT track_sessions_tracking_mode_check CHECK (tracking_mode IN ('normal', 'low_power', 'high_frequency'));
+ALTER TABLE track_sessions ADD COLUMN tracking_auto BOOLEAN NOT NULL DEFAULT TRUE;
@@ -0,0 +1,42 @@
+-- First time each hiker on a trip came within 50 m of a waypoint. Visits are
+-- recorded as points arrive, so the trip timeline reads them instead of
+-- matching every point of the trip against every waypoint on each page.
+CREATE TABLE trip_waypoint_visits (
+    trip_id UUID NOT NULL REFERENCES trips(id) ON DELETE CASCADE,
+    waypoint_id UUID NOT NULL REFERENCES waypoints(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    session_id UUID NOT NULL REFERENCES track_sessions(id) ON DELETE CASCADE,
+    visited_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (trip_id, waypoint_id, user_id)
+);
+
+CREATE INDEX idx_trip_waypoint_visits_time ON trip_waypoint_visits(trip_id, visited_at);
+
+-- record_waypoint_visits keeps the earliest visit when points arrive out of
+-- order, as batches and imports do.
+CREATE FUNCTION record_waypoint_visits() RETURNS TRIGGER
+LANGUAGE plpgsql AS $$
+BEGIN
+    INSERT INTO trip_waypoint_visits (trip_id, waypoint_id, user_id, session_id, visited_at)
+    SELECT ts.trip_id, w.id, ts.user_id, ts.id, NEW.recorded_at
+    FROM track_sessions ts
+    JOIN waypoints w ON ST_DWithin(NEW.location, w.location, 50)
+    WHERE ts.id = NEW.session_id AND ts.trip_id IS NOT NULL AND ts.user_id IS NOT NULL
+    ON CONFLICT (trip_id, waypoint_id, user_id) DO UPDATE
+        SET visited_at = EXCLUDED.visited_at, session_id = EXCLUDED.session_id
+        WHERE EXCLUDED.visited_at < trip_waypoint_visits.visited_at;
+    RETURN NULL;
+END
+$$;
+
+CREATE TRIGGER track_points_waypoint_visits
+    AFTER INSERT ON track_points
+    FOR EACH ROW EXECUTE FUNCTION record_waypoint_visits();
+
+INSERT INTO trip_waypoint_visits (trip_id, waypoint_id, user_id, session_id, visited_at)
+SELECT DISTINCT ON (ts.trip_id, w.id, ts.user_id) ts.trip_id, w.id, ts.user_id, ts.id, tp.recorded_at
+FROM track_sessions ts
+JOIN track_points tp ON tp.session_id = ts.id
+JOIN waypoints w ON ST_DWithin(tp.location, w.location, 50)
+WHERE ts.trip_id IS NOT NULL AND ts.user_id IS NOT NULL
+ORDER BY ts.trip_id, w.id, ts.user_id, tp.recorded_at;